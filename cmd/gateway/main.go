@@ -3,9 +3,15 @@ package main
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/Fiagram/gateway/internal/app"
 	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	gateway_log "github.com/Fiagram/gateway/internal/log"
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
 	"github.com/spf13/cobra"
 	"go.uber.org/fx"
 )
@@ -33,11 +39,184 @@ func main() {
 		},
 	}
 
-	rootCommand.Flags().StringVarP(&configFilePath,
+	rootCommand.PersistentFlags().StringVarP(&configFilePath,
 		"config-file-path", "c", "",
 		"Use the provided config file, otherwise the default embedded config applied.")
 
+	keysCommand := &cobra.Command{
+		Use:   "keys",
+		Short: "Manages the access token signing keys.",
+	}
+	keysCommand.AddCommand(&cobra.Command{
+		Use:   "rotate",
+		Short: "Generates and activates a new signing key in the keys directory.",
+		Long: "Generates a new signing key into auth.token.keysDir. Running gateways pick it up " +
+			"on their next reload and keep the previous keys for verification until they expire.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			config, err := configs.NewConfig(configs.ConfigFilePath(configFilePath))
+			if err != nil {
+				return err
+			}
+
+			logger, cleanup, err := gateway_log.InitializeLogger(config.Log)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			keyring, err := token_logic.NewKeyring(config.Auth.Token, utils.NewClock(), logger)
+			if err != nil {
+				return err
+			}
+
+			kid, err := keyring.Rotate(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Rotated signing key, new kid: %s (signs once every instance has reloaded the keys)\n", kid)
+			return nil
+		},
+	})
+	rootCommand.AddCommand(keysCommand)
+
+	var (
+		clientName      string
+		clientScopes    []string
+		clientAudiences []string
+		isPrintConfig   bool
+	)
+	clientsCommand := &cobra.Command{
+		Use:   "clients",
+		Short: "Manages the OAuth clients of other services.",
+	}
+	createClientCommand := &cobra.Command{
+		Use:   "create <client-id>",
+		Short: "Registers an OAuth client and prints its secret.",
+		Long: "Registers an OAuth client for the client_credentials grant in the cache. The secret " +
+			"is printed once and only its hash is stored. With --print-config nothing is stored, " +
+			"the entry to add to auth.oauth.clients is printed instead.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if isPrintConfig {
+				secret, secretHash, err := oauth_logic.NewClientSecret()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Client secret: %s\n\n", secret)
+				fmt.Printf("- id: %s\n  name: %q\n  secretHash: %s\n  scopes: [%s]\n  audiences: [%s]\n",
+					args[0], clientName, secretHash, strings.Join(clientScopes, ", "), strings.Join(clientAudiences, ", "))
+				return nil
+			}
+
+			oauthLogic, cleanup, err := newOAuthLogic(configFilePath)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			secret, _, err := oauthLogic.RegisterClient(cmd.Context(), oauth_logic.RegisterClientParams{
+				Id:        args[0],
+				Name:      clientName,
+				Scopes:    clientScopes,
+				Audiences: clientAudiences,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Registered client %s, secret: %s\n", args[0], secret)
+			return nil
+		},
+	}
+	createClientCommand.Flags().StringVar(&clientName, "name", "", "Human readable name of the client.")
+	createClientCommand.Flags().StringSliceVar(&clientScopes, "scope", nil, "Scope the client may request, repeatable.")
+	createClientCommand.Flags().StringSliceVar(&clientAudiences, "audience", nil,
+		"Service the client may request tokens for, repeatable.")
+	createClientCommand.Flags().BoolVar(&isPrintConfig, "print-config", false,
+		"Print a config entry instead of registering the client in the cache.")
+	clientsCommand.AddCommand(createClientCommand)
+	clientsCommand.AddCommand(&cobra.Command{
+		Use:   "delete <client-id>",
+		Short: "Deletes an OAuth client registered in the cache.",
+		Long: "Deletes an OAuth client registered in the cache. Access tokens already issued to it " +
+			"stay valid until they expire.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oauthLogic, cleanup, err := newOAuthLogic(configFilePath)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			if err := oauthLogic.DeleteClient(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+
+			fmt.Printf("Deleted client %s\n", args[0])
+			return nil
+		},
+	})
+	clientsCommand.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the OAuth clients of the config and of the cache.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			oauthLogic, cleanup, err := newOAuthLogic(configFilePath)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			clients, err := oauthLogic.ListClients(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			for _, client := range clients {
+				fmt.Printf("%s\t%s\t%s\n", client.Id, client.Name, strings.Join(client.Scopes, " "))
+			}
+			return nil
+		},
+	})
+	rootCommand.AddCommand(clientsCommand)
+
 	if err := rootCommand.Execute(); err != nil {
 		log.Panic(err)
 	}
 }
+
+// newOAuthLogic builds the client registry on top of the configured cache
+// for the clients command.
+func newOAuthLogic(configFilePath string) (oauth_logic.OAuth, func(), error) {
+	config, err := configs.NewConfig(configs.ConfigFilePath(configFilePath))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger, cleanup, err := gateway_log.InitializeLogger(config.Log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheClient, err := cache.NewClient(config.Cache, logger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	clock := utils.NewClock()
+	keyring, err := token_logic.NewKeyring(config.Auth.Token, clock, logger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	oauthLogic := oauth_logic.NewOAuthLogic(
+		config.Auth.OAuth,
+		cache.NewOAuthClient(cacheClient, logger),
+		token_logic.NewTokenLogic(config.Auth.Token, keyring, clock, logger),
+		clock,
+		logger,
+	)
+	return oauthLogic, cleanup, nil
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/Fiagram/gateway/internal/configs"
 	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
 	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/idp"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
 	"github.com/Fiagram/gateway/internal/handler"
 	"github.com/Fiagram/gateway/internal/log"
 	"github.com/Fiagram/gateway/internal/logic"
@@ -17,6 +19,8 @@ var Module = fx.Module(
 
 	cache.Module,
 	account_grpc.Module,
+	mail.Module,
+	idp.Module,
 
 	logic.Module,
 	handler.Module,
@@ -3,15 +3,284 @@ package configs
 import "time"
 
 type Auth struct {
-	Domain string `yaml:"domain"`
-	Token  Token  `yaml:"token"`
+	Domain            string            `yaml:"domain"`
+	Token             Token             `yaml:"token"`
+	Mfa               Mfa               `yaml:"mfa"`
+	WebAuthn          WebAuthn          `yaml:"webauthn"`
+	OAuth             OAuth             `yaml:"oauth"`
+	SignInThrottle    SignInThrottle    `yaml:"signInThrottle"`
+	PasswordReset     PasswordReset     `yaml:"passwordReset"`
+	EmailVerification EmailVerification `yaml:"emailVerification"`
+	MagicLink         MagicLink         `yaml:"magicLink"`
+	Oidc              Oidc              `yaml:"oidc"`
+	Federation        Federation        `yaml:"federation"`
+	Csrf              Csrf              `yaml:"csrf"`
+	Impersonation     Impersonation     `yaml:"impersonation"`
+	StepUp            StepUp            `yaml:"stepUp"`
+	Dpop              Dpop              `yaml:"dpop"`
+	PasswordPolicy    PasswordPolicy    `yaml:"passwordPolicy"`
+	Registration      Registration      `yaml:"registration"`
 }
 
 type Token struct {
-	Secret              string        `yaml:"secret"`
-	AccessTokenTTL      time.Duration `yaml:"accessTokenTTL"`
-	RefreshTokenLongTTL time.Duration `yaml:"refreshTokenLongTTL"`
-	RefreshTokenTTL     time.Duration `yaml:"refreshTokenTTL"`
+	// Algorithm is one of HS256, RS256, ES256 or EdDSA. HS256 signs with
+	// Secret, the asymmetric ones with the PEM key read from PrivateKeyFile.
+	Algorithm      string `yaml:"algorithm"`
+	Secret         string `yaml:"secret"`
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+	// KeysDir holds the rotated signing keys shared by every gateway
+	// instance. Rotation is only possible when it is set.
+	KeysDir            string        `yaml:"keysDir"`
+	RotationInterval   time.Duration `yaml:"rotationInterval"`
+	KeysReloadInterval time.Duration `yaml:"keysReloadInterval"`
+	AccessTokenTTL     time.Duration `yaml:"accessTokenTTL"`
+	// RefreshTokenTTL is the idle timeout of a session, RefreshTokenLongTTL
+	// the one of remember-me sessions. SessionMaxLifetime and
+	// RememberMeSessionMaxLifetime end them however often they are used.
+	RefreshTokenLongTTL          time.Duration `yaml:"refreshTokenLongTTL"`
+	RefreshTokenTTL              time.Duration `yaml:"refreshTokenTTL"`
+	SessionMaxLifetime           time.Duration `yaml:"sessionMaxLifetime"`
+	RememberMeSessionMaxLifetime time.Duration `yaml:"rememberMeSessionMaxLifetime"`
+	// Issuer is the iss claim of the access tokens. Audience is the aud of
+	// the tokens meant for the gateway itself, the only one it accepts, and
+	// Audiences are the other Fiagram services tokens may be requested for.
+	Issuer    string   `yaml:"issuer"`
+	Audience  string   `yaml:"audience"`
+	Audiences []string `yaml:"audiences"`
+	// Leeway tolerates clock skew when checking exp, nbf and iat
+	Leeway time.Duration `yaml:"leeway"`
+}
+
+type Mfa struct {
+	// Issuer is shown next to the account in authenticator apps
+	Issuer string `yaml:"issuer"`
+	// ChallengeTTL bounds the time between the password and the code step
+	// of a sign-in, MaxAttempts the number of codes tried per challenge.
+	ChallengeTTL time.Duration `yaml:"challengeTTL"`
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	// EnrollmentTTL bounds the time to confirm a newly generated secret
+	EnrollmentTTL time.Duration `yaml:"enrollmentTTL"`
+}
+
+type WebAuthn struct {
+	// RPID is the domain passkeys are bound to, RPOrigins the origins of the
+	// web apps allowed to use them (e.g. https://app.fiagram.com).
+	RPID          string   `yaml:"rpId"`
+	RPDisplayName string   `yaml:"rpDisplayName"`
+	RPOrigins     []string `yaml:"rpOrigins"`
+	// CeremonyTTL bounds the time between the begin and finish calls of a
+	// registration or login.
+	CeremonyTTL time.Duration `yaml:"ceremonyTTL"`
+}
+
+type OAuth struct {
+	// Clients are the machine identities known from the config, next to the
+	// ones registered with the clients command.
+	Clients []OAuthClient `yaml:"clients"`
+}
+
+type OAuthClient struct {
+	Id   string `yaml:"id"`
+	Name string `yaml:"name"`
+	// SecretHash is the hex SHA-256 of the client secret, as printed by
+	// "gateway clients create --print-config".
+	SecretHash string   `yaml:"secretHash"`
+	Scopes     []string `yaml:"scopes"`
+	// Audiences are the services the client may request tokens for, each
+	// one of the Audiences of the token config. Without any the client only
+	// gets tokens for the gateway.
+	Audiences []string `yaml:"audiences"`
+}
+
+// SignInThrottle slows down and then locks out password guessing. Failed
+// sign-ins are counted per username and per client IP, a counter is
+// forgotten Window after its last failure.
+type SignInThrottle struct {
+	Window time.Duration `yaml:"window"`
+	// After DelayAfter failures of a username each further failure makes the
+	// next attempt wait BaseDelay, doubled per failure and capped at MaxDelay
+	DelayAfter int           `yaml:"delayAfter"`
+	BaseDelay  time.Duration `yaml:"baseDelay"`
+	MaxDelay   time.Duration `yaml:"maxDelay"`
+	// Reaching a max failures count locks the username or the IP out for
+	// LockoutDuration. Many users may share an IP, its limit is higher.
+	UsernameMaxFailures int           `yaml:"usernameMaxFailures"`
+	IpMaxFailures       int           `yaml:"ipMaxFailures"`
+	LockoutDuration     time.Duration `yaml:"lockoutDuration"`
+}
+
+type PasswordReset struct {
+	// Url is the page of the web app that completes a reset, the token is
+	// appended as the token query parameter
+	Url      string        `yaml:"url"`
+	TokenTTL time.Duration `yaml:"tokenTTL"`
+	// MaxRequests is the most resets asked for one address within Window,
+	// IpMaxRequests the most asked from one client IP
+	MaxRequests   int           `yaml:"maxRequests"`
+	IpMaxRequests int           `yaml:"ipMaxRequests"`
+	Window        time.Duration `yaml:"window"`
+}
+
+type UnverifiedAccess string
+
+const (
+	// UnverifiedAccessAllow signs unverified accounts in like any other,
+	// UnverifiedAccessRestrict gives them access tokens that only reach the
+	// routes open to unverified accounts and UnverifiedAccessDeny refuses
+	// to sign them in.
+	UnverifiedAccessAllow    UnverifiedAccess = "allow"
+	UnverifiedAccessRestrict UnverifiedAccess = "restrict"
+	UnverifiedAccessDeny     UnverifiedAccess = "deny"
+)
+
+type EmailVerification struct {
+	// Url is the page of the web app that completes a verification, the
+	// token is appended as the token query parameter
+	Url      string        `yaml:"url"`
+	TokenTTL time.Duration `yaml:"tokenTTL"`
+	// ResendCooldown is the least time between two mails to an account
+	ResendCooldown   time.Duration    `yaml:"resendCooldown"`
+	UnverifiedAccess UnverifiedAccess `yaml:"unverifiedAccess"`
+}
+
+type MagicLink struct {
+	// Url is the page of the web app that completes a sign-in, the token
+	// is appended as the token query parameter
+	Url      string        `yaml:"url"`
+	TokenTTL time.Duration `yaml:"tokenTTL"`
+	// MaxRequests is the most links mailed to one address within Window,
+	// IpMaxRequests the most asked from one client IP
+	MaxRequests   int           `yaml:"maxRequests"`
+	IpMaxRequests int           `yaml:"ipMaxRequests"`
+	Window        time.Duration `yaml:"window"`
+}
+
+// Oidc is the OpenID Connect provider the first-party web apps sign in
+// with through the authorization code grant.
+type Oidc struct {
+	// Issuer is the public base URL of the gateway, the endpoints of the
+	// discovery document are derived from it
+	Issuer string `yaml:"issuer"`
+	// LoginUrl is the sign-in page of the web app, authorization requests
+	// are redirected to it with their query parameters
+	LoginUrl             string        `yaml:"loginUrl"`
+	AuthorizationCodeTTL time.Duration `yaml:"authorizationCodeTTL"`
+	Clients              []OidcClient  `yaml:"clients"`
+}
+
+type OidcClient struct {
+	Id   string `yaml:"id"`
+	Name string `yaml:"name"`
+	// SecretHash is the hex SHA-256 of the client secret. Public clients
+	// such as single page apps have none and rely on PKCE alone.
+	SecretHash   string   `yaml:"secretHash"`
+	RedirectUris []string `yaml:"redirectUris"`
+}
+
+// Federation signs accounts in through upstream OpenID Connect providers
+// such as a corporate identity provider.
+type Federation struct {
+	// RedirectUri is the callback page of the web app the providers send
+	// the users back to, it hands the code and the state to the gateway
+	RedirectUri string `yaml:"redirectUri"`
+	// StateTTL bounds the time spent at the provider
+	StateTTL time.Duration `yaml:"stateTTL"`
+	// IpMaxLinks is the most external accounts signing in for the first
+	// time from one client IP within Window. Each of them looks the
+	// accounts up by email.
+	IpMaxLinks int                 `yaml:"ipMaxLinks"`
+	Window     time.Duration       `yaml:"window"`
+	Providers  []FederatedProvider `yaml:"providers"`
+}
+
+type FederatedProvider struct {
+	Id   string `yaml:"id"`
+	Name string `yaml:"name"`
+	// Issuer is the issuer URL of the provider, its endpoints are read from
+	// the discovery document under it
+	Issuer       string   `yaml:"issuer"`
+	ClientId     string   `yaml:"clientId"`
+	ClientSecret string   `yaml:"clientSecret"`
+	Scopes       []string `yaml:"scopes"`
+	// LinkByEmail links an external account seen for the first time to
+	// the account with the same email, if the provider verified the email.
+	// Only enable it for providers trusted to verify emails.
+	LinkByEmail bool `yaml:"linkByEmail"`
+}
+
+// Csrf protects the routes authenticated by the refresh token cookie. The
+// web app sends the csrf_token cookie set next to the refresh token back in
+// the X-CSRF-Token header, and browsers have to announce an allowed origin.
+type Csrf struct {
+	// AllowedOrigins are the origins of the web apps, e.g.
+	// https://app.fiagram.com. Same-origin requests are always allowed,
+	// behind a proxy terminating TLS the origin of the gateway has to be
+	// listed as well.
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// Secret binds the tokens to the refresh token they were issued with,
+	// so that a cookie planted from a sibling subdomain is of no use. Every
+	// gateway instance needs the same secret.
+	Secret string `yaml:"secret"`
+}
+
+// Impersonation lets administrators act as another account through the
+// token exchange grant, for support.
+type Impersonation struct {
+	// TokenTTL is the lifetime of impersonation tokens, they cannot be
+	// refreshed. It is capped by the access token TTL.
+	TokenTTL time.Duration `yaml:"tokenTTL"`
+}
+
+// StepUp guards sensitive operations behind a recent authentication.
+type StepUp struct {
+	// MaxAge is how long after the account last authenticated in its
+	// session the sensitive operations are allowed.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// Dpop configures the checks of the DPoP proofs of RFC 9449 sent by
+// clients that bind their tokens to a key.
+type Dpop struct {
+	// ProofMaxAge is how far the iat of a proof may be from now, either way
+	ProofMaxAge time.Duration `yaml:"proofMaxAge"`
+}
+
+// PasswordPolicy holds the rules new passwords are checked against on
+// sign-up, reset and change.
+type PasswordPolicy struct {
+	MinLength int `yaml:"minLength"`
+	MaxLength int `yaml:"maxLength"`
+	// MinCharacterClasses is how many of lowercase letters, uppercase
+	// letters, digits and symbols a password has to mix
+	MinCharacterClasses int `yaml:"minCharacterClasses"`
+	// Denylist and the lines of DenylistFile are refused, also with digits
+	// and symbols appended, whatever their case
+	Denylist     []string `yaml:"denylist"`
+	DenylistFile string   `yaml:"denylistFile"`
+	// BreachedPasswordsDir holds the breached passwords as range files of
+	// SHA-1 hashes, one per 5 hex prefix as downloaded from Pwned
+	// Passwords. The check is skipped when it is empty.
+	BreachedPasswordsDir string `yaml:"breachedPasswordsDir"`
+}
+
+type RegistrationMode string
+
+const (
+	// RegistrationModeOpen lets anyone sign up, RegistrationModeInviteOnly
+	// only the holders of an invite code and RegistrationModeClosed nobody.
+	// New accounts of federated sign-ins are only created in the open mode.
+	RegistrationModeOpen       RegistrationMode = "open"
+	RegistrationModeInviteOnly RegistrationMode = "invite-only"
+	RegistrationModeClosed     RegistrationMode = "closed"
+)
+
+// Registration decides who may create an account.
+type Registration struct {
+	Mode RegistrationMode `yaml:"mode"`
+	// InviteCodeTTL is the lifetime of invite codes minted without an
+	// expiry, MaxInviteCodeTTL caps the expiry administrators may ask for
+	InviteCodeTTL    time.Duration `yaml:"inviteCodeTTL"`
+	MaxInviteCodeTTL time.Duration `yaml:"maxInviteCodeTTL"`
 }
 
 func GetConfigAuth(c Config) Auth {
@@ -21,3 +290,63 @@ func GetConfigAuth(c Config) Auth {
 func GetConfigAuthToken(c Config) Token {
 	return c.Auth.Token
 }
+
+func GetConfigAuthMfa(c Config) Mfa {
+	return c.Auth.Mfa
+}
+
+func GetConfigAuthWebAuthn(c Config) WebAuthn {
+	return c.Auth.WebAuthn
+}
+
+func GetConfigAuthOAuth(c Config) OAuth {
+	return c.Auth.OAuth
+}
+
+func GetConfigAuthSignInThrottle(c Config) SignInThrottle {
+	return c.Auth.SignInThrottle
+}
+
+func GetConfigAuthPasswordReset(c Config) PasswordReset {
+	return c.Auth.PasswordReset
+}
+
+func GetConfigAuthEmailVerification(c Config) EmailVerification {
+	return c.Auth.EmailVerification
+}
+
+func GetConfigAuthMagicLink(c Config) MagicLink {
+	return c.Auth.MagicLink
+}
+
+func GetConfigAuthOidc(c Config) Oidc {
+	return c.Auth.Oidc
+}
+
+func GetConfigAuthFederation(c Config) Federation {
+	return c.Auth.Federation
+}
+
+func GetConfigAuthCsrf(c Config) Csrf {
+	return c.Auth.Csrf
+}
+
+func GetConfigAuthImpersonation(c Config) Impersonation {
+	return c.Auth.Impersonation
+}
+
+func GetConfigAuthStepUp(c Config) StepUp {
+	return c.Auth.StepUp
+}
+
+func GetConfigAuthDpop(c Config) Dpop {
+	return c.Auth.Dpop
+}
+
+func GetConfigAuthPasswordPolicy(c Config) PasswordPolicy {
+	return c.Auth.PasswordPolicy
+}
+
+func GetConfigAuthRegistration(c Config) Registration {
+	return c.Auth.Registration
+}
@@ -16,6 +16,7 @@ type Config struct {
 	Log   Log   `yaml:"log"`
 	Cache Cache `yaml:"cache"`
 	Grpc  Grpc  `yaml:"grpc"`
+	Mail  Mail  `yaml:"mail"`
 }
 
 // Creates a new config instance by reading from a given YAML file.
@@ -53,3 +54,7 @@ func GetConfigLog(c Config) Log {
 func GetConfigCache(c Config) Cache {
 	return c.Cache
 }
+
+func GetConfigMail(c Config) Mail {
+	return c.Mail
+}
@@ -3,4 +3,8 @@ package configs
 type Http struct {
 	Address string `yaml:"address"`
 	Port    string `yaml:"port"`
+	// TrustedProxies are the addresses or CIDRs of the reverse proxies whose
+	// X-Forwarded-For header gives the client IP. Empty trusts no proxy, the
+	// client IP is then the address of the peer.
+	TrustedProxies []string `yaml:"trustedProxies"`
 }
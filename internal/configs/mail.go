@@ -0,0 +1,17 @@
+package configs
+
+type MailType string
+
+const (
+	// MailTypeStdout and MailTypeFile only write the mails to an outbox, they
+	// are meant for development and tests
+	MailTypeStdout MailType = "stdout"
+	MailTypeFile   MailType = "file"
+)
+
+type Mail struct {
+	Type MailType `yaml:"type"`
+	From string   `yaml:"from"`
+	// OutboxFile receives one JSON document per mail with the file type
+	OutboxFile string `yaml:"outboxFile"`
+}
@@ -9,8 +9,24 @@ var Module = fx.Module(
 		GetConfigHttp,
 		GetConfigLog,
 		GetConfigCache,
+		GetConfigMail,
 		GetConfigGrpcAccountService,
 		GetConfigAuth,
 		GetConfigAuthToken,
+		GetConfigAuthMfa,
+		GetConfigAuthWebAuthn,
+		GetConfigAuthOAuth,
+		GetConfigAuthSignInThrottle,
+		GetConfigAuthPasswordReset,
+		GetConfigAuthEmailVerification,
+		GetConfigAuthMagicLink,
+		GetConfigAuthOidc,
+		GetConfigAuthFederation,
+		GetConfigAuthCsrf,
+		GetConfigAuthImpersonation,
+		GetConfigAuthStepUp,
+		GetConfigAuthDpop,
+		GetConfigAuthPasswordPolicy,
+		GetConfigAuthRegistration,
 	),
 )
@@ -0,0 +1,40 @@
+package account_grpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	pb "github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+)
+
+// ErrEmailNotUnique is returned when several accounts have the email, the
+// account service does not enforce unique emails.
+var ErrEmailNotUnique = errors.New("several accounts have the email")
+
+// FindAccountIdByEmail returns zero when no account has the email and
+// ErrEmailNotUnique when several do. The account service cannot look
+// accounts up by email, so every account is scanned. Callers reachable
+// without signing in have to rate limit their requests before calling it.
+func FindAccountIdByEmail(ctx context.Context, client Client, email string) (uint64, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return 0, nil
+	}
+
+	resp, err := client.GetAccountAll(ctx, &pb.GetAccountAllRequest{})
+	if err != nil {
+		return 0, err
+	}
+
+	var accountId uint64
+	for i, account := range resp.AccountInfoList {
+		if i < len(resp.AccountIdList) && strings.EqualFold(strings.TrimSpace(account.Email), email) {
+			if accountId != 0 {
+				return 0, ErrEmailNotUnique
+			}
+			accountId = resp.AccountIdList[i]
+		}
+	}
+	return accountId, nil
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// AccessTokenRevocation records access tokens that must be refused before
+// they expire. Single tokens are denied by jti, all tokens of an account
+// issued up to a point in time are denied by a not-before timestamp, kept
+// with millisecond precision.
+// Entries only need to outlive the tokens they deny.
+type AccessTokenRevocation interface {
+	RevokeTokenId(ctx context.Context, tokenId string, ttl time.Duration) error
+	IsTokenIdRevoked(ctx context.Context, tokenId string) (bool, error)
+	SetNotBefore(ctx context.Context, accountId uint64, notBefore time.Time, ttl time.Duration) error
+	// GetNotBefore returns the zero time when nothing was revoked
+	GetNotBefore(ctx context.Context, accountId uint64) (time.Time, error)
+}
+
+type accessTokenRevocation struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewAccessTokenRevocation(
+	client Client,
+	logger *zap.Logger,
+) AccessTokenRevocation {
+	return &accessTokenRevocation{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (a *accessTokenRevocation) getTokenIdCacheKey(tokenId string) string {
+	return fmt.Sprintf("revoked_access_token:%s", tokenId)
+}
+
+func (a *accessTokenRevocation) getNotBeforeCacheKey(accountId uint64) string {
+	return fmt.Sprintf("access_token_not_before:%d", accountId)
+}
+
+func (a *accessTokenRevocation) RevokeTokenId(ctx context.Context, tokenId string, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, a.logger).With(zap.String("token_id", tokenId))
+
+	if err := a.client.Set(ctx, a.getTokenIdCacheKey(tokenId), "1", ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert revoked access token to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (a *accessTokenRevocation) IsTokenIdRevoked(ctx context.Context, tokenId string) (bool, error) {
+	logger := log.LoggerWithContext(ctx, a.logger).With(zap.String("token_id", tokenId))
+
+	_, err := a.client.Get(ctx, a.getTokenIdCacheKey(tokenId))
+	if errors.Is(err, ErrCacheMiss) {
+		return false, nil
+	} else if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get revoked access token from cache")
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (a *accessTokenRevocation) SetNotBefore(ctx context.Context, accountId uint64, notBefore time.Time, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, a.logger).With(zap.Uint64("account_id", accountId))
+
+	value := strconv.FormatInt(notBefore.UnixMilli(), 10)
+	if err := a.client.Set(ctx, a.getNotBeforeCacheKey(accountId), value, ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert access token not-before to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (a *accessTokenRevocation) GetNotBefore(ctx context.Context, accountId uint64) (time.Time, error) {
+	logger := log.LoggerWithContext(ctx, a.logger).With(zap.Uint64("account_id", accountId))
+
+	cacheEntry, err := a.client.Get(ctx, a.getNotBeforeCacheKey(accountId))
+	if errors.Is(err, ErrCacheMiss) {
+		return time.Time{}, nil
+	} else if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get access token not-before from cache")
+		return time.Time{}, err
+	}
+
+	var notBefore int64
+	if err := unmarshalCacheEntry(cacheEntry, &notBefore); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse access token not-before from cache")
+		return time.Time{}, err
+	}
+
+	// Entries written before the milliseconds hold seconds, which stay
+	// below 1e12 for tens of thousands of years
+	if notBefore < 1e12 {
+		return time.Unix(notBefore, 0), nil
+	}
+	return time.UnixMilli(notBefore), nil
+}
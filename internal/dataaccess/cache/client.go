@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -12,14 +13,29 @@ import (
 
 var (
 	ErrCacheMiss = errors.New("cache miss")
+	// ErrInvalidEntry is returned for an entry stored in a format that is
+	// no longer understood
+	ErrInvalidEntry = errors.New("invalid cache entry")
 )
 
 type Client interface {
 	Set(ctx context.Context, key string, data any, ttl time.Duration) error
 	Get(ctx context.Context, key string) (any, error)
 	Del(ctx context.Context, key ...string) error
+	// Incr atomically increments the integer at key, starting from zero, and
+	// restarts its ttl so that the key expires ttl after the last increment.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Decr atomically decrements the integer at key and keeps its ttl. A
+	// missing key is left missing and read as zero, so that a counter never
+	// outlives its ttl.
+	Decr(ctx context.Context, key string) (int64, error)
+	// SetIfAbsent sets key only when it does not exist yet and tells
+	// whether it did, in one atomic step.
+	SetIfAbsent(ctx context.Context, key string, data any, ttl time.Duration) (bool, error)
 	AddToSet(ctx context.Context, key string, data ...any) error
 	IsDataInSet(ctx context.Context, key string, data any) (bool, error)
+	RemoveFromSet(ctx context.Context, key string, data ...any) error
+	GetSetMembers(ctx context.Context, key string) ([]string, error)
 }
 
 func NewClient(
@@ -36,3 +52,25 @@ func NewClient(
 	}
 
 }
+
+// consume marks a single-use value such as a token or a code as used and
+// tells whether the caller is the first to use it. The check and the mark
+// are one atomic step, so exactly one of the concurrent requests presenting
+// the value wins. The marker must outlive the value, ttl is usually its
+// remaining lifetime.
+func consume(ctx context.Context, client Client, key string, ttl time.Duration) (bool, error) {
+	return client.SetIfAbsent(ctx, key, 1, ttl)
+}
+
+// unmarshalCacheEntry decodes a JSON document stored through Client.Set.
+// Redis hands it back as a string, the RAM client as whatever was stored.
+func unmarshalCacheEntry(cacheEntry any, v any) error {
+	switch data := cacheEntry.(type) {
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	case []byte:
+		return json.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("invalid cache entry type %T", cacheEntry)
+	}
+}
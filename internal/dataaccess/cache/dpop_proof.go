@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// DpopProof remembers the DPoP proofs already presented, by the hash of
+// their key thumbprint and jti, so that a captured proof cannot be replayed.
+type DpopProof interface {
+	// Consume tells whether the proof is presented for the first time.
+	Consume(ctx context.Context, proofHash string, ttl time.Duration) (bool, error)
+}
+
+type dpopProof struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewDpopProof(
+	client Client,
+	logger *zap.Logger,
+) DpopProof {
+	return &dpopProof{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (d *dpopProof) getDpopProofUsesCacheKey(proofHash string) string {
+	return fmt.Sprintf("dpop_proof_uses:%s", proofHash)
+}
+
+func (d *dpopProof) Consume(ctx context.Context, proofHash string, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, d.logger)
+
+	isFirstUse, err := consume(ctx, d.client, d.getDpopProofUsesCacheKey(proofHash), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark dpop proof as used in cache")
+		return false, err
+	}
+
+	return isFirstUse, nil
+}
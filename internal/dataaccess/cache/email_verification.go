@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// EmailVerificationEntry is the verification state of the email of an
+// account. Accounts created before emails were verified have none.
+type EmailVerificationEntry struct {
+	AccountId  uint64 `json:"accountId"`
+	Email      string `json:"email"`
+	IsVerified bool   `json:"isVerified"`
+	VerifiedAt int64  `json:"verifiedAt,omitempty"`
+	// LastSentAt is the unix time the latest verification mail was sent
+	LastSentAt int64 `json:"lastSentAt,omitempty"`
+}
+
+// EmailVerificationTokenEntry is a mailed verification token, stored under
+// the hash of the token.
+type EmailVerificationTokenEntry struct {
+	AccountId uint64 `json:"accountId"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// EmailVerification keeps the verification state per account. Unverified
+// accounts are indexed by email so that verification mails can be resent
+// without signing in.
+type EmailVerification interface {
+	Set(ctx context.Context, entry EmailVerificationEntry) error
+	Get(ctx context.Context, accountId uint64) (entry EmailVerificationEntry, err error)
+	GetUnverifiedAccountId(ctx context.Context, email string) (accountId uint64, err error)
+	SetToken(ctx context.Context, tokenHash string, entry EmailVerificationTokenEntry, ttl time.Duration) error
+	GetToken(ctx context.Context, tokenHash string) (entry EmailVerificationTokenEntry, err error)
+	DelToken(ctx context.Context, tokenHash string) error
+}
+
+type emailVerification struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewEmailVerification(
+	client Client,
+	logger *zap.Logger,
+) EmailVerification {
+	return &emailVerification{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (e *emailVerification) getEmailVerificationCacheKey(accountId uint64) string {
+	return fmt.Sprintf("email_verification:%d", accountId)
+}
+
+func (e *emailVerification) getUnverifiedEmailCacheKey(email string) string {
+	return fmt.Sprintf("unverified_email:%s", strings.ToLower(email))
+}
+
+func (e *emailVerification) getEmailVerificationTokenCacheKey(tokenHash string) string {
+	return fmt.Sprintf("email_verification_token:%s", tokenHash)
+}
+
+func (e *emailVerification) Set(ctx context.Context, entry EmailVerificationEntry) error {
+	logger := log.LoggerWithContext(ctx, e.logger).With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal email verification")
+		return err
+	}
+
+	if err := e.client.Set(ctx, e.getEmailVerificationCacheKey(entry.AccountId), string(data), 0); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert email verification to cache")
+		return err
+	}
+
+	emailKey := e.getUnverifiedEmailCacheKey(entry.Email)
+	if entry.IsVerified {
+		err = e.client.Del(ctx, emailKey)
+	} else {
+		err = e.client.Set(ctx, emailKey, strconv.FormatUint(entry.AccountId, 10), 0)
+	}
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to update unverified email index")
+		return err
+	}
+
+	return nil
+}
+
+func (e *emailVerification) Get(ctx context.Context, accountId uint64) (EmailVerificationEntry, error) {
+	logger := log.LoggerWithContext(ctx, e.logger).With(zap.Uint64("account_id", accountId))
+
+	cacheEntry, err := e.client.Get(ctx, e.getEmailVerificationCacheKey(accountId))
+	if err != nil {
+		return EmailVerificationEntry{}, err
+	}
+
+	var entry EmailVerificationEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse email verification from cache")
+		return EmailVerificationEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (e *emailVerification) GetUnverifiedAccountId(ctx context.Context, email string) (uint64, error) {
+	logger := log.LoggerWithContext(ctx, e.logger)
+
+	cacheEntry, err := e.client.Get(ctx, e.getUnverifiedEmailCacheKey(email))
+	if err != nil {
+		return 0, err
+	}
+
+	accountId, err := strconv.ParseUint(fmt.Sprint(cacheEntry), 10, 64)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse unverified email from cache")
+		return 0, err
+	}
+
+	return accountId, nil
+}
+
+func (e *emailVerification) SetToken(ctx context.Context, tokenHash string, entry EmailVerificationTokenEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, e.logger).With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal email verification token")
+		return err
+	}
+
+	if err := e.client.Set(ctx, e.getEmailVerificationTokenCacheKey(tokenHash), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert email verification token to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (e *emailVerification) GetToken(ctx context.Context, tokenHash string) (EmailVerificationTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, e.logger)
+
+	cacheEntry, err := e.client.Get(ctx, e.getEmailVerificationTokenCacheKey(tokenHash))
+	if err != nil {
+		return EmailVerificationTokenEntry{}, err
+	}
+
+	var entry EmailVerificationTokenEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse email verification token from cache")
+		return EmailVerificationTokenEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (e *emailVerification) DelToken(ctx context.Context, tokenHash string) error {
+	logger := log.LoggerWithContext(ctx, e.logger)
+
+	if err := e.client.Del(ctx, e.getEmailVerificationTokenCacheKey(tokenHash)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del email verification token from cache")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// FederatedIdentityEntry links the account of an external identity
+// provider, known by its subject, to a Fiagram account.
+type FederatedIdentityEntry struct {
+	ProviderId string `json:"providerId"`
+	Subject    string `json:"subject"`
+	AccountId  uint64 `json:"accountId"`
+	LinkedAt   int64  `json:"linkedAt"`
+}
+
+type FederatedIdentity interface {
+	Set(ctx context.Context, entry FederatedIdentityEntry) error
+	Get(ctx context.Context, providerId string, subject string) (entry FederatedIdentityEntry, err error)
+	// IncrIpLinks counts an external account signing in for the first time
+	// from the client IP, the counter expires window after the last one.
+	IncrIpLinks(ctx context.Context, ipAddress string, window time.Duration) (int64, error)
+}
+
+type federatedIdentity struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewFederatedIdentity(
+	client Client,
+	logger *zap.Logger,
+) FederatedIdentity {
+	return &federatedIdentity{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (f *federatedIdentity) getFederatedIdentityCacheKey(providerId string, subject string) string {
+	return fmt.Sprintf("federated_identity:%s:%s", providerId, subject)
+}
+
+func (f *federatedIdentity) getFederatedIpLinksCacheKey(ipAddress string) string {
+	return fmt.Sprintf("federated_ip_links:%s", ipAddress)
+}
+
+func (f *federatedIdentity) Set(ctx context.Context, entry FederatedIdentityEntry) error {
+	logger := log.LoggerWithContext(ctx, f.logger).
+		With(zap.String("provider_id", entry.ProviderId)).
+		With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal federated identity")
+		return err
+	}
+
+	key := f.getFederatedIdentityCacheKey(entry.ProviderId, entry.Subject)
+	if err := f.client.Set(ctx, key, string(data), 0); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert federated identity to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (f *federatedIdentity) Get(ctx context.Context, providerId string, subject string) (FederatedIdentityEntry, error) {
+	logger := log.LoggerWithContext(ctx, f.logger).With(zap.String("provider_id", providerId))
+
+	cacheEntry, err := f.client.Get(ctx, f.getFederatedIdentityCacheKey(providerId, subject))
+	if err != nil {
+		return FederatedIdentityEntry{}, err
+	}
+
+	var entry FederatedIdentityEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse federated identity from cache")
+		return FederatedIdentityEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (f *federatedIdentity) IncrIpLinks(ctx context.Context, ipAddress string, window time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, f.logger).With(zap.String("ip_address", ipAddress))
+
+	links, err := f.client.Incr(ctx, f.getFederatedIpLinksCacheKey(ipAddress), window)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to increment federated ip links in cache")
+		return 0, err
+	}
+
+	return links, nil
+}
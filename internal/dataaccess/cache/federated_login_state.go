@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// FederatedLoginStateEntry is a sign-in waiting for the answer of an
+// external identity provider, stored under the hash of its state.
+type FederatedLoginStateEntry struct {
+	ProviderId   string `json:"providerId"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	IsRememberMe bool   `json:"isRememberMe"`
+	ExpiresAt    int64  `json:"expiresAt"`
+}
+
+type FederatedLoginState interface {
+	Set(ctx context.Context, stateHash string, entry FederatedLoginStateEntry, ttl time.Duration) error
+	Get(ctx context.Context, stateHash string) (entry FederatedLoginStateEntry, err error)
+	// Consume tells whether the caller is the first to use the state.
+	Consume(ctx context.Context, stateHash string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, stateHash string) error
+}
+
+type federatedLoginState struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewFederatedLoginState(
+	client Client,
+	logger *zap.Logger,
+) FederatedLoginState {
+	return &federatedLoginState{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (f *federatedLoginState) getFederatedLoginStateCacheKey(stateHash string) string {
+	return fmt.Sprintf("federated_login_state:%s", stateHash)
+}
+
+func (f *federatedLoginState) getFederatedLoginStateUsesCacheKey(stateHash string) string {
+	return fmt.Sprintf("federated_login_state_uses:%s", stateHash)
+}
+
+func (f *federatedLoginState) Set(ctx context.Context, stateHash string, entry FederatedLoginStateEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, f.logger).With(zap.String("provider_id", entry.ProviderId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal federated login state")
+		return err
+	}
+
+	if err := f.client.Set(ctx, f.getFederatedLoginStateCacheKey(stateHash), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert federated login state to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (f *federatedLoginState) Get(ctx context.Context, stateHash string) (FederatedLoginStateEntry, error) {
+	logger := log.LoggerWithContext(ctx, f.logger)
+
+	cacheEntry, err := f.client.Get(ctx, f.getFederatedLoginStateCacheKey(stateHash))
+	if err != nil {
+		return FederatedLoginStateEntry{}, err
+	}
+
+	var entry FederatedLoginStateEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse federated login state from cache")
+		return FederatedLoginStateEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (f *federatedLoginState) Consume(ctx context.Context, stateHash string, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, f.logger)
+
+	isFirstUse, err := consume(ctx, f.client, f.getFederatedLoginStateUsesCacheKey(stateHash), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark federated login state as used in cache")
+		return false, err
+	}
+
+	return isFirstUse, nil
+}
+
+func (f *federatedLoginState) Del(ctx context.Context, stateHash string) error {
+	logger := log.LoggerWithContext(ctx, f.logger)
+
+	if err := f.client.Del(ctx, f.getFederatedLoginStateCacheKey(stateHash)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del federated login state from cache")
+		return err
+	}
+
+	return nil
+}
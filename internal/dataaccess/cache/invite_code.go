@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// InviteCodeEntry is a code that lets its holders sign up while the
+// registration is invite-only. Only the hash of its secret is kept, the
+// code itself is shown once on creation.
+type InviteCodeEntry struct {
+	Id         string `json:"id"`
+	SecretHash string `json:"secretHash"`
+	// Role is given to the accounts signed up with the code, empty for the
+	// default role
+	Role      string `json:"role"`
+	MaxUses   int64  `json:"maxUses"`
+	Uses      int64  `json:"uses"`
+	CreatedBy uint64 `json:"createdBy"`
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type InviteCode interface {
+	Set(ctx context.Context, entry InviteCodeEntry, ttl time.Duration) error
+	// Get also reads the uses of the code
+	Get(ctx context.Context, codeId string) (entry InviteCodeEntry, err error)
+	// IncrUses counts a use of the code and returns the uses so far.
+	IncrUses(ctx context.Context, codeId string, ttl time.Duration) (int64, error)
+	// DecrUses gives back a use counted by IncrUses.
+	DecrUses(ctx context.Context, codeId string) (int64, error)
+	Del(ctx context.Context, codeId string) error
+	List(ctx context.Context) ([]InviteCodeEntry, error)
+}
+
+type inviteCode struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewInviteCode(
+	client Client,
+	logger *zap.Logger,
+) InviteCode {
+	return &inviteCode{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (i *inviteCode) getInviteCodeCacheKey(codeId string) string {
+	return fmt.Sprintf("invite_code:%s", codeId)
+}
+
+func (i *inviteCode) getInviteCodeUsesCacheKey(codeId string) string {
+	return fmt.Sprintf("invite_code_uses:%s", codeId)
+}
+
+func (i *inviteCode) getInviteCodesCacheKey() string {
+	return "invite_codes"
+}
+
+func (i *inviteCode) Set(ctx context.Context, entry InviteCodeEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.String("invite_code_id", entry.Id))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal invite code")
+		return err
+	}
+
+	if err := i.client.Set(ctx, i.getInviteCodeCacheKey(entry.Id), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert invite code to cache")
+		return err
+	}
+
+	if err := i.client.AddToSet(ctx, i.getInviteCodesCacheKey(), entry.Id); err != nil {
+		logger.With(zap.Error(err)).Error("failed to index invite code in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (i *inviteCode) Get(ctx context.Context, codeId string) (InviteCodeEntry, error) {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.String("invite_code_id", codeId))
+
+	cacheEntry, err := i.client.Get(ctx, i.getInviteCodeCacheKey(codeId))
+	if err != nil {
+		return InviteCodeEntry{}, err
+	}
+
+	var entry InviteCodeEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse invite code from cache")
+		return InviteCodeEntry{}, err
+	}
+
+	uses, err := i.client.Get(ctx, i.getInviteCodeUsesCacheKey(codeId))
+	if errors.Is(err, ErrCacheMiss) {
+		return entry, nil
+	} else if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get invite code uses from cache")
+		return InviteCodeEntry{}, err
+	}
+	if err := unmarshalCacheEntry(uses, &entry.Uses); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse invite code uses from cache")
+		return InviteCodeEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (i *inviteCode) IncrUses(ctx context.Context, codeId string, ttl time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.String("invite_code_id", codeId))
+
+	uses, err := i.client.Incr(ctx, i.getInviteCodeUsesCacheKey(codeId), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to count invite code uses in cache")
+		return 0, err
+	}
+
+	return uses, nil
+}
+
+func (i *inviteCode) DecrUses(ctx context.Context, codeId string) (int64, error) {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.String("invite_code_id", codeId))
+
+	uses, err := i.client.Decr(ctx, i.getInviteCodeUsesCacheKey(codeId))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to give back invite code use in cache")
+		return 0, err
+	}
+
+	return uses, nil
+}
+
+// Del keeps the uses counter until it expires with the code, so that a
+// code cannot be used past its limit while it is being deleted.
+func (i *inviteCode) Del(ctx context.Context, codeId string) error {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.String("invite_code_id", codeId))
+
+	if err := i.client.Del(ctx, i.getInviteCodeCacheKey(codeId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del invite code from cache")
+		return err
+	}
+
+	if err := i.client.RemoveFromSet(ctx, i.getInviteCodesCacheKey(), codeId); err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove invite code from index in cache")
+		return err
+	}
+
+	return nil
+}
+
+// List also drops the ids of codes that expired on their own from the
+// index.
+func (i *inviteCode) List(ctx context.Context) ([]InviteCodeEntry, error) {
+	logger := log.LoggerWithContext(ctx, i.logger)
+
+	indexKey := i.getInviteCodesCacheKey()
+	codeIds, err := i.client.GetSetMembers(ctx, indexKey)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get invite codes from cache")
+		return nil, err
+	}
+
+	entries := make([]InviteCodeEntry, 0, len(codeIds))
+	expired := make([]any, 0)
+	for _, codeId := range codeIds {
+		entry, err := i.Get(ctx, codeId)
+		if errors.Is(err, ErrCacheMiss) {
+			expired = append(expired, codeId)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(expired) > 0 {
+		if err := i.client.RemoveFromSet(ctx, indexKey, expired...); err != nil {
+			logger.With(zap.Error(err)).Error("failed to prune expired invite codes from index")
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// MagicLinkTokenEntry is a pending passwordless sign-in, stored under the
+// hash of the token mailed to the account.
+type MagicLinkTokenEntry struct {
+	AccountId    uint64 `json:"accountId"`
+	IsRememberMe bool   `json:"isRememberMe"`
+	CreatedAt    int64  `json:"createdAt"`
+	ExpiresAt    int64  `json:"expiresAt"`
+}
+
+// MagicLinkToken keeps the mailed sign-in links and counts the links asked
+// for each email.
+type MagicLinkToken interface {
+	Set(ctx context.Context, tokenHash string, entry MagicLinkTokenEntry, ttl time.Duration) error
+	Get(ctx context.Context, tokenHash string) (entry MagicLinkTokenEntry, err error)
+	// Consume tells whether the caller is the first to use the token.
+	Consume(ctx context.Context, tokenHash string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, tokenHash string) error
+	// IncrRequests counts a link asked for the email, the counter expires
+	// window after the last request.
+	IncrRequests(ctx context.Context, email string, window time.Duration) (int64, error)
+	// IncrIpRequests counts a link asked from the client IP, the counter
+	// expires window after the last request.
+	IncrIpRequests(ctx context.Context, ipAddress string, window time.Duration) (int64, error)
+}
+
+type magicLinkToken struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewMagicLinkToken(
+	client Client,
+	logger *zap.Logger,
+) MagicLinkToken {
+	return &magicLinkToken{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (m *magicLinkToken) getMagicLinkTokenCacheKey(tokenHash string) string {
+	return fmt.Sprintf("magic_link_token:%s", tokenHash)
+}
+
+func (m *magicLinkToken) getMagicLinkTokenUsesCacheKey(tokenHash string) string {
+	return fmt.Sprintf("magic_link_token_uses:%s", tokenHash)
+}
+
+func (m *magicLinkToken) getMagicLinkRequestsCacheKey(email string) string {
+	return fmt.Sprintf("magic_link_requests:%s", strings.ToLower(email))
+}
+
+func (m *magicLinkToken) getMagicLinkIpRequestsCacheKey(ipAddress string) string {
+	return fmt.Sprintf("magic_link_ip_requests:%s", ipAddress)
+}
+
+func (m *magicLinkToken) Set(ctx context.Context, tokenHash string, entry MagicLinkTokenEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal magic link token")
+		return err
+	}
+
+	if err := m.client.Set(ctx, m.getMagicLinkTokenCacheKey(tokenHash), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert magic link token to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (m *magicLinkToken) Get(ctx context.Context, tokenHash string) (MagicLinkTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	cacheEntry, err := m.client.Get(ctx, m.getMagicLinkTokenCacheKey(tokenHash))
+	if err != nil {
+		return MagicLinkTokenEntry{}, err
+	}
+
+	var entry MagicLinkTokenEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse magic link token from cache")
+		return MagicLinkTokenEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (m *magicLinkToken) Consume(ctx context.Context, tokenHash string, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	isFirstUse, err := consume(ctx, m.client, m.getMagicLinkTokenUsesCacheKey(tokenHash), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark magic link token as used in cache")
+		return false, err
+	}
+
+	return isFirstUse, nil
+}
+
+func (m *magicLinkToken) Del(ctx context.Context, tokenHash string) error {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	if err := m.client.Del(ctx, m.getMagicLinkTokenCacheKey(tokenHash)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del magic link token from cache")
+		return err
+	}
+
+	return nil
+}
+
+func (m *magicLinkToken) IncrRequests(ctx context.Context, email string, window time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	requests, err := m.client.Incr(ctx, m.getMagicLinkRequestsCacheKey(email), window)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to increment magic link requests in cache")
+		return 0, err
+	}
+
+	return requests, nil
+}
+
+func (m *magicLinkToken) IncrIpRequests(ctx context.Context, ipAddress string, window time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.String("ip_address", ipAddress))
+
+	requests, err := m.client.Incr(ctx, m.getMagicLinkIpRequestsCacheKey(ipAddress), window)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to increment magic link ip requests in cache")
+		return 0, err
+	}
+
+	return requests, nil
+}
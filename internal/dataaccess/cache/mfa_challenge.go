@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// MfaChallengeEntry is a sign-in that passed the password step and waits
+// for its second factor.
+type MfaChallengeEntry struct {
+	AccountId    uint64 `json:"accountId"`
+	IsRememberMe bool   `json:"isRememberMe"`
+	ExpiresAt    int64  `json:"expiresAt"`
+}
+
+type MfaChallenge interface {
+	Set(ctx context.Context, challenge string, entry MfaChallengeEntry, ttl time.Duration) error
+	Get(ctx context.Context, challenge string) (entry MfaChallengeEntry, err error)
+	// IncrAttempts counts a code presented for the challenge and returns
+	// the attempts so far.
+	IncrAttempts(ctx context.Context, challenge string, ttl time.Duration) (int64, error)
+	Del(ctx context.Context, challenge string) error
+}
+
+type mfaChallenge struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewMfaChallenge(
+	client Client,
+	logger *zap.Logger,
+) MfaChallenge {
+	return &mfaChallenge{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (m *mfaChallenge) getMfaChallengeCacheKey(challenge string) string {
+	return fmt.Sprintf("mfa_challenge:%s", challenge)
+}
+
+func (m *mfaChallenge) getMfaChallengeAttemptsCacheKey(challenge string) string {
+	return fmt.Sprintf("mfa_challenge_attempts:%s", challenge)
+}
+
+func (m *mfaChallenge) Set(ctx context.Context, challenge string, entry MfaChallengeEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal mfa challenge")
+		return err
+	}
+
+	if err := m.client.Set(ctx, m.getMfaChallengeCacheKey(challenge), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert mfa challenge to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (m *mfaChallenge) Get(ctx context.Context, challenge string) (MfaChallengeEntry, error) {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	cacheEntry, err := m.client.Get(ctx, m.getMfaChallengeCacheKey(challenge))
+	if err != nil {
+		return MfaChallengeEntry{}, err
+	}
+
+	var entry MfaChallengeEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse mfa challenge from cache")
+		return MfaChallengeEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (m *mfaChallenge) IncrAttempts(ctx context.Context, challenge string, ttl time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	attempts, err := m.client.Incr(ctx, m.getMfaChallengeAttemptsCacheKey(challenge), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to count mfa challenge attempts in cache")
+		return 0, err
+	}
+
+	return attempts, nil
+}
+
+// Del keeps the attempts counter until it expires with the challenge.
+func (m *mfaChallenge) Del(ctx context.Context, challenge string) error {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	if err := m.client.Del(ctx, m.getMfaChallengeCacheKey(challenge)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del mfa challenge from cache")
+		return err
+	}
+
+	return nil
+}
@@ -10,5 +10,23 @@ var Module = fx.Module(
 		NewClient,
 		NewUsernamesTaken,
 		NewRefreshToken,
+		NewRefreshTokenFamily,
+		NewSession,
+		NewAccessTokenRevocation,
+		NewTotpEnrollment,
+		NewMfaChallenge,
+		NewWebAuthnSession,
+		NewWebAuthnCredential,
+		NewPersonalAccessToken,
+		NewOAuthClient,
+		NewSignInThrottle,
+		NewPasswordResetToken,
+		NewEmailVerification,
+		NewMagicLinkToken,
+		NewOidcAuthorizationCode,
+		NewFederatedLoginState,
+		NewFederatedIdentity,
+		NewDpopProof,
+		NewInviteCode,
 	),
 )
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// OAuthClientEntry is a machine identity registered with the clients
+// command. Only the hash of its secret is kept. Audiences are the services
+// it may request tokens for, none for the gateway only.
+type OAuthClientEntry struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	SecretHash string   `json:"secretHash"`
+	Scopes     []string `json:"scopes"`
+	Audiences  []string `json:"audiences"`
+	CreatedAt  int64    `json:"createdAt"`
+}
+
+type OAuthClient interface {
+	Set(ctx context.Context, entry OAuthClientEntry) error
+	Get(ctx context.Context, clientId string) (entry OAuthClientEntry, err error)
+	Del(ctx context.Context, clientId string) error
+	List(ctx context.Context) ([]OAuthClientEntry, error)
+}
+
+type oAuthClient struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewOAuthClient(
+	client Client,
+	logger *zap.Logger,
+) OAuthClient {
+	return &oAuthClient{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (o *oAuthClient) getOAuthClientCacheKey(clientId string) string {
+	return fmt.Sprintf("oauth_client:%s", clientId)
+}
+
+func (o *oAuthClient) getOAuthClientsCacheKey() string {
+	return "oauth_clients"
+}
+
+// Set stores the client without expiry, clients live until deleted.
+func (o *oAuthClient) Set(ctx context.Context, entry OAuthClientEntry) error {
+	logger := log.LoggerWithContext(ctx, o.logger).With(zap.String("client_id", entry.Id))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal oauth client")
+		return err
+	}
+
+	if err := o.client.Set(ctx, o.getOAuthClientCacheKey(entry.Id), string(data), 0); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert oauth client to cache")
+		return err
+	}
+
+	if err := o.client.AddToSet(ctx, o.getOAuthClientsCacheKey(), entry.Id); err != nil {
+		logger.With(zap.Error(err)).Error("failed to index oauth client in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (o *oAuthClient) Get(ctx context.Context, clientId string) (OAuthClientEntry, error) {
+	logger := log.LoggerWithContext(ctx, o.logger).With(zap.String("client_id", clientId))
+
+	cacheEntry, err := o.client.Get(ctx, o.getOAuthClientCacheKey(clientId))
+	if err != nil {
+		return OAuthClientEntry{}, err
+	}
+
+	var entry OAuthClientEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse oauth client from cache")
+		return OAuthClientEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (o *oAuthClient) Del(ctx context.Context, clientId string) error {
+	logger := log.LoggerWithContext(ctx, o.logger).With(zap.String("client_id", clientId))
+
+	if err := o.client.Del(ctx, o.getOAuthClientCacheKey(clientId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del oauth client from cache")
+		return err
+	}
+
+	if err := o.client.RemoveFromSet(ctx, o.getOAuthClientsCacheKey(), clientId); err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove oauth client from index in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (o *oAuthClient) List(ctx context.Context) ([]OAuthClientEntry, error) {
+	logger := log.LoggerWithContext(ctx, o.logger)
+
+	clientIds, err := o.client.GetSetMembers(ctx, o.getOAuthClientsCacheKey())
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get oauth clients from cache")
+		return nil, err
+	}
+
+	entries := make([]OAuthClientEntry, 0, len(clientIds))
+	for _, clientId := range clientIds {
+		entry, err := o.Get(ctx, clientId)
+		if errors.Is(err, ErrCacheMiss) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// OidcAuthorizationCodeEntry is an authorization code handed to an OpenID
+// Connect client, stored under the hash of the code.
+type OidcAuthorizationCodeEntry struct {
+	ClientId      string   `json:"clientId"`
+	RedirectUri   string   `json:"redirectUri"`
+	AccountId     uint64   `json:"accountId"`
+	Scopes        []string `json:"scopes"`
+	Nonce         string   `json:"nonce,omitempty"`
+	CodeChallenge string   `json:"codeChallenge"`
+	ExpiresAt     int64    `json:"expiresAt"`
+}
+
+type OidcAuthorizationCode interface {
+	Set(ctx context.Context, codeHash string, entry OidcAuthorizationCodeEntry, ttl time.Duration) error
+	Get(ctx context.Context, codeHash string) (entry OidcAuthorizationCodeEntry, err error)
+	// Consume marks the code as exchanged for sessionId and tells whether
+	// the caller is the first to use it. The marker and the session are
+	// stored in one step, so the callers that come second always learn the
+	// session of the first one.
+	Consume(ctx context.Context, codeHash string, sessionId string, ttl time.Duration) (isFirstUse bool, firstSessionId string, err error)
+}
+
+type oidcAuthorizationCode struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewOidcAuthorizationCode(
+	client Client,
+	logger *zap.Logger,
+) OidcAuthorizationCode {
+	return &oidcAuthorizationCode{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (o *oidcAuthorizationCode) getOidcAuthorizationCodeCacheKey(codeHash string) string {
+	return fmt.Sprintf("oidc_authorization_code:%s", codeHash)
+}
+
+func (o *oidcAuthorizationCode) getOidcAuthorizationCodeSessionCacheKey(codeHash string) string {
+	return fmt.Sprintf("oidc_authorization_code_session:%s", codeHash)
+}
+
+func (o *oidcAuthorizationCode) Set(ctx context.Context, codeHash string, entry OidcAuthorizationCodeEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, o.logger).
+		With(zap.String("client_id", entry.ClientId)).
+		With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal oidc authorization code")
+		return err
+	}
+
+	if err := o.client.Set(ctx, o.getOidcAuthorizationCodeCacheKey(codeHash), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert oidc authorization code to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (o *oidcAuthorizationCode) Get(ctx context.Context, codeHash string) (OidcAuthorizationCodeEntry, error) {
+	logger := log.LoggerWithContext(ctx, o.logger)
+
+	cacheEntry, err := o.client.Get(ctx, o.getOidcAuthorizationCodeCacheKey(codeHash))
+	if err != nil {
+		return OidcAuthorizationCodeEntry{}, err
+	}
+
+	var entry OidcAuthorizationCodeEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse oidc authorization code from cache")
+		return OidcAuthorizationCodeEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (o *oidcAuthorizationCode) Consume(ctx context.Context, codeHash string, sessionId string, ttl time.Duration) (bool, string, error) {
+	logger := log.LoggerWithContext(ctx, o.logger).With(zap.String("session_id", sessionId))
+
+	key := o.getOidcAuthorizationCodeSessionCacheKey(codeHash)
+	isFirstUse, err := o.client.SetIfAbsent(ctx, key, sessionId, ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark oidc authorization code as used in cache")
+		return false, "", err
+	} else if isFirstUse {
+		return true, sessionId, nil
+	}
+
+	firstSessionId, err := o.client.Get(ctx, key)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get session of used oidc authorization code from cache")
+		return false, "", err
+	}
+
+	return false, fmt.Sprint(firstSessionId), nil
+}
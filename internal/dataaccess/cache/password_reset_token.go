@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// PasswordResetTokenEntry is a pending password reset, stored under the
+// hash of the token mailed to the account.
+type PasswordResetTokenEntry struct {
+	AccountId uint64 `json:"accountId"`
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// PasswordResetToken keeps one pending reset per account, a newer token
+// replaces the older ones.
+type PasswordResetToken interface {
+	Set(ctx context.Context, tokenHash string, entry PasswordResetTokenEntry, ttl time.Duration) error
+	Get(ctx context.Context, tokenHash string) (entry PasswordResetTokenEntry, err error)
+	// GetCurrent returns the hash of the latest token of the account.
+	GetCurrent(ctx context.Context, accountId uint64) (tokenHash string, err error)
+	// Consume tells whether the caller is the first to use the token.
+	Consume(ctx context.Context, tokenHash string, ttl time.Duration) (bool, error)
+	// Release undoes Consume, for a reset that failed after taking the token.
+	Release(ctx context.Context, tokenHash string) error
+	Del(ctx context.Context, tokenHash string, accountId uint64) error
+	// IncrRequests counts a reset asked for an email or from an IP, the
+	// counter expires window after the last request.
+	IncrRequests(ctx context.Context, kind string, value string, window time.Duration) (int64, error)
+}
+
+type passwordResetToken struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewPasswordResetToken(
+	client Client,
+	logger *zap.Logger,
+) PasswordResetToken {
+	return &passwordResetToken{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (p *passwordResetToken) getPasswordResetTokenCacheKey(tokenHash string) string {
+	return fmt.Sprintf("password_reset_token:%s", tokenHash)
+}
+
+func (p *passwordResetToken) getPasswordResetTokenUsesCacheKey(tokenHash string) string {
+	return fmt.Sprintf("password_reset_token_uses:%s", tokenHash)
+}
+
+func (p *passwordResetToken) getPasswordResetRequestsCacheKey(kind string, value string) string {
+	return fmt.Sprintf("password_reset_requests:%s:%s", kind, value)
+}
+
+func (p *passwordResetToken) getAccountPasswordResetTokenCacheKey(accountId uint64) string {
+	return fmt.Sprintf("account_password_reset_token:%d", accountId)
+}
+
+func (p *passwordResetToken) Set(ctx context.Context, tokenHash string, entry PasswordResetTokenEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal password reset token")
+		return err
+	}
+
+	if err := p.client.Set(ctx, p.getPasswordResetTokenCacheKey(tokenHash), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert password reset token to cache")
+		return err
+	}
+
+	accountKey := p.getAccountPasswordResetTokenCacheKey(entry.AccountId)
+	if err := p.client.Set(ctx, accountKey, tokenHash, ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert account password reset token to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (p *passwordResetToken) Get(ctx context.Context, tokenHash string) (PasswordResetTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, p.logger)
+
+	cacheEntry, err := p.client.Get(ctx, p.getPasswordResetTokenCacheKey(tokenHash))
+	if err != nil {
+		return PasswordResetTokenEntry{}, err
+	}
+
+	var entry PasswordResetTokenEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse password reset token from cache")
+		return PasswordResetTokenEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (p *passwordResetToken) GetCurrent(ctx context.Context, accountId uint64) (string, error) {
+	cacheEntry, err := p.client.Get(ctx, p.getAccountPasswordResetTokenCacheKey(accountId))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprint(cacheEntry), nil
+}
+
+func (p *passwordResetToken) Consume(ctx context.Context, tokenHash string, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, p.logger)
+
+	isFirstUse, err := consume(ctx, p.client, p.getPasswordResetTokenUsesCacheKey(tokenHash), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark password reset token as used in cache")
+		return false, err
+	}
+
+	return isFirstUse, nil
+}
+
+func (p *passwordResetToken) Release(ctx context.Context, tokenHash string) error {
+	logger := log.LoggerWithContext(ctx, p.logger)
+
+	if err := p.client.Del(ctx, p.getPasswordResetTokenUsesCacheKey(tokenHash)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to release password reset token in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (p *passwordResetToken) Del(ctx context.Context, tokenHash string, accountId uint64) error {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.Uint64("account_id", accountId))
+
+	err := p.client.Del(ctx,
+		p.getPasswordResetTokenCacheKey(tokenHash),
+		p.getAccountPasswordResetTokenCacheKey(accountId))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to del password reset token from cache")
+		return err
+	}
+
+	return nil
+}
+
+func (p *passwordResetToken) IncrRequests(ctx context.Context, kind string, value string, window time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.String("kind", kind))
+
+	requests, err := p.client.Incr(ctx, p.getPasswordResetRequestsCacheKey(kind, value), window)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to increment password reset requests in cache")
+		return 0, err
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// PersonalAccessTokenEntry is a long-lived token of an account. Only the
+// hash of its secret is kept, the token itself is shown once on creation.
+type PersonalAccessTokenEntry struct {
+	Id         string   `json:"id"`
+	AccountId  uint64   `json:"accountId"`
+	Name       string   `json:"name"`
+	SecretHash string   `json:"secretHash"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  int64    `json:"createdAt"`
+	// ExpiresAt is zero for tokens that never expire
+	ExpiresAt  int64 `json:"expiresAt"`
+	LastUsedAt int64 `json:"lastUsedAt"`
+}
+
+type PersonalAccessToken interface {
+	Set(ctx context.Context, entry PersonalAccessTokenEntry, ttl time.Duration) error
+	Get(ctx context.Context, tokenId string) (entry PersonalAccessTokenEntry, err error)
+	// SetLastUsedAt is kept apart from Set so that recording a use cannot
+	// bring back a token revoked in the meantime.
+	SetLastUsedAt(ctx context.Context, tokenId string, lastUsedAt int64, ttl time.Duration) error
+	Del(ctx context.Context, accountId uint64, tokenId string) error
+	ListByAccount(ctx context.Context, accountId uint64) ([]PersonalAccessTokenEntry, error)
+}
+
+type personalAccessToken struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewPersonalAccessToken(
+	client Client,
+	logger *zap.Logger,
+) PersonalAccessToken {
+	return &personalAccessToken{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (p *personalAccessToken) getPersonalAccessTokenCacheKey(tokenId string) string {
+	return fmt.Sprintf("personal_access_token:%s", tokenId)
+}
+
+func (p *personalAccessToken) getPersonalAccessTokenLastUsedCacheKey(tokenId string) string {
+	return fmt.Sprintf("personal_access_token_last_used:%s", tokenId)
+}
+
+func (p *personalAccessToken) getAccountPersonalAccessTokensCacheKey(accountId uint64) string {
+	return fmt.Sprintf("account_personal_access_tokens:%d", accountId)
+}
+
+func (p *personalAccessToken) Set(ctx context.Context, entry PersonalAccessTokenEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, p.logger).
+		With(zap.String("token_id", entry.Id)).
+		With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal personal access token")
+		return err
+	}
+
+	if err := p.client.Set(ctx, p.getPersonalAccessTokenCacheKey(entry.Id), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert personal access token to cache")
+		return err
+	}
+
+	if err := p.client.AddToSet(ctx, p.getAccountPersonalAccessTokensCacheKey(entry.AccountId), entry.Id); err != nil {
+		logger.With(zap.Error(err)).Error("failed to index personal access token by account in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (p *personalAccessToken) Get(ctx context.Context, tokenId string) (PersonalAccessTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.String("token_id", tokenId))
+
+	cacheEntry, err := p.client.Get(ctx, p.getPersonalAccessTokenCacheKey(tokenId))
+	if err != nil {
+		return PersonalAccessTokenEntry{}, err
+	}
+
+	var entry PersonalAccessTokenEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse personal access token from cache")
+		return PersonalAccessTokenEntry{}, err
+	}
+
+	lastUsedAt, err := p.client.Get(ctx, p.getPersonalAccessTokenLastUsedCacheKey(tokenId))
+	if errors.Is(err, ErrCacheMiss) {
+		return entry, nil
+	} else if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get personal access token last use from cache")
+		return PersonalAccessTokenEntry{}, err
+	}
+	if err := unmarshalCacheEntry(lastUsedAt, &entry.LastUsedAt); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse personal access token last use from cache")
+		return PersonalAccessTokenEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (p *personalAccessToken) SetLastUsedAt(ctx context.Context, tokenId string, lastUsedAt int64, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.String("token_id", tokenId))
+
+	if err := p.client.Set(ctx, p.getPersonalAccessTokenLastUsedCacheKey(tokenId), strconv.FormatInt(lastUsedAt, 10), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert personal access token last use to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (p *personalAccessToken) Del(ctx context.Context, accountId uint64, tokenId string) error {
+	logger := log.LoggerWithContext(ctx, p.logger).
+		With(zap.String("token_id", tokenId)).
+		With(zap.Uint64("account_id", accountId))
+
+	if err := p.client.Del(ctx, p.getPersonalAccessTokenCacheKey(tokenId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del personal access token from cache")
+		return err
+	}
+
+	if err := p.client.Del(ctx, p.getPersonalAccessTokenLastUsedCacheKey(tokenId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del personal access token last use from cache")
+		return err
+	}
+
+	if err := p.client.RemoveFromSet(ctx, p.getAccountPersonalAccessTokensCacheKey(accountId), tokenId); err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove personal access token from account index in cache")
+		return err
+	}
+
+	return nil
+}
+
+// ListByAccount also drops the ids of tokens that expired on their own
+// from the account index.
+func (p *personalAccessToken) ListByAccount(ctx context.Context, accountId uint64) ([]PersonalAccessTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.Uint64("account_id", accountId))
+
+	indexKey := p.getAccountPersonalAccessTokensCacheKey(accountId)
+	tokenIds, err := p.client.GetSetMembers(ctx, indexKey)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get account personal access tokens from cache")
+		return nil, err
+	}
+
+	entries := make([]PersonalAccessTokenEntry, 0, len(tokenIds))
+	expired := make([]any, 0)
+	for _, tokenId := range tokenIds {
+		entry, err := p.Get(ctx, tokenId)
+		if errors.Is(err, ErrCacheMiss) {
+			expired = append(expired, tokenId)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(expired) > 0 {
+		if err := p.client.RemoveFromSet(ctx, indexKey, expired...); err != nil {
+			logger.With(zap.Error(err)).Error("failed to prune expired personal access tokens from account index")
+		}
+	}
+
+	return entries, nil
+}
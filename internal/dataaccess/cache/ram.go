@@ -2,7 +2,9 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 
 type ramClient struct {
 	cache      map[string]any
+	expiresAt  map[string]time.Time
 	cacheMutex *sync.Mutex
 	logger     *zap.Logger
 }
@@ -20,16 +23,18 @@ func NewRamClient(
 ) Client {
 	return &ramClient{
 		cache:      make(map[string]any),
+		expiresAt:  make(map[string]time.Time),
 		cacheMutex: new(sync.Mutex),
 		logger:     logger,
 	}
 }
 
-func (c ramClient) Set(_ context.Context, key string, data any, _ time.Duration) error {
+func (c ramClient) Set(_ context.Context, key string, data any, ttl time.Duration) error {
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
 
 	c.cache[key] = data
+	c.setTTL(key, ttl)
 	return nil
 }
 
@@ -37,6 +42,7 @@ func (c ramClient) Get(_ context.Context, key string) (any, error) {
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
 
+	c.evictIfExpired(key)
 	data, ok := c.cache[key]
 	if !ok {
 		return nil, ErrCacheMiss
@@ -45,12 +51,72 @@ func (c ramClient) Get(_ context.Context, key string) (any, error) {
 	return data, nil
 }
 
+func (c ramClient) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	c.evictIfExpired(key)
+	var value int64
+	if data, ok := c.cache[key]; ok {
+		parsed, err := strconv.ParseInt(fmt.Sprint(data), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of %s is not an integer", key)
+		}
+		value = parsed
+	}
+	value++
+
+	// Stored as a string, the way redis returns counters
+	c.cache[key] = strconv.FormatInt(value, 10)
+	c.setTTL(key, ttl)
+	return value, nil
+}
+
+func (c ramClient) Decr(_ context.Context, key string) (int64, error) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	c.evictIfExpired(key)
+	data, ok := c.cache[key]
+	if !ok {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(fmt.Sprint(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of %s is not an integer", key)
+	}
+	value--
+
+	// The ttl of the key is left as it is
+	c.cache[key] = strconv.FormatInt(value, 10)
+	return value, nil
+}
+
+func (c ramClient) SetIfAbsent(_ context.Context, key string, data any, ttl time.Duration) (bool, error) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	c.evictIfExpired(key)
+	if _, ok := c.cache[key]; ok {
+		return false, nil
+	}
+
+	c.cache[key] = data
+	c.setTTL(key, ttl)
+	return true, nil
+}
+
 func (c ramClient) AddToSet(_ context.Context, key string, data ...any) error {
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
 
 	set := c.getSet(key)
-	set = append(set, data...)
+	for _, d := range data {
+		// Members are unique like in a redis set
+		if !slices.Contains(set, d) {
+			set = append(set, d)
+		}
+	}
 	c.cache[key] = set
 	return nil
 }
@@ -68,18 +134,62 @@ func (c ramClient) IsDataInSet(_ context.Context, key string, data any) (bool, e
 	return false, nil
 }
 
+func (c ramClient) RemoveFromSet(_ context.Context, key string, data ...any) error {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	set := slices.DeleteFunc(c.getSet(key), func(member any) bool {
+		return slices.Contains(data, member)
+	})
+	c.cache[key] = set
+	return nil
+}
+
+func (c ramClient) GetSetMembers(_ context.Context, key string) ([]string, error) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	// Members come back as strings, the way redis returns them
+	members := make([]string, 0)
+	for _, member := range c.getSet(key) {
+		members = append(members, fmt.Sprint(member))
+	}
+	return members, nil
+}
+
 func (c ramClient) Del(ctx context.Context, keys ...string) error {
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
 
 	for _, key := range keys {
 		delete(c.cache, key)
+		delete(c.expiresAt, key)
 	}
 
 	return nil
 }
 
+// setTTL mirrors redis: a zero ttl keeps the key until it is deleted.
+func (c ramClient) setTTL(key string, ttl time.Duration) {
+	if ttl > 0 {
+		c.expiresAt[key] = time.Now().Add(ttl)
+	} else {
+		delete(c.expiresAt, key)
+	}
+}
+
+// evictIfExpired lazily removes a key whose ttl has passed. The caller must
+// hold the mutex.
+func (c ramClient) evictIfExpired(key string) {
+	expiresAt, ok := c.expiresAt[key]
+	if ok && !time.Now().Before(expiresAt) {
+		delete(c.cache, key)
+		delete(c.expiresAt, key)
+	}
+}
+
 func (c ramClient) getSet(key string) []any {
+	c.evictIfExpired(key)
 	setValue, ok := c.cache[key]
 	if !ok {
 		return make([]any, 0)
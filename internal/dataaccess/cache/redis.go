@@ -87,6 +87,32 @@ func (c *redisClient) IsDataInSet(ctx context.Context, key string, data any) (bo
 	return result, nil
 }
 
+func (c *redisClient) RemoveFromSet(ctx context.Context, key string, data ...any) error {
+	logger := log.LoggerWithContext(ctx, c.logger).
+		With(zap.String("key", key)).
+		With(zap.Any("data", data))
+
+	if err := c.accessObject.SRem(ctx, key, data...).Err(); err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove data from set inside cache")
+		return status.Error(codes.Internal, "failed to remove data from set inside cache")
+	}
+
+	return nil
+}
+
+func (c *redisClient) GetSetMembers(ctx context.Context, key string) ([]string, error) {
+	logger := log.LoggerWithContext(ctx, c.logger).
+		With(zap.String("key", key))
+
+	members, err := c.accessObject.SMembers(ctx, key).Result()
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get members of set inside cache")
+		return nil, status.Error(codes.Internal, "failed to get members of set inside cache")
+	}
+
+	return members, nil
+}
+
 func (c *redisClient) Set(ctx context.Context, key string, data any, ttl time.Duration) error {
 	logger := log.LoggerWithContext(ctx, c.logger).
 		With(zap.String("key", key)).
@@ -102,6 +128,20 @@ func (c *redisClient) Set(ctx context.Context, key string, data any, ttl time.Du
 	return nil
 }
 
+func (c *redisClient) SetIfAbsent(ctx context.Context, key string, data any, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, c.logger).
+		With(zap.String("key", key)).
+		With(zap.Duration("ttl", ttl))
+
+	isSet, err := c.accessObject.SetNX(ctx, key, data, ttl).Result()
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to set data into cache if absent")
+		return false, status.Error(codes.Internal, "failed to set data into cache")
+	}
+
+	return isSet, nil
+}
+
 func (c *redisClient) Del(ctx context.Context, key ...string) error {
 	logger := log.LoggerWithContext(ctx, c.logger).
 		With(zap.Any("keys", key))
@@ -113,3 +153,48 @@ func (c *redisClient) Del(ctx context.Context, key ...string) error {
 
 	return nil
 }
+
+func (c *redisClient) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, c.logger).
+		With(zap.String("key", key)).
+		With(zap.Duration("ttl", ttl))
+
+	// MULTI makes the increment and the expiry one step, a counter must not
+	// be left without ttl
+	var incr *redis.IntCmd
+	_, err := c.accessObject.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to increment counter inside cache")
+		return 0, status.Error(codes.Internal, "failed to increment counter inside cache")
+	}
+
+	return incr.Val(), nil
+}
+
+// decrIfExists decrements a key only when it exists, DECR alone would
+// create it without ttl
+var decrIfExists = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+return redis.call("DECR", KEYS[1])
+`)
+
+func (c *redisClient) Decr(ctx context.Context, key string) (int64, error) {
+	logger := log.LoggerWithContext(ctx, c.logger).
+		With(zap.String("key", key))
+
+	value, err := decrIfExists.Run(ctx, c.accessObject, []string{key}).Int64()
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to decrement counter inside cache")
+		return 0, status.Error(codes.Internal, "failed to decrement counter inside cache")
+	}
+
+	return value, nil
+}
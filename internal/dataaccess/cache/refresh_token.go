@@ -2,18 +2,36 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/Fiagram/gateway/internal/log"
 	"go.uber.org/zap"
 )
 
+type RefreshTokenEntry struct {
+	AccountId uint64 `json:"accountId"`
+	FamilyId  string `json:"familyId"`
+	// RotatedAt is the unix time the token was exchanged for its successor.
+	// A rotated token is kept only to detect its reuse.
+	RotatedAt int64 `json:"rotatedAt,omitempty"`
+	// ExpiresAt is the unix time the token expires, zero for tokens issued
+	// before it was recorded
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// ClientId is the OpenID Connect client the token was issued to, empty
+	// for the tokens of the gateway's own sign-in
+	ClientId string `json:"clientId,omitempty"`
+}
+
 type RefreshToken interface {
-	Set(ctx context.Context, key string, id uint64, ttl time.Duration) error
-	Get(ctx context.Context, key string) (id uint64, err error)
+	Set(ctx context.Context, key string, entry RefreshTokenEntry, ttl time.Duration) error
+	// Get returns ErrInvalidEntry for the tokens stored before the entries
+	// were JSON, which only held the account id.
+	Get(ctx context.Context, key string) (entry RefreshTokenEntry, err error)
 	Del(ctx context.Context, key string) (bool, error)
+	// Consume tells whether the token is exchanged for the first time.
+	Consume(ctx context.Context, key string, ttl time.Duration) (bool, error)
 }
 
 type refreshToken struct {
@@ -35,11 +53,21 @@ func (r *refreshToken) getRefreshTokenCacheKey(token string) string {
 	return fmt.Sprintf("refresh_token:%s", token)
 }
 
-func (r *refreshToken) Set(ctx context.Context, key string, accountID uint64, ttl time.Duration) error {
+func (r *refreshToken) getRefreshTokenUsesCacheKey(token string) string {
+	return fmt.Sprintf("refresh_token_uses:%s", token)
+}
+
+func (r *refreshToken) Set(ctx context.Context, key string, entry RefreshTokenEntry, ttl time.Duration) error {
 	logger := log.LoggerWithContext(ctx, r.logger)
 
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal refresh token entry")
+		return err
+	}
+
 	cacheKey := r.getRefreshTokenCacheKey(key)
-	if err := r.client.Set(ctx, cacheKey, accountID, ttl); err != nil {
+	if err := r.client.Set(ctx, cacheKey, string(data), ttl); err != nil {
 		logger.With(zap.Error(err)).Error("failed to insert token key to cache")
 		return err
 	}
@@ -47,38 +75,23 @@ func (r *refreshToken) Set(ctx context.Context, key string, accountID uint64, tt
 	return nil
 }
 
-func (r *refreshToken) Get(ctx context.Context, key string) (data uint64, err error) {
+func (r *refreshToken) Get(ctx context.Context, key string) (RefreshTokenEntry, error) {
 	logger := log.LoggerWithContext(ctx, r.logger)
 
 	cacheKey := r.getRefreshTokenCacheKey(key)
 	cacheEntry, err := r.client.Get(ctx, cacheKey)
 	if err != nil {
 		logger.With(zap.Error(err)).Error("failed to get token key to cache")
-		return 0, err
-	}
-
-	if cacheEntry == nil {
-		return 0, ErrCacheMiss
+		return RefreshTokenEntry{}, err
 	}
 
-	// Try to convert from string (Redis returns data as string)
-	var accountID uint64
-	if strData, ok := cacheEntry.(string); ok {
-		id, err := strconv.ParseUint(strData, 10, 64)
-		if err != nil {
-			logger.With(zap.Error(err)).Error("failed to parse account id from cache")
-			return 0, err
-		}
-		accountID = id
-	} else if id, ok := cacheEntry.(uint64); ok {
-		// In case it's already uint64 (from in-memory cache)
-		accountID = id
-	} else {
-		logger.Error("cache entry is not of type string or uint64")
-		return 0, fmt.Errorf("invalid cache entry type")
+	var entry RefreshTokenEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Warn("failed to parse refresh token entry from cache")
+		return RefreshTokenEntry{}, fmt.Errorf("%w: %w", ErrInvalidEntry, err)
 	}
 
-	return accountID, nil
+	return entry, nil
 }
 
 func (r *refreshToken) Del(ctx context.Context, key string) (bool, error) {
@@ -93,3 +106,15 @@ func (r *refreshToken) Del(ctx context.Context, key string) (bool, error) {
 
 	return true, nil
 }
+
+func (r *refreshToken) Consume(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, r.logger)
+
+	isFirstUse, err := consume(ctx, r.client, r.getRefreshTokenUsesCacheKey(key), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark refresh token as used in cache")
+		return false, err
+	}
+
+	return isFirstUse, nil
+}
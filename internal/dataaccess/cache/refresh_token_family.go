@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// RefreshTokenFamilyEntry tracks the chain of refresh tokens issued from one
+// sign-in. Only CurrentToken may be exchanged, every older token of the
+// family is a reuse.
+type RefreshTokenFamilyEntry struct {
+	AccountId    uint64 `json:"accountId"`
+	CurrentToken string `json:"currentToken"`
+	CreatedAt    int64  `json:"createdAt"`
+	// AuthTime is the unix time the account last authenticated in the
+	// session, zero for families created before it was recorded
+	AuthTime int64 `json:"authTime,omitempty"`
+	// KeyThumbprint binds the refresh tokens of the family to the DPoP key
+	// of the client that signed in
+	KeyThumbprint string `json:"keyThumbprint,omitempty"`
+	// IsRememberMe picks the lifetimes of the session policy on rotation
+	IsRememberMe bool `json:"isRememberMe,omitempty"`
+}
+
+type RefreshTokenFamily interface {
+	Set(ctx context.Context, familyId string, entry RefreshTokenFamilyEntry, ttl time.Duration) error
+	Get(ctx context.Context, familyId string) (entry RefreshTokenFamilyEntry, err error)
+	Del(ctx context.Context, familyId string) error
+}
+
+type refreshTokenFamily struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewRefreshTokenFamily(
+	client Client,
+	logger *zap.Logger,
+) RefreshTokenFamily {
+	return &refreshTokenFamily{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (r *refreshTokenFamily) getFamilyCacheKey(familyId string) string {
+	return fmt.Sprintf("refresh_token_family:%s", familyId)
+}
+
+func (r *refreshTokenFamily) Set(ctx context.Context, familyId string, entry RefreshTokenFamilyEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, r.logger).With(zap.String("family_id", familyId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal refresh token family")
+		return err
+	}
+
+	if err := r.client.Set(ctx, r.getFamilyCacheKey(familyId), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert refresh token family to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (r *refreshTokenFamily) Get(ctx context.Context, familyId string) (RefreshTokenFamilyEntry, error) {
+	logger := log.LoggerWithContext(ctx, r.logger).With(zap.String("family_id", familyId))
+
+	cacheEntry, err := r.client.Get(ctx, r.getFamilyCacheKey(familyId))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get refresh token family from cache")
+		return RefreshTokenFamilyEntry{}, err
+	}
+
+	var entry RefreshTokenFamilyEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse refresh token family from cache")
+		return RefreshTokenFamilyEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (r *refreshTokenFamily) Del(ctx context.Context, familyId string) error {
+	logger := log.LoggerWithContext(ctx, r.logger).With(zap.String("family_id", familyId))
+
+	if err := r.client.Del(ctx, r.getFamilyCacheKey(familyId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del refresh token family from cache")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// SessionEntry describes a sign-in as shown to its owner. The id is shared
+// with the refresh token family of the sign-in.
+type SessionEntry struct {
+	Id              string `json:"id"`
+	AccountId       uint64 `json:"accountId"`
+	UserAgent       string `json:"userAgent"`
+	IpAddress       string `json:"ipAddress"`
+	CreatedAt       int64  `json:"createdAt"`
+	LastRefreshedAt int64  `json:"lastRefreshedAt"`
+	IsRememberMe    bool   `json:"isRememberMe"`
+}
+
+type Session interface {
+	Set(ctx context.Context, entry SessionEntry, ttl time.Duration) error
+	Get(ctx context.Context, sessionId string) (entry SessionEntry, err error)
+	Del(ctx context.Context, accountId uint64, sessionId string) error
+	ListByAccount(ctx context.Context, accountId uint64) ([]SessionEntry, error)
+}
+
+type session struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewSession(
+	client Client,
+	logger *zap.Logger,
+) Session {
+	return &session{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (s *session) getSessionCacheKey(sessionId string) string {
+	return fmt.Sprintf("session:%s", sessionId)
+}
+
+func (s *session) getAccountSessionsCacheKey(accountId uint64) string {
+	return fmt.Sprintf("account_sessions:%d", accountId)
+}
+
+func (s *session) Set(ctx context.Context, entry SessionEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, s.logger).
+		With(zap.String("session_id", entry.Id)).
+		With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal session")
+		return err
+	}
+
+	if err := s.client.Set(ctx, s.getSessionCacheKey(entry.Id), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert session to cache")
+		return err
+	}
+
+	if err := s.client.AddToSet(ctx, s.getAccountSessionsCacheKey(entry.AccountId), entry.Id); err != nil {
+		logger.With(zap.Error(err)).Error("failed to index session by account in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (s *session) Get(ctx context.Context, sessionId string) (SessionEntry, error) {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.String("session_id", sessionId))
+
+	cacheEntry, err := s.client.Get(ctx, s.getSessionCacheKey(sessionId))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get session from cache")
+		return SessionEntry{}, err
+	}
+
+	var entry SessionEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse session from cache")
+		return SessionEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (s *session) Del(ctx context.Context, accountId uint64, sessionId string) error {
+	logger := log.LoggerWithContext(ctx, s.logger).
+		With(zap.String("session_id", sessionId)).
+		With(zap.Uint64("account_id", accountId))
+
+	if err := s.client.Del(ctx, s.getSessionCacheKey(sessionId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del session from cache")
+		return err
+	}
+
+	if err := s.client.RemoveFromSet(ctx, s.getAccountSessionsCacheKey(accountId), sessionId); err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove session from account index in cache")
+		return err
+	}
+
+	return nil
+}
+
+// ListByAccount also drops the ids of sessions that expired on their own
+// from the account index.
+func (s *session) ListByAccount(ctx context.Context, accountId uint64) ([]SessionEntry, error) {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.Uint64("account_id", accountId))
+
+	indexKey := s.getAccountSessionsCacheKey(accountId)
+	sessionIds, err := s.client.GetSetMembers(ctx, indexKey)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get account sessions from cache")
+		return nil, err
+	}
+
+	entries := make([]SessionEntry, 0, len(sessionIds))
+	expired := make([]any, 0)
+	for _, sessionId := range sessionIds {
+		entry, err := s.Get(ctx, sessionId)
+		if errors.Is(err, ErrCacheMiss) {
+			expired = append(expired, sessionId)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(expired) > 0 {
+		if err := s.client.RemoveFromSet(ctx, indexKey, expired...); err != nil {
+			logger.With(zap.Error(err)).Error("failed to prune expired sessions from account index")
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// SignInBlockEntry refuses the sign-ins of a username, of a client IP or
+// the second factor of an account until BlockedUntil, either to slow down
+// guessing or as a lockout.
+type SignInBlockEntry struct {
+	// Kind is "username", "ip" or "account", Value the username, the IP
+	// address or the account id
+	Kind         string `json:"kind"`
+	Value        string `json:"value"`
+	Failures     int64  `json:"failures"`
+	BlockedUntil int64  `json:"blockedUntil"`
+	IsLockout    bool   `json:"isLockout"`
+	CreatedAt    int64  `json:"createdAt"`
+}
+
+// SignInThrottle keeps the failed sign-in counters and the blocks derived
+// from them. Lockouts are indexed so that administrators can list them.
+type SignInThrottle interface {
+	// IncrFailures counts a failed sign-in, the counter expires window after
+	// the last failure.
+	IncrFailures(ctx context.Context, kind string, value string, window time.Duration) (int64, error)
+	ResetFailures(ctx context.Context, kind string, value string) error
+	SetBlock(ctx context.Context, entry SignInBlockEntry, ttl time.Duration) error
+	GetBlock(ctx context.Context, kind string, value string) (entry SignInBlockEntry, err error)
+	DelBlock(ctx context.Context, kind string, value string) error
+	ListLockouts(ctx context.Context) ([]SignInBlockEntry, error)
+}
+
+type signInThrottle struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewSignInThrottle(
+	client Client,
+	logger *zap.Logger,
+) SignInThrottle {
+	return &signInThrottle{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (s *signInThrottle) getSignInFailuresCacheKey(kind string, value string) string {
+	return fmt.Sprintf("sign_in_failures:%s:%s", kind, value)
+}
+
+func (s *signInThrottle) getSignInBlockCacheKey(kind string, value string) string {
+	return fmt.Sprintf("sign_in_block:%s:%s", kind, value)
+}
+
+func (s *signInThrottle) getSignInLockoutsCacheKey() string {
+	return "sign_in_lockouts"
+}
+
+func (s *signInThrottle) IncrFailures(ctx context.Context, kind string, value string, window time.Duration) (int64, error) {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.String("kind", kind))
+
+	failures, err := s.client.Incr(ctx, s.getSignInFailuresCacheKey(kind, value), window)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to increment sign-in failures in cache")
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (s *signInThrottle) ResetFailures(ctx context.Context, kind string, value string) error {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.String("kind", kind))
+
+	if err := s.client.Del(ctx, s.getSignInFailuresCacheKey(kind, value)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del sign-in failures from cache")
+		return err
+	}
+
+	return nil
+}
+
+func (s *signInThrottle) SetBlock(ctx context.Context, entry SignInBlockEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.String("kind", entry.Kind))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal sign-in block")
+		return err
+	}
+
+	if err := s.client.Set(ctx, s.getSignInBlockCacheKey(entry.Kind, entry.Value), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert sign-in block to cache")
+		return err
+	}
+
+	if entry.IsLockout {
+		if err := s.client.AddToSet(ctx, s.getSignInLockoutsCacheKey(), entry.Kind+":"+entry.Value); err != nil {
+			logger.With(zap.Error(err)).Error("failed to add sign-in lockout to index")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *signInThrottle) GetBlock(ctx context.Context, kind string, value string) (SignInBlockEntry, error) {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.String("kind", kind))
+
+	cacheEntry, err := s.client.Get(ctx, s.getSignInBlockCacheKey(kind, value))
+	if err != nil {
+		return SignInBlockEntry{}, err
+	}
+
+	var entry SignInBlockEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse sign-in block from cache")
+		return SignInBlockEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (s *signInThrottle) DelBlock(ctx context.Context, kind string, value string) error {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.String("kind", kind))
+
+	if err := s.client.Del(ctx, s.getSignInBlockCacheKey(kind, value)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del sign-in block from cache")
+		return err
+	}
+
+	if err := s.client.RemoveFromSet(ctx, s.getSignInLockoutsCacheKey(), kind+":"+value); err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove sign-in lockout from index")
+		return err
+	}
+
+	return nil
+}
+
+// ListLockouts also drops the lockouts that expired on their own from the
+// index.
+func (s *signInThrottle) ListLockouts(ctx context.Context) ([]SignInBlockEntry, error) {
+	logger := log.LoggerWithContext(ctx, s.logger)
+
+	indexKey := s.getSignInLockoutsCacheKey()
+	subjects, err := s.client.GetSetMembers(ctx, indexKey)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get sign-in lockouts from cache")
+		return nil, err
+	}
+
+	entries := make([]SignInBlockEntry, 0, len(subjects))
+	expired := make([]any, 0)
+	for _, subject := range subjects {
+		kind, value, _ := strings.Cut(subject, ":")
+		entry, err := s.GetBlock(ctx, kind, value)
+		if errors.Is(err, ErrCacheMiss) || (err == nil && !entry.IsLockout) {
+			expired = append(expired, subject)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(expired) > 0 {
+		if err := s.client.RemoveFromSet(ctx, indexKey, expired...); err != nil {
+			logger.With(zap.Error(err)).Error("failed to prune expired sign-in lockouts from index")
+		}
+	}
+
+	return entries, nil
+}
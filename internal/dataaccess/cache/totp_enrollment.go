@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// TotpEnrollmentEntry is the TOTP second factor of an account. The account
+// service has no field for it, so the gateway keeps it. Unconfirmed entries
+// expire, confirmed ones are stored without TTL.
+type TotpEnrollmentEntry struct {
+	Secret      string `json:"secret"`
+	IsConfirmed bool   `json:"isConfirmed"`
+	// LastUsedStep is the time step of the code that confirmed the
+	// enrollment, codes of the same or an earlier step are replays
+	LastUsedStep int64 `json:"lastUsedStep"`
+	CreatedAt    int64 `json:"createdAt"`
+}
+
+type TotpEnrollment interface {
+	Set(ctx context.Context, accountId uint64, entry TotpEnrollmentEntry, ttl time.Duration) error
+	Get(ctx context.Context, accountId uint64) (entry TotpEnrollmentEntry, err error)
+	Del(ctx context.Context, accountId uint64) error
+	// ConsumeStep tells whether a code of the time step is accepted for the
+	// first time.
+	ConsumeStep(ctx context.Context, accountId uint64, step int64, ttl time.Duration) (bool, error)
+}
+
+type totpEnrollment struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewTotpEnrollment(
+	client Client,
+	logger *zap.Logger,
+) TotpEnrollment {
+	return &totpEnrollment{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (t *totpEnrollment) getTotpEnrollmentCacheKey(accountId uint64) string {
+	return fmt.Sprintf("mfa_totp:%d", accountId)
+}
+
+func (t *totpEnrollment) getTotpStepUsesCacheKey(accountId uint64, step int64) string {
+	return fmt.Sprintf("mfa_totp_step_uses:%d:%d", accountId, step)
+}
+
+func (t *totpEnrollment) Set(ctx context.Context, accountId uint64, entry TotpEnrollmentEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, t.logger).With(zap.Uint64("account_id", accountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal totp enrollment")
+		return err
+	}
+
+	if err := t.client.Set(ctx, t.getTotpEnrollmentCacheKey(accountId), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert totp enrollment to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (t *totpEnrollment) Get(ctx context.Context, accountId uint64) (TotpEnrollmentEntry, error) {
+	logger := log.LoggerWithContext(ctx, t.logger).With(zap.Uint64("account_id", accountId))
+
+	cacheEntry, err := t.client.Get(ctx, t.getTotpEnrollmentCacheKey(accountId))
+	if err != nil {
+		return TotpEnrollmentEntry{}, err
+	}
+
+	var entry TotpEnrollmentEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse totp enrollment from cache")
+		return TotpEnrollmentEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (t *totpEnrollment) Del(ctx context.Context, accountId uint64) error {
+	logger := log.LoggerWithContext(ctx, t.logger).With(zap.Uint64("account_id", accountId))
+
+	if err := t.client.Del(ctx, t.getTotpEnrollmentCacheKey(accountId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del totp enrollment from cache")
+		return err
+	}
+
+	return nil
+}
+
+func (t *totpEnrollment) ConsumeStep(ctx context.Context, accountId uint64, step int64, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, t.logger).With(zap.Uint64("account_id", accountId))
+
+	isFirstUse, err := consume(ctx, t.client, t.getTotpStepUsesCacheKey(accountId, step), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark totp step as used in cache")
+		return false, err
+	}
+
+	return isFirstUse, nil
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// WebAuthnCredentialEntry is a passkey registered to an account. The id is
+// the base64url encoded credential id, Credential the record kept by the
+// WebAuthn library to verify assertions.
+type WebAuthnCredentialEntry struct {
+	Id         string          `json:"id"`
+	AccountId  uint64          `json:"accountId"`
+	Credential json.RawMessage `json:"credential"`
+	CreatedAt  int64           `json:"createdAt"`
+	LastUsedAt int64           `json:"lastUsedAt"`
+}
+
+type WebAuthnCredential interface {
+	Set(ctx context.Context, entry WebAuthnCredentialEntry) error
+	Get(ctx context.Context, credentialId string) (entry WebAuthnCredentialEntry, err error)
+	Del(ctx context.Context, accountId uint64, credentialId string) error
+	ListByAccount(ctx context.Context, accountId uint64) ([]WebAuthnCredentialEntry, error)
+	// Lock reserves the credential for one assertion at a time, so that the
+	// sign counter is checked and stored without a concurrent use in between.
+	// It reports false while another assertion holds the credential.
+	Lock(ctx context.Context, credentialId string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, credentialId string) error
+}
+
+type webAuthnCredential struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewWebAuthnCredential(
+	client Client,
+	logger *zap.Logger,
+) WebAuthnCredential {
+	return &webAuthnCredential{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (w *webAuthnCredential) getWebAuthnCredentialCacheKey(credentialId string) string {
+	return fmt.Sprintf("webauthn_credential:%s", credentialId)
+}
+
+func (w *webAuthnCredential) getAccountWebAuthnCredentialsCacheKey(accountId uint64) string {
+	return fmt.Sprintf("account_webauthn_credentials:%d", accountId)
+}
+
+func (w *webAuthnCredential) getWebAuthnCredentialLockCacheKey(credentialId string) string {
+	return fmt.Sprintf("webauthn_credential_lock:%s", credentialId)
+}
+
+// Set stores the credential without expiry, passkeys live until removed.
+func (w *webAuthnCredential) Set(ctx context.Context, entry WebAuthnCredentialEntry) error {
+	logger := log.LoggerWithContext(ctx, w.logger).
+		With(zap.String("credential_id", entry.Id)).
+		With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal webauthn credential")
+		return err
+	}
+
+	if err := w.client.Set(ctx, w.getWebAuthnCredentialCacheKey(entry.Id), string(data), 0); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert webauthn credential to cache")
+		return err
+	}
+
+	if err := w.client.AddToSet(ctx, w.getAccountWebAuthnCredentialsCacheKey(entry.AccountId), entry.Id); err != nil {
+		logger.With(zap.Error(err)).Error("failed to index webauthn credential by account in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (w *webAuthnCredential) Get(ctx context.Context, credentialId string) (WebAuthnCredentialEntry, error) {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.String("credential_id", credentialId))
+
+	cacheEntry, err := w.client.Get(ctx, w.getWebAuthnCredentialCacheKey(credentialId))
+	if err != nil {
+		return WebAuthnCredentialEntry{}, err
+	}
+
+	var entry WebAuthnCredentialEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse webauthn credential from cache")
+		return WebAuthnCredentialEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (w *webAuthnCredential) Del(ctx context.Context, accountId uint64, credentialId string) error {
+	logger := log.LoggerWithContext(ctx, w.logger).
+		With(zap.String("credential_id", credentialId)).
+		With(zap.Uint64("account_id", accountId))
+
+	if err := w.client.Del(ctx, w.getWebAuthnCredentialCacheKey(credentialId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del webauthn credential from cache")
+		return err
+	}
+
+	if err := w.client.RemoveFromSet(ctx, w.getAccountWebAuthnCredentialsCacheKey(accountId), credentialId); err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove webauthn credential from account index in cache")
+		return err
+	}
+
+	return nil
+}
+
+func (w *webAuthnCredential) ListByAccount(ctx context.Context, accountId uint64) ([]WebAuthnCredentialEntry, error) {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.Uint64("account_id", accountId))
+
+	credentialIds, err := w.client.GetSetMembers(ctx, w.getAccountWebAuthnCredentialsCacheKey(accountId))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get account webauthn credentials from cache")
+		return nil, err
+	}
+
+	entries := make([]WebAuthnCredentialEntry, 0, len(credentialIds))
+	for _, credentialId := range credentialIds {
+		entry, err := w.Get(ctx, credentialId)
+		if errors.Is(err, ErrCacheMiss) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (w *webAuthnCredential) Lock(ctx context.Context, credentialId string, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.String("credential_id", credentialId))
+
+	isLocked, err := w.client.SetIfAbsent(ctx, w.getWebAuthnCredentialLockCacheKey(credentialId), 1, ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to lock webauthn credential in cache")
+		return false, err
+	}
+
+	return isLocked, nil
+}
+
+func (w *webAuthnCredential) Unlock(ctx context.Context, credentialId string) error {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.String("credential_id", credentialId))
+
+	if err := w.client.Del(ctx, w.getWebAuthnCredentialLockCacheKey(credentialId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to unlock webauthn credential in cache")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// WebAuthnSessionEntry is the state of a registration or login ceremony
+// between its begin and finish calls. AccountId is zero for logins, where
+// the account is only known from the passkey.
+type WebAuthnSessionEntry struct {
+	AccountId   uint64          `json:"accountId"`
+	SessionData json.RawMessage `json:"sessionData"`
+}
+
+type WebAuthnSession interface {
+	Set(ctx context.Context, sessionId string, entry WebAuthnSessionEntry, ttl time.Duration) error
+	Get(ctx context.Context, sessionId string) (entry WebAuthnSessionEntry, err error)
+	// Consume marks the session as answered and reports whether this was
+	// the first answer, concurrent finish calls see false.
+	Consume(ctx context.Context, sessionId string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, sessionId string) error
+}
+
+type webAuthnSession struct {
+	client Client
+	logger *zap.Logger
+}
+
+func NewWebAuthnSession(
+	client Client,
+	logger *zap.Logger,
+) WebAuthnSession {
+	return &webAuthnSession{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (w *webAuthnSession) getWebAuthnSessionCacheKey(sessionId string) string {
+	return fmt.Sprintf("webauthn_session:%s", sessionId)
+}
+
+func (w *webAuthnSession) getWebAuthnSessionUsesCacheKey(sessionId string) string {
+	return fmt.Sprintf("webauthn_session_uses:%s", sessionId)
+}
+
+func (w *webAuthnSession) Set(ctx context.Context, sessionId string, entry WebAuthnSessionEntry, ttl time.Duration) error {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.Uint64("account_id", entry.AccountId))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal webauthn session")
+		return err
+	}
+
+	if err := w.client.Set(ctx, w.getWebAuthnSessionCacheKey(sessionId), string(data), ttl); err != nil {
+		logger.With(zap.Error(err)).Error("failed to insert webauthn session to cache")
+		return err
+	}
+
+	return nil
+}
+
+func (w *webAuthnSession) Get(ctx context.Context, sessionId string) (WebAuthnSessionEntry, error) {
+	logger := log.LoggerWithContext(ctx, w.logger)
+
+	cacheEntry, err := w.client.Get(ctx, w.getWebAuthnSessionCacheKey(sessionId))
+	if err != nil {
+		return WebAuthnSessionEntry{}, err
+	}
+
+	var entry WebAuthnSessionEntry
+	if err := unmarshalCacheEntry(cacheEntry, &entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse webauthn session from cache")
+		return WebAuthnSessionEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (w *webAuthnSession) Consume(ctx context.Context, sessionId string, ttl time.Duration) (bool, error) {
+	logger := log.LoggerWithContext(ctx, w.logger)
+
+	isFirstUse, err := consume(ctx, w.client, w.getWebAuthnSessionUsesCacheKey(sessionId), ttl)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to mark webauthn session as used in cache")
+		return false, err
+	}
+
+	return isFirstUse, nil
+}
+
+func (w *webAuthnSession) Del(ctx context.Context, sessionId string) error {
+	logger := log.LoggerWithContext(ctx, w.logger)
+
+	if err := w.client.Del(ctx, w.getWebAuthnSessionCacheKey(sessionId)); err != nil {
+		logger.With(zap.Error(err)).Error("failed to del webauthn session from cache")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package idp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// maxResponseSize bounds the documents read from a provider
+	maxResponseSize = 1 << 20
+)
+
+// Metadata is the part of the discovery document of a provider the gateway
+// relies on.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+}
+
+// JSONWebKey is a public key of a provider as described by RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// TokenError is an error answered by the token endpoint of a provider, as
+// in RFC 6749 section 5.2.
+type TokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *TokenError) Error() string {
+	if e.Description == "" {
+		return "identity provider refused the token request: " + e.Code
+	}
+	return fmt.Sprintf("identity provider refused the token request: %s: %s", e.Code, e.Description)
+}
+
+// Client talks to upstream OpenID Connect providers.
+type Client interface {
+	// GetMetadata reads the discovery document under the issuer URL.
+	GetMetadata(ctx context.Context, issuer string) (Metadata, error)
+	// ExchangeCode calls the token endpoint, authenticating with HTTP basic
+	// when there is a client secret. Errors of the provider are *TokenError.
+	ExchangeCode(ctx context.Context, tokenEndpoint string, clientId string, clientSecret string, params url.Values) (TokenResponse, error)
+	GetKeySet(ctx context.Context, jwksUri string) (JSONWebKeySet, error)
+}
+
+type client struct {
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+func NewClient(
+	logger *zap.Logger,
+) Client {
+	return &client{
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		logger:     logger,
+	}
+}
+
+func (c *client) GetMetadata(ctx context.Context, issuer string) (Metadata, error) {
+	logger := log.LoggerWithContext(ctx, c.logger).With(zap.String("issuer", issuer))
+
+	var metadata Metadata
+	discoveryUrl := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, discoveryUrl, &metadata); err != nil {
+		logger.With(zap.Error(err)).Error("failed to get identity provider metadata")
+		return Metadata{}, err
+	}
+
+	return metadata, nil
+}
+
+func (c *client) ExchangeCode(
+	ctx context.Context,
+	tokenEndpoint string,
+	clientId string,
+	clientSecret string,
+	params url.Values,
+) (TokenResponse, error) {
+	logger := log.LoggerWithContext(ctx, c.logger).With(zap.String("token_endpoint", tokenEndpoint))
+
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+	if clientSecret == "" {
+		form.Set("client_id", clientId)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		// RFC 6749 section 2.3.1 encodes the credentials before HTTP basic
+		req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to call identity provider token endpoint")
+		return TokenResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to read identity provider token response")
+		return TokenResponse{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		tokenErr := &TokenError{}
+		if err := json.Unmarshal(body, tokenErr); err != nil || tokenErr.Code == "" {
+			return TokenResponse{}, fmt.Errorf("identity provider token endpoint answered %d", resp.StatusCode)
+		}
+		return TokenResponse{}, tokenErr
+	}
+
+	var tokens TokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse identity provider token response")
+		return TokenResponse{}, err
+	}
+
+	return tokens, nil
+}
+
+func (c *client) GetKeySet(ctx context.Context, jwksUri string) (JSONWebKeySet, error) {
+	logger := log.LoggerWithContext(ctx, c.logger).With(zap.String("jwks_uri", jwksUri))
+
+	var keySet JSONWebKeySet
+	if err := c.getJSON(ctx, jwksUri, &keySet); err != nil {
+		logger.With(zap.Error(err)).Error("failed to get identity provider keys")
+		return JSONWebKeySet{}, err
+	}
+
+	return keySet, nil
+}
+
+func (c *client) getJSON(ctx context.Context, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", target, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,12 @@
+package mail
+
+import (
+	"go.uber.org/fx"
+)
+
+var Module = fx.Module(
+	"mail",
+	fx.Provide(
+		NewSender,
+	),
+)
@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/log"
+	"go.uber.org/zap"
+)
+
+// OutboxEntry is a mail as written to an outbox, one JSON document per line.
+type OutboxEntry struct {
+	From string `json:"from"`
+	Message
+	SentAt int64 `json:"sentAt"`
+}
+
+// outboxSender writes the mails instead of delivering them. openWriter is
+// called once per mail so that a file outbox survives being rotated.
+type outboxSender struct {
+	from       string
+	openWriter func() (io.WriteCloser, error)
+	mutex      *sync.Mutex
+	logger     *zap.Logger
+}
+
+func NewStdoutSender(
+	from string,
+	logger *zap.Logger,
+) Sender {
+	return &outboxSender{
+		from: from,
+		openWriter: func() (io.WriteCloser, error) {
+			return nopCloser{os.Stdout}, nil
+		},
+		mutex:  new(sync.Mutex),
+		logger: logger,
+	}
+}
+
+func NewFileSender(
+	from string,
+	path string,
+	logger *zap.Logger,
+) Sender {
+	return &outboxSender{
+		from: from,
+		openWriter: func() (io.WriteCloser, error) {
+			return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		},
+		mutex:  new(sync.Mutex),
+		logger: logger,
+	}
+}
+
+func (o *outboxSender) Send(ctx context.Context, message Message) error {
+	logger := log.LoggerWithContext(ctx, o.logger)
+
+	data, err := json.Marshal(OutboxEntry{
+		From:    o.from,
+		Message: message,
+		SentAt:  time.Now().Unix(),
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal mail")
+		return err
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	writer, err := o.openWriter()
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to open mail outbox")
+		return err
+	}
+	defer writer.Close()
+
+	if _, err := writer.Write(append(data, '\n')); err != nil {
+		logger.With(zap.Error(err)).Error("failed to write mail to outbox")
+		return err
+	}
+
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"go.uber.org/zap"
+)
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Sender delivers mails to the accounts. Implementations must be safe for
+// concurrent use.
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+func NewSender(
+	config configs.Mail,
+	logger *zap.Logger,
+) (Sender, error) {
+	switch config.Type {
+	case configs.MailTypeStdout:
+		return NewStdoutSender(config.From, logger), nil
+	case configs.MailTypeFile:
+		if config.OutboxFile == "" {
+			return nil, fmt.Errorf("outboxFile is required by the %s mail type", config.Type)
+		}
+		return NewFileSender(config.From, config.OutboxFile, logger), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail type: %s", config.Type)
+	}
+}
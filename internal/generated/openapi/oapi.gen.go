@@ -4,12 +4,36 @@
 package oapi
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/oapi-codegen/runtime"
 )
 
 const (
+	CsrfTokenScopes          = "CsrfToken.Scopes"
 	RefreshTokenCookieScopes = "RefreshTokenCookie.Scopes"
 	BearerAuthScopes         = "bearerAuth.Scopes"
+	ClientBasicAuthScopes    = "clientBasicAuth.Scopes"
+)
+
+// Defines values for AccessTokenResponseTokenType.
+const (
+	Bearer AccessTokenResponseTokenType = "Bearer"
+	DPoP   AccessTokenResponseTokenType = "DPoP"
+)
+
+// Defines values for CreateInviteCodeRequestRole.
+const (
+	CreateInviteCodeRequestRoleAdmin  CreateInviteCodeRequestRole = "admin"
+	CreateInviteCodeRequestRoleMember CreateInviteCodeRequestRole = "member"
+)
+
+// Defines values for InviteCodeRole.
+const (
+	InviteCodeRoleAdmin  InviteCodeRole = "admin"
+	InviteCodeRoleMember InviteCodeRole = "member"
 )
 
 // Defines values for Role.
@@ -26,8 +50,14 @@ type AccessTokenResponse struct {
 
 	// Token JWT access token (store in memory; avoid localStorage if possible)
 	Token string `json:"token"`
+
+	// TokenType DPoP when the request carried a DPoP proof (RFC 9449), the token is then bound to the proof key and has to be sent with the DPoP scheme and a new proof on every request.
+	TokenType *AccessTokenResponseTokenType `json:"tokenType,omitempty"`
 }
 
+// AccessTokenResponseTokenType DPoP when the request carried a DPoP proof (RFC 9449), the token is then bound to the proof key and has to be sent with the DPoP scheme and a new proof on every request.
+type AccessTokenResponseTokenType string
+
 // Account defines model for Account.
 type Account struct {
 	Email    Email    `json:"email"`
@@ -39,6 +69,50 @@ type Account struct {
 	Username    Username     `json:"username"`
 }
 
+// ChangePasswordRequest defines model for ChangePasswordRequest.
+type ChangePasswordRequest struct {
+	// Password Checked against the password policy of the server, by default 8-72 characters including at least one uppercase, one lowercase, one digit, and one special character; no whitespace. Common and breached passwords and passwords resembling the username or email are refused.
+	Password *Password `json:"password,omitempty"`
+}
+
+// CreateInviteCodeRequest defines model for CreateInviteCodeRequest.
+type CreateInviteCodeRequest struct {
+	// ExpiresAt Unix time of the expiry, omit for the configured lifetime
+	ExpiresAt *int64 `json:"expiresAt,omitempty"`
+
+	// MaxUses Sign-ups the code allows, 1 when omitted
+	MaxUses *int64 `json:"maxUses,omitempty"`
+
+	// Role Role of the accounts signed up with the code, member when omitted
+	Role *CreateInviteCodeRequestRole `json:"role,omitempty"`
+}
+
+// CreateInviteCodeRequestRole Role of the accounts signed up with the code, member when omitted
+type CreateInviteCodeRequestRole string
+
+// CreatePersonalAccessTokenRequest defines model for CreatePersonalAccessTokenRequest.
+type CreatePersonalAccessTokenRequest struct {
+	// ExpiresAt Unix time of the expiry, omit for a token that never expires
+	ExpiresAt *int64   `json:"expiresAt,omitempty"`
+	Name      string   `json:"name"`
+	Scopes    *[]Scope `json:"scopes,omitempty"`
+}
+
+// CreatedInviteCodeResponse defines model for CreatedInviteCodeResponse.
+type CreatedInviteCodeResponse struct {
+	// Code The code to hand out, it is not shown again.
+	Code       string     `json:"code"`
+	InviteCode InviteCode `json:"inviteCode"`
+}
+
+// CreatedPersonalAccessTokenResponse defines model for CreatedPersonalAccessTokenResponse.
+type CreatedPersonalAccessTokenResponse struct {
+	PersonalAccessToken PersonalAccessToken `json:"personalAccessToken"`
+
+	// Token The token to send as bearer token, it is not shown again.
+	Token string `json:"token"`
+}
+
 // Email defines model for Email.
 type Email = string
 
@@ -49,32 +123,385 @@ type ErrorResponse struct {
 	Message string                  `json:"message"`
 }
 
+// FederatedLoginCallbackRequest defines model for FederatedLoginCallbackRequest.
+type FederatedLoginCallbackRequest struct {
+	// Code The authorization code returned by the provider
+	Code string `json:"code"`
+
+	// State The state returned by the provider
+	State string `json:"state"`
+}
+
+// FederatedProvider defines model for FederatedProvider.
+type FederatedProvider struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// FederatedProvidersResponse defines model for FederatedProvidersResponse.
+type FederatedProvidersResponse struct {
+	Providers []FederatedProvider `json:"providers"`
+}
+
+// ForgotPasswordRequest defines model for ForgotPasswordRequest.
+type ForgotPasswordRequest struct {
+	Email Email `json:"email"`
+}
+
 // Fullname defines model for Fullname.
 type Fullname = string
 
-// Password 8-72 characters, including at least one uppercase, one lowercase, one digit, and one special character; no whitespace.
+// InviteCode defines model for InviteCode.
+type InviteCode struct {
+	// CreatedAt Unix time of the creation
+	CreatedAt int64 `json:"createdAt"`
+
+	// CreatedBy Account id of the administrator who minted the code
+	CreatedBy uint64 `json:"createdBy"`
+
+	// ExpiresAt Unix time of the expiry
+	ExpiresAt int64  `json:"expiresAt"`
+	Id        string `json:"id"`
+	MaxUses   int64  `json:"maxUses"`
+
+	// Role Role of the accounts signed up with the code
+	Role InviteCodeRole `json:"role"`
+	Uses int64          `json:"uses"`
+}
+
+// InviteCodeRole Role of the accounts signed up with the code
+type InviteCodeRole string
+
+// InviteCodesResponse defines model for InviteCodesResponse.
+type InviteCodesResponse struct {
+	InviteCodes []InviteCode `json:"inviteCodes"`
+}
+
+// JsonWebKey defines model for JsonWebKey.
+type JsonWebKey struct {
+	// Alg One of RS256, ES256 or EdDSA
+	Alg *string `json:"alg,omitempty"`
+	Crv *string `json:"crv,omitempty"`
+
+	// E RSA public exponent (base64url)
+	E *string `json:"e,omitempty"`
+
+	// Kid RFC 7638 thumbprint of the key
+	Kid string `json:"kid"`
+
+	// Kty One of RSA, EC or OKP
+	Kty string `json:"kty"`
+
+	// N RSA modulus (base64url)
+	N   *string `json:"n,omitempty"`
+	Use *string `json:"use,omitempty"`
+
+	// X Curve point x coordinate (base64url)
+	X *string `json:"x,omitempty"`
+
+	// Y Curve point y coordinate (base64url)
+	Y *string `json:"y,omitempty"`
+}
+
+// JsonWebKeySet defines model for JsonWebKeySet.
+type JsonWebKeySet struct {
+	Keys []JsonWebKey `json:"keys"`
+}
+
+// MagicLinkConsumeRequest defines model for MagicLinkConsumeRequest.
+type MagicLinkConsumeRequest struct {
+	// Token The token of the sign-in link
+	Token string `json:"token"`
+}
+
+// MagicLinkRequest defines model for MagicLinkRequest.
+type MagicLinkRequest struct {
+	Email Email `json:"email"`
+
+	// IsRememberMe If true, server may issue longer refresh token lifetime.
+	IsRememberMe *bool `json:"isRememberMe,omitempty"`
+}
+
+// MfaChallengeResponse defines model for MfaChallengeResponse.
+type MfaChallengeResponse struct {
+	// Exp Unix timestamp when the challenge expires
+	Exp int64 `json:"exp"`
+
+	// MfaToken Opaque single-use challenge of the sign-in
+	MfaToken string `json:"mfaToken"`
+}
+
+// MfaStatusResponse defines model for MfaStatusResponse.
+type MfaStatusResponse struct {
+	TotpEnabled bool `json:"totpEnabled"`
+}
+
+// OAuthError defines model for OAuthError.
+type OAuthError struct {
+	// Error Error code of RFC 6749 section 5.2
+	Error            string  `json:"error"`
+	ErrorDescription *string `json:"error_description,omitempty"`
+}
+
+// OAuthIntrospectionResponse defines model for OAuthIntrospectionResponse.
+type OAuthIntrospectionResponse struct {
+	Active bool `json:"active"`
+
+	// Aud The services an access token is meant for
+	Aud *[]string `json:"aud,omitempty"`
+
+	// ClientId The client a service token was issued to
+	ClientId *string `json:"client_id,omitempty"`
+	Exp      *int64  `json:"exp,omitempty"`
+	Iat      *int64  `json:"iat,omitempty"`
+	Jti      *string `json:"jti,omitempty"`
+
+	// Scope Space separated scopes of restricted tokens
+	Scope *string `json:"scope,omitempty"`
+
+	// Sub The account id, or the client id of service tokens
+	Sub *string `json:"sub,omitempty"`
+
+	// TokenType access_token or refresh_token
+	TokenType *string `json:"token_type,omitempty"`
+}
+
+// OAuthTokenActionRequest defines model for OAuthTokenActionRequest.
+type OAuthTokenActionRequest struct {
+	ClientId     *string `json:"client_id,omitempty"`
+	ClientSecret *string `json:"client_secret,omitempty"`
+	Token        string  `json:"token"`
+
+	// TokenTypeHint access_token or refresh_token, ignored since the kind is detected
+	TokenTypeHint *string `json:"token_type_hint,omitempty"`
+}
+
+// OAuthTokenRequest defines model for OAuthTokenRequest.
+type OAuthTokenRequest struct {
+	// Audience Space separated services the token is meant for, for the client_credentials grant. The token is meant for the gateway when omitted.
+	Audience     *string `json:"audience,omitempty"`
+	ClientId     *string `json:"client_id,omitempty"`
+	ClientSecret *string `json:"client_secret,omitempty"`
+
+	// Code The authorization code, for the authorization_code grant
+	Code *string `json:"code,omitempty"`
+
+	// CodeVerifier The PKCE code verifier, for the authorization_code grant
+	CodeVerifier *string `json:"code_verifier,omitempty"`
+	GrantType    string  `json:"grant_type"`
+
+	// RedirectUri The redirect_uri of the authorization request, for the authorization_code grant
+	RedirectUri *string `json:"redirect_uri,omitempty"`
+
+	// RefreshToken The refresh token, for the refresh_token grant
+	RefreshToken *string `json:"refresh_token,omitempty"`
+
+	// RequestedSubject Id of the account to impersonate, for the token exchange grant
+	RequestedSubject *string `json:"requested_subject,omitempty"`
+
+	// RequestedTokenType Only urn:ietf:params:oauth:token-type:access_token may be requested
+	RequestedTokenType *string `json:"requested_token_type,omitempty"`
+
+	// Scope Space separated scopes, every scope of the client when omitted
+	Scope *string `json:"scope,omitempty"`
+
+	// SubjectToken The access token of the administrator, for the token exchange grant
+	SubjectToken *string `json:"subject_token,omitempty"`
+
+	// SubjectTokenType Must be urn:ietf:params:oauth:token-type:access_token, for the token exchange grant
+	SubjectTokenType *string `json:"subject_token_type,omitempty"`
+}
+
+// OAuthTokenResponse defines model for OAuthTokenResponse.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+
+	// ExpiresIn Lifetime of the access token in seconds
+	ExpiresIn int64 `json:"expires_in"`
+
+	// IdToken Issued for authorization codes only
+	IdToken *string `json:"id_token,omitempty"`
+
+	// IssuedTokenType Returned by the token exchange grant only
+	IssuedTokenType *string `json:"issued_token_type,omitempty"`
+
+	// RefreshToken Issued to OpenID Connect clients only
+	RefreshToken *string `json:"refresh_token,omitempty"`
+	Scope        *string `json:"scope,omitempty"`
+	TokenType    string  `json:"token_type"`
+}
+
+// OidcAuthorizationRequest defines model for OidcAuthorizationRequest.
+type OidcAuthorizationRequest struct {
+	ClientId            string  `json:"client_id"`
+	CodeChallenge       string  `json:"code_challenge"`
+	CodeChallengeMethod string  `json:"code_challenge_method"`
+	Nonce               *string `json:"nonce,omitempty"`
+	RedirectUri         string  `json:"redirect_uri"`
+	ResponseType        string  `json:"response_type"`
+	Scope               string  `json:"scope"`
+	State               *string `json:"state,omitempty"`
+}
+
+// OidcAuthorizationResponse defines model for OidcAuthorizationResponse.
+type OidcAuthorizationResponse struct {
+	// RedirectUri The redirect_uri carrying the code or the error, and the state
+	RedirectUri string `json:"redirectUri"`
+}
+
+// OidcUserInfo defines model for OidcUserInfo.
+type OidcUserInfo struct {
+	Email             *string `json:"email,omitempty"`
+	Name              *string `json:"name,omitempty"`
+	PhoneNumber       *string `json:"phone_number,omitempty"`
+	PreferredUsername *string `json:"preferred_username,omitempty"`
+
+	// Sub The account id
+	Sub string `json:"sub"`
+}
+
+// OpenIdConfiguration defines model for OpenIdConfiguration.
+type OpenIdConfiguration struct {
+	AuthorizationEndpoint             string    `json:"authorization_endpoint"`
+	ClaimsSupported                   *[]string `json:"claims_supported,omitempty"`
+	CodeChallengeMethodsSupported     *[]string `json:"code_challenge_methods_supported,omitempty"`
+	GrantTypesSupported               *[]string `json:"grant_types_supported,omitempty"`
+	IdTokenSigningAlgValuesSupported  []string  `json:"id_token_signing_alg_values_supported"`
+	Issuer                            string    `json:"issuer"`
+	JwksUri                           string    `json:"jwks_uri"`
+	ResponseTypesSupported            []string  `json:"response_types_supported"`
+	ScopesSupported                   *[]string `json:"scopes_supported,omitempty"`
+	SubjectTypesSupported             []string  `json:"subject_types_supported"`
+	TokenEndpoint                     string    `json:"token_endpoint"`
+	TokenEndpointAuthMethodsSupported *[]string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	UserinfoEndpoint                  string    `json:"userinfo_endpoint"`
+}
+
+// Password Checked against the password policy of the server, by default 8-72 characters including at least one uppercase, one lowercase, one digit, and one special character; no whitespace. Common and breached passwords and passwords resembling the username or email are refused.
 type Password = string
 
+// PersonalAccessToken defines model for PersonalAccessToken.
+type PersonalAccessToken struct {
+	// CreatedAt Unix time of the creation
+	CreatedAt int64 `json:"createdAt"`
+
+	// ExpiresAt Unix time of the expiry, absent for tokens that never expire
+	ExpiresAt *int64 `json:"expiresAt,omitempty"`
+	Id        string `json:"id"`
+
+	// LastUsedAt Unix time of the last use, to the minute, absent if never used
+	LastUsedAt *int64  `json:"lastUsedAt,omitempty"`
+	Name       string  `json:"name"`
+	Scopes     []Scope `json:"scopes"`
+}
+
+// PersonalAccessTokensResponse defines model for PersonalAccessTokensResponse.
+type PersonalAccessTokensResponse struct {
+	Tokens []PersonalAccessToken `json:"tokens"`
+}
+
 // PhoneNumber Abide by the E.164 standard
 type PhoneNumber struct {
 	CountryCode *string `json:"countryCode,omitempty"`
 	Number      *string `json:"number,omitempty"`
 }
 
+// ReauthenticateRequest The password, or the TOTP code instead when TOTP is enabled
+type ReauthenticateRequest struct {
+	Code *TotpCode `json:"code,omitempty"`
+
+	// Password Checked against the password policy of the server, by default 8-72 characters including at least one uppercase, one lowercase, one digit, and one special character; no whitespace. Common and breached passwords and passwords resembling the username or email are refused.
+	Password *Password `json:"password,omitempty"`
+}
+
 // RefreshResponse defines model for RefreshResponse.
 type RefreshResponse struct {
 	AccessToken AccessTokenResponse `json:"accessToken"`
 }
 
+// ResendEmailVerificationRequest defines model for ResendEmailVerificationRequest.
+type ResendEmailVerificationRequest struct {
+	Email Email `json:"email"`
+}
+
+// ResetPasswordRequest defines model for ResetPasswordRequest.
+type ResetPasswordRequest struct {
+	// Password Checked against the password policy of the server, by default 8-72 characters including at least one uppercase, one lowercase, one digit, and one special character; no whitespace. Common and breached passwords and passwords resembling the username or email are refused.
+	Password *Password `json:"password,omitempty"`
+
+	// Token The token of the reset link
+	Token string `json:"token"`
+}
+
 // Role defines model for Role.
 type Role string
 
+// Scope Personal access tokens, service tokens and the tokens of OIDC clients only
+// reach the gateway routes of the scopes they hold, tokens of a sign-in reach
+// every route. The gateway routes need:
+//   - account:read for GET /users/me and GET /users/me/mfa
+//   - account:write for the routes that change how the account signs in
+//   - sessions:read to list the sessions and personal access tokens
+//   - sessions:write to revoke them and to sign out everywhere
+//   - admin for the /admin routes, along with the ADMIN role
+//   - openid for /oauth/userinfo
+//
+// Other scopes are passed on to the Fiagram services.
+type Scope = string
+
+// Session defines model for Session.
+type Session struct {
+	// CreatedAt Unix time of the sign-in
+	CreatedAt int64  `json:"createdAt"`
+	Id        string `json:"id"`
+	IpAddress string `json:"ipAddress"`
+
+	// IsCurrent Whether the calling access token belongs to this session
+	IsCurrent    bool `json:"isCurrent"`
+	IsRememberMe bool `json:"isRememberMe"`
+
+	// LastRefreshedAt Unix time of the last refresh token rotation
+	LastRefreshedAt int64  `json:"lastRefreshedAt"`
+	UserAgent       string `json:"userAgent"`
+}
+
+// SessionsResponse defines model for SessionsResponse.
+type SessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+// SignInLockout defines model for SignInLockout.
+type SignInLockout struct {
+	CreatedAt int64 `json:"createdAt"`
+
+	// Failures Failed sign-ins that caused the lockout
+	Failures int64 `json:"failures"`
+
+	// Kind username, ip or account
+	Kind string `json:"kind"`
+
+	// LockedUntil Unix time the lockout ends
+	LockedUntil int64  `json:"lockedUntil"`
+	Value       string `json:"value"`
+}
+
+// SignInLockoutsResponse defines model for SignInLockoutsResponse.
+type SignInLockoutsResponse struct {
+	Lockouts []SignInLockout `json:"lockouts"`
+}
+
+// SigninMfaRequest defines model for SigninMfaRequest.
+type SigninMfaRequest struct {
+	Code     TotpCode `json:"code"`
+	MfaToken string   `json:"mfaToken"`
+}
+
 // SigninRequest defines model for SigninRequest.
 type SigninRequest struct {
 	// IsRememberMe If true, server may issue longer refresh token lifetime.
 	IsRememberMe *bool `json:"isRememberMe,omitempty"`
 
-	// Password 8-72 characters, including at least one uppercase, one lowercase, one digit, and one special character; no whitespace.
+	// Password Checked against the password policy of the server, by default 8-72 characters including at least one uppercase, one lowercase, one digit, and one special character; no whitespace. Common and breached passwords and passwords resembling the username or email are refused.
 	Password *Password `json:"password,omitempty"`
 	Username Username  `json:"username"`
 }
@@ -88,7 +515,10 @@ type SigninResponse struct {
 type SignupRequest struct {
 	Account Account `json:"account"`
 
-	// Password 8-72 characters, including at least one uppercase, one lowercase, one digit, and one special character; no whitespace.
+	// InviteCode Required while the registration is invite-only
+	InviteCode *string `json:"inviteCode,omitempty"`
+
+	// Password Checked against the password policy of the server, by default 8-72 characters including at least one uppercase, one lowercase, one digit, and one special character; no whitespace. Common and breached passwords and passwords resembling the username or email are refused.
 	Password *Password `json:"password,omitempty"`
 }
 
@@ -97,6 +527,23 @@ type SignupResponse struct {
 	AccessToken AccessTokenResponse `json:"accessToken"`
 }
 
+// TotpCode defines model for TotpCode.
+type TotpCode = string
+
+// TotpCodeRequest defines model for TotpCodeRequest.
+type TotpCodeRequest struct {
+	Code TotpCode `json:"code"`
+}
+
+// TotpEnrollmentResponse defines model for TotpEnrollmentResponse.
+type TotpEnrollmentResponse struct {
+	// ProvisioningUri otpauth URI to render as QR code
+	ProvisioningUri string `json:"provisioningUri"`
+
+	// Secret Base32 encoded secret for manual entry
+	Secret string `json:"secret"`
+}
+
 // Username defines model for Username.
 type Username = string
 
@@ -105,6 +552,36 @@ type UsersMeResponse struct {
 	Account Account `json:"account"`
 }
 
+// VerifyEmailRequest defines model for VerifyEmailRequest.
+type VerifyEmailRequest struct {
+	// Token The token of the verification link
+	Token string `json:"token"`
+}
+
+// WebAuthnCeremonyResponse defines model for WebAuthnCeremonyResponse.
+type WebAuthnCeremonyResponse struct {
+	// Options PublicKeyCredentialCreationOptions or PublicKeyCredentialRequestOptions wrapped in `publicKey`.
+	Options map[string]interface{} `json:"options"`
+
+	// SessionId Id of the ceremony, to send back with the credential.
+	SessionId string `json:"sessionId"`
+}
+
+// WebAuthnFinishRequest defines model for WebAuthnFinishRequest.
+type WebAuthnFinishRequest struct {
+	// Credential The PublicKeyCredential returned by the browser, serialized as JSON.
+	Credential map[string]interface{} `json:"credential"`
+	SessionId  string                 `json:"sessionId"`
+}
+
+// WebAuthnLoginFinishRequest defines model for WebAuthnLoginFinishRequest.
+type WebAuthnLoginFinishRequest struct {
+	// Credential The PublicKeyCredential returned by the browser, serialized as JSON.
+	Credential   map[string]interface{} `json:"credential"`
+	IsRememberMe *bool                  `json:"isRememberMe,omitempty"`
+	SessionId    string                 `json:"sessionId"`
+}
+
 // BadRequest defines model for BadRequest.
 type BadRequest = ErrorResponse
 
@@ -114,26 +591,167 @@ type Forbidden = ErrorResponse
 // InternalServerError defines model for InternalServerError.
 type InternalServerError = ErrorResponse
 
+// InvalidPassword defines model for InvalidPassword.
+type InvalidPassword = ErrorResponse
+
 // NotFound defines model for NotFound.
 type NotFound = ErrorResponse
 
+// StepUpRequired defines model for StepUpRequired.
+type StepUpRequired = ErrorResponse
+
 // TooManyRequests defines model for TooManyRequests.
 type TooManyRequests = ErrorResponse
 
 // Unauthorized defines model for Unauthorized.
 type Unauthorized = ErrorResponse
 
+// StartFederatedLoginParams defines parameters for StartFederatedLogin.
+type StartFederatedLoginParams struct {
+	// IsRememberMe If true, server may issue longer refresh token lifetime.
+	IsRememberMe *bool `form:"isRememberMe,omitempty" json:"isRememberMe,omitempty"`
+}
+
+// StartOidcAuthorizationParams defines parameters for StartOidcAuthorization.
+type StartOidcAuthorizationParams struct {
+	ResponseType        string  `form:"response_type" json:"response_type"`
+	ClientId            string  `form:"client_id" json:"client_id"`
+	RedirectUri         string  `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string  `form:"scope" json:"scope"`
+	State               *string `form:"state,omitempty" json:"state,omitempty"`
+	Nonce               *string `form:"nonce,omitempty" json:"nonce,omitempty"`
+	CodeChallenge       string  `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string  `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// CreateInviteCodeJSONRequestBody defines body for CreateInviteCode for application/json ContentType.
+type CreateInviteCodeJSONRequestBody = CreateInviteCodeRequest
+
+// VerifyEmailJSONRequestBody defines body for VerifyEmail for application/json ContentType.
+type VerifyEmailJSONRequestBody = VerifyEmailRequest
+
+// ResendEmailVerificationJSONRequestBody defines body for ResendEmailVerification for application/json ContentType.
+type ResendEmailVerificationJSONRequestBody = ResendEmailVerificationRequest
+
+// CompleteFederatedLoginJSONRequestBody defines body for CompleteFederatedLogin for application/json ContentType.
+type CompleteFederatedLoginJSONRequestBody = FederatedLoginCallbackRequest
+
+// RequestMagicLinkJSONRequestBody defines body for RequestMagicLink for application/json ContentType.
+type RequestMagicLinkJSONRequestBody = MagicLinkRequest
+
+// ConsumeMagicLinkJSONRequestBody defines body for ConsumeMagicLink for application/json ContentType.
+type ConsumeMagicLinkJSONRequestBody = MagicLinkConsumeRequest
+
+// ForgotPasswordJSONRequestBody defines body for ForgotPassword for application/json ContentType.
+type ForgotPasswordJSONRequestBody = ForgotPasswordRequest
+
+// ResetPasswordJSONRequestBody defines body for ResetPassword for application/json ContentType.
+type ResetPasswordJSONRequestBody = ResetPasswordRequest
+
+// ReauthenticateJSONRequestBody defines body for Reauthenticate for application/json ContentType.
+type ReauthenticateJSONRequestBody = ReauthenticateRequest
+
 // SignInJSONRequestBody defines body for SignIn for application/json ContentType.
 type SignInJSONRequestBody = SigninRequest
 
+// SignInMfaJSONRequestBody defines body for SignInMfa for application/json ContentType.
+type SignInMfaJSONRequestBody = SigninMfaRequest
+
 // SignUpJSONRequestBody defines body for SignUp for application/json ContentType.
 type SignUpJSONRequestBody = SignupRequest
 
+// FinishWebAuthnLoginJSONRequestBody defines body for FinishWebAuthnLogin for application/json ContentType.
+type FinishWebAuthnLoginJSONRequestBody = WebAuthnLoginFinishRequest
+
+// FinishWebAuthnRegistrationJSONRequestBody defines body for FinishWebAuthnRegistration for application/json ContentType.
+type FinishWebAuthnRegistrationJSONRequestBody = WebAuthnFinishRequest
+
+// ApproveOidcAuthorizationFormdataRequestBody defines body for ApproveOidcAuthorization for application/x-www-form-urlencoded ContentType.
+type ApproveOidcAuthorizationFormdataRequestBody = OidcAuthorizationRequest
+
+// IntrospectOAuthTokenFormdataRequestBody defines body for IntrospectOAuthToken for application/x-www-form-urlencoded ContentType.
+type IntrospectOAuthTokenFormdataRequestBody = OAuthTokenActionRequest
+
+// RevokeOAuthTokenFormdataRequestBody defines body for RevokeOAuthToken for application/x-www-form-urlencoded ContentType.
+type RevokeOAuthTokenFormdataRequestBody = OAuthTokenActionRequest
+
+// IssueOAuthTokenFormdataRequestBody defines body for IssueOAuthToken for application/x-www-form-urlencoded ContentType.
+type IssueOAuthTokenFormdataRequestBody = OAuthTokenRequest
+
+// DisableTotpJSONRequestBody defines body for DisableTotp for application/json ContentType.
+type DisableTotpJSONRequestBody = TotpCodeRequest
+
+// ConfirmTotpJSONRequestBody defines body for ConfirmTotp for application/json ContentType.
+type ConfirmTotpJSONRequestBody = TotpCodeRequest
+
+// ChangeMyPasswordJSONRequestBody defines body for ChangeMyPassword for application/json ContentType.
+type ChangeMyPasswordJSONRequestBody = ChangePasswordRequest
+
+// CreateMyTokenJSONRequestBody defines body for CreateMyToken for application/json ContentType.
+type CreateMyTokenJSONRequestBody = CreatePersonalAccessTokenRequest
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
+	// Get the public keys used to sign access tokens
+	// (GET /.well-known/jwks.json)
+	GetJwks(c *gin.Context)
+	// Get the OpenID Connect discovery document
+	// (GET /.well-known/openid-configuration)
+	GetOpenIdConfiguration(c *gin.Context)
+	// Sign an account out of every session
+	// (DELETE /admin/accounts/{accountId}/sessions)
+	RevokeAccountSessions(c *gin.Context, accountId uint64)
+	// List the invite codes
+	// (GET /admin/invite-codes)
+	ListInviteCodes(c *gin.Context)
+	// Mint an invite code
+	// (POST /admin/invite-codes)
+	CreateInviteCode(c *gin.Context)
+	// Revoke an invite code
+	// (DELETE /admin/invite-codes/{inviteCodeId})
+	RevokeInviteCode(c *gin.Context, inviteCodeId string)
+	// List the usernames and IPs locked out of signing in
+	// (GET /admin/sign-in-lockouts)
+	ListSignInLockouts(c *gin.Context)
+	// Lift a sign-in lockout
+	// (DELETE /admin/sign-in-lockouts/{kind}/{value})
+	UnlockSignIn(c *gin.Context, kind string, value string)
+	// Verify the email of an account
+	// (POST /auth/email/verify)
+	VerifyEmail(c *gin.Context)
+	// Resend the email verification link
+	// (POST /auth/email/verify/resend)
+	ResendEmailVerification(c *gin.Context)
+	// Sign in with the answer of an external identity provider
+	// (POST /auth/federation/callback)
+	CompleteFederatedLogin(c *gin.Context)
+	// List the external identity providers
+	// (GET /auth/federation/providers)
+	ListFederatedProviders(c *gin.Context)
+	// Start a sign-in through an external identity provider
+	// (GET /auth/federation/{providerId}/authorize)
+	StartFederatedLogin(c *gin.Context, providerId string, params StartFederatedLoginParams)
+	// Ask for a passwordless sign-in link
+	// (POST /auth/magic-link)
+	RequestMagicLink(c *gin.Context)
+	// Sign in with a sign-in link
+	// (POST /auth/magic-link/consume)
+	ConsumeMagicLink(c *gin.Context)
+	// Request a password reset
+	// (POST /auth/password/forgot)
+	ForgotPassword(c *gin.Context)
+	// Choose a new password with a reset token
+	// (POST /auth/password/reset)
+	ResetPassword(c *gin.Context)
+	// Authenticate again for a sensitive operation
+	// (POST /auth/reauthenticate)
+	Reauthenticate(c *gin.Context)
 	// Sign in
 	// (POST /auth/signin)
 	SignIn(c *gin.Context)
+	// Complete a sign-in with a second factor
+	// (POST /auth/signin/mfa)
+	SignInMfa(c *gin.Context)
 	// Sign up a new account
 	// (POST /auth/signup)
 	SignUp(c *gin.Context)
@@ -143,9 +761,72 @@ type ServerInterface interface {
 	// Sign out and revoke refresh token
 	// (POST /auth/token/signout)
 	SignOut(c *gin.Context)
+	// Sign out of every session
+	// (POST /auth/token/signout-all)
+	SignOutAll(c *gin.Context)
+	// Start a passkey sign-in
+	// (POST /auth/webauthn/login/begin)
+	BeginWebAuthnLogin(c *gin.Context)
+	// Complete a passkey sign-in
+	// (POST /auth/webauthn/login/finish)
+	FinishWebAuthnLogin(c *gin.Context)
+	// Start a passkey registration
+	// (POST /auth/webauthn/register/begin)
+	BeginWebAuthnRegistration(c *gin.Context)
+	// Complete a passkey registration
+	// (POST /auth/webauthn/register/finish)
+	FinishWebAuthnRegistration(c *gin.Context)
+	// Start an OpenID Connect authorization
+	// (GET /oauth/authorize)
+	StartOidcAuthorization(c *gin.Context, params StartOidcAuthorizationParams)
+	// Approve an OpenID Connect authorization
+	// (POST /oauth/authorize)
+	ApproveOidcAuthorization(c *gin.Context)
+	// Introspect an access or refresh token
+	// (POST /oauth/introspect)
+	IntrospectOAuthToken(c *gin.Context)
+	// Revoke an access or refresh token
+	// (POST /oauth/revoke)
+	RevokeOAuthToken(c *gin.Context)
+	// Issue tokens to a service or an OpenID Connect client
+	// (POST /oauth/token)
+	IssueOAuthToken(c *gin.Context)
+	// Get the claims about the signed in user
+	// (GET /oauth/userinfo)
+	GetOidcUserInfo(c *gin.Context)
 	// Get current user information
 	// (GET /users/me)
 	GetMe(c *gin.Context)
+	// Get the second factors of the current user
+	// (GET /users/me/mfa)
+	GetMfaStatus(c *gin.Context)
+	// Disable TOTP
+	// (DELETE /users/me/mfa/totp)
+	DisableTotp(c *gin.Context)
+	// Start a TOTP enrollment
+	// (POST /users/me/mfa/totp)
+	EnrollTotp(c *gin.Context)
+	// Confirm a TOTP enrollment
+	// (POST /users/me/mfa/totp/confirm)
+	ConfirmTotp(c *gin.Context)
+	// Change the password of the current user
+	// (PUT /users/me/password)
+	ChangeMyPassword(c *gin.Context)
+	// List the signed-in sessions of the current user
+	// (GET /users/me/sessions)
+	ListMySessions(c *gin.Context)
+	// Revoke one of the sessions of the current user
+	// (DELETE /users/me/sessions/{sessionId})
+	RevokeMySession(c *gin.Context, sessionId string)
+	// List the personal access tokens of the current user
+	// (GET /users/me/tokens)
+	ListMyTokens(c *gin.Context)
+	// Create a personal access token
+	// (POST /users/me/tokens)
+	CreateMyToken(c *gin.Context)
+	// Revoke a personal access token
+	// (DELETE /users/me/tokens/{tokenId})
+	RevokeMyToken(c *gin.Context, tokenId string)
 }
 
 // ServerInterfaceWrapper converts contexts to parameters.
@@ -157,8 +838,8 @@ type ServerInterfaceWrapper struct {
 
 type MiddlewareFunc func(c *gin.Context)
 
-// SignIn operation middleware
-func (siw *ServerInterfaceWrapper) SignIn(c *gin.Context) {
+// GetJwks operation middleware
+func (siw *ServerInterfaceWrapper) GetJwks(c *gin.Context) {
 
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
@@ -167,11 +848,11 @@ func (siw *ServerInterfaceWrapper) SignIn(c *gin.Context) {
 		}
 	}
 
-	siw.Handler.SignIn(c)
+	siw.Handler.GetJwks(c)
 }
 
-// SignUp operation middleware
-func (siw *ServerInterfaceWrapper) SignUp(c *gin.Context) {
+// GetOpenIdConfiguration operation middleware
+func (siw *ServerInterfaceWrapper) GetOpenIdConfiguration(c *gin.Context) {
 
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
@@ -180,13 +861,24 @@ func (siw *ServerInterfaceWrapper) SignUp(c *gin.Context) {
 		}
 	}
 
-	siw.Handler.SignUp(c)
+	siw.Handler.GetOpenIdConfiguration(c)
 }
 
-// RefreshToken operation middleware
-func (siw *ServerInterfaceWrapper) RefreshToken(c *gin.Context) {
+// RevokeAccountSessions operation middleware
+func (siw *ServerInterfaceWrapper) RevokeAccountSessions(c *gin.Context) {
 
-	c.Set(RefreshTokenCookieScopes, []string{})
+	var err error
+
+	// ------------- Path parameter "accountId" -------------
+	var accountId uint64
+
+	err = runtime.BindStyledParameterWithOptions("simple", "accountId", c.Param("accountId"), &accountId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter accountId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
 
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
@@ -195,13 +887,13 @@ func (siw *ServerInterfaceWrapper) RefreshToken(c *gin.Context) {
 		}
 	}
 
-	siw.Handler.RefreshToken(c)
+	siw.Handler.RevokeAccountSessions(c, accountId)
 }
 
-// SignOut operation middleware
-func (siw *ServerInterfaceWrapper) SignOut(c *gin.Context) {
+// ListInviteCodes operation middleware
+func (siw *ServerInterfaceWrapper) ListInviteCodes(c *gin.Context) {
 
-	c.Set(RefreshTokenCookieScopes, []string{})
+	c.Set(BearerAuthScopes, []string{})
 
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
@@ -210,11 +902,11 @@ func (siw *ServerInterfaceWrapper) SignOut(c *gin.Context) {
 		}
 	}
 
-	siw.Handler.SignOut(c)
+	siw.Handler.ListInviteCodes(c)
 }
 
-// GetMe operation middleware
-func (siw *ServerInterfaceWrapper) GetMe(c *gin.Context) {
+// CreateInviteCode operation middleware
+func (siw *ServerInterfaceWrapper) CreateInviteCode(c *gin.Context) {
 
 	c.Set(BearerAuthScopes, []string{})
 
@@ -225,7 +917,767 @@ func (siw *ServerInterfaceWrapper) GetMe(c *gin.Context) {
 		}
 	}
 
-	siw.Handler.GetMe(c)
+	siw.Handler.CreateInviteCode(c)
+}
+
+// RevokeInviteCode operation middleware
+func (siw *ServerInterfaceWrapper) RevokeInviteCode(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "inviteCodeId" -------------
+	var inviteCodeId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "inviteCodeId", c.Param("inviteCodeId"), &inviteCodeId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter inviteCodeId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.RevokeInviteCode(c, inviteCodeId)
+}
+
+// ListSignInLockouts operation middleware
+func (siw *ServerInterfaceWrapper) ListSignInLockouts(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ListSignInLockouts(c)
+}
+
+// UnlockSignIn operation middleware
+func (siw *ServerInterfaceWrapper) UnlockSignIn(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "kind" -------------
+	var kind string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "kind", c.Param("kind"), &kind, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter kind: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Path parameter "value" -------------
+	var value string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "value", c.Param("value"), &value, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter value: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.UnlockSignIn(c, kind, value)
+}
+
+// VerifyEmail operation middleware
+func (siw *ServerInterfaceWrapper) VerifyEmail(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.VerifyEmail(c)
+}
+
+// ResendEmailVerification operation middleware
+func (siw *ServerInterfaceWrapper) ResendEmailVerification(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ResendEmailVerification(c)
+}
+
+// CompleteFederatedLogin operation middleware
+func (siw *ServerInterfaceWrapper) CompleteFederatedLogin(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.CompleteFederatedLogin(c)
+}
+
+// ListFederatedProviders operation middleware
+func (siw *ServerInterfaceWrapper) ListFederatedProviders(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ListFederatedProviders(c)
+}
+
+// StartFederatedLogin operation middleware
+func (siw *ServerInterfaceWrapper) StartFederatedLogin(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "providerId" -------------
+	var providerId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "providerId", c.Param("providerId"), &providerId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter providerId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params StartFederatedLoginParams
+
+	// ------------- Optional query parameter "isRememberMe" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "isRememberMe", c.Request.URL.Query(), &params.IsRememberMe)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter isRememberMe: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.StartFederatedLogin(c, providerId, params)
+}
+
+// RequestMagicLink operation middleware
+func (siw *ServerInterfaceWrapper) RequestMagicLink(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.RequestMagicLink(c)
+}
+
+// ConsumeMagicLink operation middleware
+func (siw *ServerInterfaceWrapper) ConsumeMagicLink(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ConsumeMagicLink(c)
+}
+
+// ForgotPassword operation middleware
+func (siw *ServerInterfaceWrapper) ForgotPassword(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ForgotPassword(c)
+}
+
+// ResetPassword operation middleware
+func (siw *ServerInterfaceWrapper) ResetPassword(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ResetPassword(c)
+}
+
+// Reauthenticate operation middleware
+func (siw *ServerInterfaceWrapper) Reauthenticate(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.Reauthenticate(c)
+}
+
+// SignIn operation middleware
+func (siw *ServerInterfaceWrapper) SignIn(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.SignIn(c)
+}
+
+// SignInMfa operation middleware
+func (siw *ServerInterfaceWrapper) SignInMfa(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.SignInMfa(c)
+}
+
+// SignUp operation middleware
+func (siw *ServerInterfaceWrapper) SignUp(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.SignUp(c)
+}
+
+// RefreshToken operation middleware
+func (siw *ServerInterfaceWrapper) RefreshToken(c *gin.Context) {
+
+	c.Set(CsrfTokenScopes, []string{})
+
+	c.Set(RefreshTokenCookieScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.RefreshToken(c)
+}
+
+// SignOut operation middleware
+func (siw *ServerInterfaceWrapper) SignOut(c *gin.Context) {
+
+	c.Set(CsrfTokenScopes, []string{})
+
+	c.Set(RefreshTokenCookieScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.SignOut(c)
+}
+
+// SignOutAll operation middleware
+func (siw *ServerInterfaceWrapper) SignOutAll(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.SignOutAll(c)
+}
+
+// BeginWebAuthnLogin operation middleware
+func (siw *ServerInterfaceWrapper) BeginWebAuthnLogin(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.BeginWebAuthnLogin(c)
+}
+
+// FinishWebAuthnLogin operation middleware
+func (siw *ServerInterfaceWrapper) FinishWebAuthnLogin(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.FinishWebAuthnLogin(c)
+}
+
+// BeginWebAuthnRegistration operation middleware
+func (siw *ServerInterfaceWrapper) BeginWebAuthnRegistration(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.BeginWebAuthnRegistration(c)
+}
+
+// FinishWebAuthnRegistration operation middleware
+func (siw *ServerInterfaceWrapper) FinishWebAuthnRegistration(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.FinishWebAuthnRegistration(c)
+}
+
+// StartOidcAuthorization operation middleware
+func (siw *ServerInterfaceWrapper) StartOidcAuthorization(c *gin.Context) {
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params StartOidcAuthorizationParams
+
+	// ------------- Required query parameter "response_type" -------------
+
+	if paramValue := c.Query("response_type"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandler(c, fmt.Errorf("Query argument response_type is required, but not found"), http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "response_type", c.Request.URL.Query(), &params.ResponseType)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter response_type: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "client_id" -------------
+
+	if paramValue := c.Query("client_id"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandler(c, fmt.Errorf("Query argument client_id is required, but not found"), http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "client_id", c.Request.URL.Query(), &params.ClientId)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter client_id: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "redirect_uri" -------------
+
+	if paramValue := c.Query("redirect_uri"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandler(c, fmt.Errorf("Query argument redirect_uri is required, but not found"), http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "redirect_uri", c.Request.URL.Query(), &params.RedirectUri)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter redirect_uri: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "scope" -------------
+
+	if paramValue := c.Query("scope"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandler(c, fmt.Errorf("Query argument scope is required, but not found"), http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "scope", c.Request.URL.Query(), &params.Scope)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter scope: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "state" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "state", c.Request.URL.Query(), &params.State)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter state: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "nonce" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "nonce", c.Request.URL.Query(), &params.Nonce)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter nonce: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "code_challenge" -------------
+
+	if paramValue := c.Query("code_challenge"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandler(c, fmt.Errorf("Query argument code_challenge is required, but not found"), http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "code_challenge", c.Request.URL.Query(), &params.CodeChallenge)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter code_challenge: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Required query parameter "code_challenge_method" -------------
+
+	if paramValue := c.Query("code_challenge_method"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandler(c, fmt.Errorf("Query argument code_challenge_method is required, but not found"), http.StatusBadRequest)
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "code_challenge_method", c.Request.URL.Query(), &params.CodeChallengeMethod)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter code_challenge_method: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.StartOidcAuthorization(c, params)
+}
+
+// ApproveOidcAuthorization operation middleware
+func (siw *ServerInterfaceWrapper) ApproveOidcAuthorization(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ApproveOidcAuthorization(c)
+}
+
+// IntrospectOAuthToken operation middleware
+func (siw *ServerInterfaceWrapper) IntrospectOAuthToken(c *gin.Context) {
+
+	c.Set(ClientBasicAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.IntrospectOAuthToken(c)
+}
+
+// RevokeOAuthToken operation middleware
+func (siw *ServerInterfaceWrapper) RevokeOAuthToken(c *gin.Context) {
+
+	c.Set(ClientBasicAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.RevokeOAuthToken(c)
+}
+
+// IssueOAuthToken operation middleware
+func (siw *ServerInterfaceWrapper) IssueOAuthToken(c *gin.Context) {
+
+	c.Set(ClientBasicAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.IssueOAuthToken(c)
+}
+
+// GetOidcUserInfo operation middleware
+func (siw *ServerInterfaceWrapper) GetOidcUserInfo(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.GetOidcUserInfo(c)
+}
+
+// GetMe operation middleware
+func (siw *ServerInterfaceWrapper) GetMe(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.GetMe(c)
+}
+
+// GetMfaStatus operation middleware
+func (siw *ServerInterfaceWrapper) GetMfaStatus(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.GetMfaStatus(c)
+}
+
+// DisableTotp operation middleware
+func (siw *ServerInterfaceWrapper) DisableTotp(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.DisableTotp(c)
+}
+
+// EnrollTotp operation middleware
+func (siw *ServerInterfaceWrapper) EnrollTotp(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.EnrollTotp(c)
+}
+
+// ConfirmTotp operation middleware
+func (siw *ServerInterfaceWrapper) ConfirmTotp(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ConfirmTotp(c)
+}
+
+// ChangeMyPassword operation middleware
+func (siw *ServerInterfaceWrapper) ChangeMyPassword(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ChangeMyPassword(c)
+}
+
+// ListMySessions operation middleware
+func (siw *ServerInterfaceWrapper) ListMySessions(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ListMySessions(c)
+}
+
+// RevokeMySession operation middleware
+func (siw *ServerInterfaceWrapper) RevokeMySession(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "sessionId" -------------
+	var sessionId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "sessionId", c.Param("sessionId"), &sessionId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter sessionId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.RevokeMySession(c, sessionId)
+}
+
+// ListMyTokens operation middleware
+func (siw *ServerInterfaceWrapper) ListMyTokens(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.ListMyTokens(c)
+}
+
+// CreateMyToken operation middleware
+func (siw *ServerInterfaceWrapper) CreateMyToken(c *gin.Context) {
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.CreateMyToken(c)
+}
+
+// RevokeMyToken operation middleware
+func (siw *ServerInterfaceWrapper) RevokeMyToken(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "tokenId" -------------
+	var tokenId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "tokenId", c.Param("tokenId"), &tokenId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter tokenId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.RevokeMyToken(c, tokenId)
 }
 
 // GinServerOptions provides options for the Gin server.
@@ -255,9 +1707,49 @@ func RegisterHandlersWithOptions(router gin.IRouter, si ServerInterface, options
 		ErrorHandler:       errorHandler,
 	}
 
+	router.GET(options.BaseURL+"/.well-known/jwks.json", wrapper.GetJwks)
+	router.GET(options.BaseURL+"/.well-known/openid-configuration", wrapper.GetOpenIdConfiguration)
+	router.DELETE(options.BaseURL+"/admin/accounts/:accountId/sessions", wrapper.RevokeAccountSessions)
+	router.GET(options.BaseURL+"/admin/invite-codes", wrapper.ListInviteCodes)
+	router.POST(options.BaseURL+"/admin/invite-codes", wrapper.CreateInviteCode)
+	router.DELETE(options.BaseURL+"/admin/invite-codes/:inviteCodeId", wrapper.RevokeInviteCode)
+	router.GET(options.BaseURL+"/admin/sign-in-lockouts", wrapper.ListSignInLockouts)
+	router.DELETE(options.BaseURL+"/admin/sign-in-lockouts/:kind/:value", wrapper.UnlockSignIn)
+	router.POST(options.BaseURL+"/auth/email/verify", wrapper.VerifyEmail)
+	router.POST(options.BaseURL+"/auth/email/verify/resend", wrapper.ResendEmailVerification)
+	router.POST(options.BaseURL+"/auth/federation/callback", wrapper.CompleteFederatedLogin)
+	router.GET(options.BaseURL+"/auth/federation/providers", wrapper.ListFederatedProviders)
+	router.GET(options.BaseURL+"/auth/federation/:providerId/authorize", wrapper.StartFederatedLogin)
+	router.POST(options.BaseURL+"/auth/magic-link", wrapper.RequestMagicLink)
+	router.POST(options.BaseURL+"/auth/magic-link/consume", wrapper.ConsumeMagicLink)
+	router.POST(options.BaseURL+"/auth/password/forgot", wrapper.ForgotPassword)
+	router.POST(options.BaseURL+"/auth/password/reset", wrapper.ResetPassword)
+	router.POST(options.BaseURL+"/auth/reauthenticate", wrapper.Reauthenticate)
 	router.POST(options.BaseURL+"/auth/signin", wrapper.SignIn)
+	router.POST(options.BaseURL+"/auth/signin/mfa", wrapper.SignInMfa)
 	router.POST(options.BaseURL+"/auth/signup", wrapper.SignUp)
 	router.POST(options.BaseURL+"/auth/token/refresh", wrapper.RefreshToken)
 	router.POST(options.BaseURL+"/auth/token/signout", wrapper.SignOut)
+	router.POST(options.BaseURL+"/auth/token/signout-all", wrapper.SignOutAll)
+	router.POST(options.BaseURL+"/auth/webauthn/login/begin", wrapper.BeginWebAuthnLogin)
+	router.POST(options.BaseURL+"/auth/webauthn/login/finish", wrapper.FinishWebAuthnLogin)
+	router.POST(options.BaseURL+"/auth/webauthn/register/begin", wrapper.BeginWebAuthnRegistration)
+	router.POST(options.BaseURL+"/auth/webauthn/register/finish", wrapper.FinishWebAuthnRegistration)
+	router.GET(options.BaseURL+"/oauth/authorize", wrapper.StartOidcAuthorization)
+	router.POST(options.BaseURL+"/oauth/authorize", wrapper.ApproveOidcAuthorization)
+	router.POST(options.BaseURL+"/oauth/introspect", wrapper.IntrospectOAuthToken)
+	router.POST(options.BaseURL+"/oauth/revoke", wrapper.RevokeOAuthToken)
+	router.POST(options.BaseURL+"/oauth/token", wrapper.IssueOAuthToken)
+	router.GET(options.BaseURL+"/oauth/userinfo", wrapper.GetOidcUserInfo)
 	router.GET(options.BaseURL+"/users/me", wrapper.GetMe)
+	router.GET(options.BaseURL+"/users/me/mfa", wrapper.GetMfaStatus)
+	router.DELETE(options.BaseURL+"/users/me/mfa/totp", wrapper.DisableTotp)
+	router.POST(options.BaseURL+"/users/me/mfa/totp", wrapper.EnrollTotp)
+	router.POST(options.BaseURL+"/users/me/mfa/totp/confirm", wrapper.ConfirmTotp)
+	router.PUT(options.BaseURL+"/users/me/password", wrapper.ChangeMyPassword)
+	router.GET(options.BaseURL+"/users/me/sessions", wrapper.ListMySessions)
+	router.DELETE(options.BaseURL+"/users/me/sessions/:sessionId", wrapper.RevokeMySession)
+	router.GET(options.BaseURL+"/users/me/tokens", wrapper.ListMyTokens)
+	router.POST(options.BaseURL+"/users/me/tokens", wrapper.CreateMyToken)
+	router.DELETE(options.BaseURL+"/users/me/tokens/:tokenId", wrapper.RevokeMyToken)
 }
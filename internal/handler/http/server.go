@@ -2,43 +2,85 @@ package handler
 
 import (
 	"context"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Fiagram/gateway/internal/configs"
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
 	"github.com/Fiagram/gateway/internal/handler/middlewares"
 	"github.com/Fiagram/gateway/internal/log"
+	csrf_logic "github.com/Fiagram/gateway/internal/logic/csrf"
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
 	auth_logic "github.com/Fiagram/gateway/internal/logic/http"
+	oidc_logic "github.com/Fiagram/gateway/internal/logic/oidc"
+	pat_logic "github.com/Fiagram/gateway/internal/logic/pat"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
 	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+const defaultStepUpMaxAge = 5 * time.Minute
+
 type HttpServer interface {
 	Start(ctx context.Context) error
 }
 
 type httpServer struct {
-	httpConfig configs.Http
+	httpConfig   configs.Http
+	stepUpConfig configs.StepUp
 
-	authLogic  auth_logic.AuthLogic
-	usersLogic auth_logic.UsersLogic
-	tokenLogic token_logic.Token
+	authLogic      auth_logic.AuthLogic
+	usersLogic     auth_logic.UsersLogic
+	wellKnownLogic auth_logic.WellKnownLogic
+	mfaLogic       auth_logic.MfaLogic
+	oauthLogic     auth_logic.OAuthLogic
+	adminLogic     auth_logic.AdminLogic
+	tokenLogic     token_logic.Token
+	sessionLogic   session_logic.Session
+	patLogic       pat_logic.PersonalAccessToken
+	csrfLogic      csrf_logic.Csrf
+	dpopLogic      dpop_logic.Dpop
 
+	clock  utils.Clock
 	logger *zap.Logger
 }
 
 func NewHttpServer(
 	httpConfig configs.Http,
+	stepUpConfig configs.StepUp,
 	authLogic auth_logic.AuthLogic,
 	usersLogic auth_logic.UsersLogic,
+	wellKnownLogic auth_logic.WellKnownLogic,
+	mfaLogic auth_logic.MfaLogic,
+	oauthLogic auth_logic.OAuthLogic,
+	adminLogic auth_logic.AdminLogic,
 	tokenLogic token_logic.Token,
+	sessionLogic session_logic.Session,
+	patLogic pat_logic.PersonalAccessToken,
+	csrfLogic csrf_logic.Csrf,
+	dpopLogic dpop_logic.Dpop,
+	clock utils.Clock,
 	logger *zap.Logger,
 ) HttpServer {
 	return &httpServer{
-		httpConfig: httpConfig,
-		authLogic:  authLogic,
-		usersLogic: usersLogic,
-		tokenLogic: tokenLogic,
-		logger:     logger,
+		httpConfig:     httpConfig,
+		stepUpConfig:   stepUpConfig,
+		authLogic:      authLogic,
+		usersLogic:     usersLogic,
+		wellKnownLogic: wellKnownLogic,
+		mfaLogic:       mfaLogic,
+		oauthLogic:     oauthLogic,
+		adminLogic:     adminLogic,
+		tokenLogic:     tokenLogic,
+		sessionLogic:   sessionLogic,
+		patLogic:       patLogic,
+		csrfLogic:      csrfLogic,
+		dpopLogic:      dpopLogic,
+		clock:          clock,
+		logger:         logger,
 	}
 }
 
@@ -47,16 +89,142 @@ func (s *httpServer) Start(ctx context.Context) error {
 
 	r := gin.Default()
 
+	// The client IP feeds the sign-in throttle and the security log, it is
+	// only taken from X-Forwarded-For behind the configured proxies
+	if err := r.SetTrustedProxies(s.httpConfig.TrustedProxies); err != nil {
+		logger.With(zap.Error(err)).Error("invalid trusted proxies")
+		return err
+	}
+
+	wellKnown := r.Group("/.well-known")
+	wellKnown.GET("/jwks.json", s.wellKnownLogic.GetJwks)
+	wellKnown.GET("/openid-configuration", s.wellKnownLogic.GetOpenIdConfiguration)
+
 	public := r.Group("/api/v1")
 	public.POST("/auth/signup", s.authLogic.SignUp)
 	public.POST("/auth/signin", s.authLogic.SignIn)
-	public.POST("/auth/token/signout", s.authLogic.SignOut)
-	public.POST("/auth/token/refresh", s.authLogic.RefreshToken)
+	public.POST("/auth/signin/mfa", s.authLogic.SignInMfa)
+	public.POST("/auth/password/forgot", s.authLogic.ForgotPassword)
+	public.POST("/auth/password/reset", s.authLogic.ResetPassword)
+	public.POST("/auth/magic-link", s.authLogic.RequestMagicLink)
+	public.POST("/auth/magic-link/consume", s.authLogic.ConsumeMagicLink)
+	public.GET("/auth/federation/providers", s.authLogic.ListFederatedProviders)
+	public.GET("/auth/federation/:providerId/authorize", func(c *gin.Context) {
+		var params oapi.StartFederatedLoginParams
+		if err := c.ShouldBindQuery(&params); err != nil {
+			c.JSON(http.StatusBadRequest, oapi.BadRequest{
+				Code:    "BadRequest",
+				Message: "invalid query parameters",
+			})
+			return
+		}
+		s.authLogic.StartFederatedLogin(c, c.Param("providerId"), params)
+	})
+	public.POST("/auth/federation/callback", s.authLogic.CompleteFederatedLogin)
+	public.POST("/auth/email/verify", s.authLogic.VerifyEmail)
+	public.POST("/auth/email/verify/resend", s.authLogic.ResendEmailVerification)
+	public.POST("/auth/webauthn/login/begin", s.authLogic.BeginWebAuthnLogin)
+	public.POST("/auth/webauthn/login/finish", s.authLogic.FinishWebAuthnLogin)
+	public.POST("/oauth/token", s.oauthLogic.IssueOAuthToken)
+	public.GET("/oauth/authorize", func(c *gin.Context) {
+		var params oapi.StartOidcAuthorizationParams
+		if err := c.ShouldBindQuery(&params); err != nil {
+			c.JSON(http.StatusBadRequest, oapi.OAuthError{
+				Error:            "invalid_request",
+				ErrorDescription: utils.Ptr("invalid authorization request"),
+			})
+			return
+		}
+		s.oauthLogic.StartOidcAuthorization(c, params)
+	})
+	public.POST("/oauth/introspect", s.oauthLogic.IntrospectOAuthToken)
+	public.POST("/oauth/revoke", s.oauthLogic.RevokeOAuthToken)
+
+	// The refresh token cookie authenticates these, browsers would send it
+	// along with forged cross-site requests
+	cookieAuthenticated := r.Group("/api/v1/auth/token",
+		middlewares.VerifyCsrf(s.csrfLogic),
+	)
+	cookieAuthenticated.POST("/signout", s.authLogic.SignOut)
+	cookieAuthenticated.POST("/refresh", s.authLogic.RefreshToken)
 
 	authorized := r.Group("/api/v1",
-		middlewares.VerifyAccessToken(s.tokenLogic),
+		middlewares.VerifyAccessToken(s.tokenLogic, s.sessionLogic, s.patLogic, s.dpopLogic, s.clock),
+	)
+	authorized.POST("/auth/token/signout-all",
+		middlewares.RefuseImpersonation(),
+		middlewares.RequireScope(token_logic.ScopeSessionsWrite),
+		s.authLogic.SignOutAll)
+	authorized.GET("/users/me",
+		middlewares.RequireScope(token_logic.ScopeAccountRead),
+		s.usersLogic.GetMe)
+
+	// Accounts whose email is not verified only get the routes above
+	verified := authorized.Group("", middlewares.RequireVerifiedEmail())
+	verified.GET("/oauth/userinfo",
+		middlewares.RequireScope(oidc_logic.ScopeOpenId),
+		s.oauthLogic.GetOidcUserInfo)
+	verified.GET("/users/me/mfa",
+		middlewares.RequireScope(token_logic.ScopeAccountRead),
+		s.mfaLogic.GetMfaStatus)
+
+	sessionsRead := verified.Group("", middlewares.RequireScope(token_logic.ScopeSessionsRead))
+	sessionsRead.GET("/users/me/sessions", s.usersLogic.ListMySessions)
+	sessionsRead.GET("/users/me/tokens", s.usersLogic.ListMyTokens)
+
+	sessionsWrite := verified.Group("", middlewares.RequireScope(token_logic.ScopeSessionsWrite))
+	sessionsWrite.DELETE("/users/me/sessions/:sessionId", func(c *gin.Context) {
+		s.usersLogic.RevokeMySession(c, c.Param("sessionId"))
+	})
+	sessionsWrite.DELETE("/users/me/tokens/:tokenId", func(c *gin.Context) {
+		s.usersLogic.RevokeMyToken(c, c.Param("tokenId"))
+	})
+
+	// Administrators impersonating an account can look around but cannot
+	// mint lasting credentials nor change how the account signs in
+	personal := verified.Group("",
+		middlewares.RefuseImpersonation(),
+		middlewares.RequireScope(token_logic.ScopeAccountWrite),
+	)
+	personal.POST("/auth/reauthenticate", s.authLogic.Reauthenticate)
+	personal.POST("/auth/webauthn/register/finish", s.authLogic.FinishWebAuthnRegistration)
+	personal.POST("/oauth/authorize", s.oauthLogic.ApproveOidcAuthorization)
+	personal.POST("/users/me/mfa/totp/confirm", s.mfaLogic.ConfirmTotp)
+
+	// Adding or removing a way to sign in needs a recent authentication,
+	// a stolen access token alone is not enough
+	sensitive := personal.Group("", middlewares.RequireRecentAuth(
+		utils.If(s.stepUpConfig.MaxAge > 0, s.stepUpConfig.MaxAge, defaultStepUpMaxAge), s.clock))
+	sensitive.POST("/auth/webauthn/register/begin", s.authLogic.BeginWebAuthnRegistration)
+	sensitive.POST("/users/me/tokens", s.usersLogic.CreateMyToken)
+	sensitive.POST("/users/me/mfa/totp", s.mfaLogic.EnrollTotp)
+	sensitive.DELETE("/users/me/mfa/totp", s.mfaLogic.DisableTotp)
+	sensitive.PUT("/users/me/password", s.usersLogic.ChangeMyPassword)
+
+	admin := verified.Group("/admin",
+		middlewares.RequireRole(token_logic.RoleAdmin),
+		middlewares.RequireScope(token_logic.ScopeAdmin),
 	)
-	authorized.GET("/users/me", s.usersLogic.GetMe)
+	admin.DELETE("/accounts/:accountId/sessions", func(c *gin.Context) {
+		accountId, err := strconv.ParseUint(c.Param("accountId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, oapi.BadRequest{
+				Code:    "BadRequest",
+				Message: "invalid account id",
+			})
+			return
+		}
+		s.adminLogic.RevokeAccountSessions(c, accountId)
+	})
+	admin.GET("/sign-in-lockouts", s.adminLogic.ListSignInLockouts)
+	admin.DELETE("/sign-in-lockouts/:kind/:value", func(c *gin.Context) {
+		s.adminLogic.UnlockSignIn(c, c.Param("kind"), c.Param("value"))
+	})
+	admin.GET("/invite-codes", s.adminLogic.ListInviteCodes)
+	admin.POST("/invite-codes", s.adminLogic.CreateInviteCode)
+	admin.DELETE("/invite-codes/:inviteCodeId", func(c *gin.Context) {
+		s.adminLogic.RevokeInviteCode(c, c.Param("inviteCodeId"))
+	})
 
 	address := s.httpConfig.Address
 	port := s.httpConfig.Port
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"net/http"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// RefuseImpersonation keeps administrators acting as an account from
+// minting lasting credentials or changing the authentication factors of the
+// account. It has to run after VerifyAccessToken.
+func RefuseImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("actorAccountId"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, oapi.Forbidden{
+				Code:    "Forbidden",
+				Message: "not allowed while impersonating an account",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRecentAuth lets through the users that authenticated in their
+// session within maxAge. The others are told to step up as in RFC 9470 and
+// get a fresh token from /auth/reauthenticate. Tokens without an "authTime"
+// such as personal access tokens are never recent enough. It has to run
+// after VerifyAccessToken.
+func RequireRecentAuth(maxAge time.Duration, clock utils.Clock) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authTime := c.GetTime("authTime")
+		if !authTime.IsZero() && clock.Now().Sub(authTime) <= maxAge {
+			c.Next()
+			return
+		}
+
+		maxAgeSeconds := int64(maxAge / time.Second)
+		c.Header("WWW-Authenticate", fmt.Sprintf(
+			`Bearer error="insufficient_user_authentication", `+
+				`error_description="a more recent authentication is required", max_age=%d`,
+			maxAgeSeconds))
+		c.AbortWithStatusJSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "StepUpRequired",
+			Message: "a more recent authentication is required",
+			Details: &map[string]any{"maxAge": maxAgeSeconds},
+		})
+	}
+}
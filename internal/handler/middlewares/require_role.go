@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole lets through principals whose role is one of the given ones.
+// It has to run after VerifyAccessToken. Service principals and personal
+// access tokens carry no role and are always refused.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if role == "" || !slices.Contains(roles, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, oapi.Forbidden{
+				Code:    "Forbidden",
+				Message: "the role of the account does not allow this operation",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
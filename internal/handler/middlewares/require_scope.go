@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope lets through principals holding every given scope. It has
+// to run after VerifyAccessToken. Access tokens of a sign-in are not
+// restricted to scopes and always pass, while personal access tokens,
+// service tokens and the tokens of OIDC clients only hold the scopes they
+// were issued with.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, isRestricted := c.Get("scopes")
+		if !isRestricted {
+			c.Next()
+			return
+		}
+
+		granted, _ := value.([]string)
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, oapi.Forbidden{
+					Code:    "Forbidden",
+					Message: "the token lacks the scope " + scope,
+				})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
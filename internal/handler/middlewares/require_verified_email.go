@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"net/http"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail refuses the restricted access tokens issued to
+// accounts whose email is not verified yet. It has to run after
+// VerifyAccessToken.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("emailUnverified") {
+			c.AbortWithStatusJSON(http.StatusForbidden, oapi.Forbidden{
+				Code:    "Forbidden",
+				Message: "the email of the account is not verified",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,24 +1,51 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
+	pat_logic "github.com/Fiagram/gateway/internal/logic/pat"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
 	logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func VerifyAccessToken(tokenLogic logic.Token) gin.HandlerFunc {
+// Principal types set as "principalType" in the context. Users carry an
+// "accountId" and a "role", services the "clientId" of their OAuth client.
+// Tokens restricted to "scopes" set them in the context as well, users
+// whose email is not verified yet "emailUnverified", impersonation tokens
+// the "actorAccountId" of the administrator acting as the user, tokens of a
+// sign-in the "authTime" the user last authenticated at, and DPoP bound
+// tokens the "keyThumbprint" of their key.
+const (
+	PrincipalTypeUser    = "user"
+	PrincipalTypeService = "service"
+)
+
+func VerifyAccessToken(
+	tokenLogic logic.Token,
+	sessionLogic session_logic.Session,
+	patLogic pat_logic.PersonalAccessToken,
+	dpopLogic dpop_logic.Dpop,
+	clock utils.Clock,
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var token string
 
-		// Try Authorization header
+		// Try Authorization header, bound tokens come with the DPoP scheme
 		authHeader := c.GetHeader("Authorization")
+		isDpop := false
 		if after, ok := strings.CutPrefix(authHeader, "Bearer "); ok {
 			token = after
+		} else if after, ok := strings.CutPrefix(authHeader, dpop_logic.TokenType+" "); ok {
+			token = after
+			isDpop = true
 		}
 
 		if token == "" {
@@ -29,6 +56,38 @@ func VerifyAccessToken(tokenLogic logic.Token) gin.HandlerFunc {
 			return
 		}
 
+		// Personal access tokens are opaque and checked against the cache
+		if pat_logic.IsPersonalAccessToken(token) {
+			if isDpop {
+				abortWithInvalidDpopProof(c, "personal access tokens are bearer tokens")
+				return
+			}
+
+			entry, err := patLogic.Verify(c, token)
+			if errors.Is(err, pat_logic.ErrInvalidToken) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, oapi.Unauthorized{
+					Code:    "Unauthorized",
+					Message: "invalid or expired personal access token",
+				})
+				return
+			} else if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, oapi.InternalServerError{
+					Code:    "InternalServerError",
+					Message: "failed to verify personal access token",
+				})
+				return
+			}
+
+			// The role is left out since the account may have lost it
+			// since the token was created
+			c.Set("principalType", PrincipalTypeUser)
+			c.Set("accountId", entry.AccountId)
+			c.Set("personalAccessTokenId", entry.Id)
+			c.Set("scopes", entry.Scopes)
+			c.Next()
+			return
+		}
+
 		claims, expiresAt, err := tokenLogic.GetPayloadFromAccessToken(c, token)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, oapi.Unauthorized{
@@ -36,13 +95,13 @@ func VerifyAccessToken(tokenLogic logic.Token) gin.HandlerFunc {
 				Message: "failed to verify access token",
 			})
 			return
-		} else if time.Now().After(expiresAt) {
+		} else if clock.Now().After(expiresAt) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, oapi.Unauthorized{
 				Code:    "Unauthorized",
 				Message: "the access token has expired",
 			})
 			return
-		} else if claims.AccountId == 0 {
+		} else if claims.AccountId == 0 && !claims.IsService() {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, oapi.Unauthorized{
 				Code:    "Unauthorized",
 				Message: "invalid access token",
@@ -50,11 +109,87 @@ func VerifyAccessToken(tokenLogic logic.Token) gin.HandlerFunc {
 			return
 		}
 
+		// A bound token is only good with a proof of its key, made for this
+		// request and this token. Downgrading it to a bearer token is refused.
+		if claims.KeyThumbprint != "" || isDpop {
+			if claims.KeyThumbprint == "" {
+				abortWithInvalidDpopProof(c, "the access token is not bound to a dpop key")
+				return
+			} else if !isDpop {
+				abortWithInvalidDpopProof(c, "the access token has to be sent with the DPoP scheme")
+				return
+			}
+			keyThumbprint, err := dpopLogic.VerifyProof(c, c.GetHeader(dpop_logic.HeaderName),
+				c.Request.Method, dpop_logic.RequestUri(c.Request), token)
+			if err != nil && !errors.Is(err, dpop_logic.ErrInvalidProof) {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, oapi.InternalServerError{
+					Code:    "InternalServerError",
+					Message: "failed to verify dpop proof",
+				})
+				return
+			} else if err != nil || keyThumbprint != claims.KeyThumbprint {
+				abortWithInvalidDpopProof(c, dpop_logic.ErrInvalidProof.Error())
+				return
+			}
+		}
+
+		// Signed tokens stay valid until they expire unless they were revoked
+		isRevoked, err := sessionLogic.IsAccessTokenRevoked(c, claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: "failed to check access token revocation",
+			})
+			return
+		} else if isRevoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, oapi.Unauthorized{
+				Code:    "Unauthorized",
+				Message: "the access token has been revoked",
+			})
+			return
+		}
+
+		if claims.IsService() {
+			c.Set("principalType", PrincipalTypeService)
+			c.Set("clientId", claims.ClientId)
+			c.Set("scopes", claims.Scopes)
+			c.Next()
+			return
+		}
+
+		c.Set("principalType", PrincipalTypeUser)
 		c.Set("accountId", claims.AccountId)
+		c.Set("sessionId", claims.SessionId)
+		c.Set("role", claims.Role)
+		if len(claims.Scopes) > 0 {
+			c.Set("scopes", claims.Scopes)
+		}
+		if claims.IsEmailUnverified {
+			c.Set("emailUnverified", true)
+		}
+		if claims.IsImpersonation() {
+			c.Set("actorAccountId", claims.ActorAccountId)
+		}
+		if !claims.AuthTime.IsZero() {
+			c.Set("authTime", claims.AuthTime)
+		}
+		if claims.KeyThumbprint != "" {
+			c.Set("keyThumbprint", claims.KeyThumbprint)
+		}
 		c.Next()
 	}
 }
 
+// abortWithInvalidDpopProof answers with the invalid_dpop_proof error of
+// RFC 9449.
+func abortWithInvalidDpopProof(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", fmt.Sprintf(`DPoP error="invalid_dpop_proof", error_description=%q`, message))
+	c.AbortWithStatusJSON(http.StatusUnauthorized, oapi.Unauthorized{
+		Code:    "Unauthorized",
+		Message: message,
+	})
+}
+
 func LogWithFormatter() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(
 		func(param gin.LogFormatterParams) string {
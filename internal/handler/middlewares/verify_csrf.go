@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	csrf_logic "github.com/Fiagram/gateway/internal/logic/csrf"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyCsrf guards the routes authenticated by the refresh token cookie.
+// Browsers have to announce an allowed origin, and requests carrying the
+// cookie have to send the CSRF token cookie back in the CSRF header.
+// Requests without the cookie are left to the handler.
+func VerifyCsrf(csrfLogic csrf_logic.Csrf) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Browsers send the Origin of cross-site requests, older ones only
+		// the Referer
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			if referer, err := url.Parse(c.GetHeader("Referer")); err == nil && referer.Host != "" {
+				origin = referer.Scheme + "://" + referer.Host
+			}
+		}
+		// Behind a proxy terminating TLS the request arrives over http, the
+		// origin of the gateway has to be allowed in the config then
+		requestOrigin := utils.If(c.Request.TLS != nil, "https", "http") + "://" + c.Request.Host
+		if origin != "" && !csrfLogic.IsOriginAllowed(origin, requestOrigin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, oapi.Forbidden{
+				Code:    "Forbidden",
+				Message: "origin is not allowed",
+			})
+			return
+		}
+
+		refreshToken, err := c.Cookie("refresh_token")
+		if err != nil || refreshToken == "" {
+			c.Next()
+			return
+		}
+
+		cookieToken, _ := c.Cookie(csrf_logic.CookieName)
+		headerToken := c.GetHeader(csrf_logic.HeaderName)
+		if subtle.ConstantTimeCompare([]byte(cookieToken), []byte(headerToken)) != 1 ||
+			!csrfLogic.VerifyToken(refreshToken, headerToken) {
+			c.AbortWithStatusJSON(http.StatusForbidden, oapi.Forbidden{
+				Code:    "Forbidden",
+				Message: "missing or invalid csrf token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -41,7 +41,17 @@ func InitializeLogger(logConfig configs.Log) (logger *zap.Logger, cleanup func()
 	return
 }
 
-func LoggerWithContext(_ context.Context, logger *zap.Logger) *zap.Logger {
+func LoggerWithContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
 	// TODO: Add request ID to context
+	if ctx == nil {
+		return logger
+	}
+
+	// Requests made with impersonation tokens name the administrator behind
+	// them, the access token middleware sets it on the gin context
+	if actorAccountId, ok := ctx.Value("actorAccountId").(uint64); ok {
+		logger = logger.With(zap.Uint64("actor_account_id", actorAccountId))
+	}
+
 	return logger
 }
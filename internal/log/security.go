@@ -0,0 +1,12 @@
+package log
+
+import "go.uber.org/zap"
+
+// SecurityLogger tags the entries of a security relevant event so they can be
+// routed to the audit trail apart from the regular application logs.
+func SecurityLogger(logger *zap.Logger, event string) *zap.Logger {
+	return logger.With(
+		zap.Bool("security", true),
+		zap.String("event", event),
+	)
+}
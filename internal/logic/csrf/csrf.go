@@ -0,0 +1,98 @@
+package logic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"go.uber.org/zap"
+)
+
+const (
+	// CookieName is the cookie the token is handed to the web app in, it is
+	// readable by scripts. HeaderName is the header it is sent back in.
+	CookieName = "csrf_token"
+	HeaderName = "X-CSRF-Token"
+)
+
+// Csrf guards the routes authenticated by the refresh token cookie with
+// a double-submit token and an allow-list of origins. The token is an HMAC
+// of the refresh token, a token only works with the cookie it was issued
+// next to.
+type Csrf interface {
+	GenerateToken(refreshToken string) string
+	VerifyToken(refreshToken string, token string) bool
+	// IsOriginAllowed tells whether a request from the origin may use the
+	// cookie. The origin the request was sent to, the scheme and the host
+	// of the gateway itself, is allowed.
+	IsOriginAllowed(origin string, requestOrigin string) bool
+}
+
+type csrf struct {
+	allowedOrigins []string
+	key            []byte
+}
+
+func NewCsrfLogic(
+	config configs.Csrf,
+	logger *zap.Logger,
+) (Csrf, error) {
+	key := []byte(config.Secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			logger.With(zap.Error(err)).Error("failed to generate csrf secret")
+			return nil, err
+		}
+		logger.Warn("no csrf secret configured, csrf tokens will not survive a restart or work across instances")
+	}
+
+	allowedOrigins := make([]string, 0, len(config.AllowedOrigins))
+	for _, origin := range config.AllowedOrigins {
+		allowedOrigins = append(allowedOrigins, normalizeOrigin(origin))
+	}
+
+	return &csrf{
+		allowedOrigins: allowedOrigins,
+		key:            key,
+	}, nil
+}
+
+func (c *csrf) GenerateToken(refreshToken string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(refreshToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *csrf) VerifyToken(refreshToken string, token string) bool {
+	if token == "" {
+		return false
+	}
+	expected := c.GenerateToken(refreshToken)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+func (c *csrf) IsOriginAllowed(origin string, requestOrigin string) bool {
+	origin = normalizeOrigin(origin)
+	if slices.Contains(c.allowedOrigins, origin) {
+		return true
+	}
+
+	// An http page of the same host is another origin than the gateway
+	// served over https, the scheme has to match as well
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	return parsed.Scheme+"://"+parsed.Host == normalizeOrigin(requestOrigin)
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
@@ -0,0 +1,204 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderName is the request header carrying the proof, TokenType the
+	// authorization scheme and token type of bound access tokens
+	HeaderName = "DPoP"
+	TokenType  = "DPoP"
+
+	proofType = "dpop+jwt"
+
+	defaultProofMaxAge = time.Minute
+)
+
+var ErrInvalidProof = errors.New("invalid dpop proof")
+
+// Only asymmetric algorithms make sense, the key is in the proof itself
+var proofAlgorithms = []string{"ES256", "ES384", "RS256", "PS256", "EdDSA"}
+
+// Dpop checks the proofs of possession of RFC 9449. A proof is a JWT signed
+// by a key of the client and carrying the public key, it is made for one
+// request and accepted once.
+type Dpop interface {
+	// VerifyProof checks the proof sent with a request to uri and returns
+	// the RFC 7638 thumbprint of its key. The access token is the one sent
+	// along, empty for the token requests that bind new tokens to the key.
+	VerifyProof(ctx context.Context, proof string, method string, uri string, accessToken string) (thumbprint string, err error)
+}
+
+type dpop struct {
+	config         configs.Dpop
+	dpopProofCache cache.DpopProof
+	clock          utils.Clock
+	logger         *zap.Logger
+}
+
+func NewDpopLogic(
+	config configs.Dpop,
+	dpopProofCache cache.DpopProof,
+	clock utils.Clock,
+	logger *zap.Logger,
+) Dpop {
+	config.ProofMaxAge = utils.If(config.ProofMaxAge > 0, config.ProofMaxAge, defaultProofMaxAge)
+	return &dpop{
+		config:         config,
+		dpopProofCache: dpopProofCache,
+		clock:          clock,
+		logger:         logger,
+	}
+}
+
+func (d *dpop) VerifyProof(ctx context.Context, proof string, method string, uri string, accessToken string) (string, error) {
+	logger := log.LoggerWithContext(ctx, d.logger)
+
+	var thumbprint string
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(proofAlgorithms),
+		jwt.WithoutClaimsValidation(),
+	)
+	token, err := parser.Parse(proof, func(token *jwt.Token) (any, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		jwk, err := headerJSONWebKey(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		thumbprint, err = jwk.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		return token_logic.ParseJSONWebKey(jwk)
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Debug("failed to verify dpop proof")
+		return "", ErrInvalidProof
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidProof
+	}
+
+	// The proof is made for this request only
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	if htm != method || !isSameUri(htu, uri) {
+		logger.Debug("dpop proof was made for another request")
+		return "", ErrInvalidProof
+	}
+
+	now := d.clock.Now()
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return "", ErrInvalidProof
+	}
+	issuedAt := time.Unix(int64(iat), 0)
+	if issuedAt.Before(now.Add(-d.config.ProofMaxAge)) || issuedAt.After(now.Add(d.config.ProofMaxAge)) {
+		logger.Debug("dpop proof is not fresh")
+		return "", ErrInvalidProof
+	}
+
+	// Proofs presented with an access token name the token by its hash
+	if accessToken != "" {
+		ath, _ := claims["ath"].(string)
+		sum := sha256.Sum256([]byte(accessToken))
+		expected := base64.RawURLEncoding.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(ath), []byte(expected)) != 1 {
+			logger.Debug("dpop proof was made for another access token")
+			return "", ErrInvalidProof
+		}
+	}
+
+	// A proof is accepted once while it is fresh, jti only has to be unique
+	// per key
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", ErrInvalidProof
+	}
+	isFirstUse, err := d.dpopProofCache.Consume(ctx, hashProof(thumbprint, jti), 2*d.config.ProofMaxAge)
+	if err != nil {
+		return "", err
+	} else if !isFirstUse {
+		log.SecurityLogger(logger, "dpop_proof_replayed").
+			With(zap.String("jkt", thumbprint)).
+			Warn("dpop proof presented again")
+		return "", ErrInvalidProof
+	}
+
+	return thumbprint, nil
+}
+
+// headerJSONWebKey reads the public key of the jwk header, a private key
+// there is refused.
+func headerJSONWebKey(header any) (token_logic.JSONWebKey, error) {
+	members, ok := header.(map[string]any)
+	if !ok {
+		return token_logic.JSONWebKey{}, errors.New("jwk header is required")
+	}
+	if _, ok := members["d"]; ok {
+		return token_logic.JSONWebKey{}, errors.New("jwk header holds a private key")
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return token_logic.JSONWebKey{}, err
+	}
+	var jwk token_logic.JSONWebKey
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return token_logic.JSONWebKey{}, err
+	}
+	return jwk, nil
+}
+
+// RequestUri is the uri a proof for the request has to name. The scheme
+// set by a TLS terminating proxy is honoured.
+func RequestUri(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return (&url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath}).String()
+}
+
+// isSameUri compares the htu of a proof with the request uri, without the
+// query and fragment as RFC 9449 asks.
+func isSameUri(htu string, uri string) bool {
+	proofUri, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	requestUri, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(proofUri.Scheme, requestUri.Scheme) &&
+		strings.EqualFold(proofUri.Host, requestUri.Host) &&
+		proofUri.EscapedPath() == requestUri.EscapedPath()
+}
+
+func hashProof(thumbprint string, jti string) string {
+	sum := sha256.Sum256([]byte(thumbprint + ":" + jti))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,594 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/idp"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	"github.com/Fiagram/gateway/internal/log"
+	invite_logic "github.com/Fiagram/gateway/internal/logic/invite"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	verification_logic "github.com/Fiagram/gateway/internal/logic/verification"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStateTTL   = 10 * time.Minute
+	defaultIpMaxLinks = 20
+	defaultLinkWindow = time.Hour
+	// idTokenLeeway absorbs the clock skew between the gateway and the
+	// providers
+	idTokenLeeway = time.Minute
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// idTokenMethods are the signing algorithms accepted from providers. HMAC
+// is left out, the gateway only trusts keys published by the provider.
+var idTokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "EdDSA"}
+
+// usernameDisallowed strips what is not allowed in generated usernames
+var usernameDisallowed = regexp.MustCompile(`[^a-z0-9._-]`)
+
+const (
+	minUsernameLength = 5
+	maxUsernameLength = 20
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidState    = errors.New("invalid or expired federated sign-in")
+	ErrInvalidIdToken  = errors.New("the identity provider returned an invalid ID token")
+	ErrCodeRejected    = errors.New("the identity provider rejected the authorization code")
+	ErrEmailNotUnique  = errors.New("the email of the external account belongs to several accounts")
+	ErrTooManyLinks    = errors.New("too many new external accounts signed in, try again later")
+	// ErrSignUpClosed refuses the first sign-in of an external account not
+	// linked to an existing account while the registration is not open
+	ErrSignUpClosed = errors.New("new accounts cannot be created through an identity provider")
+)
+
+type ProviderInfo struct {
+	Id   string
+	Name string
+}
+
+type LoginResult struct {
+	AccountId    uint64
+	IsRememberMe bool
+	// IsCreated is true when the account was created for this sign-in
+	IsCreated bool
+}
+
+// Federation signs accounts in through upstream OpenID Connect providers
+// with the authorization code flow and PKCE. An external account is linked
+// to a Fiagram account on its first sign-in, the link is kept by subject
+// so that later changes of its email or username at the provider do not
+// matter.
+type Federation interface {
+	ListProviders(ctx context.Context) []ProviderInfo
+	// StartLogin returns the authorization URL of the provider to send the
+	// user agent to.
+	StartLogin(ctx context.Context, providerId string, isRememberMe bool) (authorizationUrl string, err error)
+	// CompleteLogin redeems the code returned by the provider and validates
+	// its ID token. A state is only accepted once. Past the max external
+	// accounts signing in for the first time from the IP it returns
+	// ErrTooManyLinks.
+	CompleteLogin(ctx context.Context, state string, code string, ipAddress string) (LoginResult, error)
+}
+
+// discovery is what is known of a provider, read on first use
+type discovery struct {
+	metadata idp.Metadata
+	keys     map[string]any
+}
+
+type federation struct {
+	config                 configs.Federation
+	loginStateCache        cache.FederatedLoginState
+	federatedIdentityCache cache.FederatedIdentity
+	idpClient              idp.Client
+	accountGrpc            account_grpc.Client
+	verificationLogic      verification_logic.EmailVerification
+	inviteLogic            invite_logic.Invite
+	clock                  utils.Clock
+	logger                 *zap.Logger
+
+	discoveries map[string]*discovery
+	mutex       *sync.Mutex
+}
+
+func NewFederationLogic(
+	config configs.Federation,
+	loginStateCache cache.FederatedLoginState,
+	federatedIdentityCache cache.FederatedIdentity,
+	idpClient idp.Client,
+	accountGrpc account_grpc.Client,
+	verificationLogic verification_logic.EmailVerification,
+	inviteLogic invite_logic.Invite,
+	clock utils.Clock,
+	logger *zap.Logger,
+) Federation {
+	config.StateTTL = utils.If(config.StateTTL > 0, config.StateTTL, defaultStateTTL)
+	config.IpMaxLinks = utils.If(config.IpMaxLinks > 0, config.IpMaxLinks, defaultIpMaxLinks)
+	config.Window = utils.If(config.Window > 0, config.Window, defaultLinkWindow)
+
+	return &federation{
+		config:                 config,
+		loginStateCache:        loginStateCache,
+		federatedIdentityCache: federatedIdentityCache,
+		idpClient:              idpClient,
+		accountGrpc:            accountGrpc,
+		verificationLogic:      verificationLogic,
+		inviteLogic:            inviteLogic,
+		clock:                  clock,
+		logger:                 logger,
+		discoveries:            make(map[string]*discovery),
+		mutex:                  new(sync.Mutex),
+	}
+}
+
+func (f *federation) ListProviders(ctx context.Context) []ProviderInfo {
+	providers := make([]ProviderInfo, 0, len(f.config.Providers))
+	for _, provider := range f.config.Providers {
+		providers = append(providers, ProviderInfo{
+			Id:   provider.Id,
+			Name: provider.Name,
+		})
+	}
+	return providers
+}
+
+func (f *federation) StartLogin(ctx context.Context, providerId string, isRememberMe bool) (string, error) {
+	provider, ok := f.findProvider(providerId)
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	metadata, err := f.getMetadata(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := utils.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := utils.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = f.loginStateCache.Set(ctx, utils.HashSecret(state), cache.FederatedLoginStateEntry{
+		ProviderId:   provider.Id,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		IsRememberMe: isRememberMe,
+		ExpiresAt:    f.clock.Now().Add(f.config.StateTTL).Unix(),
+	}, f.config.StateTTL)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationUrl, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	codeChallenge := sha256.Sum256([]byte(codeVerifier))
+
+	query := authorizationUrl.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientId)
+	query.Set("redirect_uri", f.config.RedirectUri)
+	query.Set("scope", strings.Join(utils.If(len(provider.Scopes) > 0, provider.Scopes, defaultScopes), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(codeChallenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authorizationUrl.RawQuery = query.Encode()
+
+	return authorizationUrl.String(), nil
+}
+
+func (f *federation) CompleteLogin(ctx context.Context, state string, code string, ipAddress string) (LoginResult, error) {
+	logger := log.LoggerWithContext(ctx, f.logger)
+
+	stateHash := utils.HashSecret(state)
+	entry, err := f.loginStateCache.Get(ctx, stateHash)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return LoginResult{}, ErrInvalidState
+	} else if err != nil {
+		return LoginResult{}, err
+	}
+	logger = logger.With(zap.String("provider_id", entry.ProviderId))
+
+	if !f.clock.Now().Before(time.Unix(entry.ExpiresAt, 0)) {
+		return LoginResult{}, ErrInvalidState
+	}
+
+	isFirstUse, err := f.loginStateCache.Consume(ctx, stateHash, f.config.StateTTL)
+	if err != nil {
+		return LoginResult{}, err
+	} else if !isFirstUse {
+		log.SecurityLogger(logger, "federated_login_replay").Warn("federated sign-in state presented again")
+		return LoginResult{}, ErrInvalidState
+	}
+
+	if err := f.loginStateCache.Del(ctx, stateHash); err != nil {
+		return LoginResult{}, err
+	}
+
+	provider, ok := f.findProvider(entry.ProviderId)
+	if !ok {
+		return LoginResult{}, ErrInvalidState
+	}
+	metadata, err := f.getMetadata(ctx, provider)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	tokens, err := f.idpClient.ExchangeCode(ctx, metadata.TokenEndpoint, provider.ClientId, provider.ClientSecret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {f.config.RedirectUri},
+		"code_verifier": {entry.CodeVerifier},
+	})
+	var tokenErr *idp.TokenError
+	if errors.As(err, &tokenErr) {
+		log.SecurityLogger(logger, "federated_login_failed").
+			With(zap.String("error", tokenErr.Code)).
+			Warn("identity provider rejected the authorization code")
+		return LoginResult{}, ErrCodeRejected
+	} else if err != nil {
+		return LoginResult{}, err
+	}
+
+	claims, err := f.verifyIdToken(ctx, provider, tokens.IdToken, entry.Nonce)
+	if err != nil {
+		log.SecurityLogger(logger, "federated_login_failed").
+			With(zap.Error(err)).
+			Warn("identity provider returned an invalid ID token")
+		return LoginResult{}, ErrInvalidIdToken
+	}
+
+	accountId, isCreated, err := f.linkAccount(ctx, provider, claims, ipAddress)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	log.SecurityLogger(logger, "federated_login").
+		With(zap.Uint64("account_id", accountId)).
+		Info("signed in through an identity provider")
+
+	return LoginResult{
+		AccountId:    accountId,
+		IsRememberMe: entry.IsRememberMe,
+		IsCreated:    isCreated,
+	}, nil
+}
+
+// idTokenClaims are the claims of an upstream ID token the gateway reads
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+}
+
+func (f *federation) verifyIdToken(ctx context.Context, provider configs.FederatedProvider, idToken string, nonce string) (*idTokenClaims, error) {
+	if idToken == "" {
+		return nil, errors.New("no ID token in the token response")
+	}
+
+	metadata, err := f.getMetadata(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return f.getKey(ctx, provider, kid)
+	},
+		jwt.WithValidMethods(idTokenMethods),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(provider.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+		jwt.WithTimeFunc(f.clock.Now),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	// A token for several audiences has to name the party it was issued to
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != provider.ClientId {
+		return nil, errors.New("ID token was issued to another party")
+	}
+
+	return claims, nil
+}
+
+// linkAccount finds the account linked to the external account, linking
+// or creating one on its first sign-in.
+func (f *federation) linkAccount(ctx context.Context, provider configs.FederatedProvider, claims *idTokenClaims, ipAddress string) (uint64, bool, error) {
+	logger := log.LoggerWithContext(ctx, f.logger).
+		With(zap.String("provider_id", provider.Id)).
+		With(zap.String("ip_address", ipAddress))
+
+	entry, err := f.federatedIdentityCache.Get(ctx, provider.Id, claims.Subject)
+	if err == nil {
+		return entry.AccountId, false, nil
+	} else if !errors.Is(err, cache.ErrCacheMiss) {
+		return 0, false, err
+	}
+
+	// The limit comes before the lookups by email, which scan the accounts
+	if ipAddress != "" {
+		links, err := f.federatedIdentityCache.IncrIpLinks(ctx, ipAddress, f.config.Window)
+		if err != nil {
+			return 0, false, err
+		} else if links > int64(f.config.IpMaxLinks) {
+			log.SecurityLogger(logger, "federated_link_rate_limited").Warn("too many new external accounts signed in from an ip")
+			return 0, false, ErrTooManyLinks
+		}
+	}
+
+	var accountId uint64
+	if provider.LinkByEmail && claims.EmailVerified {
+		accountId, err = account_grpc.FindAccountIdByEmail(ctx, f.accountGrpc, claims.Email)
+		if errors.Is(err, account_grpc.ErrEmailNotUnique) {
+			log.SecurityLogger(logger, "federated_link_ambiguous_email").Warn("refused to link an email of several accounts")
+			return 0, false, ErrEmailNotUnique
+		} else if err != nil {
+			logger.With(zap.Error(err)).Error("failed to find account by email")
+			return 0, false, err
+		}
+	}
+
+	isCreated := accountId == 0
+	if isCreated {
+		// Invite codes cannot be presented through a provider
+		if f.inviteLogic.Mode() != configs.RegistrationModeOpen {
+			log.SecurityLogger(logger, "federated_sign_up_refused").Info("refused to create an account while the registration is not open")
+			return 0, false, ErrSignUpClosed
+		}
+		accountId, err = f.createAccount(ctx, provider, claims)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	err = f.federatedIdentityCache.Set(ctx, cache.FederatedIdentityEntry{
+		ProviderId: provider.Id,
+		Subject:    claims.Subject,
+		AccountId:  accountId,
+		LinkedAt:   f.clock.Now().Unix(),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	log.SecurityLogger(logger, "federated_identity_linked").
+		With(zap.Uint64("account_id", accountId)).
+		With(zap.Bool("is_created", isCreated)).
+		Info("linked an external account")
+
+	return accountId, isCreated, nil
+}
+
+func (f *federation) createAccount(ctx context.Context, provider configs.FederatedProvider, claims *idTokenClaims) (uint64, error) {
+	logger := log.LoggerWithContext(ctx, f.logger).With(zap.String("provider_id", provider.Id))
+
+	username, err := f.availableUsername(ctx, provider, claims)
+	if err != nil {
+		return 0, err
+	}
+	password, err := generatePassword()
+	if err != nil {
+		return 0, err
+	}
+
+	// An email that another account has is left out, it was not trusted
+	// enough to link the accounts and must not be found for the other one
+	email := strings.TrimSpace(claims.Email)
+	ownerId, err := account_grpc.FindAccountIdByEmail(ctx, f.accountGrpc, email)
+	if errors.Is(err, account_grpc.ErrEmailNotUnique) || (err == nil && ownerId != 0) {
+		log.SecurityLogger(logger, "federated_email_dropped").Info("created an account without the email of another account")
+		email = ""
+	} else if err != nil {
+		logger.With(zap.Error(err)).Error("failed to find account by email")
+		return 0, err
+	}
+
+	resp, err := f.accountGrpc.CreateAccount(ctx, &account_service.CreateAccountRequest{
+		AccountInfo: &account_service.AccountInfo{
+			Username: username,
+			Fullname: utils.If(strings.TrimSpace(claims.Name) != "", strings.TrimSpace(claims.Name), username),
+			Email:    email,
+			Role:     account_service.AccountInfo_MEMBER,
+		},
+		Password: password,
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to create account")
+		return 0, err
+	} else if resp.AccountId == 0 {
+		return 0, errors.New("account service did not create the account")
+	}
+
+	// An email the provider did not verify is verified as at sign-up, the
+	// account exists already so a failed mail can be resent later
+	if email != "" && !claims.EmailVerified {
+		if err := f.verificationLogic.Start(ctx, resp.AccountId, email); err != nil {
+			logger.With(zap.Error(err)).
+				With(zap.Uint64("account_id", resp.AccountId)).
+				Error("failed to start email verification")
+		}
+	}
+
+	return resp.AccountId, nil
+}
+
+// availableUsername derives the username of a new account from the
+// external one, falling back to one made of the provider and the subject.
+func (f *federation) availableUsername(ctx context.Context, provider configs.FederatedProvider, claims *idTokenClaims) (string, error) {
+	emailName, _, _ := strings.Cut(claims.Email, "@")
+	subjectHash := sha256.Sum256([]byte(provider.Id + ":" + claims.Subject))
+	candidates := []string{
+		claims.PreferredUsername,
+		emailName,
+		"fed_" + hex.EncodeToString(subjectHash[:])[:maxUsernameLength-len("fed_")],
+	}
+
+	for _, candidate := range candidates {
+		username := usernameDisallowed.ReplaceAllString(strings.ToLower(strings.TrimSpace(candidate)), "")
+		username = username[:min(len(username), maxUsernameLength)]
+		if len(username) < minUsernameLength {
+			continue
+		}
+
+		resp, err := f.accountGrpc.IsUsernameTaken(ctx, &account_service.IsUsernameTakenRequest{
+			Username: username,
+		})
+		if err != nil {
+			return "", err
+		} else if !resp.IsTaken {
+			return username, nil
+		}
+	}
+
+	return "", errors.New("no username available for the external account")
+}
+
+func (f *federation) findProvider(providerId string) (configs.FederatedProvider, bool) {
+	index := slices.IndexFunc(f.config.Providers, func(provider configs.FederatedProvider) bool {
+		return provider.Id == providerId
+	})
+	if index < 0 {
+		return configs.FederatedProvider{}, false
+	}
+	return f.config.Providers[index], true
+}
+
+// getMetadata reads the discovery document of the provider once.
+func (f *federation) getMetadata(ctx context.Context, provider configs.FederatedProvider) (idp.Metadata, error) {
+	f.mutex.Lock()
+	known, ok := f.discoveries[provider.Id]
+	f.mutex.Unlock()
+	if ok {
+		return known.metadata, nil
+	}
+
+	metadata, err := f.idpClient.GetMetadata(ctx, provider.Issuer)
+	if err != nil {
+		return idp.Metadata{}, err
+	}
+	// OpenID Connect Discovery requires the issuer to be the one asked for
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(provider.Issuer, "/") {
+		return idp.Metadata{}, fmt.Errorf("identity provider %s announced the issuer %s", provider.Id, metadata.Issuer)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.discoveries[provider.Id] = &discovery{metadata: metadata}
+	return metadata, nil
+}
+
+// getKey returns the verification key of the provider with the kid. The
+// keys are read again when the kid is unknown, since providers rotate
+// them.
+func (f *federation) getKey(ctx context.Context, provider configs.FederatedProvider, kid string) (any, error) {
+	metadata, err := f.getMetadata(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	keys := f.discoveries[provider.Id].keys
+	f.mutex.Unlock()
+
+	key, ok := findKey(keys, kid)
+	if ok {
+		return key, nil
+	}
+
+	keySet, err := f.idpClient.GetKeySet(ctx, metadata.JwksUri)
+	if err != nil {
+		return nil, err
+	}
+	keys = make(map[string]any, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := token_logic.ParseJSONWebKey(token_logic.JSONWebKey(jwk))
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	f.mutex.Lock()
+	f.discoveries[provider.Id].keys = keys
+	f.mutex.Unlock()
+
+	key, ok = findKey(keys, kid)
+	if !ok {
+		return nil, fmt.Errorf("no key %q published by the identity provider", kid)
+	}
+	return key, nil
+}
+
+// findKey looks a key up by kid. Tokens without a kid are only accepted
+// from providers publishing a single key.
+func findKey(keys map[string]any, kid string) (any, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok && kid != ""
+}
+
+// generatePassword makes the password of an account created for an
+// external one. Nobody knows it, the account signs in through its
+// provider or sets a password with a reset.
+func generatePassword() (string, error) {
+	password, err := utils.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	// Meets the password rules of the account service
+	return password + "aA1!", nil
+}
@@ -0,0 +1,262 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	invite_logic "github.com/Fiagram/gateway/internal/logic/invite"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AdminLogic serves the routes restricted to the ADMIN role, the role is
+// checked by the route group rather than by the handlers.
+type AdminLogic interface {
+	RevokeAccountSessions(c *gin.Context, accountId uint64)
+	ListSignInLockouts(c *gin.Context)
+	UnlockSignIn(c *gin.Context, kind string, value string)
+	ListInviteCodes(c *gin.Context)
+	CreateInviteCode(c *gin.Context)
+	RevokeInviteCode(c *gin.Context, inviteCodeId string)
+}
+
+var _ AdminLogic = (oapi.ServerInterface)(nil)
+
+type adminLogic struct {
+	sessionLogic  session_logic.Session
+	throttleLogic throttle_logic.SignInThrottle
+	inviteLogic   invite_logic.Invite
+	logger        *zap.Logger
+}
+
+func NewAdminLogic(
+	sessionLogic session_logic.Session,
+	throttleLogic throttle_logic.SignInThrottle,
+	inviteLogic invite_logic.Invite,
+	logger *zap.Logger,
+) AdminLogic {
+	return &adminLogic{
+		sessionLogic:  sessionLogic,
+		throttleLogic: throttleLogic,
+		inviteLogic:   inviteLogic,
+		logger:        logger,
+	}
+}
+
+func (a *adminLogic) RevokeAccountSessions(c *gin.Context, accountId uint64) {
+	logger := log.LoggerWithContext(c, a.logger).
+		With(zap.Uint64("account_id", accountId)).
+		With(zap.Uint64("admin_account_id", c.GetUint64("accountId")))
+
+	if accountId == 0 {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: "invalid account id",
+		})
+		return
+	}
+
+	if err := a.sessionLogic.RevokeAll(c, accountId); err != nil {
+		errMsg := "failed to revoke sessions of the account"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	log.SecurityLogger(logger, "admin_signout_account").Info("signed an account out of every session")
+
+	c.Status(http.StatusNoContent)
+}
+
+func (a *adminLogic) ListSignInLockouts(c *gin.Context) {
+	logger := log.LoggerWithContext(c, a.logger)
+
+	entries, err := a.throttleLogic.ListLockouts(c)
+	if err != nil {
+		errMsg := "failed to list sign-in lockouts"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	lockouts := make([]oapi.SignInLockout, 0, len(entries))
+	for _, entry := range entries {
+		lockouts = append(lockouts, oapi.SignInLockout{
+			Kind:        entry.Kind,
+			Value:       entry.Value,
+			Failures:    entry.Failures,
+			LockedUntil: entry.BlockedUntil,
+			CreatedAt:   entry.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, oapi.SignInLockoutsResponse{
+		Lockouts: lockouts,
+	})
+}
+
+func (a *adminLogic) UnlockSignIn(c *gin.Context, kind string, value string) {
+	logger := log.LoggerWithContext(c, a.logger).
+		With(zap.Uint64("admin_account_id", c.GetUint64("accountId")))
+
+	err := a.throttleLogic.Unlock(c, kind, value)
+	if errors.Is(err, throttle_logic.ErrInvalidKind) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return
+	} else if errors.Is(err, throttle_logic.ErrLockoutNotFound) {
+		c.JSON(http.StatusNotFound, oapi.NotFound{
+			Code:    "NotFound",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to lift sign-in lockout"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (a *adminLogic) ListInviteCodes(c *gin.Context) {
+	logger := log.LoggerWithContext(c, a.logger)
+
+	entries, err := a.inviteLogic.List(c)
+	if err != nil {
+		errMsg := "failed to list invite codes"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	inviteCodes := make([]oapi.InviteCode, 0, len(entries))
+	for _, entry := range entries {
+		inviteCodes = append(inviteCodes, toInviteCode(entry))
+	}
+
+	c.JSON(http.StatusOK, oapi.InviteCodesResponse{
+		InviteCodes: inviteCodes,
+	})
+}
+
+func (a *adminLogic) CreateInviteCode(c *gin.Context) {
+	logger := log.LoggerWithContext(c, a.logger).
+		With(zap.Uint64("admin_account_id", c.GetUint64("accountId")))
+
+	var req oapi.CreateInviteCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	params := invite_logic.CreateParams{
+		CreatedBy: c.GetUint64("accountId"),
+	}
+	if req.Role != nil {
+		params.Role = string(*req.Role)
+	}
+	if req.MaxUses != nil {
+		// Zero would fall back to a single use
+		if *req.MaxUses == 0 {
+			c.JSON(http.StatusBadRequest, oapi.BadRequest{
+				Code:    "BadRequest",
+				Message: invite_logic.ErrInvalidMaxUses.Error(),
+			})
+			return
+		}
+		params.MaxUses = *req.MaxUses
+	}
+	if req.ExpiresAt != nil {
+		params.ExpiresAt = time.Unix(*req.ExpiresAt, 0)
+	}
+
+	code, entry, err := a.inviteLogic.Create(c, params)
+	if errors.Is(err, invite_logic.ErrInvalidRole) ||
+		errors.Is(err, invite_logic.ErrInvalidMaxUses) ||
+		errors.Is(err, invite_logic.ErrInvalidExpiry) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to create invite code"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The code must never be cached by intermediaries
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, oapi.CreatedInviteCodeResponse{
+		Code:       code,
+		InviteCode: toInviteCode(entry),
+	})
+}
+
+func (a *adminLogic) RevokeInviteCode(c *gin.Context, inviteCodeId string) {
+	logger := log.LoggerWithContext(c, a.logger).
+		With(zap.String("invite_code_id", inviteCodeId)).
+		With(zap.Uint64("admin_account_id", c.GetUint64("accountId")))
+
+	err := a.inviteLogic.Revoke(c, inviteCodeId)
+	if errors.Is(err, invite_logic.ErrInviteNotFound) {
+		c.JSON(http.StatusNotFound, oapi.NotFound{
+			Code:    "NotFound",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to revoke invite code"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func toInviteCode(entry cache.InviteCodeEntry) oapi.InviteCode {
+	return oapi.InviteCode{
+		Id:        entry.Id,
+		Role:      oapi.InviteCodeRole(entry.Role),
+		MaxUses:   entry.MaxUses,
+		Uses:      entry.Uses,
+		CreatedBy: entry.CreatedBy,
+		CreatedAt: entry.CreatedAt,
+		ExpiresAt: entry.ExpiresAt,
+	}
+}
@@ -1,7 +1,10 @@
 package logic
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,7 +14,18 @@ import (
 	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
 	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
 	"github.com/Fiagram/gateway/internal/log"
+	csrf_logic "github.com/Fiagram/gateway/internal/logic/csrf"
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
+	federation_logic "github.com/Fiagram/gateway/internal/logic/federation"
+	invite_logic "github.com/Fiagram/gateway/internal/logic/invite"
+	magiclink_logic "github.com/Fiagram/gateway/internal/logic/magiclink"
+	mfa_logic "github.com/Fiagram/gateway/internal/logic/mfa"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
 	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	verification_logic "github.com/Fiagram/gateway/internal/logic/verification"
+	webauthn_logic "github.com/Fiagram/gateway/internal/logic/webauthn"
 	"github.com/Fiagram/gateway/internal/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -19,9 +33,25 @@ import (
 
 type AuthLogic interface {
 	SignIn(c *gin.Context)
+	SignInMfa(c *gin.Context)
 	SignUp(c *gin.Context)
 	RefreshToken(c *gin.Context)
 	SignOut(c *gin.Context)
+	SignOutAll(c *gin.Context)
+	Reauthenticate(c *gin.Context)
+	BeginWebAuthnRegistration(c *gin.Context)
+	FinishWebAuthnRegistration(c *gin.Context)
+	BeginWebAuthnLogin(c *gin.Context)
+	FinishWebAuthnLogin(c *gin.Context)
+	ForgotPassword(c *gin.Context)
+	ResetPassword(c *gin.Context)
+	VerifyEmail(c *gin.Context)
+	ResendEmailVerification(c *gin.Context)
+	RequestMagicLink(c *gin.Context)
+	ConsumeMagicLink(c *gin.Context)
+	ListFederatedProviders(c *gin.Context)
+	StartFederatedLogin(c *gin.Context, providerId string, params oapi.StartFederatedLoginParams)
+	CompleteFederatedLogin(c *gin.Context)
 }
 
 var _ AuthLogic = (oapi.ServerInterface)(nil)
@@ -29,26 +59,59 @@ var _ AuthLogic = (oapi.ServerInterface)(nil)
 type authLogic struct {
 	authConfig          configs.Auth
 	usernamesTakenCache cache.UsernamesTaken
-	refreshTokenCache   cache.RefreshToken
 	accountGrpc         account_grpc.Client
 	tokenLogic          token_logic.Token
+	sessionLogic        session_logic.Session
+	mfaLogic            mfa_logic.Mfa
+	webAuthnLogic       webauthn_logic.WebAuthn
+	throttleLogic       throttle_logic.SignInThrottle
+	passwordResetLogic  password_logic.PasswordReset
+	passwordPolicy      password_logic.Policy
+	inviteLogic         invite_logic.Invite
+	verificationLogic   verification_logic.EmailVerification
+	magicLinkLogic      magiclink_logic.MagicLink
+	federationLogic     federation_logic.Federation
+	csrfLogic           csrf_logic.Csrf
+	dpopLogic           dpop_logic.Dpop
 	logger              *zap.Logger
 }
 
 func NewAuthLogic(
 	authConfig configs.Auth,
 	usernamesTakenCache cache.UsernamesTaken,
-	refreshTokenCache cache.RefreshToken,
 	accountGrpc account_grpc.Client,
 	tokenLogic token_logic.Token,
+	sessionLogic session_logic.Session,
+	mfaLogic mfa_logic.Mfa,
+	webAuthnLogic webauthn_logic.WebAuthn,
+	throttleLogic throttle_logic.SignInThrottle,
+	passwordResetLogic password_logic.PasswordReset,
+	passwordPolicy password_logic.Policy,
+	inviteLogic invite_logic.Invite,
+	verificationLogic verification_logic.EmailVerification,
+	magicLinkLogic magiclink_logic.MagicLink,
+	federationLogic federation_logic.Federation,
+	csrfLogic csrf_logic.Csrf,
+	dpopLogic dpop_logic.Dpop,
 	logger *zap.Logger,
 ) AuthLogic {
 	return &authLogic{
 		authConfig:          authConfig,
 		usernamesTakenCache: usernamesTakenCache,
-		refreshTokenCache:   refreshTokenCache,
 		accountGrpc:         accountGrpc,
 		tokenLogic:          tokenLogic,
+		sessionLogic:        sessionLogic,
+		mfaLogic:            mfaLogic,
+		webAuthnLogic:       webAuthnLogic,
+		throttleLogic:       throttleLogic,
+		passwordResetLogic:  passwordResetLogic,
+		passwordPolicy:      passwordPolicy,
+		inviteLogic:         inviteLogic,
+		verificationLogic:   verificationLogic,
+		magicLinkLogic:      magicLinkLogic,
+		federationLogic:     federationLogic,
+		csrfLogic:           csrfLogic,
+		dpopLogic:           dpopLogic,
 		logger:              logger,
 	}
 }
@@ -68,24 +131,33 @@ func (o *authLogic) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Get account ID from refresh token cache
-	accountId, err := o.refreshTokenCache.Get(c, refreshToken)
-	if err != nil || accountId == 0 {
+	keyThumbprint, ok := o.dpopKeyThumbprint(c)
+	if !ok {
+		return
+	}
+
+	// Rotate the refresh token, a reused token revokes its whole family
+	client := clientInfo(c)
+	client.KeyThumbprint = keyThumbprint
+	issued, err := o.sessionLogic.Rotate(c, refreshToken, client)
+	if errors.Is(err, session_logic.ErrKeyMismatch) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: err.Error(),
+		})
+		return
+	} else if errors.Is(err, session_logic.ErrInvalidRefreshToken) ||
+		errors.Is(err, session_logic.ErrRefreshTokenReused) {
 		errMsg := "invalid or expired refresh token"
 		logger.With(zap.Error(err)).Error(errMsg)
+		clearRefreshTokenCookie(c, o.authConfig.Domain)
 		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
 			Code:    "Unauthorized",
 			Message: errMsg,
 		})
 		return
-	}
-
-	// Create a new access token
-	accessToken, accessTokenExpiresAt, err := o.tokenLogic.GenerateAccessToken(c, token_logic.TokenPayload{
-		AccountId: accountId,
-	})
-	if err != nil {
-		errMsg := "failed to generate access token"
+	} else if err != nil {
+		errMsg := "failed to rotate refresh token"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
@@ -94,10 +166,10 @@ func (o *authLogic) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Generate new refresh token (rotation)
-	newRefreshToken, newRefreshTokenExpiresAt, err := o.tokenLogic.GenerateRefreshToken(c)
+	// The role is looked up again so that role changes apply on refresh
+	role, err := o.accountRole(c, issued.AccountId)
 	if err != nil {
-		errMsg := "failed to generate refresh token"
+		errMsg := "failed to get account role"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
@@ -106,10 +178,22 @@ func (o *authLogic) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Save the new refresh token to cache
-	err = o.refreshTokenCache.Set(c, newRefreshToken, accountId, o.authConfig.Token.RefreshTokenTTL)
+	isEmailUnverified, ok := o.checkEmailVerified(c, issued.AccountId)
+	if !ok {
+		return
+	}
+
+	// Create a new access token
+	accessToken, accessTokenExpiresAt, err := o.tokenLogic.GenerateAccessToken(c, token_logic.TokenPayload{
+		AccountId:         issued.AccountId,
+		SessionId:         issued.SessionId,
+		Role:              role,
+		IsEmailUnverified: isEmailUnverified,
+		AuthTime:          issued.AuthTime,
+		KeyThumbprint:     keyThumbprint,
+	})
 	if err != nil {
-		errMsg := "failed to save refresh token"
+		errMsg := "failed to generate access token"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
@@ -118,31 +202,13 @@ func (o *authLogic) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Revoke old refresh token
-	if _, err := o.refreshTokenCache.Del(c, refreshToken); err != nil {
-		logger.With(zap.Error(err)).Error("failed to revoke old refresh token")
-		// Continue anyway, not a critical error
-	}
-
 	// Return the refresh token to cookie
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    newRefreshToken,
-		Path:     "/api/v1/auth/token",
-		Domain:   o.authConfig.Domain,
-		Expires:  newRefreshTokenExpiresAt,
-		MaxAge:   int(time.Until(newRefreshTokenExpiresAt).Seconds()),
-		Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	setRefreshTokenCookie(c, o.authConfig.Domain, issued.RefreshToken,
+		o.csrfLogic.GenerateToken(issued.RefreshToken), issued.ExpiresAt)
 
 	// Return the new access token in response
 	c.JSON(http.StatusOK, oapi.RefreshResponse{
-		AccessToken: oapi.AccessTokenResponse{
-			Token: accessToken,
-			Exp:   accessTokenExpiresAt.Unix(),
-		},
+		AccessToken: accessTokenResponse(accessToken, accessTokenExpiresAt, keyThumbprint),
 	})
 }
 
@@ -161,9 +227,10 @@ func (o *authLogic) SignIn(c *gin.Context) {
 		return
 	}
 
-	// Verify data input is not empty
+	// Verify data input is not empty. The password is checked as typed,
+	// like it is set
 	username := strings.TrimSpace(req.Username)
-	password := strings.TrimSpace(*req.Password)
+	password := *req.Password
 	isRememberMe := *req.IsRememberMe
 	logger.With(zap.String("username", username))
 	if username == "" || password == "" {
@@ -176,12 +243,27 @@ func (o *authLogic) SignIn(c *gin.Context) {
 		return
 	}
 
-	// Checking account valid
-	validResp, err := o.accountGrpc.CheckAccountValid(c,
-		&account_service.CheckAccountValidRequest{
-			Username: username,
-			Password: password,
+	// Refuse the attempt while the username or the IP is blocked
+	retryAfter, err := o.throttleLogic.Check(c, username, c.ClientIP())
+	if errors.Is(err, throttle_logic.ErrTooManyAttempts) {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+		c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+			Code:    "TooManyRequests",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to check sign-in attempts"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
 		})
+		return
+	}
+
+	// Checking account valid
+	accountId, err := password_logic.CheckAccountValid(c, o.accountGrpc, username, password)
 	if err != nil {
 		errMsg := "failed to check account valid"
 		logger.With(zap.Error(err)).Error(errMsg)
@@ -190,7 +272,16 @@ func (o *authLogic) SignIn(c *gin.Context) {
 			Message: errMsg,
 		})
 		return
-	} else if validResp.AccountId == 0 {
+	} else if accountId == 0 {
+		if err := o.throttleLogic.RecordFailure(c, username, c.ClientIP()); err != nil {
+			errMsg := "failed to record failed sign-in"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
 			Code:    "Unauthorized",
 			Message: "invalid username or password",
@@ -198,12 +289,8 @@ func (o *authLogic) SignIn(c *gin.Context) {
 		return
 	}
 
-	// Create a new access token
-	accessToken, accessTokenExpiresAt, err := o.tokenLogic.GenerateAccessToken(c, token_logic.TokenPayload{
-		AccountId: validResp.AccountId,
-	})
-	if err != nil {
-		errMsg := "failed to gen access token"
+	if err := o.throttleLogic.RecordSuccess(c, username); err != nil {
+		errMsg := "failed to reset failed sign-ins"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
@@ -212,27 +299,41 @@ func (o *authLogic) SignIn(c *gin.Context) {
 		return
 	}
 
-	// Create refresh token
-	refreshToken, refreshTokenExpiresAt, err := o.tokenLogic.GenerateRefreshToken(c)
-	if err != nil {
-		errMsg := "failed to gen refresh token"
+	o.completeSignIn(c, accountId, isRememberMe)
+}
+
+func (o *authLogic) SignInMfa(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	// Decode the incoming JSON object
+	var req oapi.SigninMfaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
 		logger.With(zap.Error(err)).Error(errMsg)
-		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
-			Code:    "InternalServerError",
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
 			Message: errMsg,
 		})
 		return
 	}
 
-	// Save the refresh token to the redis
-	err = o.refreshTokenCache.Set(c,
-		refreshToken, validResp.AccountId,
-		utils.If(isRememberMe,
-			o.authConfig.Token.RefreshTokenLongTTL,
-			o.authConfig.Token.RefreshTokenTTL),
-	)
-	if err != nil {
-		errMsg := "failed to save refresh token"
+	// Exchange the challenge and the code for the sign-in
+	challenge, err := o.mfaLogic.CompleteChallenge(c, req.MfaToken, req.Code)
+	if errors.Is(err, mfa_logic.ErrInvalidChallenge) ||
+		errors.Is(err, mfa_logic.ErrInvalidCode) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: err.Error(),
+		})
+		return
+	} else if errors.Is(err, throttle_logic.ErrTooManyAttempts) {
+		c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+			Code:    "TooManyRequests",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to complete mfa challenge"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
@@ -241,26 +342,7 @@ func (o *authLogic) SignIn(c *gin.Context) {
 		return
 	}
 
-	// Return the refresh token to cookie
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Path:     "/api/v1/auth/token",
-		Domain:   o.authConfig.Domain,
-		Expires:  refreshTokenExpiresAt,
-		MaxAge:   int(time.Until(refreshTokenExpiresAt).Seconds()),
-		Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	// Return the access token to the response
-	c.JSON(http.StatusOK, oapi.SigninResponse{
-		AccessToken: oapi.AccessTokenResponse{
-			Token: accessToken,
-			Exp:   accessTokenExpiresAt.Unix(),
-		},
-	})
+	o.startSession(c, challenge.AccountId, challenge.IsRememberMe)
 }
 
 func (o *authLogic) SignOut(c *gin.Context) {
@@ -278,9 +360,8 @@ func (o *authLogic) SignOut(c *gin.Context) {
 		return
 	}
 
-	// Revoke the refresh token from cache
-	isDone, err := o.refreshTokenCache.Del(c, refreshToken)
-	if err != nil || isDone == false {
+	// Revoke the refresh token together with its family
+	if err := o.sessionLogic.Revoke(c, refreshToken); err != nil {
 		errMsg := "failed to revoke refresh token"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
@@ -290,17 +371,50 @@ func (o *authLogic) SignOut(c *gin.Context) {
 		return
 	}
 
-	// Return the refresh token to cookie
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/api/v1/auth/token",
-		Domain:   o.authConfig.Domain,
-		MaxAge:   -1,
-		Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	// Revoke the access token of the caller as well, if there is one
+	if accessToken, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		payload, expiresAt, err := o.tokenLogic.GetPayloadFromAccessToken(c, accessToken)
+		if err == nil {
+			err = o.sessionLogic.RevokeAccessToken(c, payload, expiresAt)
+		}
+		if err != nil {
+			logger.With(zap.Error(err)).Warn("failed to revoke access token on sign out")
+		}
+	}
+
+	// Clear the refresh token cookie
+	clearRefreshTokenCookie(c, o.authConfig.Domain)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (o *authLogic) SignOutAll(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// Revoke every session and every access token of the account
+	if err := o.sessionLogic.RevokeAll(c, accountId.(uint64)); err != nil {
+		errMsg := "failed to revoke sessions"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// Clear the refresh token cookie
+	clearRefreshTokenCookie(c, o.authConfig.Domain)
 
 	c.Status(http.StatusNoContent)
 }
@@ -310,7 +424,7 @@ func (o *authLogic) SignUp(c *gin.Context) {
 
 	// Decode the incoming JSON object
 	var req oapi.SignupRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || req.Password == nil {
 		logger.With(zap.Error(err)).Error("failed to decode incoming JSON")
 		c.JSON(http.StatusBadRequest, oapi.BadRequest{
 			Code:    "BadRequest",
@@ -319,6 +433,46 @@ func (o *authLogic) SignUp(c *gin.Context) {
 		return
 	}
 
+	inviteCode := ""
+	if req.InviteCode != nil {
+		inviteCode = strings.TrimSpace(*req.InviteCode)
+	}
+	switch o.inviteLogic.Mode() {
+	case configs.RegistrationModeClosed:
+		c.JSON(http.StatusForbidden, oapi.Forbidden{
+			Code:    "Forbidden",
+			Message: invite_logic.ErrRegistrationClosed.Error(),
+		})
+		return
+	case configs.RegistrationModeInviteOnly:
+		if inviteCode == "" {
+			c.JSON(http.StatusForbidden, oapi.Forbidden{
+				Code:    "Forbidden",
+				Message: invite_logic.ErrInviteRequired.Error(),
+			})
+			return
+		}
+	}
+
+	// The password is taken as typed, whitespace is refused rather than
+	// trimmed away
+	err := o.passwordPolicy.Validate(c, *req.Password, password_logic.Account{
+		Username: req.Account.Username,
+		Email:    req.Account.Email,
+	})
+	if errors.Is(err, password_logic.ErrInvalidPassword) {
+		writeInvalidPassword(c, err)
+		return
+	} else if err != nil {
+		errMsg := "failed to check password"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
 	// Check whether the username is taken
 	username := req.Account.Username
 	isTaken, err := o.usernamesTakenCache.Has(c, username)
@@ -353,6 +507,33 @@ func (o *authLogic) SignUp(c *gin.Context) {
 		return
 	}
 
+	// The code is consumed last, so that a sign-up refused for another
+	// reason does not use it up. A code is also honoured in the open mode
+	// for the role it assigns.
+	role := account_service.AccountInfo_MEMBER
+	var invite cache.InviteCodeEntry
+	if inviteCode != "" {
+		invite, err = o.inviteLogic.Redeem(c, inviteCode)
+		if errors.Is(err, invite_logic.ErrInvalidInviteCode) {
+			c.JSON(http.StatusForbidden, oapi.Forbidden{
+				Code:    "Forbidden",
+				Message: err.Error(),
+			})
+			return
+		} else if err != nil {
+			errMsg := "failed to redeem invite code"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
+		if invite.Role == token_logic.RoleAdmin {
+			role = account_service.AccountInfo_ADMIN
+		}
+	}
+
 	// Process the incoming request
 	accResp, err := o.accountGrpc.CreateAccount(c, &account_service.CreateAccountRequest{
 		AccountInfo: &account_service.AccountInfo{
@@ -360,11 +541,17 @@ func (o *authLogic) SignUp(c *gin.Context) {
 			Fullname:    strings.TrimSpace(req.Account.Fullname),
 			Email:       strings.TrimSpace(req.Account.Email),
 			PhoneNumber: strings.TrimSpace(*req.Account.PhoneNumber.CountryCode + " " + *req.Account.PhoneNumber.Number),
-			Role:        2,
+			Role:        role,
 		},
-		Password: strings.TrimSpace(*req.Password),
+		Password: *req.Password,
 	})
 	if err != nil || accResp.AccountId == 0 {
+		// The invite code was not used after all
+		if inviteCode != "" {
+			if err := o.inviteLogic.Release(c, invite); err != nil {
+				logger.With(zap.Error(err)).Error("failed to release invite code")
+			}
+		}
 		c.JSON(http.StatusBadRequest, oapi.BadRequest{
 			Code:    "BadRequest",
 			Message: "failed to process grpc method",
@@ -372,24 +559,67 @@ func (o *authLogic) SignUp(c *gin.Context) {
 		return
 	}
 
-	// Create a new access token
-	accessToken, accessTokenExpiresAt, err := o.tokenLogic.GenerateAccessToken(c, token_logic.TokenPayload{
-		AccountId: accResp.AccountId,
-	})
+	// The account exists already, a failed mail can be resent later
+	err = o.verificationLogic.Start(c, accResp.AccountId, strings.TrimSpace(req.Account.Email))
 	if err != nil {
-		errMsg := "failed to gen access token"
+		logger.With(zap.Error(err)).
+			With(zap.Uint64("account_id", accResp.AccountId)).
+			Error("failed to start email verification")
+	}
+
+	if o.verificationLogic.UnverifiedAccess() == configs.UnverifiedAccessDeny {
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	o.startSession(c, accResp.AccountId, false)
+}
+
+// completeSignIn answers a sign-in whose first factor was verified, with
+// an MFA challenge for accounts that have a second factor and with the
+// tokens of a new session otherwise.
+func (o *authLogic) completeSignIn(c *gin.Context, accountId uint64, isRememberMe bool) {
+	logger := log.LoggerWithContext(c, o.logger).With(zap.Uint64("account_id", accountId))
+
+	// Accounts with a second factor get a challenge instead of tokens
+	isMfaEnabled, err := o.mfaLogic.IsEnabled(c, accountId)
+	if err != nil {
+		errMsg := "failed to check mfa status"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
 			Message: errMsg,
 		})
 		return
+	} else if isMfaEnabled {
+		challenge, expiresAt, err := o.mfaLogic.StartChallenge(c, accountId, isRememberMe)
+		if err != nil {
+			errMsg := "failed to start mfa challenge"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, oapi.MfaChallengeResponse{
+			MfaToken: challenge,
+			Exp:      expiresAt.Unix(),
+		})
+		return
 	}
 
-	// Create refresh token
-	refreshToken, refreshTokenExpiresAt, err := o.tokenLogic.GenerateRefreshToken(c)
+	o.startSession(c, accountId, isRememberMe)
+}
+
+// startSession issues the refresh and access tokens of a completed sign-in
+// and writes them to the response.
+func (o *authLogic) startSession(c *gin.Context, accountId uint64, isRememberMe bool) {
+	logger := log.LoggerWithContext(c, o.logger).With(zap.Uint64("account_id", accountId))
+
+	role, err := o.accountRole(c, accountId)
 	if err != nil {
-		errMsg := "failed to gen refresh token"
+		errMsg := "failed to get account role"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
@@ -398,12 +628,26 @@ func (o *authLogic) SignUp(c *gin.Context) {
 		return
 	}
 
-	// Save the refresh token to the redis
-	err = o.refreshTokenCache.Set(c,
-		refreshToken, accResp.AccountId,
-		o.authConfig.Token.RefreshTokenTTL)
+	isEmailUnverified, ok := o.checkEmailVerified(c, accountId)
+	if !ok {
+		return
+	}
+
+	keyThumbprint, ok := o.dpopKeyThumbprint(c)
+	if !ok {
+		return
+	}
+
+	// Start a new session with its own refresh token family
+	client := clientInfo(c)
+	client.KeyThumbprint = keyThumbprint
+	issued, err := o.sessionLogic.Start(c, session_logic.StartParams{
+		AccountId:    accountId,
+		IsRememberMe: isRememberMe,
+		Client:       client,
+	})
 	if err != nil {
-		errMsg := "failed to save refresh token"
+		errMsg := "failed to start session"
 		logger.With(zap.Error(err)).Error(errMsg)
 		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
 			Code:    "InternalServerError",
@@ -412,24 +656,133 @@ func (o *authLogic) SignUp(c *gin.Context) {
 		return
 	}
 
-	// Return the refresh token to cookie
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Path:     "/api/v1/auth/token",
-		Domain:   o.authConfig.Domain,
-		Expires:  refreshTokenExpiresAt,
-		MaxAge:   int(time.Until(refreshTokenExpiresAt).Seconds()),
-		Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+	// Create a new access token
+	accessToken, accessTokenExpiresAt, err := o.tokenLogic.GenerateAccessToken(c, token_logic.TokenPayload{
+		AccountId:         accountId,
+		SessionId:         issued.SessionId,
+		Role:              role,
+		IsEmailUnverified: isEmailUnverified,
+		AuthTime:          issued.AuthTime,
+		KeyThumbprint:     keyThumbprint,
 	})
+	if err != nil {
+		errMsg := "failed to gen access token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// Return the refresh token to cookie
+	setRefreshTokenCookie(c, o.authConfig.Domain, issued.RefreshToken,
+		o.csrfLogic.GenerateToken(issued.RefreshToken), issued.ExpiresAt)
 
 	// Return the access token to the response
 	c.JSON(http.StatusOK, oapi.SigninResponse{
-		AccessToken: oapi.AccessTokenResponse{
-			Token: accessToken,
-			Exp:   accessTokenExpiresAt.Unix(),
-		},
+		AccessToken: accessTokenResponse(accessToken, accessTokenExpiresAt, keyThumbprint),
+	})
+}
+
+// dpopKeyThumbprint verifies the DPoP proof of a token request, if any, and
+// returns the thumbprint of the key the tokens are bound to. It writes the
+// error to the response when ok is false.
+func (o *authLogic) dpopKeyThumbprint(c *gin.Context) (keyThumbprint string, ok bool) {
+	proof := c.GetHeader(dpop_logic.HeaderName)
+	if proof == "" {
+		return "", true
+	}
+
+	keyThumbprint, err := o.dpopLogic.VerifyProof(c, proof, c.Request.Method, dpop_logic.RequestUri(c.Request), "")
+	if errors.Is(err, dpop_logic.ErrInvalidProof) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return "", false
+	} else if err != nil {
+		errMsg := "failed to verify dpop proof"
+		log.LoggerWithContext(c, o.logger).With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return "", false
+	}
+
+	return keyThumbprint, true
+}
+
+// accessTokenResponse tells clients how to send the token, bound tokens
+// need the DPoP scheme
+func accessTokenResponse(token string, expiresAt time.Time, keyThumbprint string) oapi.AccessTokenResponse {
+	tokenType := utils.If(keyThumbprint != "", oapi.DPoP, oapi.Bearer)
+	return oapi.AccessTokenResponse{
+		Token:     token,
+		Exp:       expiresAt.Unix(),
+		TokenType: &tokenType,
+	}
+}
+
+// checkEmailVerified applies the policy for accounts whose email is not
+// verified. It tells whether their access token has to be restricted, and
+// writes the error to the response when ok is false.
+func (o *authLogic) checkEmailVerified(c *gin.Context, accountId uint64) (isEmailUnverified bool, ok bool) {
+	logger := log.LoggerWithContext(c, o.logger).With(zap.Uint64("account_id", accountId))
+
+	access := o.verificationLogic.UnverifiedAccess()
+	if access == configs.UnverifiedAccessAllow {
+		return false, true
+	}
+
+	isVerified, err := o.verificationLogic.IsVerified(c, accountId)
+	if err != nil {
+		errMsg := "failed to check email verification"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return false, false
+	} else if isVerified {
+		return false, true
+	}
+
+	if access == configs.UnverifiedAccessDeny {
+		c.JSON(http.StatusForbidden, oapi.Forbidden{
+			Code:    "Forbidden",
+			Message: "the email of the account is not verified",
+		})
+		return false, false
+	}
+
+	return true, true
+}
+
+// accountRole looks up the role embedded in the access tokens of an account
+func (o *authLogic) accountRole(c *gin.Context, accountId uint64) (string, error) {
+	account, err := o.accountGrpc.GetAccount(c, &account_service.GetAccountRequest{
+		AccountId: accountId,
 	})
+	if err != nil {
+		return "", err
+	}
+
+	switch account.GetAccount().GetRole() {
+	case account_service.AccountInfo_ADMIN:
+		return token_logic.RoleAdmin, nil
+	case account_service.AccountInfo_MEMBER:
+		return token_logic.RoleMember, nil
+	default:
+		return "", nil
+	}
+}
+
+// clientInfo describes the device of the request for the session registry
+func clientInfo(c *gin.Context) session_logic.ClientInfo {
+	return session_logic.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IpAddress: c.ClientIP(),
+	}
 }
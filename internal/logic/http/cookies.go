@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"net/http"
+	"time"
+
+	csrf_logic "github.com/Fiagram/gateway/internal/logic/csrf"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	refreshTokenCookieName = "refresh_token"
+	refreshTokenCookiePath = "/api/v1/auth/token"
+)
+
+// setRefreshTokenCookie also sets the CSRF token of the refresh token, in
+// a cookie the web app can read.
+func setRefreshTokenCookie(c *gin.Context, domain string, refreshToken string, csrfToken string, expiresAt time.Time) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshTokenCookieName,
+		Value:    refreshToken,
+		Path:     refreshTokenCookiePath,
+		Domain:   domain,
+		Expires:  expiresAt,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrf_logic.CookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		Domain:   domain,
+		Expires:  expiresAt,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearRefreshTokenCookie(c *gin.Context, domain string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshTokenCookieName,
+		Value:    "",
+		Path:     refreshTokenCookiePath,
+		Domain:   domain,
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrf_logic.CookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   domain,
+		MaxAge:   -1,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	verification_logic "github.com/Fiagram/gateway/internal/logic/verification"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (o *authLogic) VerifyEmail(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	_, err := o.verificationLogic.Verify(c, req.Token)
+	if errors.Is(err, verification_logic.ErrInvalidVerificationToken) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to verify email"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (o *authLogic) ResendEmailVerification(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.ResendEmailVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	if err := o.verificationLogic.Resend(c, req.Email); err != nil {
+		errMsg := "failed to resend email verification"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// Same answer whether or not a mail was sent
+	c.Status(http.StatusAccepted)
+}
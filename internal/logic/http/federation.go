@@ -0,0 +1,103 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	federation_logic "github.com/Fiagram/gateway/internal/logic/federation"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (o *authLogic) ListFederatedProviders(c *gin.Context) {
+	providers := o.federationLogic.ListProviders(c)
+
+	resp := oapi.FederatedProvidersResponse{
+		Providers: make([]oapi.FederatedProvider, 0, len(providers)),
+	}
+	for _, provider := range providers {
+		resp.Providers = append(resp.Providers, oapi.FederatedProvider{
+			Id:   provider.Id,
+			Name: provider.Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (o *authLogic) StartFederatedLogin(c *gin.Context, providerId string, params oapi.StartFederatedLoginParams) {
+	logger := log.LoggerWithContext(c, o.logger).With(zap.String("provider_id", providerId))
+
+	isRememberMe := params.IsRememberMe != nil && *params.IsRememberMe
+	authorizationUrl, err := o.federationLogic.StartLogin(c, providerId, isRememberMe)
+	if errors.Is(err, federation_logic.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, oapi.NotFound{
+			Code:    "NotFound",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to start federated sign-in"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authorizationUrl)
+}
+
+func (o *authLogic) CompleteFederatedLogin(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.FederatedLoginCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	result, err := o.federationLogic.CompleteLogin(c, req.State, req.Code, c.ClientIP())
+	if errors.Is(err, federation_logic.ErrInvalidState) ||
+		errors.Is(err, federation_logic.ErrCodeRejected) ||
+		errors.Is(err, federation_logic.ErrInvalidIdToken) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: err.Error(),
+		})
+		return
+	} else if errors.Is(err, federation_logic.ErrSignUpClosed) ||
+		errors.Is(err, federation_logic.ErrEmailNotUnique) {
+		c.JSON(http.StatusForbidden, oapi.Forbidden{
+			Code:    "Forbidden",
+			Message: err.Error(),
+		})
+		return
+	} else if errors.Is(err, federation_logic.ErrTooManyLinks) {
+		c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+			Code:    "TooManyRequests",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to complete federated sign-in"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The provider only stands in for the password, a second factor still
+	// applies
+	o.completeSignIn(c, result.AccountId, result.IsRememberMe)
+}
@@ -0,0 +1,86 @@
+package logic
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	magiclink_logic "github.com/Fiagram/gateway/internal/logic/magiclink"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (o *authLogic) RequestMagicLink(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	isRememberMe := req.IsRememberMe != nil && *req.IsRememberMe
+	retryAfter, err := o.magicLinkLogic.Request(c, req.Email, c.ClientIP(), isRememberMe)
+	if errors.Is(err, magiclink_logic.ErrTooManyRequests) {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+		c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+			Code:    "TooManyRequests",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to request sign-in link"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// Same answer whether or not an account has the email
+	c.Status(http.StatusAccepted)
+}
+
+func (o *authLogic) ConsumeMagicLink(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.MagicLinkConsumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	entry, err := o.magicLinkLogic.Consume(c, req.Token)
+	if errors.Is(err, magiclink_logic.ErrInvalidMagicLink) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to consume sign-in link"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The link only stands in for the password, a second factor still applies
+	o.completeSignIn(c, entry.AccountId, entry.IsRememberMe)
+}
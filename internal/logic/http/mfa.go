@@ -0,0 +1,224 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+
+	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	mfa_logic "github.com/Fiagram/gateway/internal/logic/mfa"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type MfaLogic interface {
+	GetMfaStatus(c *gin.Context)
+	EnrollTotp(c *gin.Context)
+	ConfirmTotp(c *gin.Context)
+	DisableTotp(c *gin.Context)
+}
+
+var _ MfaLogic = (oapi.ServerInterface)(nil)
+
+type mfaLogic struct {
+	accountGrpc account_grpc.Client
+	mfa         mfa_logic.Mfa
+	logger      *zap.Logger
+}
+
+func NewMfaLogic(
+	accountGrpc account_grpc.Client,
+	mfa mfa_logic.Mfa,
+	logger *zap.Logger,
+) MfaLogic {
+	return &mfaLogic{
+		accountGrpc: accountGrpc,
+		mfa:         mfa,
+		logger:      logger,
+	}
+}
+
+func (m *mfaLogic) GetMfaStatus(c *gin.Context) {
+	logger := log.LoggerWithContext(c, m.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	isEnabled, err := m.mfa.IsEnabled(c, accountId.(uint64))
+	if err != nil {
+		errMsg := "failed to check mfa status"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, oapi.MfaStatusResponse{
+		TotpEnabled: isEnabled,
+	})
+}
+
+func (m *mfaLogic) EnrollTotp(c *gin.Context) {
+	logger := log.LoggerWithContext(c, m.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The username labels the entry in the authenticator app
+	account, err := m.accountGrpc.GetAccount(c, &account_service.GetAccountRequest{
+		AccountId: accountId.(uint64),
+	})
+	if err != nil {
+		errMsg := "failed to get account from account service"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	enrollment, err := m.mfa.BeginTotpEnrollment(c, accountId.(uint64), account.Account.Username)
+	if errors.Is(err, mfa_logic.ErrMfaAlreadyEnabled) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to start totp enrollment"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The secret must never be cached by intermediaries
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, oapi.TotpEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningUri: enrollment.ProvisioningUri,
+	})
+}
+
+func (m *mfaLogic) ConfirmTotp(c *gin.Context) {
+	logger := log.LoggerWithContext(c, m.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	var req oapi.TotpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	err := m.mfa.ConfirmTotpEnrollment(c, accountId.(uint64), req.Code)
+	if errors.Is(err, mfa_logic.ErrEnrollmentNotFound) ||
+		errors.Is(err, mfa_logic.ErrMfaAlreadyEnabled) ||
+		errors.Is(err, mfa_logic.ErrInvalidCode) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to confirm totp enrollment"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (m *mfaLogic) DisableTotp(c *gin.Context) {
+	logger := log.LoggerWithContext(c, m.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	var req oapi.TotpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	err := m.mfa.DisableTotp(c, accountId.(uint64), req.Code)
+	if errors.Is(err, mfa_logic.ErrMfaNotEnabled) ||
+		errors.Is(err, mfa_logic.ErrInvalidCode) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return
+	} else if errors.Is(err, throttle_logic.ErrTooManyAttempts) {
+		c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+			Code:    "TooManyRequests",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to disable totp"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,278 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	oidc_logic "github.com/Fiagram/gateway/internal/logic/oidc"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// grantTypeClientCredentials is the grant of the token endpoint served to
+// services
+const grantTypeClientCredentials = "client_credentials"
+
+type OAuthLogic interface {
+	IssueOAuthToken(c *gin.Context)
+	IntrospectOAuthToken(c *gin.Context)
+	RevokeOAuthToken(c *gin.Context)
+	StartOidcAuthorization(c *gin.Context, params oapi.StartOidcAuthorizationParams)
+	ApproveOidcAuthorization(c *gin.Context)
+	GetOidcUserInfo(c *gin.Context)
+}
+
+var _ OAuthLogic = (oapi.ServerInterface)(nil)
+
+type oAuthLogic struct {
+	oauth         oauth_logic.OAuth
+	introspection oauth_logic.TokenIntrospection
+	tokenExchange oauth_logic.TokenExchange
+	oidc          oidc_logic.Provider
+	dpopLogic     dpop_logic.Dpop
+	clock         utils.Clock
+	logger        *zap.Logger
+}
+
+func NewOAuthLogic(
+	oauth oauth_logic.OAuth,
+	introspection oauth_logic.TokenIntrospection,
+	tokenExchange oauth_logic.TokenExchange,
+	oidc oidc_logic.Provider,
+	dpopLogic dpop_logic.Dpop,
+	clock utils.Clock,
+	logger *zap.Logger,
+) OAuthLogic {
+	return &oAuthLogic{
+		oauth:         oauth,
+		introspection: introspection,
+		tokenExchange: tokenExchange,
+		oidc:          oidc,
+		dpopLogic:     dpopLogic,
+		clock:         clock,
+		logger:        logger,
+	}
+}
+
+// IssueOAuthToken answers with the error format of RFC 6749 section 5.2
+// rather than the usual error response, OAuth client libraries expect it.
+func (o *oAuthLogic) IssueOAuthToken(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	// Token responses must never be cached by intermediaries
+	c.Header("Cache-Control", "no-store")
+
+	grantType := c.PostForm("grant_type")
+	if grantType == "" {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_request",
+			ErrorDescription: utils.Ptr("grant_type is required"),
+		})
+		return
+	} else if grantType == grantTypeAuthorizationCode || grantType == grantTypeRefreshToken {
+		o.issueOidcTokens(c, grantType)
+		return
+	} else if grantType == oauth_logic.GrantTypeTokenExchange {
+		o.exchangeToken(c)
+		return
+	} else if grantType != grantTypeClientCredentials {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error: "unsupported_grant_type",
+			ErrorDescription: utils.Ptr("grant_type must be client_credentials, authorization_code, " +
+				"refresh_token or " + oauth_logic.GrantTypeTokenExchange),
+		})
+		return
+	}
+
+	clientId, clientSecret, isBasicAuth := clientCredentials(c)
+	if clientId == "" || clientSecret == "" {
+		writeInvalidClient(c, isBasicAuth, "client authentication is required")
+		return
+	}
+
+	issued, err := o.oauth.IssueClientCredentialsToken(c, clientId, clientSecret,
+		strings.Fields(c.PostForm("scope")), strings.Fields(c.PostForm("audience")))
+	if errors.Is(err, oauth_logic.ErrInvalidClient) {
+		writeInvalidClient(c, isBasicAuth, err.Error())
+		return
+	} else if errors.Is(err, oauth_logic.ErrInvalidScope) {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_scope",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if errors.Is(err, oauth_logic.ErrInvalidAudience) ||
+		errors.Is(err, token_logic.ErrInvalidAudience) {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_target",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to issue access token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, oapi.OAuthTokenResponse{
+		AccessToken: issued.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(issued.ExpiresAt.Sub(o.clock.Now()) / time.Second),
+		Scope:       utils.PtrIfNotZero(strings.Join(issued.Scopes, " ")),
+	})
+}
+
+// IntrospectOAuthToken is open to every authenticated client, resource
+// servers use it to check the tokens presented to them.
+func (o *oAuthLogic) IntrospectOAuthToken(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	c.Header("Cache-Control", "no-store")
+
+	if _, ok := o.authenticateClient(c); !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_request",
+			ErrorDescription: utils.Ptr("token is required"),
+		})
+		return
+	}
+
+	introspection, err := o.introspection.Introspect(c, token)
+	if err != nil {
+		errMsg := "failed to introspect token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	if !introspection.Active {
+		c.JSON(http.StatusOK, oapi.OAuthIntrospectionResponse{Active: false})
+		return
+	}
+
+	response := oapi.OAuthIntrospectionResponse{
+		Active:    true,
+		TokenType: utils.Ptr(introspection.TokenType),
+		Sub:       utils.Ptr(introspection.Subject),
+		ClientId:  utils.PtrIfNotZero(introspection.ClientId),
+		Scope:     utils.PtrIfNotZero(strings.Join(introspection.Scopes, " ")),
+		Jti:       utils.PtrIfNotZero(introspection.TokenId),
+	}
+	if !introspection.IssuedAt.IsZero() {
+		response.Iat = utils.Ptr(introspection.IssuedAt.Unix())
+	}
+	if !introspection.ExpiresAt.IsZero() {
+		response.Exp = utils.Ptr(introspection.ExpiresAt.Unix())
+	}
+	if len(introspection.Audience) > 0 {
+		response.Aud = utils.Ptr(introspection.Audience)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (o *oAuthLogic) RevokeOAuthToken(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	client, ok := o.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_request",
+			ErrorDescription: utils.Ptr("token is required"),
+		})
+		return
+	}
+
+	err := o.introspection.RevokeToken(c, client.Id, token)
+	if errors.Is(err, oauth_logic.ErrTokenNotOwned) {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "unauthorized_client",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to revoke token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// authenticateClient checks the client credentials of the request and
+// answers with invalid_client when they are missing or wrong.
+func (o *oAuthLogic) authenticateClient(c *gin.Context) (cache.OAuthClientEntry, bool) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	clientId, clientSecret, isBasicAuth := clientCredentials(c)
+	if clientId == "" || clientSecret == "" {
+		writeInvalidClient(c, isBasicAuth, "client authentication is required")
+		return cache.OAuthClientEntry{}, false
+	}
+
+	client, err := o.oauth.AuthenticateClient(c, clientId, clientSecret)
+	if errors.Is(err, oauth_logic.ErrInvalidClient) {
+		writeInvalidClient(c, isBasicAuth, err.Error())
+		return cache.OAuthClientEntry{}, false
+	} else if err != nil {
+		errMsg := "failed to authenticate client"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return cache.OAuthClientEntry{}, false
+	}
+
+	return client, true
+}
+
+// clientCredentials reads client_secret_basic, which takes precedence, or
+// client_secret_post.
+func clientCredentials(c *gin.Context) (clientId string, clientSecret string, isBasicAuth bool) {
+	clientId, clientSecret, isBasicAuth = c.Request.BasicAuth()
+	if !isBasicAuth {
+		clientId = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+	return clientId, clientSecret, isBasicAuth
+}
+
+func writeInvalidClient(c *gin.Context, isBasicAuth bool, description string) {
+	if isBasicAuth {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(http.StatusUnauthorized, oapi.OAuthError{
+		Error:            "invalid_client",
+		ErrorDescription: utils.Ptr(description),
+	})
+}
@@ -0,0 +1,256 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	oidc_logic "github.com/Fiagram/gateway/internal/logic/oidc"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Grants of the token endpoint served to the OpenID Connect clients
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+)
+
+func (o *oAuthLogic) StartOidcAuthorization(c *gin.Context, params oapi.StartOidcAuthorizationParams) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	req := oidc_logic.AuthorizationRequest{
+		ResponseType:        params.ResponseType,
+		ClientId:            params.ClientId,
+		RedirectUri:         params.RedirectUri,
+		Scopes:              strings.Fields(params.Scope),
+		State:               utils.Deref(params.State),
+		Nonce:               utils.Deref(params.Nonce),
+		CodeChallenge:       params.CodeChallenge,
+		CodeChallengeMethod: params.CodeChallengeMethod,
+	}
+
+	err := o.oidc.ValidateAuthorizationRequest(c, req)
+	if isUserAgentError(err) {
+		writeInvalidAuthorizationRequest(c, err)
+		return
+	} else if err != nil {
+		c.Redirect(http.StatusFound, clientRedirectUri(req, url.Values{
+			"error":             {authorizationErrorCode(err)},
+			"error_description": {err.Error()},
+		}))
+		return
+	}
+
+	// The web app signs the user in and approves the request
+	loginUrl, err := o.oidc.GetLoginUrl(c, c.Request.URL.Query())
+	if err != nil {
+		errMsg := "failed to build login url"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, loginUrl)
+}
+
+// ApproveOidcAuthorization is only open to the access tokens of a sign-in,
+// personal access tokens and services cannot approve for a user.
+func (o *oAuthLogic) ApproveOidcAuthorization(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	accountId := c.GetUint64("accountId")
+	if c.GetString("sessionId") == "" || accountId == 0 {
+		c.JSON(http.StatusForbidden, oapi.Forbidden{
+			Code:    "Forbidden",
+			Message: "only a signed in user can approve an authorization",
+		})
+		return
+	}
+
+	req := oidc_logic.AuthorizationRequest{
+		ResponseType:        c.PostForm("response_type"),
+		ClientId:            c.PostForm("client_id"),
+		RedirectUri:         c.PostForm("redirect_uri"),
+		Scopes:              strings.Fields(c.PostForm("scope")),
+		State:               c.PostForm("state"),
+		Nonce:               c.PostForm("nonce"),
+		CodeChallenge:       c.PostForm("code_challenge"),
+		CodeChallengeMethod: c.PostForm("code_challenge_method"),
+	}
+
+	code, err := o.oidc.Authorize(c, accountId, req)
+	if isUserAgentError(err) {
+		writeInvalidAuthorizationRequest(c, err)
+		return
+	} else if isAuthorizationError(err) {
+		c.JSON(http.StatusOK, oapi.OidcAuthorizationResponse{
+			RedirectUri: clientRedirectUri(req, url.Values{
+				"error":             {authorizationErrorCode(err)},
+				"error_description": {err.Error()},
+			}),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to authorize client"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, oapi.OidcAuthorizationResponse{
+		RedirectUri: clientRedirectUri(req, url.Values{"code": {code}}),
+	})
+}
+
+func (o *oAuthLogic) GetOidcUserInfo(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	accountId := c.GetUint64("accountId")
+	if accountId == 0 {
+		c.JSON(http.StatusForbidden, oapi.Forbidden{
+			Code:    "Forbidden",
+			Message: "services have no user info",
+		})
+		return
+	}
+
+	userInfo, err := o.oidc.GetUserInfo(c, accountId)
+	if err != nil {
+		errMsg := "failed to get user info"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, oapi.OidcUserInfo{
+		Sub:               userInfo.Subject,
+		Name:              utils.PtrIfNotZero(userInfo.Name),
+		PreferredUsername: utils.PtrIfNotZero(userInfo.PreferredUsername),
+		Email:             utils.PtrIfNotZero(userInfo.Email),
+		PhoneNumber:       utils.PtrIfNotZero(userInfo.PhoneNumber),
+	})
+}
+
+// issueOidcTokens serves the authorization_code and refresh_token grants
+// of the token endpoint.
+func (o *oAuthLogic) issueOidcTokens(c *gin.Context, grantType string) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	// Public clients only send their client_id
+	clientId, clientSecret, isBasicAuth := clientCredentials(c)
+	if clientId == "" {
+		writeInvalidClient(c, isBasicAuth, "client authentication is required")
+		return
+	}
+
+	var (
+		issued oidc_logic.IssuedTokens
+		err    error
+	)
+	if grantType == grantTypeAuthorizationCode {
+		issued, err = o.oidc.ExchangeCode(c, oidc_logic.ExchangeCodeParams{
+			ClientId:     clientId,
+			ClientSecret: clientSecret,
+			Code:         c.PostForm("code"),
+			RedirectUri:  c.PostForm("redirect_uri"),
+			CodeVerifier: c.PostForm("code_verifier"),
+			Client:       clientInfo(c),
+		})
+	} else {
+		issued, err = o.oidc.Refresh(c, clientId, clientSecret, c.PostForm("refresh_token"), clientInfo(c))
+	}
+	if errors.Is(err, oidc_logic.ErrInvalidClient) {
+		writeInvalidClient(c, isBasicAuth, err.Error())
+		return
+	} else if errors.Is(err, oidc_logic.ErrInvalidGrant) {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_grant",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to issue tokens"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, oapi.OAuthTokenResponse{
+		AccessToken:  issued.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(issued.ExpiresAt.Sub(o.clock.Now()) / time.Second),
+		Scope:        utils.PtrIfNotZero(strings.Join(issued.Scopes, " ")),
+		RefreshToken: utils.PtrIfNotZero(issued.RefreshToken),
+		IdToken:      utils.PtrIfNotZero(issued.IdToken),
+	})
+}
+
+// isUserAgentError tells the authorization errors that must not be
+// redirected, the redirect_uri cannot be trusted.
+func isUserAgentError(err error) bool {
+	return errors.Is(err, oidc_logic.ErrUnknownClient) ||
+		errors.Is(err, oidc_logic.ErrInvalidRedirectUri)
+}
+
+func isAuthorizationError(err error) bool {
+	return errors.Is(err, oidc_logic.ErrUnsupportedResponseType) ||
+		errors.Is(err, oidc_logic.ErrInvalidScope) ||
+		errors.Is(err, oidc_logic.ErrPkceRequired)
+}
+
+// authorizationErrorCode is the error code of RFC 6749 section 4.1.2.1
+func authorizationErrorCode(err error) string {
+	switch {
+	case errors.Is(err, oidc_logic.ErrUnsupportedResponseType):
+		return "unsupported_response_type"
+	case errors.Is(err, oidc_logic.ErrInvalidScope):
+		return "invalid_scope"
+	default:
+		return "invalid_request"
+	}
+}
+
+func writeInvalidAuthorizationRequest(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, oapi.OAuthError{
+		Error:            "invalid_request",
+		ErrorDescription: utils.Ptr(err.Error()),
+	})
+}
+
+// clientRedirectUri adds the response parameters and the state to the
+// redirect_uri of the request.
+func clientRedirectUri(req oidc_logic.AuthorizationRequest, params url.Values) string {
+	redirectUri, err := url.Parse(req.RedirectUri)
+	if err != nil {
+		// Registered redirect uris are valid, this is never reached
+		return req.RedirectUri
+	}
+
+	query := redirectUri.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirectUri.RawQuery = query.Encode()
+	return redirectUri.String()
+}
@@ -0,0 +1,103 @@
+package logic
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (o *authLogic) ForgotPassword(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	retryAfter, err := o.passwordResetLogic.RequestReset(c, req.Email, c.ClientIP())
+	if errors.Is(err, password_logic.ErrTooManyRequests) {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+		c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+			Code:    "TooManyRequests",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to request password reset"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// Same answer whether or not an account has the email
+	c.Status(http.StatusAccepted)
+}
+
+func (o *authLogic) ResetPassword(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Password == nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	err := o.passwordResetLogic.ResetPassword(c, req.Token, *req.Password)
+	if errors.Is(err, password_logic.ErrInvalidPassword) {
+		writeInvalidPassword(c, err)
+		return
+	} else if errors.Is(err, password_logic.ErrInvalidResetToken) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to reset password"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// writeInvalidPassword answers a password refused by the policy, the broken
+// rules are listed in the details.
+func writeInvalidPassword(c *gin.Context, err error) {
+	violations := make([]string, 0)
+	var policyErr *password_logic.PolicyError
+	if errors.As(err, &policyErr) {
+		violations = policyErr.Violations
+	}
+
+	c.JSON(http.StatusBadRequest, oapi.BadRequest{
+		Code:    "InvalidPassword",
+		Message: password_logic.ErrInvalidPassword.Error(),
+		Details: &map[string]any{"violations": violations},
+	})
+}
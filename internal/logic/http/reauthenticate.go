@@ -0,0 +1,224 @@
+package logic
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	mfa_logic "github.com/Fiagram/gateway/internal/logic/mfa"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Reauthenticate refreshes the authentication time of the session behind
+// the access token. Accounts with TOTP prove themselves with a code, the
+// others with their password, and failures count towards the sign-in
+// lockout of the username.
+func (o *authLogic) Reauthenticate(c *gin.Context) {
+	accountId := c.GetUint64("accountId")
+	sessionId := c.GetString("sessionId")
+	logger := log.LoggerWithContext(c, o.logger).With(zap.Uint64("account_id", accountId))
+
+	// Personal access tokens and service tokens have no session to step up
+	if sessionId == "" {
+		c.JSON(http.StatusForbidden, oapi.Forbidden{
+			Code:    "Forbidden",
+			Message: "reauthentication requires a signed in session",
+		})
+		return
+	}
+
+	var req oapi.ReauthenticateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	accResp, err := o.accountGrpc.GetAccount(c, &account_service.GetAccountRequest{
+		AccountId: accountId,
+	})
+	if err != nil {
+		errMsg := "failed to get account"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+	username := accResp.GetAccount().GetUsername()
+
+	// A stolen access token must not open a way around the sign-in lockout
+	retryAfter, err := o.throttleLogic.Check(c, username, c.ClientIP())
+	if errors.Is(err, throttle_logic.ErrTooManyAttempts) {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+		c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+			Code:    "TooManyRequests",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to check sign-in attempts"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	isMfaEnabled, err := o.mfaLogic.IsEnabled(c, accountId)
+	if err != nil {
+		errMsg := "failed to check mfa status"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	var isValid bool
+	if isMfaEnabled {
+		if req.Code == nil {
+			c.JSON(http.StatusBadRequest, oapi.BadRequest{
+				Code:    "BadRequest",
+				Message: "a totp code is required",
+			})
+			return
+		}
+		err := o.mfaLogic.VerifyTotp(c, accountId, *req.Code)
+		if errors.Is(err, throttle_logic.ErrTooManyAttempts) {
+			c.JSON(http.StatusTooManyRequests, oapi.TooManyRequests{
+				Code:    "TooManyRequests",
+				Message: err.Error(),
+			})
+			return
+		} else if err != nil && !errors.Is(err, mfa_logic.ErrInvalidCode) {
+			errMsg := "failed to verify totp code"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
+		isValid = err == nil
+	} else {
+		if req.Password == nil || *req.Password == "" {
+			c.JSON(http.StatusBadRequest, oapi.BadRequest{
+				Code:    "BadRequest",
+				Message: "the password is required",
+			})
+			return
+		}
+		validAccountId, err := password_logic.CheckAccountValid(c, o.accountGrpc, username, *req.Password)
+		if err != nil {
+			errMsg := "failed to check account valid"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
+		isValid = validAccountId == accountId
+	}
+
+	if !isValid {
+		if err := o.throttleLogic.RecordFailure(c, username, c.ClientIP()); err != nil {
+			errMsg := "failed to record failed sign-in"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
+		log.SecurityLogger(logger, "reauthentication_failed").Warn("reauthentication failed")
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: "invalid credentials",
+		})
+		return
+	}
+
+	if err := o.throttleLogic.RecordSuccess(c, username); err != nil {
+		errMsg := "failed to reset failed sign-ins"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	authTime, err := o.sessionLogic.Reauthenticate(c, accountId, sessionId)
+	if errors.Is(err, session_logic.ErrSessionNotFound) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: "the session has ended",
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to reauthenticate session"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	role, err := o.accountRole(c, accountId)
+	if err != nil {
+		errMsg := "failed to get account role"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	isEmailUnverified, ok := o.checkEmailVerified(c, accountId)
+	if !ok {
+		return
+	}
+
+	accessToken, accessTokenExpiresAt, err := o.tokenLogic.GenerateAccessToken(c, token_logic.TokenPayload{
+		AccountId:         accountId,
+		SessionId:         sessionId,
+		Role:              role,
+		IsEmailUnverified: isEmailUnverified,
+		AuthTime:          authTime,
+		// The fresh token stays bound to the key of the one it replaces
+		KeyThumbprint: c.GetString("keyThumbprint"),
+	})
+	if err != nil {
+		errMsg := "failed to generate access token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, oapi.SigninResponse{
+		AccessToken: accessTokenResponse(accessToken, accessTokenExpiresAt, c.GetString("keyThumbprint")),
+	})
+}
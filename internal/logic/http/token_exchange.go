@@ -0,0 +1,112 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// exchangeToken serves the token exchange grant, through which
+// administrators impersonate accounts. The subject token authenticates the
+// request, there is no client to authenticate.
+func (o *oAuthLogic) exchangeToken(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	subjectToken := c.PostForm("subject_token")
+	if subjectToken == "" || c.PostForm("subject_token_type") != oauth_logic.TokenTypeUriAccessToken {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_request",
+			ErrorDescription: utils.Ptr("subject_token must be an access token"),
+		})
+		return
+	}
+	requestedTokenType := c.PostForm("requested_token_type")
+	if requestedTokenType != "" && requestedTokenType != oauth_logic.TokenTypeUriAccessToken {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_request",
+			ErrorDescription: utils.Ptr("only access tokens can be requested"),
+		})
+		return
+	}
+	accountId, err := strconv.ParseUint(c.PostForm("requested_subject"), 10, 64)
+	if err != nil || accountId == 0 {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_request",
+			ErrorDescription: utils.Ptr("requested_subject must be an account id"),
+		})
+		return
+	}
+
+	// The proof, if any, has no ath claim since the subject token is not
+	// sent as an access token
+	keyThumbprint := ""
+	if proof := c.GetHeader(dpop_logic.HeaderName); proof != "" {
+		keyThumbprint, err = o.dpopLogic.VerifyProof(c, proof, c.Request.Method, dpop_logic.RequestUri(c.Request), "")
+		if errors.Is(err, dpop_logic.ErrInvalidProof) {
+			c.JSON(http.StatusBadRequest, oapi.OAuthError{
+				Error:            "invalid_dpop_proof",
+				ErrorDescription: utils.Ptr(err.Error()),
+			})
+			return
+		} else if err != nil {
+			errMsg := "failed to verify dpop proof"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
+	}
+
+	issued, err := o.tokenExchange.Impersonate(c, subjectToken, keyThumbprint, accountId)
+	if errors.Is(err, oauth_logic.ErrDpopKeyMismatch) {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_dpop_proof",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if errors.Is(err, oauth_logic.ErrInvalidSubjectToken) {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_grant",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if errors.Is(err, oauth_logic.ErrImpersonationNotAllowed) {
+		c.JSON(http.StatusForbidden, oapi.OAuthError{
+			Error:            "access_denied",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if errors.Is(err, oauth_logic.ErrInvalidTarget) {
+		c.JSON(http.StatusBadRequest, oapi.OAuthError{
+			Error:            "invalid_target",
+			ErrorDescription: utils.Ptr(err.Error()),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to exchange token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, oapi.OAuthTokenResponse{
+		AccessToken:     issued.AccessToken,
+		TokenType:       utils.If(keyThumbprint != "", dpop_logic.TokenType, "Bearer"),
+		ExpiresIn:       int64(issued.ExpiresAt.Sub(o.clock.Now()) / time.Second),
+		IssuedTokenType: utils.Ptr(oauth_logic.TokenTypeUriAccessToken),
+	})
+}
@@ -1,12 +1,18 @@
 package logic
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
 	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
 	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
 	"github.com/Fiagram/gateway/internal/log"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	pat_logic "github.com/Fiagram/gateway/internal/logic/pat"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
 	"github.com/Fiagram/gateway/internal/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -14,22 +20,37 @@ import (
 
 type UsersLogic interface {
 	GetMe(c *gin.Context)
+	ListMySessions(c *gin.Context)
+	RevokeMySession(c *gin.Context, sessionId string)
+	ListMyTokens(c *gin.Context)
+	CreateMyToken(c *gin.Context)
+	RevokeMyToken(c *gin.Context, tokenId string)
+	ChangeMyPassword(c *gin.Context)
 }
 
 var _ UsersLogic = (oapi.ServerInterface)(nil)
 
 type usersLogic struct {
-	accountGrpc account_grpc.Client
-	logger      *zap.Logger
+	accountGrpc    account_grpc.Client
+	sessionLogic   session_logic.Session
+	patLogic       pat_logic.PersonalAccessToken
+	passwordPolicy password_logic.Policy
+	logger         *zap.Logger
 }
 
 func NewUsersLogic(
 	accountGrpc account_grpc.Client,
+	sessionLogic session_logic.Session,
+	patLogic pat_logic.PersonalAccessToken,
+	passwordPolicy password_logic.Policy,
 	logger *zap.Logger,
 ) UsersLogic {
 	return &usersLogic{
-		accountGrpc: accountGrpc,
-		logger:      logger,
+		accountGrpc:    accountGrpc,
+		sessionLogic:   sessionLogic,
+		patLogic:       patLogic,
+		passwordPolicy: passwordPolicy,
+		logger:         logger,
 	}
 }
 
@@ -72,5 +93,337 @@ func (u *usersLogic) GetMe(c *gin.Context) {
 			Role: "member", // TODO: fill proper role with converters int <-> string
 		},
 	})
+}
+
+func (u *usersLogic) ListMySessions(c *gin.Context) {
+	logger := log.LoggerWithContext(c, u.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+	currentSessionId := c.GetString("sessionId")
+
+	entries, err := u.sessionLogic.List(c, accountId.(uint64))
+	if err != nil {
+		errMsg := "failed to list sessions"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	sessions := make([]oapi.Session, 0, len(entries))
+	for _, entry := range entries {
+		sessions = append(sessions, oapi.Session{
+			Id:              entry.Id,
+			UserAgent:       entry.UserAgent,
+			IpAddress:       entry.IpAddress,
+			CreatedAt:       entry.CreatedAt,
+			LastRefreshedAt: entry.LastRefreshedAt,
+			IsRememberMe:    entry.IsRememberMe,
+			IsCurrent:       entry.Id == currentSessionId,
+		})
+	}
+
+	c.JSON(http.StatusOK, oapi.SessionsResponse{
+		Sessions: sessions,
+	})
+}
+
+func (u *usersLogic) RevokeMySession(c *gin.Context, sessionId string) {
+	logger := log.LoggerWithContext(c, u.logger).With(zap.String("session_id", sessionId))
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	err := u.sessionLogic.RevokeSession(c, accountId.(uint64), sessionId)
+	if errors.Is(err, session_logic.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, oapi.NotFound{
+			Code:    "NotFound",
+			Message: "session not found",
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to revoke session"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (u *usersLogic) ListMyTokens(c *gin.Context) {
+	logger := log.LoggerWithContext(c, u.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	entries, err := u.patLogic.List(c, accountId.(uint64))
+	if err != nil {
+		errMsg := "failed to list personal access tokens"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	tokens := make([]oapi.PersonalAccessToken, 0, len(entries))
+	for _, entry := range entries {
+		tokens = append(tokens, toPersonalAccessToken(entry))
+	}
+
+	c.JSON(http.StatusOK, oapi.PersonalAccessTokensResponse{
+		Tokens: tokens,
+	})
+}
+
+func (u *usersLogic) CreateMyToken(c *gin.Context) {
+	logger := log.LoggerWithContext(c, u.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// A leaked token must not be able to mint more tokens
+	if _, isPersonalAccessToken := c.Get("personalAccessTokenId"); isPersonalAccessToken {
+		c.JSON(http.StatusForbidden, oapi.Forbidden{
+			Code:    "Forbidden",
+			Message: "personal access tokens cannot create personal access tokens",
+		})
+		return
+	}
+
+	var req oapi.CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	params := pat_logic.CreateParams{
+		AccountId: accountId.(uint64),
+		Name:      req.Name,
+	}
+	if req.Scopes != nil {
+		params.Scopes = *req.Scopes
+	}
+	if req.ExpiresAt != nil {
+		params.ExpiresAt = time.Unix(*req.ExpiresAt, 0)
+	}
+
+	token, entry, err := u.patLogic.Create(c, params)
+	if errors.Is(err, pat_logic.ErrInvalidName) ||
+		errors.Is(err, pat_logic.ErrInvalidScope) ||
+		errors.Is(err, pat_logic.ErrInvalidExpiry) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to create personal access token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The token must never be cached by intermediaries
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, oapi.CreatedPersonalAccessTokenResponse{
+		Token:               token,
+		PersonalAccessToken: toPersonalAccessToken(entry),
+	})
+}
+
+func (u *usersLogic) RevokeMyToken(c *gin.Context, tokenId string) {
+	logger := log.LoggerWithContext(c, u.logger).With(zap.String("token_id", tokenId))
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	err := u.patLogic.Revoke(c, accountId.(uint64), tokenId)
+	if errors.Is(err, pat_logic.ErrTokenNotFound) {
+		c.JSON(http.StatusNotFound, oapi.NotFound{
+			Code:    "NotFound",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to revoke personal access token"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func toPersonalAccessToken(entry cache.PersonalAccessTokenEntry) oapi.PersonalAccessToken {
+	token := oapi.PersonalAccessToken{
+		Id:        entry.Id,
+		Name:      entry.Name,
+		Scopes:    entry.Scopes,
+		CreatedAt: entry.CreatedAt,
+	}
+	if entry.ExpiresAt != 0 {
+		token.ExpiresAt = &entry.ExpiresAt
+	}
+	if entry.LastUsedAt != 0 {
+		token.LastUsedAt = &entry.LastUsedAt
+	}
+	return token
+}
+
+// ChangeMyPassword replaces the password of the account. Whoever knew the
+// old password loses the other sessions, the current one is kept.
+func (u *usersLogic) ChangeMyPassword(c *gin.Context) {
+	accountId := c.GetUint64("accountId")
+	sessionId := c.GetString("sessionId")
+	logger := log.LoggerWithContext(c, u.logger).With(zap.Uint64("account_id", accountId))
+
+	var req oapi.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Password == nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	accResp, err := u.accountGrpc.GetAccount(c, &account_service.GetAccountRequest{
+		AccountId: accountId,
+	})
+	if err != nil {
+		errMsg := "failed to get account"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	err = u.passwordPolicy.Validate(c, *req.Password, password_logic.Account{
+		Username: accResp.GetAccount().GetUsername(),
+		Email:    accResp.GetAccount().GetEmail(),
+	})
+	if errors.Is(err, password_logic.ErrInvalidPassword) {
+		writeInvalidPassword(c, err)
+		return
+	} else if err != nil {
+		errMsg := "failed to check password"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	_, err = u.accountGrpc.UpdateAccountPassword(c, &account_service.UpdateAccountPasswordRequest{
+		AccountId: accountId,
+		Password:  *req.Password,
+	})
+	if err != nil {
+		errMsg := "failed to update password"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	entries, err := u.sessionLogic.List(c, accountId)
+	if err != nil {
+		errMsg := "failed to list sessions"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+	revokedSessions := 0
+	for _, entry := range entries {
+		if entry.Id == sessionId {
+			continue
+		}
+		err := u.sessionLogic.RevokeSession(c, accountId, entry.Id)
+		if err == nil {
+			revokedSessions++
+		} else if !errors.Is(err, session_logic.ErrSessionNotFound) {
+			errMsg := "failed to revoke session"
+			logger.With(zap.Error(err)).Error(errMsg)
+			c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+				Code:    "InternalServerError",
+				Message: errMsg,
+			})
+			return
+		}
+	}
+
+	log.SecurityLogger(logger, "password_changed").
+		With(zap.Int("revoked_sessions", revokedSessions)).
+		Info("changed the password of the account")
 
+	c.Status(http.StatusNoContent)
 }
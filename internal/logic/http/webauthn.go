@@ -0,0 +1,208 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	"github.com/Fiagram/gateway/internal/log"
+	webauthn_logic "github.com/Fiagram/gateway/internal/logic/webauthn"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (o *authLogic) BeginWebAuthnRegistration(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The username and full name label the passkey on the authenticator
+	account, err := o.accountGrpc.GetAccount(c, &account_service.GetAccountRequest{
+		AccountId: accountId.(uint64),
+	})
+	if err != nil {
+		errMsg := "failed to get account from account service"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	sessionId, options, err := o.webAuthnLogic.BeginRegistration(c, accountId.(uint64),
+		account.Account.Username, account.Account.Fullname)
+	if err != nil {
+		errMsg := "failed to begin passkey registration"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	o.writeWebAuthnCeremony(c, sessionId, options)
+}
+
+func (o *authLogic) FinishWebAuthnRegistration(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	accountId, exists := c.Get("accountId")
+	if !exists || accountId.(uint64) == 0 {
+		errMsg := "accountId not existed in context"
+		logger.Error(errMsg)
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: errMsg,
+		})
+		return
+	}
+
+	var req oapi.WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	credential, err := json.Marshal(req.Credential)
+	if err != nil {
+		errMsg := "failed to encode the credential"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	err = o.webAuthnLogic.FinishRegistration(c, accountId.(uint64), req.SessionId, credential)
+	if errors.Is(err, webauthn_logic.ErrInvalidCeremony) ||
+		errors.Is(err, webauthn_logic.ErrInvalidCredential) ||
+		errors.Is(err, webauthn_logic.ErrCredentialAlreadyRegistered) {
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to finish passkey registration"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (o *authLogic) BeginWebAuthnLogin(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	sessionId, options, err := o.webAuthnLogic.BeginLogin(c)
+	if err != nil {
+		errMsg := "failed to begin passkey sign-in"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	o.writeWebAuthnCeremony(c, sessionId, options)
+}
+
+func (o *authLogic) FinishWebAuthnLogin(c *gin.Context) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	var req oapi.WebAuthnLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errMsg := "failed to bind JSON object"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	credential, err := json.Marshal(req.Credential)
+	if err != nil {
+		errMsg := "failed to encode the credential"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusBadRequest, oapi.BadRequest{
+			Code:    "BadRequest",
+			Message: errMsg,
+		})
+		return
+	}
+
+	accountId, err := o.webAuthnLogic.FinishLogin(c, req.SessionId, credential)
+	if errors.Is(err, webauthn_logic.ErrInvalidCeremony) ||
+		errors.Is(err, webauthn_logic.ErrInvalidCredential) {
+		c.JSON(http.StatusUnauthorized, oapi.Unauthorized{
+			Code:    "Unauthorized",
+			Message: err.Error(),
+		})
+		return
+	} else if err != nil {
+		errMsg := "failed to finish passkey sign-in"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	// The passkey only stands in for the password, a second factor still
+	// applies
+	isRememberMe := req.IsRememberMe != nil && *req.IsRememberMe
+	o.completeSignIn(c, accountId, isRememberMe)
+}
+
+// writeWebAuthnCeremony returns the browser options of a ceremony as a
+// plain JSON object next to its session id.
+func (o *authLogic) writeWebAuthnCeremony(c *gin.Context, sessionId string, options any) {
+	logger := log.LoggerWithContext(c, o.logger)
+
+	data, err := json.Marshal(options)
+	var optionsObject map[string]any
+	if err == nil {
+		err = json.Unmarshal(data, &optionsObject)
+	}
+	if err != nil {
+		errMsg := "failed to encode webauthn options"
+		logger.With(zap.Error(err)).Error(errMsg)
+		c.JSON(http.StatusInternalServerError, oapi.InternalServerError{
+			Code:    "InternalServerError",
+			Message: errMsg,
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, oapi.WebAuthnCeremonyResponse{
+		SessionId: sessionId,
+		Options:   optionsObject,
+	})
+}
@@ -0,0 +1,94 @@
+package logic
+
+import (
+	"net/http"
+
+	oapi "github.com/Fiagram/gateway/internal/generated/openapi"
+	oidc_logic "github.com/Fiagram/gateway/internal/logic/oidc"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type WellKnownLogic interface {
+	GetJwks(c *gin.Context)
+	GetOpenIdConfiguration(c *gin.Context)
+}
+
+var _ WellKnownLogic = (oapi.ServerInterface)(nil)
+
+type wellKnownLogic struct {
+	tokenLogic token_logic.Token
+	oidc       oidc_logic.Provider
+	logger     *zap.Logger
+}
+
+func NewWellKnownLogic(
+	tokenLogic token_logic.Token,
+	oidc oidc_logic.Provider,
+	logger *zap.Logger,
+) WellKnownLogic {
+	return &wellKnownLogic{
+		tokenLogic: tokenLogic,
+		oidc:       oidc,
+		logger:     logger,
+	}
+}
+
+func (w *wellKnownLogic) GetJwks(c *gin.Context) {
+	jwks := w.tokenLogic.GetJSONWebKeySet(c)
+
+	keys := make([]oapi.JsonWebKey, 0, len(jwks))
+	for _, jwk := range jwks {
+		keys = append(keys, oapi.JsonWebKey{
+			Kty: jwk.Kty,
+			Kid: jwk.Kid,
+			Use: utils.PtrIfNotZero(jwk.Use),
+			Alg: utils.PtrIfNotZero(jwk.Alg),
+			N:   utils.PtrIfNotZero(jwk.N),
+			E:   utils.PtrIfNotZero(jwk.E),
+			Crv: utils.PtrIfNotZero(jwk.Crv),
+			X:   utils.PtrIfNotZero(jwk.X),
+			Y:   utils.PtrIfNotZero(jwk.Y),
+		})
+	}
+
+	// Verifiers are expected to cache the set and re-fetch on an unknown kid
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, oapi.JsonWebKeySet{
+		Keys: keys,
+	})
+}
+
+func (w *wellKnownLogic) GetOpenIdConfiguration(c *gin.Context) {
+	metadata := w.oidc.GetMetadata(c)
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, oapi.OpenIdConfiguration{
+		Issuer:                           metadata.Issuer,
+		AuthorizationEndpoint:            metadata.AuthorizationEndpoint,
+		TokenEndpoint:                    metadata.TokenEndpoint,
+		UserinfoEndpoint:                 metadata.UserInfoEndpoint,
+		JwksUri:                          metadata.JwksUri,
+		ResponseTypesSupported:           []string{oidc_logic.ResponseTypeCode},
+		SubjectTypesSupported:            []string{"public"},
+		IdTokenSigningAlgValuesSupported: []string{metadata.SigningAlgorithm},
+		ScopesSupported:                  utils.Ptr(metadata.Scopes),
+		GrantTypesSupported: utils.Ptr([]string{
+			grantTypeAuthorizationCode,
+			grantTypeRefreshToken,
+			grantTypeClientCredentials,
+		}),
+		TokenEndpointAuthMethodsSupported: utils.Ptr([]string{
+			"client_secret_basic",
+			"client_secret_post",
+			"none",
+		}),
+		CodeChallengeMethodsSupported: utils.Ptr([]string{oidc_logic.CodeChallengeMethodS256}),
+		ClaimsSupported: utils.Ptr([]string{
+			"iss", "sub", "aud", "exp", "iat", "nonce", "sid",
+			"name", "preferred_username", "email", "phone_number",
+		}),
+	})
+}
@@ -0,0 +1,257 @@
+package logic
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+// CodePrefix marks invite codes so that they can be found by secret
+// scanners.
+const CodePrefix = "fgi_"
+
+const (
+	defaultInviteCodeTTL    = 7 * 24 * time.Hour
+	defaultMaxInviteCodeTTL = 90 * 24 * time.Hour
+	maxUsesLimit            = 10000
+)
+
+var (
+	ErrRegistrationClosed = errors.New("sign-up is closed")
+	ErrInviteRequired     = errors.New("an invite code is required to sign up")
+	ErrInvalidInviteCode  = errors.New("invalid, expired or used up invite code")
+	ErrInviteNotFound     = errors.New("invite code not found")
+	ErrInvalidExpiry      = errors.New("expiry of the invite code must be in the future and within the allowed lifetime")
+	ErrInvalidMaxUses     = errors.New("max uses of the invite code must be between 1 and 10000")
+	ErrInvalidRole        = errors.New("invalid invite code role")
+)
+
+type CreateParams struct {
+	// CreatedBy is the administrator minting the code
+	CreatedBy uint64
+	// Role is given to the accounts signed up with the code, empty for
+	// members
+	Role string
+	// MaxUses is one for single-use codes when left zero
+	MaxUses int64
+	// ExpiresAt is the zero time for the configured lifetime
+	ExpiresAt time.Time
+}
+
+// Invite decides who may sign up. While the registration is invite-only,
+// sign-ups have to present a code minted by an administrator. A code reads
+// fgi_<id>_<secret>, the id locates the entry and the secret is checked
+// against its stored hash.
+type Invite interface {
+	Mode() configs.RegistrationMode
+	// Create returns the code, which cannot be recovered afterwards.
+	Create(ctx context.Context, params CreateParams) (code string, entry cache.InviteCodeEntry, err error)
+	List(ctx context.Context) ([]cache.InviteCodeEntry, error)
+	Revoke(ctx context.Context, codeId string) error
+	// Redeem counts a use of the code and returns its entry. The uses are
+	// counted atomically, so a code is never accepted more than its max
+	// uses, also when concurrent sign-ups present it.
+	Redeem(ctx context.Context, code string) (cache.InviteCodeEntry, error)
+	// Release gives back the use counted by Redeem for a sign-up that failed
+	// afterwards, a used up code is restored.
+	Release(ctx context.Context, entry cache.InviteCodeEntry) error
+}
+
+type invite struct {
+	config          configs.Registration
+	inviteCodeCache cache.InviteCode
+	clock           utils.Clock
+	logger          *zap.Logger
+}
+
+func NewInviteLogic(
+	config configs.Registration,
+	inviteCodeCache cache.InviteCode,
+	clock utils.Clock,
+	logger *zap.Logger,
+) (Invite, error) {
+	config.Mode = utils.If(config.Mode != "", config.Mode, configs.RegistrationModeOpen)
+	switch config.Mode {
+	case configs.RegistrationModeOpen, configs.RegistrationModeInviteOnly, configs.RegistrationModeClosed:
+	default:
+		return nil, fmt.Errorf("unknown registration mode %q", config.Mode)
+	}
+	config.InviteCodeTTL = utils.If(config.InviteCodeTTL > 0, config.InviteCodeTTL, defaultInviteCodeTTL)
+	config.MaxInviteCodeTTL = utils.If(config.MaxInviteCodeTTL > 0, config.MaxInviteCodeTTL, defaultMaxInviteCodeTTL)
+
+	return &invite{
+		config:          config,
+		inviteCodeCache: inviteCodeCache,
+		clock:           clock,
+		logger:          logger,
+	}, nil
+}
+
+func (i *invite) Mode() configs.RegistrationMode {
+	return i.config.Mode
+}
+
+func (i *invite) Create(ctx context.Context, params CreateParams) (string, cache.InviteCodeEntry, error) {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.Uint64("admin_account_id", params.CreatedBy))
+
+	params.Role = utils.If(params.Role != "", params.Role, token_logic.RoleMember)
+	if params.Role != token_logic.RoleMember && params.Role != token_logic.RoleAdmin {
+		return "", cache.InviteCodeEntry{}, ErrInvalidRole
+	}
+	params.MaxUses = utils.If(params.MaxUses != 0, params.MaxUses, 1)
+	if params.MaxUses < 1 || params.MaxUses > maxUsesLimit {
+		return "", cache.InviteCodeEntry{}, ErrInvalidMaxUses
+	}
+
+	now := i.clock.Now()
+	ttl := i.config.InviteCodeTTL
+	if !params.ExpiresAt.IsZero() {
+		ttl = params.ExpiresAt.Sub(now)
+		if ttl <= 0 || ttl > i.config.MaxInviteCodeTTL {
+			return "", cache.InviteCodeEntry{}, ErrInvalidExpiry
+		}
+	}
+
+	codeId, err := utils.RandomHex(8)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate invite code id")
+		return "", cache.InviteCodeEntry{}, err
+	}
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate invite code secret")
+		return "", cache.InviteCodeEntry{}, err
+	}
+
+	entry := cache.InviteCodeEntry{
+		Id:         codeId,
+		SecretHash: utils.HashSecret(secret),
+		Role:       params.Role,
+		MaxUses:    params.MaxUses,
+		CreatedBy:  params.CreatedBy,
+		CreatedAt:  now.Unix(),
+		ExpiresAt:  now.Add(ttl).Unix(),
+	}
+	if err := i.inviteCodeCache.Set(ctx, entry, ttl); err != nil {
+		return "", cache.InviteCodeEntry{}, err
+	}
+
+	log.SecurityLogger(logger, "invite_code_created").
+		With(zap.String("invite_code_id", codeId)).
+		With(zap.String("role", entry.Role)).
+		With(zap.Int64("max_uses", entry.MaxUses)).
+		Info("created invite code")
+
+	return CodePrefix + codeId + "_" + secret, entry, nil
+}
+
+func (i *invite) List(ctx context.Context) ([]cache.InviteCodeEntry, error) {
+	return i.inviteCodeCache.List(ctx)
+}
+
+func (i *invite) Revoke(ctx context.Context, codeId string) error {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.String("invite_code_id", codeId))
+
+	_, err := i.inviteCodeCache.Get(ctx, codeId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrInviteNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := i.inviteCodeCache.Del(ctx, codeId); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "invite_code_revoked").Info("revoked invite code")
+
+	return nil
+}
+
+func (i *invite) Redeem(ctx context.Context, code string) (cache.InviteCodeEntry, error) {
+	logger := log.LoggerWithContext(ctx, i.logger)
+
+	code = strings.TrimSpace(code)
+	codeId, secret, ok := strings.Cut(strings.TrimPrefix(code, CodePrefix), "_")
+	if !ok || !strings.HasPrefix(code, CodePrefix) || codeId == "" || secret == "" {
+		return cache.InviteCodeEntry{}, ErrInvalidInviteCode
+	}
+	logger = logger.With(zap.String("invite_code_id", codeId))
+
+	entry, err := i.inviteCodeCache.Get(ctx, codeId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return cache.InviteCodeEntry{}, ErrInvalidInviteCode
+	} else if err != nil {
+		return cache.InviteCodeEntry{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashSecret(secret)), []byte(entry.SecretHash)) != 1 {
+		log.SecurityLogger(logger, "invite_code_rejected").Warn("invite code presented with a wrong secret")
+		return cache.InviteCodeEntry{}, ErrInvalidInviteCode
+	}
+
+	ttl := time.Unix(entry.ExpiresAt, 0).Sub(i.clock.Now())
+	if ttl <= 0 {
+		return cache.InviteCodeEntry{}, ErrInvalidInviteCode
+	}
+
+	// The counter is the one source of truth, the uses read with the entry
+	// may be stale by now
+	uses, err := i.inviteCodeCache.IncrUses(ctx, codeId, ttl)
+	if err != nil {
+		return cache.InviteCodeEntry{}, err
+	} else if uses > entry.MaxUses {
+		log.SecurityLogger(logger, "invite_code_rejected").Warn("used up invite code presented")
+		return cache.InviteCodeEntry{}, ErrInvalidInviteCode
+	}
+	entry.Uses = uses
+
+	// A used up code is of no use anymore, the counter keeps refusing it
+	// if it cannot be deleted
+	if uses == entry.MaxUses {
+		if err := i.inviteCodeCache.Del(ctx, codeId); err != nil {
+			logger.With(zap.Error(err)).Warn("failed to delete used up invite code")
+		}
+	}
+
+	log.SecurityLogger(logger, "invite_code_redeemed").
+		With(zap.Int64("uses", uses)).
+		Info("redeemed invite code")
+
+	return entry, nil
+}
+
+func (i *invite) Release(ctx context.Context, entry cache.InviteCodeEntry) error {
+	logger := log.LoggerWithContext(ctx, i.logger).With(zap.String("invite_code_id", entry.Id))
+
+	uses, err := i.inviteCodeCache.DecrUses(ctx, entry.Id)
+	if err != nil {
+		return err
+	}
+
+	// Redeem deleted the code with its last use, it comes back for the
+	// rest of its lifetime
+	ttl := time.Unix(entry.ExpiresAt, 0).Sub(i.clock.Now())
+	if entry.Uses == entry.MaxUses && ttl > 0 {
+		entry.Uses = 0
+		if err := i.inviteCodeCache.Set(ctx, entry, ttl); err != nil {
+			return err
+		}
+	}
+
+	log.SecurityLogger(logger, "invite_code_released").
+		With(zap.Int64("uses", uses)).
+		Info("gave back invite code use")
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	"github.com/Fiagram/gateway/internal/log"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTokenTTL      = 15 * time.Minute
+	defaultMaxRequests   = 5
+	defaultIpMaxRequests = 50
+	defaultWindow        = time.Hour
+)
+
+var (
+	ErrInvalidMagicLink = errors.New("invalid or expired sign-in link")
+	ErrTooManyRequests  = errors.New("too many sign-in links asked, try again later")
+)
+
+// MagicLink signs accounts in without a password through a single-use link
+// mailed to the address of the account.
+type MagicLink interface {
+	// Request mails a sign-in link when an account has the email. Past the
+	// max requests of the email or of the IP it returns ErrTooManyRequests
+	// and the time to wait, whether or not an account has it, so that
+	// callers cannot enumerate accounts.
+	Request(ctx context.Context, email string, ipAddress string, isRememberMe bool) (retryAfter time.Duration, err error)
+	// Consume exchanges the token of a link for the sign-in it was mailed
+	// for, a token is only accepted once.
+	Consume(ctx context.Context, token string) (cache.MagicLinkTokenEntry, error)
+}
+
+type magicLink struct {
+	config         configs.MagicLink
+	magicLinkCache cache.MagicLinkToken
+	accountGrpc    account_grpc.Client
+	mailSender     mail.Sender
+	clock          utils.Clock
+	logger         *zap.Logger
+}
+
+func NewMagicLinkLogic(
+	config configs.MagicLink,
+	magicLinkCache cache.MagicLinkToken,
+	accountGrpc account_grpc.Client,
+	mailSender mail.Sender,
+	clock utils.Clock,
+	logger *zap.Logger,
+) MagicLink {
+	config.TokenTTL = utils.If(config.TokenTTL > 0, config.TokenTTL, defaultTokenTTL)
+	config.MaxRequests = utils.If(config.MaxRequests > 0, config.MaxRequests, defaultMaxRequests)
+	config.IpMaxRequests = utils.If(config.IpMaxRequests > 0, config.IpMaxRequests, defaultIpMaxRequests)
+	config.Window = utils.If(config.Window > 0, config.Window, defaultWindow)
+
+	return &magicLink{
+		config:         config,
+		magicLinkCache: magicLinkCache,
+		accountGrpc:    accountGrpc,
+		mailSender:     mailSender,
+		clock:          clock,
+		logger:         logger,
+	}
+}
+
+func (m *magicLink) Request(ctx context.Context, email string, ipAddress string, isRememberMe bool) (time.Duration, error) {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.String("ip_address", ipAddress))
+
+	// The limits come before the lookup, which scans the accounts
+	email = strings.TrimSpace(email)
+	requests, err := m.magicLinkCache.IncrRequests(ctx, email, m.config.Window)
+	if err != nil {
+		return 0, err
+	} else if requests > int64(m.config.MaxRequests) {
+		log.SecurityLogger(logger, "magic_link_rate_limited").Warn("too many sign-in links asked for an email")
+		return m.config.Window, ErrTooManyRequests
+	}
+	if ipAddress != "" {
+		requests, err := m.magicLinkCache.IncrIpRequests(ctx, ipAddress, m.config.Window)
+		if err != nil {
+			return 0, err
+		} else if requests > int64(m.config.IpMaxRequests) {
+			log.SecurityLogger(logger, "magic_link_rate_limited").Warn("too many sign-in links asked from an ip")
+			return m.config.Window, ErrTooManyRequests
+		}
+	}
+
+	accountId, err := account_grpc.FindAccountIdByEmail(ctx, m.accountGrpc, email)
+	if errors.Is(err, account_grpc.ErrEmailNotUnique) {
+		log.SecurityLogger(logger, "magic_link_ambiguous_email").Warn("sign-in link asked for an email of several accounts")
+		return 0, nil
+	} else if err != nil {
+		logger.With(zap.Error(err)).Error("failed to find account by email")
+		return 0, err
+	} else if accountId == 0 {
+		log.SecurityLogger(logger, "magic_link_unknown_email").Info("sign-in link asked for an unknown email")
+		return 0, nil
+	}
+	logger = logger.With(zap.Uint64("account_id", accountId))
+
+	token, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate magic link token")
+		return 0, err
+	}
+
+	now := m.clock.Now()
+	err = m.magicLinkCache.Set(ctx, utils.HashSecret(token), cache.MagicLinkTokenEntry{
+		AccountId:    accountId,
+		IsRememberMe: isRememberMe,
+		CreatedAt:    now.Unix(),
+		ExpiresAt:    now.Add(m.config.TokenTTL).Unix(),
+	}, m.config.TokenTTL)
+	if err != nil {
+		return 0, err
+	}
+
+	signInUrl, err := m.signInUrl(token)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to build magic link url")
+		return 0, err
+	}
+
+	err = m.mailSender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Open the link below within %s to sign in to your account:\n\n%s\n\n"+
+			"The link works once. If you did not ask for it, ignore this mail.",
+			m.config.TokenTTL, signInUrl),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.SecurityLogger(logger, "magic_link_requested").Info("mailed a sign-in link")
+
+	return 0, nil
+}
+
+func (m *magicLink) Consume(ctx context.Context, token string) (cache.MagicLinkTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	tokenHash := utils.HashSecret(token)
+	entry, err := m.magicLinkCache.Get(ctx, tokenHash)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return cache.MagicLinkTokenEntry{}, ErrInvalidMagicLink
+	} else if err != nil {
+		return cache.MagicLinkTokenEntry{}, err
+	}
+	logger = logger.With(zap.Uint64("account_id", entry.AccountId))
+
+	if !m.clock.Now().Before(time.Unix(entry.ExpiresAt, 0)) {
+		return cache.MagicLinkTokenEntry{}, ErrInvalidMagicLink
+	}
+
+	isFirstUse, err := m.magicLinkCache.Consume(ctx, tokenHash, m.config.TokenTTL)
+	if err != nil {
+		return cache.MagicLinkTokenEntry{}, err
+	} else if !isFirstUse {
+		log.SecurityLogger(logger, "magic_link_replay").Warn("sign-in link presented again")
+		return cache.MagicLinkTokenEntry{}, ErrInvalidMagicLink
+	}
+
+	if err := m.magicLinkCache.Del(ctx, tokenHash); err != nil {
+		return cache.MagicLinkTokenEntry{}, err
+	}
+
+	log.SecurityLogger(logger, "magic_link_consumed").Info("signed in with a sign-in link")
+
+	return entry, nil
+}
+
+func (m *magicLink) signInUrl(token string) (string, error) {
+	signInUrl, err := url.Parse(m.config.Url)
+	if err != nil {
+		return "", err
+	}
+
+	query := signInUrl.Query()
+	query.Set("token", token)
+	signInUrl.RawQuery = query.Encode()
+	return signInUrl.String(), nil
+}
@@ -0,0 +1,302 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultChallengeTTL  = 5 * time.Minute
+	defaultMaxAttempts   = 5
+	defaultEnrollmentTTL = 10 * time.Minute
+)
+
+var (
+	ErrMfaAlreadyEnabled  = errors.New("mfa is already enabled")
+	ErrMfaNotEnabled      = errors.New("mfa is not enabled")
+	ErrEnrollmentNotFound = errors.New("no pending totp enrollment")
+	ErrInvalidCode        = errors.New("invalid totp code")
+	ErrInvalidChallenge   = errors.New("invalid or expired mfa challenge")
+)
+
+type TotpEnrollment struct {
+	Secret          string
+	ProvisioningUri string
+}
+
+// Mfa manages the TOTP second factor of accounts and the challenges that
+// sit between the password step and the code step of a sign-in.
+type Mfa interface {
+	IsEnabled(ctx context.Context, accountId uint64) (bool, error)
+	// BeginTotpEnrollment generates a new secret, it only takes effect once
+	// confirmed with a code from the authenticator app.
+	BeginTotpEnrollment(ctx context.Context, accountId uint64, accountName string) (TotpEnrollment, error)
+	ConfirmTotpEnrollment(ctx context.Context, accountId uint64, code string) error
+	DisableTotp(ctx context.Context, accountId uint64, code string) error
+	// VerifyTotp checks a code of the confirmed second factor, for accounts
+	// proving again who they are while signed in.
+	VerifyTotp(ctx context.Context, accountId uint64, code string) error
+
+	StartChallenge(ctx context.Context, accountId uint64, isRememberMe bool) (challenge string, expiresAt time.Time, err error)
+	// CompleteChallenge consumes the challenge when the code is valid. The
+	// challenge is dropped as well once it has seen too many codes.
+	CompleteChallenge(ctx context.Context, challenge string, code string) (cache.MfaChallengeEntry, error)
+}
+
+type mfa struct {
+	config              configs.Mfa
+	totpEnrollmentCache cache.TotpEnrollment
+	mfaChallengeCache   cache.MfaChallenge
+	throttleLogic       throttle_logic.SignInThrottle
+	clock               utils.Clock
+	logger              *zap.Logger
+}
+
+func NewMfaLogic(
+	config configs.Mfa,
+	totpEnrollmentCache cache.TotpEnrollment,
+	mfaChallengeCache cache.MfaChallenge,
+	throttleLogic throttle_logic.SignInThrottle,
+	clock utils.Clock,
+	logger *zap.Logger,
+) Mfa {
+	config.ChallengeTTL = utils.If(config.ChallengeTTL > 0, config.ChallengeTTL, defaultChallengeTTL)
+	config.MaxAttempts = utils.If(config.MaxAttempts > 0, config.MaxAttempts, defaultMaxAttempts)
+	config.EnrollmentTTL = utils.If(config.EnrollmentTTL > 0, config.EnrollmentTTL, defaultEnrollmentTTL)
+
+	return &mfa{
+		config:              config,
+		totpEnrollmentCache: totpEnrollmentCache,
+		mfaChallengeCache:   mfaChallengeCache,
+		throttleLogic:       throttleLogic,
+		clock:               clock,
+		logger:              logger,
+	}
+}
+
+func (m *mfa) IsEnabled(ctx context.Context, accountId uint64) (bool, error) {
+	entry, err := m.totpEnrollmentCache.Get(ctx, accountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return entry.IsConfirmed, nil
+}
+
+func (m *mfa) BeginTotpEnrollment(ctx context.Context, accountId uint64, accountName string) (TotpEnrollment, error) {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.Uint64("account_id", accountId))
+
+	isEnabled, err := m.IsEnabled(ctx, accountId)
+	if err != nil {
+		return TotpEnrollment{}, err
+	} else if isEnabled {
+		return TotpEnrollment{}, ErrMfaAlreadyEnabled
+	}
+
+	secret, err := generateTotpSecret()
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate totp secret")
+		return TotpEnrollment{}, err
+	}
+
+	// A new enrollment replaces any pending one
+	err = m.totpEnrollmentCache.Set(ctx, accountId, cache.TotpEnrollmentEntry{
+		Secret:    secret,
+		CreatedAt: m.clock.Now().Unix(),
+	}, m.config.EnrollmentTTL)
+	if err != nil {
+		return TotpEnrollment{}, err
+	}
+
+	return TotpEnrollment{
+		Secret:          secret,
+		ProvisioningUri: totpProvisioningUri(m.config.Issuer, accountName, secret),
+	}, nil
+}
+
+func (m *mfa) ConfirmTotpEnrollment(ctx context.Context, accountId uint64, code string) error {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.Uint64("account_id", accountId))
+
+	entry, err := m.totpEnrollmentCache.Get(ctx, accountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrEnrollmentNotFound
+	} else if err != nil {
+		return err
+	} else if entry.IsConfirmed {
+		return ErrMfaAlreadyEnabled
+	}
+
+	step, ok := matchTotpStep(entry.Secret, code, m.clock.Now(), entry.LastUsedStep)
+	if !ok {
+		return ErrInvalidCode
+	}
+
+	entry.IsConfirmed = true
+	entry.LastUsedStep = step
+	if err := m.totpEnrollmentCache.Set(ctx, accountId, entry, 0); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "mfa_enabled").Info("enabled totp second factor")
+
+	return nil
+}
+
+func (m *mfa) DisableTotp(ctx context.Context, accountId uint64, code string) error {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.Uint64("account_id", accountId))
+
+	entry, err := m.totpEnrollmentCache.Get(ctx, accountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrMfaNotEnabled
+	} else if err != nil {
+		return err
+	} else if !entry.IsConfirmed {
+		return ErrMfaNotEnabled
+	}
+
+	if err := m.verifyCode(ctx, accountId, entry, code); err != nil {
+		return err
+	}
+
+	if err := m.totpEnrollmentCache.Del(ctx, accountId); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "mfa_disabled").Info("disabled totp second factor")
+
+	return nil
+}
+
+func (m *mfa) VerifyTotp(ctx context.Context, accountId uint64, code string) error {
+	entry, err := m.totpEnrollmentCache.Get(ctx, accountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrMfaNotEnabled
+	} else if err != nil {
+		return err
+	} else if !entry.IsConfirmed {
+		return ErrMfaNotEnabled
+	}
+
+	return m.verifyCode(ctx, accountId, entry, code)
+}
+
+func (m *mfa) StartChallenge(ctx context.Context, accountId uint64, isRememberMe bool) (string, time.Time, error) {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.Uint64("account_id", accountId))
+
+	challenge, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate mfa challenge")
+		return "", time.Time{}, err
+	}
+	expiresAt := m.clock.Now().Add(m.config.ChallengeTTL)
+
+	err = m.mfaChallengeCache.Set(ctx, challenge, cache.MfaChallengeEntry{
+		AccountId:    accountId,
+		IsRememberMe: isRememberMe,
+		ExpiresAt:    expiresAt.Unix(),
+	}, m.config.ChallengeTTL)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return challenge, expiresAt, nil
+}
+
+func (m *mfa) CompleteChallenge(ctx context.Context, challenge string, code string) (cache.MfaChallengeEntry, error) {
+	logger := log.LoggerWithContext(ctx, m.logger)
+
+	entry, err := m.mfaChallengeCache.Get(ctx, challenge)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return cache.MfaChallengeEntry{}, ErrInvalidChallenge
+	} else if err != nil {
+		return cache.MfaChallengeEntry{}, err
+	}
+	logger = logger.With(zap.Uint64("account_id", entry.AccountId))
+
+	if !m.clock.Now().Before(time.Unix(entry.ExpiresAt, 0)) {
+		return cache.MfaChallengeEntry{}, ErrInvalidChallenge
+	}
+
+	enrollment, err := m.totpEnrollmentCache.Get(ctx, entry.AccountId)
+	if errors.Is(err, cache.ErrCacheMiss) || (err == nil && !enrollment.IsConfirmed) {
+		// MFA was disabled in between, the sign-in has to start over
+		return cache.MfaChallengeEntry{}, ErrInvalidChallenge
+	} else if err != nil {
+		return cache.MfaChallengeEntry{}, err
+	}
+
+	// Attempts are counted before the code is checked, so that concurrent
+	// guesses cannot get past the max attempts
+	ttl := time.Unix(entry.ExpiresAt, 0).Sub(m.clock.Now())
+	attempts, err := m.mfaChallengeCache.IncrAttempts(ctx, challenge, ttl)
+	if err != nil {
+		return cache.MfaChallengeEntry{}, err
+	} else if attempts > int64(m.config.MaxAttempts) {
+		return cache.MfaChallengeEntry{}, ErrInvalidChallenge
+	}
+
+	err = m.verifyCode(ctx, entry.AccountId, enrollment, code)
+	if errors.Is(err, ErrInvalidCode) {
+		if attempts == int64(m.config.MaxAttempts) {
+			log.SecurityLogger(logger, "mfa_challenge_exhausted").
+				With(zap.Int64("attempts", attempts)).
+				Warn("too many invalid codes, dropping the mfa challenge")
+			if err := m.mfaChallengeCache.Del(ctx, challenge); err != nil {
+				return cache.MfaChallengeEntry{}, err
+			}
+		}
+		return cache.MfaChallengeEntry{}, ErrInvalidCode
+	} else if err != nil {
+		return cache.MfaChallengeEntry{}, err
+	}
+
+	// A challenge signs in once
+	if err := m.mfaChallengeCache.Del(ctx, challenge); err != nil {
+		return cache.MfaChallengeEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// verifyCode accepts a code of a confirmed enrollment and burns its time
+// step so that the same code cannot be used twice. Invalid codes count
+// toward the sign-in throttle of the account, whichever challenge or
+// request they come with, and ErrTooManyAttempts is returned while it is
+// blocked.
+func (m *mfa) verifyCode(ctx context.Context, accountId uint64, entry cache.TotpEnrollmentEntry, code string) error {
+	logger := log.LoggerWithContext(ctx, m.logger).With(zap.Uint64("account_id", accountId))
+
+	if _, err := m.throttleLogic.CheckAccount(ctx, accountId); err != nil {
+		return err
+	}
+
+	step, ok := matchTotpStep(entry.Secret, code, m.clock.Now(), entry.LastUsedStep)
+	if ok {
+		// The step stays burnt for as long as its code could match
+		isFirstUse, err := m.totpEnrollmentCache.ConsumeStep(ctx, accountId, step, (2*totpSkew+1)*totpPeriod)
+		if err != nil {
+			return err
+		} else if !isFirstUse {
+			log.SecurityLogger(logger, "totp_code_replayed").Warn("totp code presented twice")
+		}
+		ok = isFirstUse
+	}
+	if !ok {
+		if err := m.throttleLogic.RecordAccountFailure(ctx, accountId); err != nil {
+			return err
+		}
+		return ErrInvalidCode
+	}
+
+	return m.throttleLogic.RecordAccountSuccess(ctx, accountId)
+}
@@ -0,0 +1,123 @@
+package logic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTP parameters of RFC 6238 as understood by every authenticator app
+const (
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	totpSecretSize = 20
+	// totpSkew is the number of steps accepted before and after the current
+	// one to tolerate clock drift between the phone and the gateway
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateTotpSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// TotpCode computes the code of the base32 encoded secret at the given time.
+func TotpCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTotpSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCodeAtStep(key, totpStep(t)), nil
+}
+
+func totpCodeAtStep(key []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation of RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for range totpDigits {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// matchTotpStep returns the step within the skew window whose code equals
+// the given one and that comes after lastUsedStep, or false.
+func matchTotpStep(secret string, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	key, err := decodeTotpSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	if _, err := strconv.Atoi(code); err != nil {
+		return 0, false
+	}
+
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCodeAtStep(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpProvisioningUri builds the otpauth URI shown as QR code to enroll an
+// authenticator app.
+func totpProvisioningUri(issuer string, accountName string, secret string) string {
+	label := accountName
+	if issuer != "" {
+		label = issuer + ":" + accountName
+	}
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	if issuer != "" {
+		query.Set("issuer", issuer)
+	}
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(int(totpPeriod/time.Second)))
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + label,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+func decodeTotpSecret(secret string) ([]byte, error) {
+	return totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+}
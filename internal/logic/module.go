@@ -1,17 +1,73 @@
 package logic
 
 import (
+	"context"
+
+	csrf_logic "github.com/Fiagram/gateway/internal/logic/csrf"
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
+	federation_logic "github.com/Fiagram/gateway/internal/logic/federation"
 	http_logic "github.com/Fiagram/gateway/internal/logic/http"
+	invite_logic "github.com/Fiagram/gateway/internal/logic/invite"
+	magiclink_logic "github.com/Fiagram/gateway/internal/logic/magiclink"
+	mfa_logic "github.com/Fiagram/gateway/internal/logic/mfa"
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	oidc_logic "github.com/Fiagram/gateway/internal/logic/oidc"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	pat_logic "github.com/Fiagram/gateway/internal/logic/pat"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
 	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	verification_logic "github.com/Fiagram/gateway/internal/logic/verification"
+	webauthn_logic "github.com/Fiagram/gateway/internal/logic/webauthn"
+	"github.com/Fiagram/gateway/internal/utils"
 	"go.uber.org/fx"
 )
 
 var Module = fx.Module(
 	"logic",
 	fx.Provide(
+		utils.NewClock,
+		token_logic.NewKeyring,
 		token_logic.NewTokenLogic,
+		session_logic.NewSessionPolicy,
+		session_logic.NewSessionLogic,
+		mfa_logic.NewMfaLogic,
+		webauthn_logic.NewWebAuthnLogic,
+		pat_logic.NewPersonalAccessTokenLogic,
+		oauth_logic.NewOAuthLogic,
+		oauth_logic.NewTokenIntrospectionLogic,
+		oauth_logic.NewTokenExchangeLogic,
+		throttle_logic.NewSignInThrottleLogic,
+		password_logic.NewPasswordPolicyLogic,
+		password_logic.NewPasswordResetLogic,
+		verification_logic.NewEmailVerificationLogic,
+		magiclink_logic.NewMagicLinkLogic,
+		oidc_logic.NewProviderLogic,
+		federation_logic.NewFederationLogic,
+		csrf_logic.NewCsrfLogic,
+		dpop_logic.NewDpopLogic,
+		invite_logic.NewInviteLogic,
 
 		http_logic.NewAuthLogic,
 		http_logic.NewUsersLogic,
+		http_logic.NewMfaLogic,
+		http_logic.NewOAuthLogic,
+		http_logic.NewAdminLogic,
+		http_logic.NewWellKnownLogic,
+	),
+	fx.Invoke(
+		func(lc fx.Lifecycle, keyring token_logic.Keyring) {
+			ctx, cancel := context.WithCancel(context.Background())
+			lc.Append(fx.Hook{
+				OnStart: func(_ context.Context) error {
+					go keyring.Watch(ctx)
+					return nil
+				},
+				OnStop: func(_ context.Context) error {
+					cancel()
+					return nil
+				},
+			})
+		},
 	),
 )
@@ -0,0 +1,276 @@
+package logic
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidClient   = errors.New("invalid client credentials")
+	ErrInvalidScope    = errors.New("requested scope is not allowed for the client")
+	ErrInvalidAudience = errors.New("requested audience is not allowed for the client")
+	ErrInvalidClientId = errors.New("client id must be 3 to 64 lowercase letters, digits, '.', '_' or '-'")
+	ErrClientExists    = errors.New("oauth client already exists")
+	ErrClientNotFound  = errors.New("oauth client not found")
+)
+
+var (
+	clientIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{2,63}$`)
+	scopePattern    = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,63}$`)
+)
+
+type RegisterClientParams struct {
+	Id     string
+	Name   string
+	Scopes []string
+	// Audiences are the services the client may request tokens for
+	Audiences []string
+}
+
+// IssuedToken is an access token handed to a service principal.
+type IssuedToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+	Scopes      []string
+}
+
+// OAuth is the registry of machine identities and the client credentials
+// grant that issues them access tokens. Clients come from the config or
+// are registered at runtime, the config wins when both know an id.
+type OAuth interface {
+	// RegisterClient returns the client secret, which cannot be recovered
+	// afterwards.
+	RegisterClient(ctx context.Context, params RegisterClientParams) (secret string, entry cache.OAuthClientEntry, err error)
+	DeleteClient(ctx context.Context, clientId string) error
+	ListClients(ctx context.Context) ([]cache.OAuthClientEntry, error)
+	// AuthenticateClient returns the client when the secret matches, it is
+	// the client authentication of every OAuth endpoint.
+	AuthenticateClient(ctx context.Context, clientId string, clientSecret string) (cache.OAuthClientEntry, error)
+	// IssueClientCredentialsToken grants the requested scopes, or every
+	// scope of the client when none is requested. The token is meant for the
+	// requested audience, the gateway when none is requested. Only the
+	// audiences of the client can be requested.
+	IssueClientCredentialsToken(ctx context.Context, clientId string, clientSecret string, scopes []string, audience []string) (IssuedToken, error)
+}
+
+type oAuth struct {
+	config           configs.OAuth
+	oauthClientCache cache.OAuthClient
+	tokenLogic       token_logic.Token
+	clock            utils.Clock
+	logger           *zap.Logger
+}
+
+func NewOAuthLogic(
+	config configs.OAuth,
+	oauthClientCache cache.OAuthClient,
+	tokenLogic token_logic.Token,
+	clock utils.Clock,
+	logger *zap.Logger,
+) OAuth {
+	return &oAuth{
+		config:           config,
+		oauthClientCache: oauthClientCache,
+		tokenLogic:       tokenLogic,
+		clock:            clock,
+		logger:           logger,
+	}
+}
+
+// NewClientSecret generates a client secret and the hash to store for it.
+func NewClientSecret() (secret string, secretHash string, err error) {
+	secret, err = utils.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, utils.HashSecret(secret), nil
+}
+
+func (o *oAuth) RegisterClient(ctx context.Context, params RegisterClientParams) (string, cache.OAuthClientEntry, error) {
+	logger := log.LoggerWithContext(ctx, o.logger).With(zap.String("client_id", params.Id))
+
+	if !clientIdPattern.MatchString(params.Id) {
+		return "", cache.OAuthClientEntry{}, ErrInvalidClientId
+	}
+	for _, scope := range params.Scopes {
+		if !scopePattern.MatchString(scope) {
+			return "", cache.OAuthClientEntry{}, ErrInvalidScope
+		}
+	}
+
+	_, err := o.getClient(ctx, params.Id)
+	if err == nil {
+		return "", cache.OAuthClientEntry{}, ErrClientExists
+	} else if !errors.Is(err, ErrClientNotFound) {
+		return "", cache.OAuthClientEntry{}, err
+	}
+
+	secret, secretHash, err := NewClientSecret()
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate client secret")
+		return "", cache.OAuthClientEntry{}, err
+	}
+
+	entry := cache.OAuthClientEntry{
+		Id:         params.Id,
+		Name:       params.Name,
+		SecretHash: secretHash,
+		Scopes:     utils.If(params.Scopes != nil, params.Scopes, []string{}),
+		Audiences:  utils.If(params.Audiences != nil, params.Audiences, []string{}),
+		CreatedAt:  o.clock.Now().Unix(),
+	}
+	if err := o.oauthClientCache.Set(ctx, entry); err != nil {
+		return "", cache.OAuthClientEntry{}, err
+	}
+
+	log.SecurityLogger(logger, "oauth_client_registered").
+		With(zap.Strings("scopes", entry.Scopes)).
+		With(zap.Strings("audiences", entry.Audiences)).
+		Info("registered oauth client")
+
+	return secret, entry, nil
+}
+
+func (o *oAuth) DeleteClient(ctx context.Context, clientId string) error {
+	logger := log.LoggerWithContext(ctx, o.logger).With(zap.String("client_id", clientId))
+
+	_, err := o.oauthClientCache.Get(ctx, clientId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrClientNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := o.oauthClientCache.Del(ctx, clientId); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "oauth_client_deleted").Info("deleted oauth client")
+
+	return nil
+}
+
+func (o *oAuth) ListClients(ctx context.Context) ([]cache.OAuthClientEntry, error) {
+	registered, err := o.oauthClientCache.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make([]cache.OAuthClientEntry, 0, len(o.config.Clients)+len(registered))
+	for _, client := range o.config.Clients {
+		clients = append(clients, configClientEntry(client))
+	}
+	for _, client := range registered {
+		if _, found := o.findConfigClient(client.Id); !found {
+			clients = append(clients, client)
+		}
+	}
+
+	return clients, nil
+}
+
+func (o *oAuth) IssueClientCredentialsToken(
+	ctx context.Context,
+	clientId string,
+	clientSecret string,
+	scopes []string,
+	audience []string,
+) (IssuedToken, error) {
+	client, err := o.AuthenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return IssuedToken{}, err
+	}
+
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return IssuedToken{}, ErrInvalidScope
+		}
+	}
+	for _, aud := range audience {
+		if !slices.Contains(client.Audiences, aud) {
+			return IssuedToken{}, ErrInvalidAudience
+		}
+	}
+
+	accessToken, expiresAt, err := o.tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{
+		ClientId: client.Id,
+		Scopes:   scopes,
+		Audience: audience,
+	})
+	if err != nil {
+		return IssuedToken{}, err
+	}
+
+	return IssuedToken{
+		AccessToken: accessToken,
+		ExpiresAt:   expiresAt,
+		Scopes:      scopes,
+	}, nil
+}
+
+func (o *oAuth) AuthenticateClient(ctx context.Context, clientId string, clientSecret string) (cache.OAuthClientEntry, error) {
+	logger := log.LoggerWithContext(ctx, o.logger).With(zap.String("client_id", clientId))
+
+	client, err := o.getClient(ctx, clientId)
+	if errors.Is(err, ErrClientNotFound) {
+		log.SecurityLogger(logger, "oauth_client_authentication_failed").Warn("unknown oauth client")
+		return cache.OAuthClientEntry{}, ErrInvalidClient
+	} else if err != nil {
+		return cache.OAuthClientEntry{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashSecret(clientSecret)), []byte(client.SecretHash)) != 1 {
+		log.SecurityLogger(logger, "oauth_client_authentication_failed").Warn("invalid oauth client secret")
+		return cache.OAuthClientEntry{}, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+func (o *oAuth) getClient(ctx context.Context, clientId string) (cache.OAuthClientEntry, error) {
+	if client, found := o.findConfigClient(clientId); found {
+		return configClientEntry(client), nil
+	}
+
+	entry, err := o.oauthClientCache.Get(ctx, clientId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return cache.OAuthClientEntry{}, ErrClientNotFound
+	} else if err != nil {
+		return cache.OAuthClientEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (o *oAuth) findConfigClient(clientId string) (configs.OAuthClient, bool) {
+	for _, client := range o.config.Clients {
+		if client.Id == clientId {
+			return client, true
+		}
+	}
+	return configs.OAuthClient{}, false
+}
+
+func configClientEntry(client configs.OAuthClient) cache.OAuthClientEntry {
+	return cache.OAuthClientEntry{
+		Id:         client.Id,
+		Name:       client.Name,
+		SecretHash: client.SecretHash,
+		Scopes:     utils.If(client.Scopes != nil, client.Scopes, []string{}),
+		Audiences:  utils.If(client.Audiences != nil, client.Audiences, []string{}),
+	}
+}
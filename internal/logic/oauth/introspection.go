@@ -0,0 +1,203 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Token types reported by introspection, they match the token_type_hint
+// values of RFC 7009
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+var ErrTokenNotOwned = errors.New("the token was issued to another client")
+
+// Introspection describes a token as in RFC 7662. Every field but Active is
+// empty for inactive tokens so that nothing leaks about them.
+type Introspection struct {
+	Active    bool
+	TokenType string
+	// Subject is the account id, or the client id for service tokens
+	Subject   string
+	ClientId  string
+	Scopes    []string
+	TokenId   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Audience are the services an access token is meant for, resource
+	// servers have to find themselves in it
+	Audience []string
+}
+
+// TokenIntrospection tells resource servers whether a token is still good
+// and lets clients give up tokens, for the access JWTs and the opaque
+// refresh tokens alike. Access tokens are told apart by their JWT shape, a
+// token type hint is not needed.
+type TokenIntrospection interface {
+	Introspect(ctx context.Context, token string) (Introspection, error)
+	// RevokeToken succeeds for unknown and invalid tokens as RFC 7009 asks.
+	// A token may only be revoked by the client it was issued to: service
+	// tokens by their client, refresh tokens by the client of their
+	// session. The tokens of first-party sign-ins were issued to no client
+	// and are ended by signing out instead.
+	RevokeToken(ctx context.Context, clientId string, token string) error
+}
+
+type tokenIntrospection struct {
+	tokenLogic        token_logic.Token
+	sessionLogic      session_logic.Session
+	refreshTokenCache cache.RefreshToken
+	clock             utils.Clock
+	logger            *zap.Logger
+}
+
+func NewTokenIntrospectionLogic(
+	tokenLogic token_logic.Token,
+	sessionLogic session_logic.Session,
+	refreshTokenCache cache.RefreshToken,
+	clock utils.Clock,
+	logger *zap.Logger,
+) TokenIntrospection {
+	return &tokenIntrospection{
+		tokenLogic:        tokenLogic,
+		sessionLogic:      sessionLogic,
+		refreshTokenCache: refreshTokenCache,
+		clock:             clock,
+		logger:            logger,
+	}
+}
+
+func (t *tokenIntrospection) Introspect(ctx context.Context, token string) (Introspection, error) {
+	if isAccessToken(token) {
+		return t.introspectAccessToken(ctx, token)
+	}
+	return t.introspectRefreshToken(ctx, token)
+}
+
+func (t *tokenIntrospection) RevokeToken(ctx context.Context, clientId string, token string) error {
+	logger := log.LoggerWithContext(ctx, t.logger).With(zap.String("client_id", clientId))
+
+	if !isAccessToken(token) {
+		// Entries of the old format cannot be used anymore either
+		entry, err := t.refreshTokenCache.Get(ctx, token)
+		if errors.Is(err, cache.ErrCacheMiss) || errors.Is(err, cache.ErrInvalidEntry) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if entry.ClientId != clientId {
+			log.SecurityLogger(logger, "oauth_token_revocation_refused").
+				With(zap.String("token_client_id", entry.ClientId)).
+				Warn("client tried to revoke a refresh token issued to another client")
+			return ErrTokenNotOwned
+		}
+
+		if err := t.sessionLogic.Revoke(ctx, token); err != nil {
+			return err
+		}
+
+		log.SecurityLogger(logger, "oauth_token_revoked").
+			With(zap.Uint64("account_id", entry.AccountId)).
+			With(zap.String("token_type", TokenTypeRefreshToken)).
+			Info("revoked refresh token")
+		return nil
+	}
+
+	payload, expiresAt, err := t.tokenLogic.InspectAccessToken(ctx, token)
+	if err != nil {
+		return nil
+	}
+	// User access tokens do not name a client, no client owns them
+	if payload.ClientId != clientId {
+		log.SecurityLogger(logger, "oauth_token_revocation_refused").
+			With(zap.String("token_client_id", payload.ClientId)).
+			Warn("client tried to revoke the token of another client")
+		return ErrTokenNotOwned
+	}
+
+	if err := t.sessionLogic.RevokeAccessToken(ctx, payload, expiresAt); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "oauth_token_revoked").
+		With(zap.Uint64("account_id", payload.AccountId)).
+		With(zap.String("token_type", TokenTypeAccessToken)).
+		Info("revoked access token")
+	return nil
+}
+
+func (t *tokenIntrospection) introspectAccessToken(ctx context.Context, token string) (Introspection, error) {
+	payload, expiresAt, err := t.tokenLogic.InspectAccessToken(ctx, token)
+	if err != nil {
+		return Introspection{}, nil
+	}
+
+	isRevoked, err := t.sessionLogic.IsAccessTokenRevoked(ctx, payload)
+	if err != nil {
+		return Introspection{}, err
+	} else if isRevoked {
+		return Introspection{}, nil
+	}
+
+	return Introspection{
+		Active:    true,
+		TokenType: TokenTypeAccessToken,
+		Subject: utils.If(payload.IsService(),
+			payload.ClientId,
+			strconv.FormatUint(payload.AccountId, 10)),
+		ClientId:  payload.ClientId,
+		Scopes:    payload.Scopes,
+		Audience:  payload.Audience,
+		TokenId:   payload.TokenId,
+		IssuedAt:  payload.IssuedAt,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (t *tokenIntrospection) introspectRefreshToken(ctx context.Context, token string) (Introspection, error) {
+	// Entries of the old format are refused on refresh, they are inactive
+	entry, err := t.refreshTokenCache.Get(ctx, token)
+	if errors.Is(err, cache.ErrCacheMiss) || errors.Is(err, cache.ErrInvalidEntry) {
+		return Introspection{}, nil
+	} else if err != nil {
+		return Introspection{}, err
+	}
+
+	// A rotated token is only kept to detect its reuse
+	if entry.RotatedAt != 0 {
+		return Introspection{}, nil
+	}
+
+	var expiresAt time.Time
+	if entry.ExpiresAt != 0 {
+		expiresAt = time.Unix(entry.ExpiresAt, 0)
+		if !t.clock.Now().Before(expiresAt) {
+			return Introspection{}, nil
+		}
+	}
+
+	return Introspection{
+		Active:    true,
+		TokenType: TokenTypeRefreshToken,
+		Subject:   strconv.FormatUint(entry.AccountId, 10),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// isAccessToken tells a JWT apart from the opaque refresh tokens, which
+// are base64url encoded and thus never contain a dot.
+func isAccessToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,170 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	"github.com/Fiagram/gateway/internal/log"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Identifiers of the token exchange grant of RFC 8693
+const (
+	GrantTypeTokenExchange  = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeUriAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+const defaultImpersonationTokenTTL = 10 * time.Minute
+
+var (
+	ErrInvalidSubjectToken     = errors.New("subject token is invalid or expired")
+	ErrImpersonationNotAllowed = errors.New("only administrators may impersonate accounts")
+	ErrInvalidTarget           = errors.New("the requested account cannot be impersonated")
+	ErrDpopKeyMismatch         = errors.New("the subject token is bound to a dpop key the request has no proof of")
+)
+
+// TokenExchange trades the access token of an administrator for a short
+// lived access token of another account, so that support can see what the
+// account sees. The issued token names the administrator in its act claim
+// and comes without a refresh token.
+type TokenExchange interface {
+	// Impersonate takes the thumbprint of the key of the DPoP proof of the
+	// request, empty without a proof. A subject token bound to a key is only
+	// accepted along with a proof of that key, and the issued token is bound
+	// to the key of the proof.
+	Impersonate(ctx context.Context, subjectToken string, keyThumbprint string, accountId uint64) (IssuedToken, error)
+}
+
+type tokenExchange struct {
+	config       configs.Impersonation
+	accountGrpc  account_grpc.Client
+	tokenLogic   token_logic.Token
+	sessionLogic session_logic.Session
+	clock        utils.Clock
+	logger       *zap.Logger
+}
+
+func NewTokenExchangeLogic(
+	config configs.Impersonation,
+	accountGrpc account_grpc.Client,
+	tokenLogic token_logic.Token,
+	sessionLogic session_logic.Session,
+	clock utils.Clock,
+	logger *zap.Logger,
+) TokenExchange {
+	config.TokenTTL = utils.If(config.TokenTTL > 0, config.TokenTTL, defaultImpersonationTokenTTL)
+	return &tokenExchange{
+		config:       config,
+		accountGrpc:  accountGrpc,
+		tokenLogic:   tokenLogic,
+		sessionLogic: sessionLogic,
+		clock:        clock,
+		logger:       logger,
+	}
+}
+
+func (t *tokenExchange) Impersonate(ctx context.Context, subjectToken string, keyThumbprint string, accountId uint64) (IssuedToken, error) {
+	logger := log.LoggerWithContext(ctx, t.logger).With(zap.Uint64("account_id", accountId))
+
+	actor, _, err := t.tokenLogic.GetPayloadFromAccessToken(ctx, subjectToken)
+	if err != nil {
+		return IssuedToken{}, ErrInvalidSubjectToken
+	}
+	isRevoked, err := t.sessionLogic.IsAccessTokenRevoked(ctx, actor)
+	if err != nil {
+		return IssuedToken{}, err
+	} else if isRevoked {
+		return IssuedToken{}, ErrInvalidSubjectToken
+	}
+
+	logger = logger.With(zap.Uint64("actor_account_id", actor.AccountId))
+
+	// A leaked bound token must not be turned into a bearer token here
+	if actor.KeyThumbprint != "" && keyThumbprint != actor.KeyThumbprint {
+		log.SecurityLogger(logger, "impersonation_refused").
+			Warn("dpop bound token used for impersonation without a proof of its key")
+		return IssuedToken{}, ErrDpopKeyMismatch
+	}
+
+	// Only the full token of a signed in administrator will do, the role is
+	// checked again in case it was taken away after the token was issued
+	if actor.IsService() || actor.IsImpersonation() || len(actor.Scopes) > 0 ||
+		actor.IsEmailUnverified || actor.Role != token_logic.RoleAdmin {
+		log.SecurityLogger(logger, "impersonation_refused").
+			Warn("non administrator token used for impersonation")
+		return IssuedToken{}, ErrImpersonationNotAllowed
+	}
+	actorAccount, err := t.getAccount(ctx, actor.AccountId)
+	if err != nil && !errors.Is(err, ErrInvalidTarget) {
+		return IssuedToken{}, err
+	}
+	if actorAccount.GetRole() != account_service.AccountInfo_ADMIN {
+		log.SecurityLogger(logger, "impersonation_refused").
+			Warn("account is no longer an administrator")
+		return IssuedToken{}, ErrImpersonationNotAllowed
+	}
+
+	// Administrators cannot act as each other nor as themselves
+	if accountId == actor.AccountId {
+		return IssuedToken{}, ErrInvalidTarget
+	}
+	account, err := t.getAccount(ctx, accountId)
+	if err != nil {
+		return IssuedToken{}, err
+	}
+	if account.GetRole() != account_service.AccountInfo_MEMBER {
+		log.SecurityLogger(logger, "impersonation_refused").
+			Warn("administrator tried to impersonate a privileged account")
+		return IssuedToken{}, ErrInvalidTarget
+	}
+
+	accessToken, expiresAt, err := t.tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{
+		AccountId:      accountId,
+		Role:           token_logic.RoleMember,
+		ActorAccountId: actor.AccountId,
+		KeyThumbprint:  keyThumbprint,
+		TTL:            t.config.TokenTTL,
+	})
+	if err != nil {
+		return IssuedToken{}, err
+	}
+
+	log.SecurityLogger(logger, "impersonation_started").
+		With(zap.Time("expires_at", expiresAt)).
+		Info("administrator started impersonating account")
+
+	return IssuedToken{
+		AccessToken: accessToken,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// getAccount returns ErrInvalidTarget for unknown accounts
+func (t *tokenExchange) getAccount(ctx context.Context, accountId uint64) (*account_service.AccountInfo, error) {
+	resp, err := t.accountGrpc.GetAccount(ctx, &account_service.GetAccountRequest{
+		AccountId: accountId,
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrInvalidTarget
+	} else if err != nil {
+		log.LoggerWithContext(ctx, t.logger).
+			With(zap.Uint64("account_id", accountId)).
+			With(zap.Error(err)).
+			Error("failed to get account from account service")
+		return nil, err
+	}
+	if resp.GetAccount() == nil {
+		return nil, ErrInvalidTarget
+	}
+
+	return resp.GetAccount(), nil
+}
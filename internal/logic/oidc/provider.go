@@ -0,0 +1,498 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	"github.com/Fiagram/gateway/internal/log"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Scopes of the provider, openid is required in every request
+const (
+	ScopeOpenId  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+const (
+	ResponseTypeCode        = "code"
+	CodeChallengeMethodS256 = "S256"
+)
+
+const defaultAuthorizationCodeTTL = time.Minute
+
+var SupportedScopes = []string{ScopeOpenId, ScopeProfile, ScopeEmail, ScopePhone}
+
+var (
+	// ErrUnknownClient and ErrInvalidRedirectUri are answered to the user
+	// agent, the other authorization errors are redirected to the client
+	ErrUnknownClient           = errors.New("unknown client")
+	ErrInvalidRedirectUri      = errors.New("redirect_uri is not registered for the client")
+	ErrUnsupportedResponseType = errors.New("only the code response type is supported")
+	ErrInvalidScope            = errors.New("scope must include openid and only supported scopes")
+	ErrPkceRequired            = errors.New("a code_challenge with the S256 method is required")
+	ErrInvalidClient           = errors.New("invalid client credentials")
+	ErrInvalidGrant            = errors.New("invalid, expired or used authorization grant")
+)
+
+// codeVerifierPattern is the code_verifier syntax of RFC 7636
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectUri         string
+	Scopes              []string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+type ExchangeCodeParams struct {
+	ClientId     string
+	ClientSecret string
+	Code         string
+	RedirectUri  string
+	CodeVerifier string
+	Client       session_logic.ClientInfo
+}
+
+// IssuedTokens are the tokens handed out by the token endpoint. The ID
+// token is only issued for authorization codes.
+type IssuedTokens struct {
+	AccessToken  string
+	ExpiresAt    time.Time
+	RefreshToken string
+	IdToken      string
+	Scopes       []string
+}
+
+type UserInfo struct {
+	Subject           string
+	Name              string
+	PreferredUsername string
+	Email             string
+	PhoneNumber       string
+}
+
+// Metadata is the content of the discovery document.
+type Metadata struct {
+	Issuer                string
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	UserInfoEndpoint      string
+	JwksUri               string
+	SigningAlgorithm      string
+	Scopes                []string
+}
+
+// Provider lets the first-party web apps sign in with OpenID Connect. The
+// gateway has no pages of its own: the authorization endpoint sends the
+// user agent to the sign-in page of the web app, which signs in with the
+// usual endpoints and then approves the request with its access token.
+// Every client has to use PKCE.
+type Provider interface {
+	GetMetadata(ctx context.Context) Metadata
+	ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) error
+	// GetLoginUrl is the sign-in page of the web app, carrying the query of
+	// the authorization request.
+	GetLoginUrl(ctx context.Context, query url.Values) (string, error)
+	// Authorize issues an authorization code for the signed in account.
+	Authorize(ctx context.Context, accountId uint64, req AuthorizationRequest) (code string, err error)
+	// ExchangeCode redeems an authorization code. A code is only accepted
+	// once, presenting it again revokes the session it was exchanged for.
+	ExchangeCode(ctx context.Context, params ExchangeCodeParams) (IssuedTokens, error)
+	// Refresh rotates a refresh token issued to the client.
+	Refresh(ctx context.Context, clientId string, clientSecret string, refreshToken string, client session_logic.ClientInfo) (IssuedTokens, error)
+	GetUserInfo(ctx context.Context, accountId uint64) (UserInfo, error)
+}
+
+type provider struct {
+	config            configs.Oidc
+	authCodeCache     cache.OidcAuthorizationCode
+	refreshTokenCache cache.RefreshToken
+	accountGrpc       account_grpc.Client
+	tokenLogic        token_logic.Token
+	sessionLogic      session_logic.Session
+	clock             utils.Clock
+	logger            *zap.Logger
+}
+
+func NewProviderLogic(
+	config configs.Oidc,
+	authCodeCache cache.OidcAuthorizationCode,
+	refreshTokenCache cache.RefreshToken,
+	accountGrpc account_grpc.Client,
+	tokenLogic token_logic.Token,
+	sessionLogic session_logic.Session,
+	clock utils.Clock,
+	logger *zap.Logger,
+) Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	config.AuthorizationCodeTTL = utils.If(config.AuthorizationCodeTTL > 0,
+		config.AuthorizationCodeTTL, defaultAuthorizationCodeTTL)
+
+	return &provider{
+		config:            config,
+		authCodeCache:     authCodeCache,
+		refreshTokenCache: refreshTokenCache,
+		accountGrpc:       accountGrpc,
+		tokenLogic:        tokenLogic,
+		sessionLogic:      sessionLogic,
+		clock:             clock,
+		logger:            logger,
+	}
+}
+
+func (p *provider) GetMetadata(ctx context.Context) Metadata {
+	return Metadata{
+		Issuer:                p.config.Issuer,
+		AuthorizationEndpoint: p.config.Issuer + "/api/v1/oauth/authorize",
+		TokenEndpoint:         p.config.Issuer + "/api/v1/oauth/token",
+		UserInfoEndpoint:      p.config.Issuer + "/api/v1/oauth/userinfo",
+		JwksUri:               p.config.Issuer + "/.well-known/jwks.json",
+		SigningAlgorithm:      p.tokenLogic.GetSigningAlgorithm(ctx),
+		Scopes:                SupportedScopes,
+	}
+}
+
+func (p *provider) ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) error {
+	client, found := p.findClient(req.ClientId)
+	if !found {
+		return ErrUnknownClient
+	}
+	if !slices.Contains(client.RedirectUris, req.RedirectUri) {
+		return ErrInvalidRedirectUri
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return ErrUnsupportedResponseType
+	}
+	if !slices.Contains(req.Scopes, ScopeOpenId) {
+		return ErrInvalidScope
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(SupportedScopes, scope) {
+			return ErrInvalidScope
+		}
+	}
+	if req.CodeChallengeMethod != CodeChallengeMethodS256 || len(req.CodeChallenge) != 43 {
+		return ErrPkceRequired
+	}
+
+	return nil
+}
+
+func (p *provider) GetLoginUrl(ctx context.Context, query url.Values) (string, error) {
+	loginUrl, err := url.Parse(p.config.LoginUrl)
+	if err != nil {
+		return "", err
+	}
+
+	loginQuery := loginUrl.Query()
+	for name, values := range query {
+		loginQuery[name] = values
+	}
+	loginUrl.RawQuery = loginQuery.Encode()
+	return loginUrl.String(), nil
+}
+
+func (p *provider) Authorize(ctx context.Context, accountId uint64, req AuthorizationRequest) (string, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).
+		With(zap.String("client_id", req.ClientId)).
+		With(zap.Uint64("account_id", accountId))
+
+	if err := p.ValidateAuthorizationRequest(ctx, req); err != nil {
+		return "", err
+	}
+
+	code, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate authorization code")
+		return "", err
+	}
+
+	err = p.authCodeCache.Set(ctx, utils.HashSecret(code), cache.OidcAuthorizationCodeEntry{
+		ClientId:      req.ClientId,
+		RedirectUri:   req.RedirectUri,
+		AccountId:     accountId,
+		Scopes:        req.Scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     p.clock.Now().Add(p.config.AuthorizationCodeTTL).Unix(),
+	}, p.config.AuthorizationCodeTTL)
+	if err != nil {
+		return "", err
+	}
+
+	log.SecurityLogger(logger, "oidc_authorized").
+		With(zap.Strings("scopes", req.Scopes)).
+		Info("issued oidc authorization code")
+
+	return code, nil
+}
+
+func (p *provider) ExchangeCode(ctx context.Context, params ExchangeCodeParams) (IssuedTokens, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.String("client_id", params.ClientId))
+
+	if err := p.authenticateClient(ctx, params.ClientId, params.ClientSecret); err != nil {
+		return IssuedTokens{}, err
+	}
+
+	codeHash := utils.HashSecret(params.Code)
+	entry, err := p.authCodeCache.Get(ctx, codeHash)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return IssuedTokens{}, ErrInvalidGrant
+	} else if err != nil {
+		return IssuedTokens{}, err
+	}
+	logger = logger.With(zap.Uint64("account_id", entry.AccountId))
+
+	expiresAt := time.Unix(entry.ExpiresAt, 0)
+	if entry.ClientId != params.ClientId || !p.clock.Now().Before(expiresAt) {
+		return IssuedTokens{}, ErrInvalidGrant
+	}
+
+	if entry.RedirectUri != params.RedirectUri || !verifyCodeChallenge(params.CodeVerifier, entry.CodeChallenge) {
+		log.SecurityLogger(logger, "oidc_code_exchange_refused").
+			Warn("authorization code presented with a wrong redirect_uri or code_verifier")
+		return IssuedTokens{}, ErrInvalidGrant
+	}
+
+	account, role, err := p.getAccount(ctx, entry.AccountId)
+	if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	// The session is started before the code is consumed, so that the
+	// session a code was exchanged for is known as soon as it counts as used
+	issued, err := p.sessionLogic.Start(ctx, session_logic.StartParams{
+		AccountId: entry.AccountId,
+		Client:    params.Client,
+		ClientId:  entry.ClientId,
+	})
+	if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	isFirstUse, firstSessionId, err := p.authCodeCache.Consume(ctx, codeHash, issued.SessionId, p.config.AuthorizationCodeTTL)
+	if err != nil {
+		return IssuedTokens{}, err
+	} else if !isFirstUse {
+		// Someone else holds the code, the tokens it was exchanged for
+		// cannot be trusted any more
+		log.SecurityLogger(logger, "oidc_code_reuse").
+			With(zap.String("session_id", firstSessionId)).
+			Warn("authorization code presented again")
+		for _, sessionId := range []string{issued.SessionId, firstSessionId} {
+			if err := p.sessionLogic.RevokeSession(ctx, entry.AccountId, sessionId); err != nil &&
+				!errors.Is(err, session_logic.ErrSessionNotFound) {
+				return IssuedTokens{}, err
+			}
+		}
+		return IssuedTokens{}, ErrInvalidGrant
+	}
+
+	accessToken, accessTokenExpiresAt, err := p.tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{
+		AccountId: entry.AccountId,
+		SessionId: issued.SessionId,
+		Role:      role,
+	})
+	if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	idToken, _, err := p.tokenLogic.GenerateIdToken(ctx, token_logic.IdTokenPayload{
+		Issuer:    p.config.Issuer,
+		AccountId: entry.AccountId,
+		Audience:  entry.ClientId,
+		Nonce:     entry.Nonce,
+		SessionId: issued.SessionId,
+		Claims:    accountClaims(account, entry.Scopes),
+	})
+	if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	log.SecurityLogger(logger, "oidc_code_exchanged").
+		With(zap.String("session_id", issued.SessionId)).
+		Info("exchanged oidc authorization code")
+
+	return IssuedTokens{
+		AccessToken:  accessToken,
+		ExpiresAt:    accessTokenExpiresAt,
+		RefreshToken: issued.RefreshToken,
+		IdToken:      idToken,
+		Scopes:       entry.Scopes,
+	}, nil
+}
+
+func (p *provider) Refresh(
+	ctx context.Context,
+	clientId string,
+	clientSecret string,
+	refreshToken string,
+	client session_logic.ClientInfo,
+) (IssuedTokens, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.String("client_id", clientId))
+
+	if err := p.authenticateClient(ctx, clientId, clientSecret); err != nil {
+		return IssuedTokens{}, err
+	}
+
+	// Refresh tokens are bound to the client they were issued to
+	entry, err := p.refreshTokenCache.Get(ctx, refreshToken)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return IssuedTokens{}, ErrInvalidGrant
+	} else if err != nil {
+		return IssuedTokens{}, err
+	} else if entry.ClientId != clientId {
+		log.SecurityLogger(logger, "oidc_refresh_refused").
+			With(zap.Uint64("account_id", entry.AccountId)).
+			Warn("client presented a refresh token issued to another client")
+		return IssuedTokens{}, ErrInvalidGrant
+	}
+
+	issued, err := p.sessionLogic.Rotate(ctx, refreshToken, client)
+	if errors.Is(err, session_logic.ErrInvalidRefreshToken) ||
+		errors.Is(err, session_logic.ErrRefreshTokenReused) {
+		return IssuedTokens{}, ErrInvalidGrant
+	} else if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	// The role is looked up again so that role changes apply on refresh
+	_, role, err := p.getAccount(ctx, issued.AccountId)
+	if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	accessToken, accessTokenExpiresAt, err := p.tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{
+		AccountId: issued.AccountId,
+		SessionId: issued.SessionId,
+		Role:      role,
+	})
+	if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	return IssuedTokens{
+		AccessToken:  accessToken,
+		ExpiresAt:    accessTokenExpiresAt,
+		RefreshToken: issued.RefreshToken,
+	}, nil
+}
+
+func (p *provider) GetUserInfo(ctx context.Context, accountId uint64) (UserInfo, error) {
+	account, _, err := p.getAccount(ctx, accountId)
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	return UserInfo{
+		Subject:           strconv.FormatUint(accountId, 10),
+		Name:              account.GetFullname(),
+		PreferredUsername: account.GetUsername(),
+		Email:             account.GetEmail(),
+		PhoneNumber:       account.GetPhoneNumber(),
+	}, nil
+}
+
+// authenticateClient checks the secret of confidential clients. Public
+// clients have no secret, PKCE binds their codes instead.
+func (p *provider) authenticateClient(ctx context.Context, clientId string, clientSecret string) error {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.String("client_id", clientId))
+
+	client, found := p.findClient(clientId)
+	if !found {
+		log.SecurityLogger(logger, "oidc_client_authentication_failed").Warn("unknown oidc client")
+		return ErrInvalidClient
+	}
+	if client.SecretHash == "" {
+		return nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashSecret(clientSecret)), []byte(client.SecretHash)) != 1 {
+		log.SecurityLogger(logger, "oidc_client_authentication_failed").Warn("invalid oidc client secret")
+		return ErrInvalidClient
+	}
+
+	return nil
+}
+
+func (p *provider) findClient(clientId string) (configs.OidcClient, bool) {
+	for _, client := range p.config.Clients {
+		if client.Id == clientId {
+			return client, true
+		}
+	}
+	return configs.OidcClient{}, false
+}
+
+// getAccount returns the account and the role embedded in its access tokens
+func (p *provider) getAccount(ctx context.Context, accountId uint64) (*account_service.AccountInfo, string, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.Uint64("account_id", accountId))
+
+	resp, err := p.accountGrpc.GetAccount(ctx, &account_service.GetAccountRequest{
+		AccountId: accountId,
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get account from account service")
+		return nil, "", err
+	}
+
+	account := resp.GetAccount()
+	switch account.GetRole() {
+	case account_service.AccountInfo_ADMIN:
+		return account, token_logic.RoleAdmin, nil
+	case account_service.AccountInfo_MEMBER:
+		return account, token_logic.RoleMember, nil
+	default:
+		return account, "", nil
+	}
+}
+
+// accountClaims are the standard claims released for the granted scopes
+func accountClaims(account *account_service.AccountInfo, scopes []string) map[string]any {
+	claims := map[string]any{}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims["name"] = account.GetFullname()
+		claims["preferred_username"] = account.GetUsername()
+	}
+	if slices.Contains(scopes, ScopeEmail) && account.GetEmail() != "" {
+		claims["email"] = account.GetEmail()
+	}
+	if slices.Contains(scopes, ScopePhone) && account.GetPhoneNumber() != "" {
+		claims["phone_number"] = account.GetPhoneNumber()
+	}
+	return claims
+}
+
+// verifyCodeChallenge checks the code_verifier against the S256 challenge
+func verifyCodeChallenge(codeVerifier string, codeChallenge string) bool {
+	if !codeVerifierPattern.MatchString(codeVerifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(codeChallenge)) == 1
+}
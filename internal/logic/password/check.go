@@ -0,0 +1,39 @@
+package logic
+
+import (
+	"context"
+	"strings"
+
+	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+)
+
+// CheckAccountValid returns the id of the account when the password is
+// right, zero otherwise. The password is checked as typed. Accounts signed
+// up before that had their password stored trimmed, so a password with
+// surrounding whitespace is tried trimmed as well until they change it.
+func CheckAccountValid(ctx context.Context, accountGrpc account_grpc.Client, username string, password string) (uint64, error) {
+	validResp, err := accountGrpc.CheckAccountValid(ctx, &account_service.CheckAccountValidRequest{
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return 0, err
+	} else if validResp.AccountId != 0 {
+		return validResp.AccountId, nil
+	}
+
+	trimmed := strings.TrimSpace(password)
+	if trimmed == password || trimmed == "" {
+		return 0, nil
+	}
+	validResp, err = accountGrpc.CheckAccountValid(ctx, &account_service.CheckAccountValidRequest{
+		Username: username,
+		Password: trimmed,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return validResp.AccountId, nil
+}
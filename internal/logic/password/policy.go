@@ -0,0 +1,243 @@
+package logic
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/log"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Used when the config leaves a rule out, bcrypt ignores what comes after
+// 72 bytes
+const (
+	defaultMinLength           = 8
+	defaultMaxLength           = 72
+	defaultMinCharacterClasses = 4
+)
+
+// Shorter usernames and email local parts are too common to refuse
+const minSimilarityFragmentRunes = 3
+
+// Rules a password can break, listed in the details of refusals
+const (
+	ViolationTooShort         = "too_short"
+	ViolationTooLong          = "too_long"
+	ViolationWhitespace       = "whitespace"
+	ViolationCharacterClasses = "character_classes"
+	ViolationDenylisted       = "denylisted"
+	ViolationSimilarToAccount = "similar_to_account"
+	ViolationBreached         = "breached"
+)
+
+var ErrInvalidPassword = errors.New("password does not meet the password policy")
+
+// PolicyError lists every rule a password breaks. It matches
+// ErrInvalidPassword with errors.Is.
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return ErrInvalidPassword.Error() + ": " + strings.Join(e.Violations, ", ")
+}
+
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrInvalidPassword
+}
+
+// Account is what a password must not resemble
+type Account struct {
+	Username string
+	Email    string
+}
+
+// Policy checks new passwords. Validate applies every rule and, when a
+// dataset is configured, refuses the passwords known from breaches. The
+// dataset is looked up by the first 5 hex characters of the SHA-1 of the
+// password, as the k-anonymity range API of Pwned Passwords.
+type Policy interface {
+	// Validate returns a *PolicyError for refused passwords. The similarity
+	// rule is skipped for an empty account.
+	Validate(ctx context.Context, password string, account Account) error
+}
+
+type policy struct {
+	config   configs.PasswordPolicy
+	denylist map[string]struct{}
+	logger   *zap.Logger
+}
+
+func NewPasswordPolicyLogic(
+	config configs.PasswordPolicy,
+	logger *zap.Logger,
+) (Policy, error) {
+	config.MinLength = utils.If(config.MinLength > 0, config.MinLength, defaultMinLength)
+	config.MaxLength = utils.If(config.MaxLength > 0, config.MaxLength, defaultMaxLength)
+	config.MinCharacterClasses = utils.If(config.MinCharacterClasses > 0,
+		min(config.MinCharacterClasses, 4), defaultMinCharacterClasses)
+
+	denylist := make(map[string]struct{})
+	for _, password := range config.Denylist {
+		denylist[strings.ToLower(password)] = struct{}{}
+	}
+	if config.DenylistFile != "" {
+		file, err := os.Open(config.DenylistFile)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to open password denylist")
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				denylist[strings.ToLower(line)] = struct{}{}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			logger.With(zap.Error(err)).Error("failed to read password denylist")
+			return nil, err
+		}
+	}
+
+	return &policy{
+		config:   config,
+		denylist: denylist,
+		logger:   logger,
+	}, nil
+}
+
+func (p *policy) Validate(ctx context.Context, password string, account Account) error {
+	violations := make([]string, 0)
+
+	length := utf8.RuneCountInString(password)
+	if length < p.config.MinLength {
+		violations = append(violations, ViolationTooShort)
+	}
+	if len(password) > p.config.MaxLength {
+		violations = append(violations, ViolationTooLong)
+	}
+	if strings.ContainsFunc(password, unicode.IsSpace) {
+		violations = append(violations, ViolationWhitespace)
+	}
+	if characterClasses(password) < p.config.MinCharacterClasses {
+		violations = append(violations, ViolationCharacterClasses)
+	}
+	if p.isDenylisted(password) {
+		violations = append(violations, ViolationDenylisted)
+	}
+	if isSimilarToAccount(password, account) {
+		violations = append(violations, ViolationSimilarToAccount)
+	}
+
+	// The dataset is only worth a look for passwords that passed the rest
+	if len(violations) == 0 && p.config.BreachedPasswordsDir != "" {
+		isBreached, err := p.isBreached(password)
+		if err != nil {
+			log.LoggerWithContext(ctx, p.logger).
+				With(zap.Error(err)).
+				Error("failed to look up breached passwords")
+			return err
+		}
+		if isBreached {
+			violations = append(violations, ViolationBreached)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// isDenylisted also catches denylisted words with digits or symbols
+// appended, like Password123!
+func (p *policy) isDenylisted(password string) bool {
+	normalized := strings.ToLower(password)
+	if _, ok := p.denylist[normalized]; ok {
+		return true
+	}
+	stem := strings.TrimRightFunc(normalized, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	_, ok := p.denylist[stem]
+	return ok
+}
+
+// isBreached looks the hash suffix up in the range file of its prefix. A
+// missing range file means no breached password has the prefix.
+func (p *policy) isBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(p.config.BreachedPasswordsDir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	// Lines are SUFFIX:COUNT, padding entries have a count of zero
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return count != "0", nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func characterClasses(password string) int {
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	classes := 0
+	for _, has := range []bool{hasLower, hasUpper, hasDigit, hasSymbol} {
+		if has {
+			classes++
+		}
+	}
+	return classes
+}
+
+// isSimilarToAccount refuses passwords that contain the username or the
+// local part of the email, or that are contained in them.
+func isSimilarToAccount(password string, account Account) bool {
+	normalized := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(account.Email, "@")
+	for _, fragment := range []string{account.Username, localPart} {
+		fragment = strings.ToLower(strings.TrimSpace(fragment))
+		if utf8.RuneCountInString(fragment) < minSimilarityFragmentRunes {
+			continue
+		}
+		if strings.Contains(normalized, fragment) || strings.Contains(fragment, normalized) {
+			return true
+		}
+	}
+	return false
+}
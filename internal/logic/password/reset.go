@@ -0,0 +1,273 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	account_grpc "github.com/Fiagram/gateway/internal/dataaccess/account_service"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	"github.com/Fiagram/gateway/internal/log"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultResetTokenTTL      = 30 * time.Minute
+	defaultMaxResetRequests   = 5
+	defaultIpMaxResetRequests = 50
+	defaultResetRequestWindow = time.Hour
+	// mailResetTimeout bounds the lookup and the mail done after answering
+	mailResetTimeout = time.Minute
+)
+
+// Kinds of the subjects reset requests are counted for
+const (
+	requestKindEmail = "email"
+	requestKindIp    = "ip"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	ErrTooManyRequests   = errors.New("too many password resets asked, try again later")
+)
+
+// PasswordReset recovers accounts whose password was forgotten through a
+// single-use token mailed to the address of the account.
+type PasswordReset interface {
+	// RequestReset mails a reset link when an account has the email. Past
+	// the max requests of the email or of the IP it returns
+	// ErrTooManyRequests and the time to wait. The account is looked up and
+	// the mail sent in the background, so that neither the result nor the
+	// time it takes tells callers whether an account has the email.
+	RequestReset(ctx context.Context, email string, ipAddress string) (retryAfter time.Duration, err error)
+	// ResetPassword replaces the password and signs the account out of
+	// every session. The new password has to pass the Policy.
+	ResetPassword(ctx context.Context, token string, password string) error
+}
+
+type passwordReset struct {
+	config          configs.PasswordReset
+	resetTokenCache cache.PasswordResetToken
+	accountGrpc     account_grpc.Client
+	sessionLogic    session_logic.Session
+	policy          Policy
+	mailSender      mail.Sender
+	clock           utils.Clock
+	logger          *zap.Logger
+}
+
+func NewPasswordResetLogic(
+	config configs.PasswordReset,
+	resetTokenCache cache.PasswordResetToken,
+	accountGrpc account_grpc.Client,
+	sessionLogic session_logic.Session,
+	policy Policy,
+	mailSender mail.Sender,
+	clock utils.Clock,
+	logger *zap.Logger,
+) PasswordReset {
+	config.TokenTTL = utils.If(config.TokenTTL > 0, config.TokenTTL, defaultResetTokenTTL)
+	config.MaxRequests = utils.If(config.MaxRequests > 0, config.MaxRequests, defaultMaxResetRequests)
+	config.IpMaxRequests = utils.If(config.IpMaxRequests > 0, config.IpMaxRequests, defaultIpMaxResetRequests)
+	config.Window = utils.If(config.Window > 0, config.Window, defaultResetRequestWindow)
+
+	return &passwordReset{
+		config:          config,
+		resetTokenCache: resetTokenCache,
+		accountGrpc:     accountGrpc,
+		sessionLogic:    sessionLogic,
+		policy:          policy,
+		mailSender:      mailSender,
+		clock:           clock,
+		logger:          logger,
+	}
+}
+
+func (p *passwordReset) RequestReset(ctx context.Context, email string, ipAddress string) (time.Duration, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.String("ip_address", ipAddress))
+
+	// The limits come before the lookup, which scans the accounts
+	email = strings.TrimSpace(email)
+	requests, err := p.resetTokenCache.IncrRequests(ctx, requestKindEmail, strings.ToLower(email), p.config.Window)
+	if err != nil {
+		return 0, err
+	} else if requests > int64(p.config.MaxRequests) {
+		log.SecurityLogger(logger, "password_reset_rate_limited").Warn("too many password resets asked for an email")
+		return p.config.Window, ErrTooManyRequests
+	}
+	if ipAddress != "" {
+		requests, err := p.resetTokenCache.IncrRequests(ctx, requestKindIp, ipAddress, p.config.Window)
+		if err != nil {
+			return 0, err
+		} else if requests > int64(p.config.IpMaxRequests) {
+			log.SecurityLogger(logger, "password_reset_rate_limited").Warn("too many password resets asked from an ip")
+			return p.config.Window, ErrTooManyRequests
+		}
+	}
+
+	// The request context ends with the answer, the mail gets its own
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailResetTimeout)
+		defer cancel()
+		if err := p.mailResetToken(ctx, logger, email); err != nil {
+			logger.With(zap.Error(err)).Error("failed to mail password reset token")
+		}
+	}()
+
+	return 0, nil
+}
+
+// mailResetToken mails a reset link when an account has the email.
+func (p *passwordReset) mailResetToken(ctx context.Context, logger *zap.Logger, email string) error {
+	accountId, err := account_grpc.FindAccountIdByEmail(ctx, p.accountGrpc, email)
+	if errors.Is(err, account_grpc.ErrEmailNotUnique) {
+		log.SecurityLogger(logger, "password_reset_ambiguous_email").Warn("password reset requested for an email of several accounts")
+		return nil
+	} else if err != nil {
+		logger.With(zap.Error(err)).Error("failed to find account by email")
+		return err
+	} else if accountId == 0 {
+		log.SecurityLogger(logger, "password_reset_unknown_email").Info("password reset requested for an unknown email")
+		return nil
+	}
+	logger = logger.With(zap.Uint64("account_id", accountId))
+
+	token, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate password reset token")
+		return err
+	}
+
+	now := p.clock.Now()
+	err = p.resetTokenCache.Set(ctx, utils.HashSecret(token), cache.PasswordResetTokenEntry{
+		AccountId: accountId,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(p.config.TokenTTL).Unix(),
+	}, p.config.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	resetUrl, err := p.resetUrl(token)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to build password reset url")
+		return err
+	}
+
+	err = p.mailSender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account. "+
+			"Open the link below within %s to choose a new password:\n\n%s\n\n"+
+			"If it was not you, ignore this mail, your password stays unchanged.",
+			p.config.TokenTTL, resetUrl),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "password_reset_requested").Info("mailed a password reset token")
+
+	return nil
+}
+
+func (p *passwordReset) ResetPassword(ctx context.Context, token string, password string) error {
+	logger := log.LoggerWithContext(ctx, p.logger)
+
+	// The account is only known from the token, its similarity is checked
+	// once the token is
+	if err := p.policy.Validate(ctx, password, Account{}); err != nil {
+		return err
+	}
+
+	tokenHash := utils.HashSecret(token)
+	entry, err := p.resetTokenCache.Get(ctx, tokenHash)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+	logger = logger.With(zap.Uint64("account_id", entry.AccountId))
+
+	if !p.clock.Now().Before(time.Unix(entry.ExpiresAt, 0)) {
+		return ErrInvalidResetToken
+	}
+
+	// Only the latest token of the account is good
+	current, err := p.resetTokenCache.GetCurrent(ctx, entry.AccountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	} else if current != tokenHash {
+		return ErrInvalidResetToken
+	}
+
+	// A refused password leaves the token usable for another try
+	accResp, err := p.accountGrpc.GetAccount(ctx, &account_service.GetAccountRequest{
+		AccountId: entry.AccountId,
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get account")
+		return err
+	}
+	if isSimilarToAccount(password, Account{
+		Username: accResp.GetAccount().GetUsername(),
+		Email:    accResp.GetAccount().GetEmail(),
+	}) {
+		return &PolicyError{Violations: []string{ViolationSimilarToAccount}}
+	}
+
+	isFirstUse, err := p.resetTokenCache.Consume(ctx, tokenHash, p.config.TokenTTL)
+	if err != nil {
+		return err
+	} else if !isFirstUse {
+		log.SecurityLogger(logger, "password_reset_token_reuse").Warn("password reset token presented again")
+		return ErrInvalidResetToken
+	}
+
+	// The token is only dropped once the password changed, a failed update
+	// hands it back for a retry
+	_, err = p.accountGrpc.UpdateAccountPassword(ctx, &account_service.UpdateAccountPasswordRequest{
+		AccountId: entry.AccountId,
+		Password:  password,
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to update account password")
+		_ = p.resetTokenCache.Release(ctx, tokenHash)
+		return err
+	}
+
+	if err := p.resetTokenCache.Del(ctx, tokenHash, entry.AccountId); err != nil {
+		return err
+	}
+
+	// Whoever knew the old password must lose the sessions it opened
+	if err := p.sessionLogic.RevokeAll(ctx, entry.AccountId); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "password_reset").Info("reset the password of the account")
+
+	return nil
+}
+
+func (p *passwordReset) resetUrl(token string) (string, error) {
+	resetUrl, err := url.Parse(p.config.Url)
+	if err != nil {
+		return "", err
+	}
+
+	query := resetUrl.Query()
+	query.Set("token", token)
+	resetUrl.RawQuery = query.Encode()
+	return resetUrl.String(), nil
+}
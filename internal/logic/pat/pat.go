@@ -0,0 +1,211 @@
+package logic
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+// TokenPrefix marks personal access tokens so that they can be told apart
+// from JWT access tokens and found by secret scanners.
+const TokenPrefix = "fgp_"
+
+// lastUsedResolution bounds how often the last-used timestamp of a token
+// is written back, scripts may use a token many times a second.
+const lastUsedResolution = time.Minute
+
+var (
+	ErrInvalidToken  = errors.New("invalid or expired personal access token")
+	ErrTokenNotFound = errors.New("personal access token not found")
+	ErrInvalidExpiry = errors.New("expiry of the personal access token must be in the future")
+	ErrInvalidName   = errors.New("name of the personal access token must have 1 to 100 characters")
+	ErrInvalidScope  = errors.New("invalid personal access token scope")
+)
+
+const (
+	maxNameLength = 100
+	maxScopes     = 32
+)
+
+var scopePattern = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,63}$`)
+
+type CreateParams struct {
+	AccountId uint64
+	Name      string
+	Scopes    []string
+	// ExpiresAt is the zero time for a token that never expires
+	ExpiresAt time.Time
+}
+
+// PersonalAccessToken manages the long-lived tokens that accounts create
+// for scripts. A token reads fgp_<id>_<secret>, the id locates the entry
+// and the secret is checked against its stored hash.
+type PersonalAccessToken interface {
+	// Create returns the token, which cannot be recovered afterwards.
+	Create(ctx context.Context, params CreateParams) (token string, entry cache.PersonalAccessTokenEntry, err error)
+	List(ctx context.Context, accountId uint64) ([]cache.PersonalAccessTokenEntry, error)
+	Revoke(ctx context.Context, accountId uint64, tokenId string) error
+	// Verify returns the entry of a valid token and records its use.
+	Verify(ctx context.Context, token string) (cache.PersonalAccessTokenEntry, error)
+}
+
+type personalAccessToken struct {
+	personalAccessTokenCache cache.PersonalAccessToken
+	clock                    utils.Clock
+	logger                   *zap.Logger
+}
+
+func NewPersonalAccessTokenLogic(
+	personalAccessTokenCache cache.PersonalAccessToken,
+	clock utils.Clock,
+	logger *zap.Logger,
+) PersonalAccessToken {
+	return &personalAccessToken{
+		personalAccessTokenCache: personalAccessTokenCache,
+		clock:                    clock,
+		logger:                   logger,
+	}
+}
+
+// IsPersonalAccessToken tells whether a bearer token is a personal access
+// token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, TokenPrefix)
+}
+
+func (p *personalAccessToken) Create(ctx context.Context, params CreateParams) (string, cache.PersonalAccessTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, p.logger).With(zap.Uint64("account_id", params.AccountId))
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > maxNameLength {
+		return "", cache.PersonalAccessTokenEntry{}, ErrInvalidName
+	}
+	if len(params.Scopes) > maxScopes {
+		return "", cache.PersonalAccessTokenEntry{}, ErrInvalidScope
+	}
+	for _, scope := range params.Scopes {
+		if !scopePattern.MatchString(scope) {
+			return "", cache.PersonalAccessTokenEntry{}, ErrInvalidScope
+		}
+	}
+
+	now := p.clock.Now()
+	var ttl time.Duration
+	if !params.ExpiresAt.IsZero() {
+		ttl = params.ExpiresAt.Sub(now)
+		if ttl <= 0 {
+			return "", cache.PersonalAccessTokenEntry{}, ErrInvalidExpiry
+		}
+	}
+
+	tokenId, err := utils.RandomHex(8)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate personal access token id")
+		return "", cache.PersonalAccessTokenEntry{}, err
+	}
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate personal access token secret")
+		return "", cache.PersonalAccessTokenEntry{}, err
+	}
+
+	entry := cache.PersonalAccessTokenEntry{
+		Id:         tokenId,
+		AccountId:  params.AccountId,
+		Name:       params.Name,
+		SecretHash: utils.HashSecret(secret),
+		Scopes:     utils.If(params.Scopes != nil, params.Scopes, []string{}),
+		CreatedAt:  now.Unix(),
+	}
+	if !params.ExpiresAt.IsZero() {
+		entry.ExpiresAt = params.ExpiresAt.Unix()
+	}
+
+	if err := p.personalAccessTokenCache.Set(ctx, entry, ttl); err != nil {
+		return "", cache.PersonalAccessTokenEntry{}, err
+	}
+
+	log.SecurityLogger(logger, "personal_access_token_created").
+		With(zap.String("token_id", tokenId)).
+		With(zap.Strings("scopes", entry.Scopes)).
+		Info("created personal access token")
+
+	return TokenPrefix + tokenId + "_" + secret, entry, nil
+}
+
+func (p *personalAccessToken) List(ctx context.Context, accountId uint64) ([]cache.PersonalAccessTokenEntry, error) {
+	return p.personalAccessTokenCache.ListByAccount(ctx, accountId)
+}
+
+func (p *personalAccessToken) Revoke(ctx context.Context, accountId uint64, tokenId string) error {
+	logger := log.LoggerWithContext(ctx, p.logger).
+		With(zap.Uint64("account_id", accountId)).
+		With(zap.String("token_id", tokenId))
+
+	entry, err := p.personalAccessTokenCache.Get(ctx, tokenId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrTokenNotFound
+	} else if err != nil {
+		return err
+	} else if entry.AccountId != accountId {
+		// Tokens of other accounts are reported as missing
+		return ErrTokenNotFound
+	}
+
+	if err := p.personalAccessTokenCache.Del(ctx, accountId, tokenId); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "personal_access_token_revoked").Info("revoked personal access token")
+
+	return nil
+}
+
+func (p *personalAccessToken) Verify(ctx context.Context, token string) (cache.PersonalAccessTokenEntry, error) {
+	logger := log.LoggerWithContext(ctx, p.logger)
+
+	tokenId, secret, ok := strings.Cut(strings.TrimPrefix(token, TokenPrefix), "_")
+	if !ok || !IsPersonalAccessToken(token) || tokenId == "" || secret == "" {
+		return cache.PersonalAccessTokenEntry{}, ErrInvalidToken
+	}
+
+	entry, err := p.personalAccessTokenCache.Get(ctx, tokenId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return cache.PersonalAccessTokenEntry{}, ErrInvalidToken
+	} else if err != nil {
+		return cache.PersonalAccessTokenEntry{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashSecret(secret)), []byte(entry.SecretHash)) != 1 {
+		return cache.PersonalAccessTokenEntry{}, ErrInvalidToken
+	}
+
+	now := p.clock.Now()
+	if entry.ExpiresAt != 0 && !now.Before(time.Unix(entry.ExpiresAt, 0)) {
+		return cache.PersonalAccessTokenEntry{}, ErrInvalidToken
+	}
+
+	if now.Sub(time.Unix(entry.LastUsedAt, 0)) >= lastUsedResolution {
+		entry.LastUsedAt = now.Unix()
+		var ttl time.Duration
+		if entry.ExpiresAt != 0 {
+			ttl = time.Unix(entry.ExpiresAt, 0).Sub(now)
+		}
+		// A token stays usable when its last use cannot be recorded
+		err := p.personalAccessTokenCache.SetLastUsedAt(ctx, entry.Id, entry.LastUsedAt, ttl)
+		if err != nil {
+			logger.With(zap.Error(err)).Warn("failed to record personal access token use")
+		}
+	}
+
+	return entry, nil
+}
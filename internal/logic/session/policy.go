@@ -0,0 +1,66 @@
+package logic
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/utils"
+)
+
+// Used when the config leaves a lifetime out
+const (
+	defaultIdleTimeout                  = 24 * time.Hour
+	defaultRememberMeIdleTimeout        = 30 * 24 * time.Hour
+	defaultSessionMaxLifetime           = 7 * 24 * time.Hour
+	defaultRememberMeSessionMaxLifetime = 90 * 24 * time.Hour
+)
+
+var ErrSessionExpired = errors.New("session reached its maximum lifetime")
+
+// Policy decides how long a session lives. A session ends when its refresh
+// token goes unused for the idle timeout, and at the latest when it reaches
+// its maximum lifetime. Remember-me sessions get the longer lifetimes of the
+// config, the others the shorter ones.
+type Policy interface {
+	// ExpiresAt is when a refresh token issued now in a session started at
+	// createdAt expires. The refresh token, its cache entries and its cookie
+	// all expire then. It fails with ErrSessionExpired once the session is
+	// past its maximum lifetime.
+	ExpiresAt(createdAt time.Time, isRememberMe bool) (time.Time, error)
+}
+
+type policy struct {
+	idleTimeout                  time.Duration
+	rememberMeIdleTimeout        time.Duration
+	sessionMaxLifetime           time.Duration
+	rememberMeSessionMaxLifetime time.Duration
+	clock                        utils.Clock
+}
+
+func NewSessionPolicy(
+	config configs.Token,
+	clock utils.Clock,
+) Policy {
+	return &policy{
+		idleTimeout:                  utils.If(config.RefreshTokenTTL > 0, config.RefreshTokenTTL, defaultIdleTimeout),
+		rememberMeIdleTimeout:        utils.If(config.RefreshTokenLongTTL > 0, config.RefreshTokenLongTTL, defaultRememberMeIdleTimeout),
+		sessionMaxLifetime:           utils.If(config.SessionMaxLifetime > 0, config.SessionMaxLifetime, defaultSessionMaxLifetime),
+		rememberMeSessionMaxLifetime: utils.If(config.RememberMeSessionMaxLifetime > 0, config.RememberMeSessionMaxLifetime, defaultRememberMeSessionMaxLifetime),
+		clock:                        clock,
+	}
+}
+
+func (p *policy) ExpiresAt(createdAt time.Time, isRememberMe bool) (time.Time, error) {
+	idleTimeout := utils.If(isRememberMe, p.rememberMeIdleTimeout, p.idleTimeout)
+	maxLifetime := utils.If(isRememberMe, p.rememberMeSessionMaxLifetime, p.sessionMaxLifetime)
+
+	// Whole seconds, the caches and cookies have no finer precision
+	now := p.clock.Now().Truncate(time.Second)
+	endsAt := createdAt.Add(maxLifetime).Truncate(time.Second)
+	if !now.Before(endsAt) {
+		return time.Time{}, ErrSessionExpired
+	}
+
+	return utils.If(now.Add(idleTimeout).Before(endsAt), now.Add(idleTimeout), endsAt), nil
+}
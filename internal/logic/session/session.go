@@ -0,0 +1,472 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrKeyMismatch         = errors.New("refresh token is bound to another dpop key")
+)
+
+// ClientInfo identifies the device a session is used from.
+type ClientInfo struct {
+	UserAgent string
+	IpAddress string
+	// KeyThumbprint is the DPoP key the request proved possession of
+	KeyThumbprint string
+}
+
+type StartParams struct {
+	AccountId    uint64
+	IsRememberMe bool
+	Client       ClientInfo
+	// ClientId binds the refresh tokens of the session to an OpenID Connect
+	// client
+	ClientId string
+}
+
+// IssuedRefreshToken is the refresh token handed out by Start and Rotate.
+type IssuedRefreshToken struct {
+	SessionId    string
+	AccountId    uint64
+	ClientId     string
+	RefreshToken string
+	ExpiresAt    time.Time
+	// AuthTime is when the account last authenticated in the session, it
+	// is kept as the refresh token rotates
+	AuthTime time.Time
+}
+
+// Session owns the refresh tokens of a sign-in. Each sign-in starts a token
+// family; rotation moves the family to a new token and presenting any
+// earlier token of the family revokes the whole family. Sessions are
+// indexed per account so their owner can list and revoke them, and live as
+// long as the Policy lets them.
+type Session interface {
+	Start(ctx context.Context, params StartParams) (IssuedRefreshToken, error)
+	Rotate(ctx context.Context, refreshToken string, client ClientInfo) (IssuedRefreshToken, error)
+	Revoke(ctx context.Context, refreshToken string) error
+	RevokeSession(ctx context.Context, accountId uint64, sessionId string) error
+	List(ctx context.Context, accountId uint64) ([]cache.SessionEntry, error)
+	// Reauthenticate records that the account proved again who it is in the
+	// session and returns the new authentication time.
+	Reauthenticate(ctx context.Context, accountId uint64, sessionId string) (time.Time, error)
+	// RevokeAll ends every session of the account and refuses every access
+	// token issued to it so far.
+	RevokeAll(ctx context.Context, accountId uint64) error
+	// RevokeAccessToken refuses a single access token until it expires.
+	RevokeAccessToken(ctx context.Context, payload token_logic.TokenPayload, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, payload token_logic.TokenPayload) (bool, error)
+}
+
+type session struct {
+	config             configs.Token
+	policy             Policy
+	refreshTokenCache  cache.RefreshToken
+	refreshFamilyCache cache.RefreshTokenFamily
+	sessionCache       cache.Session
+	revocationCache    cache.AccessTokenRevocation
+	tokenLogic         token_logic.Token
+	clock              utils.Clock
+	logger             *zap.Logger
+}
+
+func NewSessionLogic(
+	config configs.Token,
+	policy Policy,
+	refreshTokenCache cache.RefreshToken,
+	refreshFamilyCache cache.RefreshTokenFamily,
+	sessionCache cache.Session,
+	revocationCache cache.AccessTokenRevocation,
+	tokenLogic token_logic.Token,
+	clock utils.Clock,
+	logger *zap.Logger,
+) Session {
+	return &session{
+		config:             config,
+		policy:             policy,
+		refreshTokenCache:  refreshTokenCache,
+		refreshFamilyCache: refreshFamilyCache,
+		sessionCache:       sessionCache,
+		revocationCache:    revocationCache,
+		tokenLogic:         tokenLogic,
+		clock:              clock,
+		logger:             logger,
+	}
+}
+
+func (s *session) Start(ctx context.Context, params StartParams) (IssuedRefreshToken, error) {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.Uint64("account_id", params.AccountId))
+
+	refreshToken, err := s.tokenLogic.GenerateRefreshToken(ctx)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate refresh token")
+		return IssuedRefreshToken{}, err
+	}
+
+	sessionId, err := utils.RandomString(16)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate session id")
+		return IssuedRefreshToken{}, err
+	}
+
+	createdAt := s.clock.Now().Truncate(time.Second)
+	expiresAt, err := s.policy.ExpiresAt(createdAt, params.IsRememberMe)
+	if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+	now := createdAt.Unix()
+	ttl := expiresAt.Sub(createdAt)
+
+	err = s.sessionCache.Set(ctx, cache.SessionEntry{
+		Id:              sessionId,
+		AccountId:       params.AccountId,
+		UserAgent:       params.Client.UserAgent,
+		IpAddress:       params.Client.IpAddress,
+		CreatedAt:       now,
+		LastRefreshedAt: now,
+		IsRememberMe:    params.IsRememberMe,
+	}, ttl)
+	if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	err = s.refreshFamilyCache.Set(ctx, sessionId, cache.RefreshTokenFamilyEntry{
+		AccountId:     params.AccountId,
+		CurrentToken:  refreshToken,
+		CreatedAt:     now,
+		AuthTime:      now,
+		KeyThumbprint: params.Client.KeyThumbprint,
+		IsRememberMe:  params.IsRememberMe,
+	}, ttl)
+	if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	err = s.refreshTokenCache.Set(ctx, refreshToken, cache.RefreshTokenEntry{
+		AccountId: params.AccountId,
+		FamilyId:  sessionId,
+		ExpiresAt: expiresAt.Unix(),
+		ClientId:  params.ClientId,
+	}, ttl)
+	if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	return IssuedRefreshToken{
+		SessionId:    sessionId,
+		AccountId:    params.AccountId,
+		ClientId:     params.ClientId,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+		AuthTime:     time.Unix(now, 0),
+	}, nil
+}
+
+func (s *session) Rotate(ctx context.Context, refreshToken string, client ClientInfo) (IssuedRefreshToken, error) {
+	logger := log.LoggerWithContext(ctx, s.logger)
+
+	entry, err := s.refreshTokenCache.Get(ctx, refreshToken)
+	if errors.Is(err, cache.ErrCacheMiss) || errors.Is(err, cache.ErrInvalidEntry) {
+		return IssuedRefreshToken{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+	logger = logger.
+		With(zap.Uint64("account_id", entry.AccountId)).
+		With(zap.String("family_id", entry.FamilyId))
+
+	family, err := s.refreshFamilyCache.Get(ctx, entry.FamilyId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return IssuedRefreshToken{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	// A bound family only rotates for its key. The token is left as it is,
+	// the client holding the key can still use it.
+	if family.KeyThumbprint != "" && family.KeyThumbprint != client.KeyThumbprint {
+		log.SecurityLogger(logger, "refresh_token_key_mismatch").
+			With(zap.String("ip_address", client.IpAddress)).
+			With(zap.String("user_agent", client.UserAgent)).
+			Warn("bound refresh token presented without its dpop key")
+		return IssuedRefreshToken{}, ErrKeyMismatch
+	}
+
+	// Rotation extends the session by the idle timeout of its kind, up to
+	// its maximum lifetime
+	expiresAt, err := s.policy.ExpiresAt(time.Unix(family.CreatedAt, 0), family.IsRememberMe)
+	if errors.Is(err, ErrSessionExpired) {
+		logger.Info("session reached its maximum lifetime")
+		if err := s.revokeFamily(ctx, entry.AccountId, entry.FamilyId); err != nil {
+			return IssuedRefreshToken{}, err
+		}
+		return IssuedRefreshToken{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+	now := s.clock.Now().Truncate(time.Second)
+	ttl := expiresAt.Sub(now)
+
+	// The token is consumed before anything else is written, concurrent
+	// rotations read the same entry and only the first one may succeed
+	isFirstUse, err := s.refreshTokenCache.Consume(ctx, refreshToken, ttl)
+	if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	// An already rotated token means two parties hold tokens of the same
+	// family. We cannot tell which one is legitimate, so both lose it.
+	if !isFirstUse || entry.RotatedAt != 0 || family.CurrentToken != refreshToken {
+		log.SecurityLogger(logger, "refresh_token_reuse").
+			With(zap.Time("rotated_at", time.Unix(entry.RotatedAt, 0))).
+			With(zap.String("ip_address", client.IpAddress)).
+			With(zap.String("user_agent", client.UserAgent)).
+			Warn("refresh token reuse detected, revoking the token family")
+		if err := s.revokeFamily(ctx, entry.AccountId, entry.FamilyId); err != nil {
+			return IssuedRefreshToken{}, err
+		}
+		return IssuedRefreshToken{}, ErrRefreshTokenReused
+	}
+
+	newRefreshToken, err := s.tokenLogic.GenerateRefreshToken(ctx)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate refresh token")
+		return IssuedRefreshToken{}, err
+	}
+	err = s.refreshTokenCache.Set(ctx, newRefreshToken, cache.RefreshTokenEntry{
+		AccountId: entry.AccountId,
+		FamilyId:  entry.FamilyId,
+		ExpiresAt: expiresAt.Unix(),
+		ClientId:  entry.ClientId,
+	}, ttl)
+	if err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	family.CurrentToken = newRefreshToken
+	if err := s.refreshFamilyCache.Set(ctx, entry.FamilyId, family, ttl); err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	// Keep the old token as a marker for as long as the family may live
+	entry.RotatedAt = now.Unix()
+	if err := s.refreshTokenCache.Set(ctx, refreshToken, entry, ttl); err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	if err := s.touchSession(ctx, entry.FamilyId, client, now.Unix(), ttl); err != nil {
+		return IssuedRefreshToken{}, err
+	}
+
+	return IssuedRefreshToken{
+		SessionId:    entry.FamilyId,
+		AccountId:    entry.AccountId,
+		ClientId:     entry.ClientId,
+		RefreshToken: newRefreshToken,
+		ExpiresAt:    expiresAt,
+		AuthTime:     time.Unix(utils.If(family.AuthTime != 0, family.AuthTime, family.CreatedAt), 0),
+	}, nil
+}
+
+func (s *session) Reauthenticate(ctx context.Context, accountId uint64, sessionId string) (time.Time, error) {
+	logger := log.LoggerWithContext(ctx, s.logger).
+		With(zap.Uint64("account_id", accountId)).
+		With(zap.String("family_id", sessionId))
+
+	family, err := s.refreshFamilyCache.Get(ctx, sessionId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return time.Time{}, ErrSessionNotFound
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	if family.AccountId != accountId {
+		return time.Time{}, ErrSessionNotFound
+	}
+
+	// The family lives as long as its current refresh token
+	current, err := s.refreshTokenCache.Get(ctx, family.CurrentToken)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return time.Time{}, ErrSessionNotFound
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	// Sessions of OpenID Connect clients are not signed in to here
+	if current.ClientId != "" {
+		return time.Time{}, ErrSessionNotFound
+	}
+	now := s.clock.Now()
+	ttl := utils.If(current.ExpiresAt != 0,
+		time.Unix(current.ExpiresAt, 0).Sub(now),
+		s.config.RefreshTokenTTL)
+	if ttl <= 0 {
+		return time.Time{}, ErrSessionNotFound
+	}
+
+	family.AuthTime = now.Unix()
+	if err := s.refreshFamilyCache.Set(ctx, sessionId, family, ttl); err != nil {
+		return time.Time{}, err
+	}
+
+	log.SecurityLogger(logger, "reauthenticated").Info("account authenticated again in its session")
+
+	return time.Unix(family.AuthTime, 0), nil
+}
+
+func (s *session) Revoke(ctx context.Context, refreshToken string) error {
+	entry, err := s.refreshTokenCache.Get(ctx, refreshToken)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return nil
+	} else if errors.Is(err, cache.ErrInvalidEntry) {
+		// A token of the old format belongs to no family
+		_, err = s.refreshTokenCache.Del(ctx, refreshToken)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.revokeFamily(ctx, entry.AccountId, entry.FamilyId); err != nil {
+		return err
+	}
+
+	_, err = s.refreshTokenCache.Del(ctx, refreshToken)
+	return err
+}
+
+func (s *session) RevokeSession(ctx context.Context, accountId uint64, sessionId string) error {
+	entry, err := s.sessionCache.Get(ctx, sessionId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrSessionNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// Do not reveal whether a session of another account exists
+	if entry.AccountId != accountId {
+		return ErrSessionNotFound
+	}
+
+	return s.revokeFamily(ctx, accountId, sessionId)
+}
+
+func (s *session) List(ctx context.Context, accountId uint64) ([]cache.SessionEntry, error) {
+	return s.sessionCache.ListByAccount(ctx, accountId)
+}
+
+func (s *session) RevokeAll(ctx context.Context, accountId uint64) error {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.Uint64("account_id", accountId))
+
+	// Refuse the access tokens first, a failure below must not leave them usable
+	err := s.revocationCache.SetNotBefore(ctx, accountId, s.clock.Now(), s.config.AccessTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := s.sessionCache.ListByAccount(ctx, accountId)
+	if err != nil {
+		return err
+	}
+	for _, entry := range sessions {
+		if err := s.revokeFamily(ctx, accountId, entry.Id); err != nil {
+			return err
+		}
+	}
+
+	log.SecurityLogger(logger, "signout_all").
+		With(zap.Int("sessions", len(sessions))).
+		Info("revoked every session of the account")
+
+	return nil
+}
+
+func (s *session) RevokeAccessToken(ctx context.Context, payload token_logic.TokenPayload, expiresAt time.Time) error {
+	// Tokens without jti can only be refused through RevokeAll
+	if payload.TokenId == "" {
+		return nil
+	}
+
+	ttl := expiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.revocationCache.RevokeTokenId(ctx, payload.TokenId, ttl)
+}
+
+// IsAccessTokenRevoked treats tokens issued up to the not-before timestamp
+// as revoked. Both have millisecond precision, so a sign-in in the same
+// second as RevokeAll keeps its token. Tokens from before iat carried
+// milliseconds count as issued at the start of their second.
+func (s *session) IsAccessTokenRevoked(ctx context.Context, payload token_logic.TokenPayload) (bool, error) {
+	// Service tokens have no account to sign out of everywhere. Signing the
+	// administrator out everywhere ends their impersonations as well.
+	accountIds := make([]uint64, 0, 2)
+	if !payload.IsService() {
+		accountIds = append(accountIds, payload.AccountId)
+	}
+	if payload.IsImpersonation() {
+		accountIds = append(accountIds, payload.ActorAccountId)
+	}
+	for _, accountId := range accountIds {
+		notBefore, err := s.revocationCache.GetNotBefore(ctx, accountId)
+		if err != nil {
+			return false, err
+		}
+		if !notBefore.IsZero() && !payload.IssuedAt.After(notBefore) {
+			return true, nil
+		}
+	}
+
+	if payload.TokenId == "" {
+		return false, nil
+	}
+
+	return s.revocationCache.IsTokenIdRevoked(ctx, payload.TokenId)
+}
+
+// revokeFamily kills the current refresh token of the family and forgets
+// the session it belongs to.
+func (s *session) revokeFamily(ctx context.Context, accountId uint64, familyId string) error {
+	family, err := s.refreshFamilyCache.Get(ctx, familyId)
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return err
+	}
+
+	if err == nil {
+		if _, err := s.refreshTokenCache.Del(ctx, family.CurrentToken); err != nil {
+			return err
+		}
+		if err := s.refreshFamilyCache.Del(ctx, familyId); err != nil {
+			return err
+		}
+	}
+
+	return s.sessionCache.Del(ctx, accountId, familyId)
+}
+
+func (s *session) touchSession(ctx context.Context, sessionId string, client ClientInfo, now int64, ttl time.Duration) error {
+	entry, err := s.sessionCache.Get(ctx, sessionId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrInvalidRefreshToken
+	} else if err != nil {
+		return err
+	}
+
+	entry.LastRefreshedAt = now
+	entry.UserAgent = client.UserAgent
+	entry.IpAddress = client.IpAddress
+
+	return s.sessionCache.Set(ctx, entry, ttl)
+}
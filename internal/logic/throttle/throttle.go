@@ -0,0 +1,254 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Kinds of the subjects failed sign-ins are counted for
+const (
+	KindUsername = "username"
+	KindIp       = "ip"
+	// KindAccount counts the invalid second factor codes of an account
+	KindAccount = "account"
+)
+
+const (
+	defaultWindow              = 15 * time.Minute
+	defaultDelayAfter          = 3
+	defaultBaseDelay           = time.Second
+	defaultMaxDelay            = 30 * time.Second
+	defaultUsernameMaxFailures = 10
+	defaultIpMaxFailures       = 100
+	defaultLockoutDuration     = 15 * time.Minute
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many failed sign-in attempts, try again later")
+	ErrLockoutNotFound = errors.New("lockout not found")
+	ErrInvalidKind     = errors.New("kind must be username, ip or account")
+)
+
+// SignInThrottle counts failed sign-ins per username and per client IP.
+// Past a few failures every attempt on the username has to wait a growing
+// delay, past the max failures the username or the IP is locked out for a
+// while. Invalid second factor codes are counted per account alike.
+type SignInThrottle interface {
+	// Check returns ErrTooManyAttempts and the time to wait while the
+	// username or the IP is blocked.
+	Check(ctx context.Context, username string, ipAddress string) (retryAfter time.Duration, err error)
+	RecordFailure(ctx context.Context, username string, ipAddress string) error
+	// RecordSuccess forgets the failures of the username. Those of the IP
+	// stay, one valid account must not hide guessing on the others.
+	RecordSuccess(ctx context.Context, username string) error
+	// CheckAccount returns ErrTooManyAttempts and the time to wait while the
+	// second factor of the account is blocked.
+	CheckAccount(ctx context.Context, accountId uint64) (retryAfter time.Duration, err error)
+	// RecordAccountFailure counts an invalid second factor code. Passing the
+	// password step does not forget those failures, only a valid code does.
+	RecordAccountFailure(ctx context.Context, accountId uint64) error
+	RecordAccountSuccess(ctx context.Context, accountId uint64) error
+	ListLockouts(ctx context.Context) ([]cache.SignInBlockEntry, error)
+	Unlock(ctx context.Context, kind string, value string) error
+}
+
+type signInThrottle struct {
+	config              configs.SignInThrottle
+	signInThrottleCache cache.SignInThrottle
+	clock               utils.Clock
+	logger              *zap.Logger
+}
+
+func NewSignInThrottleLogic(
+	config configs.SignInThrottle,
+	signInThrottleCache cache.SignInThrottle,
+	clock utils.Clock,
+	logger *zap.Logger,
+) SignInThrottle {
+	config.Window = utils.If(config.Window > 0, config.Window, defaultWindow)
+	config.DelayAfter = utils.If(config.DelayAfter > 0, config.DelayAfter, defaultDelayAfter)
+	config.BaseDelay = utils.If(config.BaseDelay > 0, config.BaseDelay, defaultBaseDelay)
+	config.MaxDelay = utils.If(config.MaxDelay > 0, config.MaxDelay, defaultMaxDelay)
+	config.UsernameMaxFailures = utils.If(config.UsernameMaxFailures > 0, config.UsernameMaxFailures, defaultUsernameMaxFailures)
+	config.IpMaxFailures = utils.If(config.IpMaxFailures > 0, config.IpMaxFailures, defaultIpMaxFailures)
+	config.LockoutDuration = utils.If(config.LockoutDuration > 0, config.LockoutDuration, defaultLockoutDuration)
+
+	return &signInThrottle{
+		config:              config,
+		signInThrottleCache: signInThrottleCache,
+		clock:               clock,
+		logger:              logger,
+	}
+}
+
+func (s *signInThrottle) Check(ctx context.Context, username string, ipAddress string) (time.Duration, error) {
+	return s.check(ctx, subjects(username, ipAddress))
+}
+
+func (s *signInThrottle) CheckAccount(ctx context.Context, accountId uint64) (time.Duration, error) {
+	return s.check(ctx, map[string]string{KindAccount: formatAccountId(accountId)})
+}
+
+func (s *signInThrottle) check(ctx context.Context, subjects map[string]string) (time.Duration, error) {
+	var retryAfter time.Duration
+	for kind, value := range subjects {
+		entry, err := s.signInThrottleCache.GetBlock(ctx, kind, value)
+		if errors.Is(err, cache.ErrCacheMiss) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		retryAfter = max(retryAfter, time.Unix(entry.BlockedUntil, 0).Sub(s.clock.Now()))
+	}
+
+	if retryAfter > 0 {
+		return retryAfter, ErrTooManyAttempts
+	}
+	return 0, nil
+}
+
+func (s *signInThrottle) RecordFailure(ctx context.Context, username string, ipAddress string) error {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.String("ip_address", ipAddress))
+	return s.recordFailure(ctx, logger, subjects(username, ipAddress))
+}
+
+func (s *signInThrottle) RecordAccountFailure(ctx context.Context, accountId uint64) error {
+	logger := log.LoggerWithContext(ctx, s.logger).With(zap.Uint64("account_id", accountId))
+	return s.recordFailure(ctx, logger, map[string]string{KindAccount: formatAccountId(accountId)})
+}
+
+func (s *signInThrottle) recordFailure(ctx context.Context, logger *zap.Logger, subjects map[string]string) error {
+	for kind, value := range subjects {
+		failures, err := s.signInThrottleCache.IncrFailures(ctx, kind, value, s.config.Window)
+		if err != nil {
+			return err
+		}
+
+		now := s.clock.Now()
+		// An account is guessed on like a username
+		maxFailures := utils.If(kind == KindIp, s.config.IpMaxFailures, s.config.UsernameMaxFailures)
+		if failures >= int64(maxFailures) {
+			err := s.signInThrottleCache.SetBlock(ctx, cache.SignInBlockEntry{
+				Kind:         kind,
+				Value:        value,
+				Failures:     failures,
+				BlockedUntil: now.Add(s.config.LockoutDuration).Unix(),
+				IsLockout:    true,
+				CreatedAt:    now.Unix(),
+			}, s.config.LockoutDuration)
+			if err != nil {
+				return err
+			}
+
+			// The count starts over once the lockout ends
+			if err := s.signInThrottleCache.ResetFailures(ctx, kind, value); err != nil {
+				return err
+			}
+
+			log.SecurityLogger(logger, "sign_in_lockout").
+				With(zap.String("kind", kind)).
+				With(zap.String("value", value)).
+				With(zap.Int64("failures", failures)).
+				Warn("too many failed sign-ins, locking out")
+			continue
+		}
+
+		// Many users may sign in from behind one IP, it is only locked out
+		if kind != KindIp && failures > int64(s.config.DelayAfter) {
+			delay := s.delay(failures)
+			err := s.signInThrottleCache.SetBlock(ctx, cache.SignInBlockEntry{
+				Kind:         kind,
+				Value:        value,
+				Failures:     failures,
+				BlockedUntil: now.Add(delay).Unix(),
+				CreatedAt:    now.Unix(),
+			}, delay)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *signInThrottle) RecordSuccess(ctx context.Context, username string) error {
+	return s.signInThrottleCache.ResetFailures(ctx, KindUsername, normalizeUsername(username))
+}
+
+func (s *signInThrottle) RecordAccountSuccess(ctx context.Context, accountId uint64) error {
+	return s.signInThrottleCache.ResetFailures(ctx, KindAccount, formatAccountId(accountId))
+}
+
+func (s *signInThrottle) ListLockouts(ctx context.Context) ([]cache.SignInBlockEntry, error) {
+	return s.signInThrottleCache.ListLockouts(ctx)
+}
+
+func (s *signInThrottle) Unlock(ctx context.Context, kind string, value string) error {
+	logger := log.LoggerWithContext(ctx, s.logger).
+		With(zap.String("kind", kind)).
+		With(zap.String("value", value))
+
+	if kind != KindUsername && kind != KindIp && kind != KindAccount {
+		return ErrInvalidKind
+	}
+	if kind == KindUsername {
+		value = normalizeUsername(value)
+	}
+
+	_, err := s.signInThrottleCache.GetBlock(ctx, kind, value)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return ErrLockoutNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.signInThrottleCache.DelBlock(ctx, kind, value); err != nil {
+		return err
+	}
+	if err := s.signInThrottleCache.ResetFailures(ctx, kind, value); err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "sign_in_unlock").Info("lifted a sign-in lockout")
+
+	return nil
+}
+
+// delay doubles BaseDelay for every failure past DelayAfter, up to MaxDelay.
+func (s *signInThrottle) delay(failures int64) time.Duration {
+	delay := s.config.BaseDelay
+	for i := int64(s.config.DelayAfter) + 1; i < failures && delay < s.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.config.MaxDelay)
+}
+
+// subjects yields the counted kinds and values of a sign-in, an unknown IP
+// is not counted.
+func subjects(username string, ipAddress string) map[string]string {
+	subjects := map[string]string{KindUsername: normalizeUsername(username)}
+	if ipAddress != "" {
+		subjects[KindIp] = ipAddress
+	}
+	return subjects
+}
+
+func formatAccountId(accountId uint64) string {
+	return strconv.FormatUint(accountId, 10)
+}
+
+// normalizeUsername makes the spellings of a username share one counter.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,442 @@
+package logic
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	pemTypeHMACKey        = "HMAC KEY"
+	pemTypePrivateKey     = "PRIVATE KEY"
+	pemHeaderActivatedAt  = "Activated-At"
+	defaultReloadInterval = time.Minute
+)
+
+var (
+	ErrKeysDirNotConfigured = errors.New("key rotation requires auth.token.keysDir")
+)
+
+// Keyring holds the signing keys identified by kid. The most recently
+// activated key signs new tokens, older keys stay available for verification
+// until every token they signed has expired.
+type Keyring interface {
+	// Rotate generates a new key of the configured algorithm and persists it
+	// into the keys directory. The key activates one keys reload interval
+	// later, so that every instance verifies it before any token is signed
+	// with it.
+	Rotate(ctx context.Context) (kid string, err error)
+	// Refresh reloads the keys directory, rotates when the latest key is
+	// older than the rotation interval and prunes expired keys.
+	Refresh(ctx context.Context) error
+	// Watch calls Refresh periodically until ctx is cancelled.
+	Watch(ctx context.Context)
+	ActiveKid() string
+	Kids() []string
+
+	signingKey() signingKey
+	verificationKey(kid string) (signingKey, bool)
+	verificationKeys() []signingKey
+}
+
+type keyringEntry struct {
+	key         signingKey
+	activatedAt time.Time
+	// file is empty for the static key from the config
+	file string
+}
+
+type keyring struct {
+	config configs.Token
+	clock  utils.Clock
+	logger *zap.Logger
+
+	// entries are sorted by activation time, oldest first
+	entries []keyringEntry
+	mutex   *sync.RWMutex
+}
+
+func NewKeyring(
+	config configs.Token,
+	clock utils.Clock,
+	logger *zap.Logger,
+) (Keyring, error) {
+	k := &keyring{
+		config: config,
+		clock:  clock,
+		logger: logger,
+		mutex:  new(sync.RWMutex),
+	}
+
+	// The static key never expires on its own, it is treated as activated
+	// before any rotated key so that it retires on the first rotation.
+	if config.Secret != "" || config.PrivateKeyFile != "" {
+		key, err := newSigningKey(config.Algorithm, config.Secret, config.PrivateKeyFile)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to load static signing key")
+			return nil, err
+		}
+		k.entries = append(k.entries, keyringEntry{key: key})
+	}
+
+	if config.KeysDir != "" {
+		if err := k.load(); err != nil {
+			logger.With(zap.Error(err)).Error("failed to load keys directory")
+			return nil, err
+		}
+		if len(k.entries) == 0 {
+			if _, err := k.Rotate(context.Background()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(k.entries) == 0 {
+		return nil, errors.New("no token signing key configured")
+	}
+
+	return k, nil
+}
+
+func (k *keyring) Rotate(ctx context.Context) (string, error) {
+	logger := k.logger.With(zap.String("keys_dir", k.config.KeysDir))
+
+	if k.config.KeysDir == "" {
+		return "", ErrKeysDirNotConfigured
+	}
+
+	key, err := generateSigningKey(k.config.Algorithm)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate signing key")
+		return "", err
+	}
+
+	// The first key of an empty keyring activates right away, there is no
+	// other key to sign with in the meantime
+	k.mutex.RLock()
+	delay := utils.If(len(k.entries) > 0, k.reloadInterval(), 0)
+	k.mutex.RUnlock()
+
+	entry := keyringEntry{
+		key:         key,
+		activatedAt: k.clock.Now().Add(delay).UTC().Truncate(time.Second),
+		file:        filepath.Join(k.config.KeysDir, key.kid+".pem"),
+	}
+	if err := writeKeyFile(entry); err != nil {
+		logger.With(zap.Error(err)).Error("failed to write signing key")
+		return "", err
+	}
+
+	k.mutex.Lock()
+	k.entries = insertEntry(k.entries, entry)
+	k.mutex.Unlock()
+
+	logger.With(zap.String("kid", key.kid)).
+		With(zap.Time("activated_at", entry.activatedAt)).
+		Info("rotated token signing key")
+
+	return key.kid, k.prune()
+}
+
+func (k *keyring) Refresh(ctx context.Context) error {
+	if k.config.KeysDir == "" {
+		return nil
+	}
+
+	if err := k.load(); err != nil {
+		k.logger.With(zap.Error(err)).Error("failed to reload keys directory")
+		return err
+	}
+
+	if k.config.RotationInterval > 0 {
+		// A published key that has not activated yet counts as rotated,
+		// otherwise every refresh until it activates would rotate again
+		k.mutex.RLock()
+		latest := k.entries[len(k.entries)-1]
+		k.mutex.RUnlock()
+
+		if !k.clock.Now().Before(latest.activatedAt.Add(k.config.RotationInterval)) {
+			if _, err := k.Rotate(ctx); err != nil {
+				return err
+			}
+			return nil
+		}
+	}
+
+	return k.prune()
+}
+
+func (k *keyring) Watch(ctx context.Context) {
+	ticker := time.NewTicker(k.reloadInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Errors are logged by Refresh, the previous keys stay in use
+			_ = k.Refresh(ctx)
+		}
+	}
+}
+
+func (k *keyring) ActiveKid() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.activeEntry().key.kid
+}
+
+func (k *keyring) Kids() []string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	kids := make([]string, 0, len(k.entries))
+	for _, entry := range k.entries {
+		kids = append(kids, entry.key.kid)
+	}
+	return kids
+}
+
+func (k *keyring) signingKey() signingKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.activeEntry().key
+}
+
+func (k *keyring) verificationKey(kid string) (signingKey, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	for _, entry := range k.entries {
+		if entry.key.kid == kid {
+			return entry.key, true
+		}
+	}
+	return signingKey{}, false
+}
+
+func (k *keyring) verificationKeys() []signingKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	keys := make([]signingKey, 0, len(k.entries))
+	for _, entry := range k.entries {
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
+
+func (k *keyring) reloadInterval() time.Duration {
+	return utils.If(k.config.KeysReloadInterval > 0, k.config.KeysReloadInterval, defaultReloadInterval)
+}
+
+// activeEntry is the latest key whose activation time has passed. A rotated
+// key is published with an activation one reload interval ahead, so that
+// every instance has loaded it for verification before it signs.
+// The caller must hold the mutex.
+func (k *keyring) activeEntry() keyringEntry {
+	now := k.clock.Now()
+	for i := len(k.entries) - 1; i > 0; i-- {
+		if !k.entries[i].activatedAt.After(now) {
+			return k.entries[i]
+		}
+	}
+	return k.entries[0]
+}
+
+// prune drops every key retired for longer than the access token TTL, as no
+// valid token signed by it can remain. A key retires when its successor
+// activates.
+func (k *keyring) prune() error {
+	now := k.clock.Now()
+
+	k.mutex.Lock()
+	kept := make([]keyringEntry, 0, len(k.entries))
+	expired := make([]keyringEntry, 0)
+	for i, entry := range k.entries {
+		if i+1 < len(k.entries) &&
+			now.After(k.entries[i+1].activatedAt.Add(k.config.AccessTokenTTL)) {
+			expired = append(expired, entry)
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	k.entries = kept
+	k.mutex.Unlock()
+
+	for _, entry := range expired {
+		k.logger.With(zap.String("kid", entry.key.kid)).Info("pruned expired token signing key")
+		if entry.file == "" {
+			continue
+		}
+		if err := os.Remove(entry.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			k.logger.With(zap.Error(err)).Error("failed to remove expired signing key")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load merges the keys found in the keys directory into the keyring.
+func (k *keyring) load() error {
+	files, err := filepath.Glob(filepath.Join(k.config.KeysDir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]keyringEntry, 0, len(files))
+	for _, file := range files {
+		entry, err := readKeyFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read signing key %s: %w", filepath.Base(file), err)
+		}
+		loaded = append(loaded, entry)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	for _, entry := range loaded {
+		if slices.ContainsFunc(k.entries, func(e keyringEntry) bool {
+			return e.key.kid == entry.key.kid
+		}) {
+			continue
+		}
+		k.entries = insertEntry(k.entries, entry)
+	}
+
+	return nil
+}
+
+func insertEntry(entries []keyringEntry, entry keyringEntry) []keyringEntry {
+	i, _ := slices.BinarySearchFunc(entries, entry, func(a, b keyringEntry) int {
+		return a.activatedAt.Compare(b.activatedAt)
+	})
+	return slices.Insert(entries, i, entry)
+}
+
+func generateSigningKey(algorithm string) (signingKey, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch algorithm {
+	case "", AlgorithmHS256:
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return signingKey{}, err
+		}
+		return newSymmetricKey(secret)
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return signingKey{}, fmt.Errorf("unsupported token algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	return newAsymmetricKey(signer)
+}
+
+func writeKeyFile(entry keyringEntry) error {
+	block := &pem.Block{
+		Headers: map[string]string{
+			pemHeaderActivatedAt: entry.activatedAt.Format(time.RFC3339),
+		},
+	}
+
+	if entry.key.isSymmetric() {
+		block.Type = pemTypeHMACKey
+		block.Bytes = entry.key.private.([]byte)
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(entry.key.private)
+		if err != nil {
+			return err
+		}
+		block.Type = pemTypePrivateKey
+		block.Bytes = der
+	}
+
+	if err := os.MkdirAll(filepath.Dir(entry.file), 0o700); err != nil {
+		return err
+	}
+
+	// Write then rename so other instances never read a partial key
+	tmp := entry.file + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, entry.file)
+}
+
+func readKeyFile(file string) (keyringEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return keyringEntry{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return keyringEntry{}, errors.New("failed to decode PEM block")
+	}
+
+	activatedAt, err := time.Parse(time.RFC3339, block.Headers[pemHeaderActivatedAt])
+	if err != nil {
+		return keyringEntry{}, fmt.Errorf("invalid %s header: %w", pemHeaderActivatedAt, err)
+	}
+
+	var key signingKey
+	switch block.Type {
+	case pemTypeHMACKey:
+		key, err = newSymmetricKey(block.Bytes)
+	case pemTypePrivateKey:
+		var signer crypto.Signer
+		signer, err = parsePrivateKeyDER(block.Bytes)
+		if err == nil {
+			key, err = newAsymmetricKey(signer)
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block type %s", block.Type)
+	}
+	if err != nil {
+		return keyringEntry{}, err
+	}
+
+	if name := strings.TrimSuffix(filepath.Base(file), ".pem"); name != key.kid {
+		return keyringEntry{}, fmt.Errorf("file name does not match kid %s", key.kid)
+	}
+
+	return keyringEntry{
+		key:         key,
+		activatedAt: activatedAt,
+		file:        file,
+	}, nil
+}
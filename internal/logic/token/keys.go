@@ -0,0 +1,295 @@
+package logic
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// JSONWebKey is the public part of a signing key as described by RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	// private is the key handed to the signer, public the one handed to the
+	// verifier. Both are the same []byte for HMAC keys.
+	private any
+	public  any
+}
+
+func newSigningKey(algorithm, secret, privateKeyFile string) (signingKey, error) {
+	switch algorithm {
+	case "", AlgorithmHS256:
+		if secret == "" {
+			return signingKey{}, errors.New("token secret is required for HS256")
+		}
+		return newSymmetricKey([]byte(secret))
+	case AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA:
+		if privateKeyFile == "" {
+			return signingKey{}, fmt.Errorf("private key file is required for %s", algorithm)
+		}
+		pemBytes, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return signingKey{}, fmt.Errorf("failed to read private key file: %w", err)
+		}
+		signer, err := parsePrivateKeyPEM(pemBytes)
+		if err != nil {
+			return signingKey{}, err
+		}
+		key, err := newAsymmetricKey(signer)
+		if err != nil {
+			return signingKey{}, err
+		}
+		if key.method.Alg() != algorithm {
+			return signingKey{}, fmt.Errorf("private key does not match algorithm %s", algorithm)
+		}
+		return key, nil
+	default:
+		return signingKey{}, fmt.Errorf("unsupported token algorithm: %s", algorithm)
+	}
+}
+
+func newSymmetricKey(secret []byte) (signingKey, error) {
+	key := signingKey{
+		method:  jwt.SigningMethodHS256,
+		private: secret,
+		public:  secret,
+	}
+	kid, err := thumbprint(map[string]string{
+		"kty": "oct",
+		"k":   base64.RawURLEncoding.EncodeToString(secret),
+	})
+	if err != nil {
+		return signingKey{}, err
+	}
+	key.kid = kid
+	return key, nil
+}
+
+// newAsymmetricKey picks the signing method from the type of the key:
+// RSA keys sign RS256, P-256 keys ES256 and Ed25519 keys EdDSA.
+func newAsymmetricKey(signer crypto.Signer) (signingKey, error) {
+	key := signingKey{
+		private: signer,
+		public:  signer.Public(),
+	}
+	switch k := signer.(type) {
+	case *rsa.PrivateKey:
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return signingKey{}, errors.New("only P-256 ecdsa keys are supported")
+		}
+		key.method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return signingKey{}, fmt.Errorf("unsupported private key type %T", signer)
+	}
+
+	jwk, err := key.jwk()
+	if err != nil {
+		return signingKey{}, err
+	}
+	key.kid = jwk.Kid
+	return key, nil
+}
+
+// parsePrivateKeyPEM accepts PKCS#8, PKCS#1 (RSA) and SEC 1 (EC) blocks.
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM private key")
+	}
+
+	return parsePrivateKeyDER(block.Bytes)
+}
+
+func parsePrivateKeyDER(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("failed to parse private key")
+}
+
+// jwk returns the public JWK of the key with its RFC 7638 thumbprint as kid.
+// Symmetric keys have no public part and must never be published.
+func (k signingKey) jwk() (JSONWebKey, error) {
+	var (
+		jwk     JSONWebKey
+		members map[string]string
+	)
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk = JSONWebKey{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+		members = map[string]string{"kty": jwk.Kty, "n": jwk.N, "e": jwk.E}
+	case *ecdsa.PublicKey:
+		point, err := pub.Bytes()
+		if err != nil {
+			return JSONWebKey{}, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		size := (len(point) - 1) / 2
+		jwk = JSONWebKey{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+			Y:   base64.RawURLEncoding.EncodeToString(point[1+size:]),
+		}
+		members = map[string]string{"kty": jwk.Kty, "crv": jwk.Crv, "x": jwk.X, "y": jwk.Y}
+	case ed25519.PublicKey:
+		jwk = JSONWebKey{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}
+		members = map[string]string{"kty": jwk.Kty, "crv": jwk.Crv, "x": jwk.X}
+	default:
+		return JSONWebKey{}, errors.New("key has no public JWK representation")
+	}
+
+	kid, err := thumbprint(members)
+	if err != nil {
+		return JSONWebKey{}, err
+	}
+	jwk.Use = "sig"
+	jwk.Alg = k.method.Alg()
+	jwk.Kid = kid
+
+	return jwk, nil
+}
+
+// ParseJSONWebKey returns the public key described by a JWK. RSA keys,
+// the P-256 and P-384 curves and Ed25519 are supported.
+func ParseJSONWebKey(jwk JSONWebKey) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
+
+// Thumbprint computes the RFC 7638 thumbprint of the key.
+func (k JSONWebKey) Thumbprint() (string, error) {
+	switch k.Kty {
+	case "RSA":
+		return thumbprint(map[string]string{"kty": k.Kty, "n": k.N, "e": k.E})
+	case "EC":
+		return thumbprint(map[string]string{"kty": k.Kty, "crv": k.Crv, "x": k.X, "y": k.Y})
+	case "OKP":
+		return thumbprint(map[string]string{"kty": k.Kty, "crv": k.Crv, "x": k.X})
+	default:
+		return "", fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func (k signingKey) isSymmetric() bool {
+	_, ok := k.public.([]byte)
+	return ok
+}
+
+// thumbprint computes the RFC 7638 thumbprint of the required JWK members.
+// encoding/json sorts map keys, which gives the canonical member order.
+func thumbprint(members map[string]string) (string, error) {
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -2,67 +2,221 @@ package logic
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/utils"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
+// Roles of the accounts as carried by the role claim
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Scopes of the gateway routes. Personal access tokens, service tokens and
+// the tokens of OIDC clients only reach the routes of the scopes they hold,
+// the tokens of a sign-in hold none and reach every route.
+const (
+	// ScopeAccountRead reads the account and its MFA status
+	ScopeAccountRead = "account:read"
+	// ScopeAccountWrite changes how the account signs in
+	ScopeAccountWrite = "account:write"
+	// ScopeSessionsRead lists the sessions and personal access tokens
+	ScopeSessionsRead = "sessions:read"
+	// ScopeSessionsWrite revokes sessions and personal access tokens
+	ScopeSessionsWrite = "sessions:write"
+	// ScopeAdmin reaches the admin routes, along with the ADMIN role
+	ScopeAdmin = "admin"
+)
+
+// Used when the config names no issuer or audience
+const (
+	defaultIssuer   = "fiagram-gateway"
+	defaultAudience = "fiagram-gateway"
+)
+
+var ErrInvalidAudience = errors.New("the requested audience is unknown")
+
 type TokenPayload struct {
+	// AccountId is zero for tokens of service principals, which carry the
+	// ClientId of the OAuth client instead
+	AccountId uint64
+	ClientId  string
+	// Role is the role of the account when the token was issued, Scopes
+	// restrict what the token may be used for
+	Role   string
+	Scopes []string
+	// IsEmailUnverified marks the restricted tokens of accounts whose email
+	// is not verified yet
+	IsEmailUnverified bool
+	// SessionId names the sign-in the token was issued for, if any
+	SessionId string
+	// ActorAccountId is the administrator acting as the account in
+	// impersonation tokens, carried by the act claim of RFC 8693
+	ActorAccountId uint64
+	// AuthTime is when the account last proved who it is in the session of
+	// the token, zero for tokens that did not come from a sign-in
+	AuthTime time.Time
+	// KeyThumbprint binds the token to the DPoP key of the client, it is
+	// carried as cnf.jkt
+	KeyThumbprint string
+	// TTL shortens the lifetime of the token below AccessTokenTTL
+	TTL time.Duration
+	// Audience are the services the token is meant for, the gateway itself
+	// when empty. Each has to be the Audience or one of the Audiences of the
+	// config.
+	Audience []string
+	// TokenId and IssuedAt are assigned when the token is generated, they
+	// are empty for tokens issued before the jti and iat claims existed.
+	// IssuedAt has millisecond precision, a token issued right after the
+	// account signed out everywhere must not count as revoked.
+	TokenId  string
+	IssuedAt time.Time
+}
+
+// IsService tells whether the token was issued to an OAuth client rather
+// than to an account.
+func (p TokenPayload) IsService() bool {
+	return p.ClientId != ""
+}
+
+// IsImpersonation tells whether an administrator acts as the account.
+func (p TokenPayload) IsImpersonation() bool {
+	return p.ActorAccountId != 0
+}
+
+// IdTokenPayload is the content of an OpenID Connect ID token.
+type IdTokenPayload struct {
+	Issuer    string
 	AccountId uint64
+	// Audience is the id of the client the token is issued to
+	Audience  string
+	Nonce     string
+	SessionId string
+	// Claims are the claims about the account released to the client
+	Claims map[string]any
 }
 
 type Token interface {
 	GenerateAccessToken(ctx context.Context, payload TokenPayload) (token string, expiresAt time.Time, err error)
+	// GetPayloadFromAccessToken only accepts tokens meant for the gateway
 	GetPayloadFromAccessToken(ctx context.Context, token string) (payload TokenPayload, expiresAt time.Time, err error)
-	GenerateRefreshToken(ctx context.Context) (token string, expiresAt time.Time, err error)
+	// InspectAccessToken accepts tokens meant for any audience of the
+	// config, it serves introspection and revocation on behalf of the other
+	// services.
+	InspectAccessToken(ctx context.Context, token string) (payload TokenPayload, expiresAt time.Time, err error)
+	// GenerateRefreshToken only makes the opaque token, how long it lives is
+	// up to the session policy.
+	GenerateRefreshToken(ctx context.Context) (token string, err error)
+	// GenerateIdToken signs an ID token with the access token key, it lives
+	// as long as an access token.
+	GenerateIdToken(ctx context.Context, payload IdTokenPayload) (token string, expiresAt time.Time, err error)
+	GetJSONWebKeySet(ctx context.Context) []JSONWebKey
+	// GetSigningAlgorithm is the JWS algorithm of the active signing key
+	GetSigningAlgorithm(ctx context.Context) string
 }
 
 func NewTokenLogic(
 	config configs.Token,
+	keyring Keyring,
+	clock utils.Clock,
 	logger *zap.Logger,
 ) Token {
+	config.Issuer = utils.If(config.Issuer != "", config.Issuer, defaultIssuer)
+	config.Audience = utils.If(config.Audience != "", config.Audience, defaultAudience)
 	return &token{
-		config: config,
-		logger: logger,
+		config:  config,
+		keyring: keyring,
+		clock:   clock,
+		logger:  logger,
 	}
 }
 
 type token struct {
-	config configs.Token
-	logger *zap.Logger
+	config  configs.Token
+	keyring Keyring
+	clock   utils.Clock
+	logger  *zap.Logger
 }
 
-func (t *token) GenerateRefreshToken(ctx context.Context) (string, time.Time, error) {
-	expiresAt := time.Now().Add(t.config.RefreshTokenTTL)
-
-	randomBytes := make([]byte, 64)
-	_, err := rand.Read(randomBytes)
+func (t *token) GenerateRefreshToken(ctx context.Context) (string, error) {
+	tokenString, err := utils.RandomString(64)
 	if err != nil {
 		t.logger.Error("Failed to generate random bytes", zap.Error(err))
-		return "", time.Time{}, err
+		return "", err
 	}
 
-	tokenString := base64.RawURLEncoding.EncodeToString(randomBytes)
-
-	return tokenString, expiresAt, nil
+	return tokenString, nil
 }
 
 func (t *token) GenerateAccessToken(ctx context.Context, payload TokenPayload) (string, time.Time, error) {
-	createAt := time.Now()
-	expiresAt := createAt.Add(t.config.AccessTokenTTL)
+	createAt := t.clock.Now()
+	ttl := utils.If(payload.TTL > 0, min(payload.TTL, t.config.AccessTokenTTL), t.config.AccessTokenTTL)
+	expiresAt := createAt.Add(ttl)
+	key := t.keyring.signingKey()
+
+	audience := utils.If(len(payload.Audience) > 0, payload.Audience, []string{t.config.Audience})
+	for _, aud := range audience {
+		if !t.isKnownAudience(aud) {
+			return "", time.Time{}, ErrInvalidAudience
+		}
+	}
+
+	tokenId, err := utils.RandomString(16)
+	if err != nil {
+		t.logger.Error("Failed to generate token id", zap.Error(err))
+		return "", time.Time{}, err
+	}
 
 	claims := jwt.MapClaims{
-		"id":  payload.AccountId,
+		"iss": t.config.Issuer,
+		"aud": audience,
+		"jti": tokenId,
+		"iat": float64(createAt.UnixMilli()) / 1000,
+		"nbf": createAt.Unix(),
 		"exp": expiresAt.Unix(),
 	}
+	if payload.IsService() {
+		claims["sub"] = payload.ClientId
+		claims["client_id"] = payload.ClientId
+	} else {
+		// id is kept next to sub for the services that still read it
+		claims["sub"] = strconv.FormatUint(payload.AccountId, 10)
+		claims["id"] = payload.AccountId
+	}
+	if payload.SessionId != "" {
+		claims["sid"] = payload.SessionId
+	}
+	if payload.Role != "" {
+		claims["role"] = payload.Role
+	}
+	if len(payload.Scopes) > 0 {
+		claims["scope"] = strings.Join(payload.Scopes, " ")
+	}
+	if payload.IsEmailUnverified {
+		claims["email_verified"] = false
+	}
+	if payload.IsImpersonation() {
+		claims["act"] = map[string]any{"sub": strconv.FormatUint(payload.ActorAccountId, 10)}
+	}
+	if !payload.AuthTime.IsZero() {
+		claims["auth_time"] = payload.AuthTime.Unix()
+	}
+	if payload.KeyThumbprint != "" {
+		claims["cnf"] = map[string]any{"jkt": payload.KeyThumbprint}
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(t.config.Secret))
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	tokenString, err := token.SignedString(key.private)
 	if err != nil {
 		t.logger.Error("Failed to sign token", zap.Error(err))
 		return "", time.Time{}, err
@@ -71,15 +225,63 @@ func (t *token) GenerateAccessToken(ctx context.Context, payload TokenPayload) (
 	return tokenString, expiresAt, nil
 }
 
-func (t *token) GetPayloadFromAccessToken(ctx context.Context, tokenString string) (TokenPayload, time.Time, error) {
+func (t *token) GenerateIdToken(ctx context.Context, payload IdTokenPayload) (string, time.Time, error) {
+	createAt := t.clock.Now()
+	expiresAt := createAt.Add(t.config.AccessTokenTTL)
+	key := t.keyring.signingKey()
+
 	claims := jwt.MapClaims{}
+	for name, value := range payload.Claims {
+		claims[name] = value
+	}
+	claims["iss"] = payload.Issuer
+	claims["sub"] = strconv.FormatUint(payload.AccountId, 10)
+	claims["aud"] = payload.Audience
+	claims["iat"] = createAt.Unix()
+	claims["exp"] = expiresAt.Unix()
+	if payload.Nonce != "" {
+		claims["nonce"] = payload.Nonce
+	}
+	if payload.SessionId != "" {
+		claims["sid"] = payload.SessionId
+	}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(t.config.Secret), nil
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	tokenString, err := token.SignedString(key.private)
+	if err != nil {
+		t.logger.Error("Failed to sign id token", zap.Error(err))
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+func (t *token) GetPayloadFromAccessToken(ctx context.Context, tokenString string) (TokenPayload, time.Time, error) {
+	return t.parseAccessToken(tokenString, func(audience []string) bool {
+		return slices.Contains(audience, t.config.Audience)
+	})
+}
+
+func (t *token) InspectAccessToken(ctx context.Context, tokenString string) (TokenPayload, time.Time, error) {
+	return t.parseAccessToken(tokenString, func(audience []string) bool {
+		return slices.ContainsFunc(audience, t.isKnownAudience)
 	})
+}
+
+// parseAccessToken verifies the signature, the issuer and the time claims
+// of the token, and leaves the audience to isAccepted.
+func (t *token) parseAccessToken(tokenString string, isAccepted func(audience []string) bool) (TokenPayload, time.Time, error) {
+	claims := jwt.MapClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, t.lookupVerificationKey,
+		jwt.WithValidMethods(t.validMethods()),
+		jwt.WithTimeFunc(t.clock.Now),
+		jwt.WithLeeway(t.config.Leeway),
+		jwt.WithIssuer(t.config.Issuer),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		t.logger.Error("Failed to parse token", zap.Error(err))
@@ -91,8 +293,16 @@ func (t *token) GetPayloadFromAccessToken(ctx context.Context, tokenString strin
 		return TokenPayload{}, time.Time{}, errors.New("invalid token")
 	}
 
+	audience, err := claims.GetAudience()
+	if err != nil || !isAccepted(audience) {
+		t.logger.Error("Token is meant for another audience")
+		return TokenPayload{}, time.Time{}, errors.New("invalid aud in token")
+	}
+
+	// Service tokens name their client instead of an account
+	clientId, _ := claims["client_id"].(string)
 	accountID, ok := claims["id"].(float64)
-	if !ok {
+	if !ok && clientId == "" {
 		t.logger.Error("Failed to extract id from token")
 		return TokenPayload{}, time.Time{}, errors.New("invalid id in token")
 	}
@@ -104,7 +314,120 @@ func (t *token) GetPayloadFromAccessToken(ctx context.Context, tokenString strin
 	}
 	expiresAt := time.Unix(int64(exp), 0)
 
+	// sid is optional, tokens outside of a sign-in session do not carry it
+	sessionId, _ := claims["sid"].(string)
+
+	tokenId, _ := claims["jti"].(string)
+	var issuedAt time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+	var authTime time.Time
+	if authTimeClaim, ok := claims["auth_time"].(float64); ok {
+		authTime = time.Unix(int64(authTimeClaim), 0)
+	}
+
+	// cnf confirms the key of sender-constrained tokens
+	var keyThumbprint string
+	if cnf, ok := claims["cnf"]; ok {
+		confirmation, _ := cnf.(map[string]any)
+		keyThumbprint, _ = confirmation["jkt"].(string)
+		if keyThumbprint == "" {
+			t.logger.Error("Failed to extract cnf from token")
+			return TokenPayload{}, time.Time{}, errors.New("invalid cnf in token")
+		}
+	}
+
+	// role is absent from service tokens and tokens issued before it existed
+	role, _ := claims["role"].(string)
+	var scopes []string
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = strings.Fields(scope)
+	}
+
+	// email_verified is only written when false
+	emailVerified, hasEmailVerified := claims["email_verified"].(bool)
+
+	// act names the administrator behind an impersonation token
+	var actorAccountId uint64
+	if act, ok := claims["act"]; ok {
+		actor, _ := act.(map[string]any)
+		subject, _ := actor["sub"].(string)
+		actorAccountId, err = strconv.ParseUint(subject, 10, 64)
+		if err != nil || actorAccountId == 0 {
+			t.logger.Error("Failed to extract act from token")
+			return TokenPayload{}, time.Time{}, errors.New("invalid act in token")
+		}
+	}
+
 	return TokenPayload{
-		AccountId: uint64(accountID),
+		AccountId:         uint64(accountID),
+		ClientId:          clientId,
+		Role:              role,
+		Scopes:            scopes,
+		IsEmailUnverified: hasEmailVerified && !emailVerified,
+		SessionId:         sessionId,
+		ActorAccountId:    actorAccountId,
+		AuthTime:          authTime,
+		KeyThumbprint:     keyThumbprint,
+		Audience:          audience,
+		TokenId:           tokenId,
+		IssuedAt:          issuedAt,
 	}, expiresAt, nil
 }
+
+func (t *token) isKnownAudience(audience string) bool {
+	return audience == t.config.Audience || slices.Contains(t.config.Audiences, audience)
+}
+
+// lookupVerificationKey picks the key named by the kid header. Tokens
+// issued before kid headers were added are checked against the active key.
+func (t *token) lookupVerificationKey(token *jwt.Token) (any, error) {
+	key := t.keyring.signingKey()
+	if kid, ok := token.Header["kid"].(string); ok {
+		var found bool
+		key, found = t.keyring.verificationKey(kid)
+		if !found {
+			return nil, errors.New("unknown signing key")
+		}
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.public, nil
+}
+
+// validMethods are the algorithms of the keys currently in the keyring.
+func (t *token) validMethods() []string {
+	methods := make([]string, 0)
+	for _, key := range t.keyring.verificationKeys() {
+		if !slices.Contains(methods, key.method.Alg()) {
+			methods = append(methods, key.method.Alg())
+		}
+	}
+	return methods
+}
+
+func (t *token) GetJSONWebKeySet(ctx context.Context) []JSONWebKey {
+	jwks := make([]JSONWebKey, 0)
+	for _, key := range t.keyring.verificationKeys() {
+		if key.isSymmetric() {
+			continue
+		}
+
+		jwk, err := key.jwk()
+		if err != nil {
+			t.logger.Error("Failed to build JWK", zap.Error(err))
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	return jwks
+}
+
+func (t *token) GetSigningAlgorithm(ctx context.Context) string {
+	return t.keyring.signingKey().method.Alg()
+}
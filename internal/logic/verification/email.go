@@ -0,0 +1,206 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	"github.com/Fiagram/gateway/internal/log"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTokenTTL       = 24 * time.Hour
+	defaultResendCooldown = time.Minute
+)
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+
+// EmailVerification proves that the email given at sign-up belongs to the
+// account through a token mailed to it.
+type EmailVerification interface {
+	// Start marks the email of a new account as unverified and mails it a
+	// verification link.
+	Start(ctx context.Context, accountId uint64, email string) error
+	// Resend mails a new link to an unverified email. It succeeds for
+	// unknown emails and within the cooldown as well, without sending
+	// anything, so that callers cannot enumerate accounts.
+	Resend(ctx context.Context, email string) error
+	Verify(ctx context.Context, token string) (accountId uint64, err error)
+	// IsVerified is true for accounts created before emails were verified.
+	IsVerified(ctx context.Context, accountId uint64) (bool, error)
+	UnverifiedAccess() configs.UnverifiedAccess
+}
+
+type emailVerification struct {
+	config                 configs.EmailVerification
+	emailVerificationCache cache.EmailVerification
+	mailSender             mail.Sender
+	clock                  utils.Clock
+	logger                 *zap.Logger
+}
+
+func NewEmailVerificationLogic(
+	config configs.EmailVerification,
+	emailVerificationCache cache.EmailVerification,
+	mailSender mail.Sender,
+	clock utils.Clock,
+	logger *zap.Logger,
+) EmailVerification {
+	config.TokenTTL = utils.If(config.TokenTTL > 0, config.TokenTTL, defaultTokenTTL)
+	config.ResendCooldown = utils.If(config.ResendCooldown > 0, config.ResendCooldown, defaultResendCooldown)
+	config.UnverifiedAccess = utils.If(config.UnverifiedAccess != "", config.UnverifiedAccess, configs.UnverifiedAccessAllow)
+
+	return &emailVerification{
+		config:                 config,
+		emailVerificationCache: emailVerificationCache,
+		mailSender:             mailSender,
+		clock:                  clock,
+		logger:                 logger,
+	}
+}
+
+func (e *emailVerification) Start(ctx context.Context, accountId uint64, email string) error {
+	return e.send(ctx, cache.EmailVerificationEntry{
+		AccountId: accountId,
+		Email:     strings.TrimSpace(email),
+	})
+}
+
+func (e *emailVerification) Resend(ctx context.Context, email string) error {
+	logger := log.LoggerWithContext(ctx, e.logger)
+
+	accountId, err := e.emailVerificationCache.GetUnverifiedAccountId(ctx, strings.TrimSpace(email))
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	logger = logger.With(zap.Uint64("account_id", accountId))
+
+	entry, err := e.emailVerificationCache.Get(ctx, accountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if entry.IsVerified {
+		return nil
+	}
+
+	nextSendAt := time.Unix(entry.LastSentAt, 0).Add(e.config.ResendCooldown)
+	if e.clock.Now().Before(nextSendAt) {
+		logger.Info("verification mail asked again within the cooldown, not sending")
+		return nil
+	}
+
+	return e.send(ctx, entry)
+}
+
+func (e *emailVerification) Verify(ctx context.Context, token string) (uint64, error) {
+	logger := log.LoggerWithContext(ctx, e.logger)
+
+	tokenHash := utils.HashSecret(token)
+	tokenEntry, err := e.emailVerificationCache.GetToken(ctx, tokenHash)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return 0, ErrInvalidVerificationToken
+	} else if err != nil {
+		return 0, err
+	}
+	logger = logger.With(zap.Uint64("account_id", tokenEntry.AccountId))
+
+	if !e.clock.Now().Before(time.Unix(tokenEntry.ExpiresAt, 0)) {
+		return 0, ErrInvalidVerificationToken
+	}
+
+	entry, err := e.emailVerificationCache.Get(ctx, tokenEntry.AccountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return 0, ErrInvalidVerificationToken
+	} else if err != nil {
+		return 0, err
+	}
+
+	// A token only proves the address it was mailed to
+	if !strings.EqualFold(entry.Email, tokenEntry.Email) {
+		return 0, ErrInvalidVerificationToken
+	}
+
+	if !entry.IsVerified {
+		entry.IsVerified = true
+		entry.VerifiedAt = e.clock.Now().Unix()
+		if err := e.emailVerificationCache.Set(ctx, entry); err != nil {
+			return 0, err
+		}
+		log.SecurityLogger(logger, "email_verified").Info("verified the email of the account")
+	}
+
+	if err := e.emailVerificationCache.DelToken(ctx, tokenHash); err != nil {
+		return 0, err
+	}
+
+	return entry.AccountId, nil
+}
+
+func (e *emailVerification) IsVerified(ctx context.Context, accountId uint64) (bool, error) {
+	entry, err := e.emailVerificationCache.Get(ctx, accountId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return entry.IsVerified, nil
+}
+
+func (e *emailVerification) UnverifiedAccess() configs.UnverifiedAccess {
+	return e.config.UnverifiedAccess
+}
+
+// send mails a new token to the email of the entry and records the time.
+func (e *emailVerification) send(ctx context.Context, entry cache.EmailVerificationEntry) error {
+	logger := log.LoggerWithContext(ctx, e.logger).With(zap.Uint64("account_id", entry.AccountId))
+
+	token, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate email verification token")
+		return err
+	}
+
+	now := e.clock.Now()
+	err = e.emailVerificationCache.SetToken(ctx, utils.HashSecret(token), cache.EmailVerificationTokenEntry{
+		AccountId: entry.AccountId,
+		Email:     entry.Email,
+		ExpiresAt: now.Add(e.config.TokenTTL).Unix(),
+	}, e.config.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	entry.LastSentAt = now.Unix()
+	if err := e.emailVerificationCache.Set(ctx, entry); err != nil {
+		return err
+	}
+
+	verifyUrl, err := url.Parse(e.config.Url)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse email verification url")
+		return err
+	}
+	query := verifyUrl.Query()
+	query.Set("token", token)
+	verifyUrl.RawQuery = query.Encode()
+
+	return e.mailSender.Send(ctx, mail.Message{
+		To:      entry.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open the link below within %s to confirm that this address belongs to your account:\n\n%s\n\n"+
+			"If you did not sign up, ignore this mail.",
+			e.config.TokenTTL, verifyUrl.String()),
+	})
+}
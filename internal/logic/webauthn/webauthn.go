@@ -0,0 +1,405 @@
+package logic
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/log"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCeremonyTTL = 5 * time.Minute
+	// credentialLockTTL bounds how long a crashed login keeps its passkey
+	// locked, verifying an assertion takes far less
+	credentialLockTTL = 10 * time.Second
+)
+
+var (
+	ErrInvalidCeremony             = errors.New("invalid or expired webauthn ceremony")
+	ErrInvalidCredential           = errors.New("invalid webauthn credential")
+	ErrCredentialAlreadyRegistered = errors.New("webauthn credential is already registered")
+	errUnknownWebAuthnUserHandle   = errors.New("unknown webauthn user handle")
+	errWebAuthnCredentialNotOwned  = errors.New("webauthn credential is not owned by the user handle")
+)
+
+// WebAuthn runs the passkey ceremonies. Each ceremony is split in a begin
+// call, which returns the options for the browser together with a session
+// id, and a finish call that consumes the session.
+type WebAuthn interface {
+	BeginRegistration(ctx context.Context, accountId uint64, accountName string, displayName string) (sessionId string, options *protocol.CredentialCreation, err error)
+	FinishRegistration(ctx context.Context, accountId uint64, sessionId string, credential []byte) error
+	// BeginLogin starts a discoverable login, the account is only known
+	// once the authenticator picked one of its passkeys.
+	BeginLogin(ctx context.Context) (sessionId string, options *protocol.CredentialAssertion, err error)
+	FinishLogin(ctx context.Context, sessionId string, credential []byte) (accountId uint64, err error)
+}
+
+type webAuthnLogic struct {
+	config                  configs.WebAuthn
+	webAuthn                *webauthn.WebAuthn
+	webAuthnSessionCache    cache.WebAuthnSession
+	webAuthnCredentialCache cache.WebAuthnCredential
+	clock                   utils.Clock
+	logger                  *zap.Logger
+}
+
+func NewWebAuthnLogic(
+	config configs.WebAuthn,
+	webAuthnSessionCache cache.WebAuthnSession,
+	webAuthnCredentialCache cache.WebAuthnCredential,
+	clock utils.Clock,
+	logger *zap.Logger,
+) (WebAuthn, error) {
+	config.CeremonyTTL = utils.If(config.CeremonyTTL > 0, config.CeremonyTTL, defaultCeremonyTTL)
+
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    config.CeremonyTTL,
+		TimeoutUVD: config.CeremonyTTL,
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          config.RPID,
+		RPDisplayName: config.RPDisplayName,
+		RPOrigins:     config.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to create webauthn relying party")
+		return nil, err
+	}
+
+	return &webAuthnLogic{
+		config:                  config,
+		webAuthn:                w,
+		webAuthnSessionCache:    webAuthnSessionCache,
+		webAuthnCredentialCache: webAuthnCredentialCache,
+		clock:                   clock,
+		logger:                  logger,
+	}, nil
+}
+
+func (w *webAuthnLogic) BeginRegistration(
+	ctx context.Context,
+	accountId uint64,
+	accountName string,
+	displayName string,
+) (string, *protocol.CredentialCreation, error) {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.Uint64("account_id", accountId))
+
+	credentials, err := w.listCredentials(ctx, accountId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	user := &webAuthnUser{
+		accountId:   accountId,
+		name:        accountName,
+		displayName: utils.If(displayName != "", displayName, accountName),
+		credentials: credentials,
+	}
+	// Passkeys have to be discoverable to sign in without a username, and
+	// verify the user so that they stand in for the password
+	options, sessionData, err := w.webAuthn.BeginRegistration(user,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to begin webauthn registration")
+		return "", nil, err
+	}
+
+	sessionId, err := w.startSession(ctx, accountId, sessionData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sessionId, options, nil
+}
+
+func (w *webAuthnLogic) FinishRegistration(ctx context.Context, accountId uint64, sessionId string, credential []byte) error {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.Uint64("account_id", accountId))
+
+	sessionData, err := w.consumeSession(ctx, sessionId, accountId)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(credential)
+	if err != nil {
+		logger.With(zap.Error(err)).Warn("failed to parse webauthn attestation")
+		return ErrInvalidCredential
+	}
+
+	user := &webAuthnUser{accountId: accountId}
+	created, err := w.webAuthn.CreateCredential(user, sessionData, parsed)
+	if err != nil {
+		logger.With(zap.Error(err)).Warn("failed to verify webauthn attestation")
+		return ErrInvalidCredential
+	}
+
+	credentialId := base64.RawURLEncoding.EncodeToString(created.ID)
+	if _, err := w.webAuthnCredentialCache.Get(ctx, credentialId); err == nil {
+		return ErrCredentialAlreadyRegistered
+	} else if !errors.Is(err, cache.ErrCacheMiss) {
+		return err
+	}
+
+	data, err := json.Marshal(created)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal webauthn credential")
+		return err
+	}
+
+	now := w.clock.Now().Unix()
+	err = w.webAuthnCredentialCache.Set(ctx, cache.WebAuthnCredentialEntry{
+		Id:         credentialId,
+		AccountId:  accountId,
+		Credential: data,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.SecurityLogger(logger, "passkey_registered").
+		With(zap.String("credential_id", credentialId)).
+		Info("registered passkey")
+
+	return nil
+}
+
+func (w *webAuthnLogic) BeginLogin(ctx context.Context) (string, *protocol.CredentialAssertion, error) {
+	logger := log.LoggerWithContext(ctx, w.logger)
+
+	options, sessionData, err := w.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to begin webauthn login")
+		return "", nil, err
+	}
+
+	sessionId, err := w.startSession(ctx, 0, sessionData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sessionId, options, nil
+}
+
+func (w *webAuthnLogic) FinishLogin(ctx context.Context, sessionId string, credential []byte) (uint64, error) {
+	logger := log.LoggerWithContext(ctx, w.logger)
+
+	sessionData, err := w.consumeSession(ctx, sessionId, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(credential)
+	if err != nil {
+		logger.With(zap.Error(err)).Warn("failed to parse webauthn assertion")
+		return 0, ErrInvalidCredential
+	}
+
+	credentialId := base64.RawURLEncoding.EncodeToString(parsed.RawID)
+	logger = logger.With(zap.String("credential_id", credentialId))
+
+	// The sign counter is read, checked and written back below, concurrent
+	// assertions of the same passkey would all pass the clone check
+	isLocked, err := w.webAuthnCredentialCache.Lock(ctx, credentialId, credentialLockTTL)
+	if err != nil {
+		return 0, err
+	} else if !isLocked {
+		log.SecurityLogger(logger, "passkey_concurrent_use").Warn("rejected passkey used by another login at the same time")
+		return 0, ErrInvalidCredential
+	}
+	defer w.webAuthnCredentialCache.Unlock(ctx, credentialId)
+
+	var owner *webAuthnUser
+	handler := func(rawId, userHandle []byte) (webauthn.User, error) {
+		accountId, ok := accountIdFromUserHandle(userHandle)
+		if !ok {
+			return nil, errUnknownWebAuthnUserHandle
+		}
+		entry, err := w.webAuthnCredentialCache.Get(ctx, base64.RawURLEncoding.EncodeToString(rawId))
+		if err != nil {
+			return nil, err
+		}
+		if entry.AccountId != accountId {
+			return nil, errWebAuthnCredentialNotOwned
+		}
+		credentials, err := w.listCredentials(ctx, accountId)
+		if err != nil {
+			return nil, err
+		}
+		owner = &webAuthnUser{accountId: accountId, credentials: credentials}
+		return owner, nil
+	}
+
+	_, validated, err := w.webAuthn.ValidatePasskeyLogin(handler, sessionData, parsed)
+	if err != nil {
+		logger.With(zap.Error(err)).Warn("failed to verify webauthn assertion")
+		return 0, ErrInvalidCredential
+	}
+	logger = logger.With(zap.Uint64("account_id", owner.accountId))
+
+	// A sign counter that went backwards means the private key was copied
+	if validated.Authenticator.CloneWarning {
+		log.SecurityLogger(logger, "passkey_clone_detected").
+			With(zap.Uint32("sign_count", validated.Authenticator.SignCount)).
+			Warn("rejected passkey whose sign counter did not increase")
+		return 0, ErrInvalidCredential
+	}
+
+	entry, err := w.webAuthnCredentialCache.Get(ctx, credentialId)
+	if err != nil {
+		return 0, err
+	}
+	if entry.Credential, err = json.Marshal(validated); err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal webauthn credential")
+		return 0, err
+	}
+	entry.LastUsedAt = w.clock.Now().Unix()
+	if err := w.webAuthnCredentialCache.Set(ctx, entry); err != nil {
+		return 0, err
+	}
+
+	return owner.accountId, nil
+}
+
+func (w *webAuthnLogic) startSession(ctx context.Context, accountId uint64, sessionData *webauthn.SessionData) (string, error) {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.Uint64("account_id", accountId))
+
+	sessionId, err := utils.RandomString(32)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to generate webauthn session id")
+		return "", err
+	}
+
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to marshal webauthn session")
+		return "", err
+	}
+
+	err = w.webAuthnSessionCache.Set(ctx, sessionId, cache.WebAuthnSessionEntry{
+		AccountId:   accountId,
+		SessionData: data,
+	}, w.config.CeremonyTTL)
+	if err != nil {
+		return "", err
+	}
+
+	return sessionId, nil
+}
+
+// consumeSession loads the session of a ceremony, marks it as used and
+// deletes it, so that each challenge is answered at most once even when
+// finish calls race.
+func (w *webAuthnLogic) consumeSession(ctx context.Context, sessionId string, accountId uint64) (webauthn.SessionData, error) {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.Uint64("account_id", accountId))
+
+	entry, err := w.webAuthnSessionCache.Get(ctx, sessionId)
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return webauthn.SessionData{}, ErrInvalidCeremony
+	} else if err != nil {
+		return webauthn.SessionData{}, err
+	}
+
+	isFirstUse, err := w.webAuthnSessionCache.Consume(ctx, sessionId, w.config.CeremonyTTL)
+	if err != nil {
+		return webauthn.SessionData{}, err
+	} else if !isFirstUse {
+		log.SecurityLogger(logger, "webauthn_ceremony_replay").Warn("webauthn ceremony answered again")
+		return webauthn.SessionData{}, ErrInvalidCeremony
+	}
+
+	if err := w.webAuthnSessionCache.Del(ctx, sessionId); err != nil {
+		return webauthn.SessionData{}, err
+	}
+
+	// A registration session belongs to the account that began it
+	if entry.AccountId != accountId {
+		return webauthn.SessionData{}, ErrInvalidCeremony
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal(entry.SessionData, &sessionData); err != nil {
+		logger.With(zap.Error(err)).Error("failed to parse webauthn session")
+		return webauthn.SessionData{}, err
+	}
+
+	return sessionData, nil
+}
+
+func (w *webAuthnLogic) listCredentials(ctx context.Context, accountId uint64) ([]webauthn.Credential, error) {
+	logger := log.LoggerWithContext(ctx, w.logger).With(zap.Uint64("account_id", accountId))
+
+	entries, err := w.webAuthnCredentialCache.ListByAccount(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(entries))
+	for _, entry := range entries {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(entry.Credential, &credential); err != nil {
+			logger.With(zap.Error(err)).Error("failed to parse webauthn credential")
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+// webAuthnUser adapts an account to the WebAuthn library. The user handle
+// stored on the authenticator is the big endian account id.
+type webAuthnUser struct {
+	accountId   uint64
+	name        string
+	displayName string
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return binary.BigEndian.AppendUint64(nil, u.accountId)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.name
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.displayName
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func accountIdFromUserHandle(userHandle []byte) (uint64, bool) {
+	if len(userHandle) != 8 {
+		return 0, false
+	}
+	accountId := binary.BigEndian.Uint64(userHandle)
+	return accountId, accountId != 0
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "time"
+
+// Clock abstracts the wall clock so time-dependent logic can be tested.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func NewClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
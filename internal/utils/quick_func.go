@@ -10,3 +10,19 @@ func If[T any](condition bool, trueValue, falseValue T) T {
 func Ptr[T any](v T) *T {
 	return &v
 }
+
+func PtrIfNotZero[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+func Deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
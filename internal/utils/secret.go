@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// RandomString returns size random bytes encoded as unpadded base64url, for
+// ids, tokens and secrets carried in URLs and headers.
+func RandomString(size int) (string, error) {
+	randomBytes := make([]byte, size)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// RandomHex returns size random bytes hex encoded, for ids that are part
+// of a delimited string.
+func RandomHex(size int) (string, error) {
+	randomBytes := make([]byte, size)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
+
+// HashSecret hashes a generated token or secret for storage. A fast hash is
+// enough since only values from RandomString(32) or longer are passed, which
+// have 256 bits of entropy. Passwords must never be hashed with it.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,51 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAccessTokenRevocationTokenId(t *testing.T) {
+	ctx := context.Background()
+	revocation := cache.NewAccessTokenRevocation(client, zap.NewNop())
+
+	isRevoked, err := revocation.IsTokenIdRevoked(ctx, "test_jti")
+	require.NoError(t, err)
+	assert.False(t, isRevoked, "Unknown token id should not be revoked")
+
+	err = revocation.RevokeTokenId(ctx, "test_jti", 50*time.Millisecond)
+	require.NoError(t, err)
+
+	isRevoked, err = revocation.IsTokenIdRevoked(ctx, "test_jti")
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+
+	// The denylist entry goes away together with the token
+	time.Sleep(100 * time.Millisecond)
+	isRevoked, err = revocation.IsTokenIdRevoked(ctx, "test_jti")
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+}
+
+func TestAccessTokenRevocationNotBefore(t *testing.T) {
+	ctx := context.Background()
+	revocation := cache.NewAccessTokenRevocation(client, zap.NewNop())
+
+	notBefore, err := revocation.GetNotBefore(ctx, 55555)
+	require.NoError(t, err)
+	assert.True(t, notBefore.IsZero(), "Nothing revoked should give the zero time")
+
+	now := time.Now()
+	err = revocation.SetNotBefore(ctx, 55555, now, time.Minute)
+	require.NoError(t, err)
+
+	notBefore, err = revocation.GetNotBefore(ctx, 55555)
+	require.NoError(t, err)
+	assert.Equal(t, now.UnixMilli(), notBefore.UnixMilli())
+}
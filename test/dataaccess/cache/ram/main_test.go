@@ -0,0 +1,17 @@
+package cache_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"go.uber.org/zap"
+)
+
+var client cache.Client
+
+func TestMain(m *testing.M) {
+	client = cache.NewRamClient(zap.NewNop())
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,69 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPersonalAccessTokenSetGetAndDel(t *testing.T) {
+	ctx := context.Background()
+	personalAccessToken := cache.NewPersonalAccessToken(client, zap.NewNop())
+
+	entry := cache.PersonalAccessTokenEntry{
+		Id:         "test_pat_set_get",
+		AccountId:  55555,
+		Name:       "ci-deploy",
+		SecretHash: "9f86d081884c7d659a2feaa0c55ad015",
+		Scopes:     []string{"read:accounts"},
+		CreatedAt:  time.Now().Unix(),
+	}
+
+	err := personalAccessToken.Set(ctx, entry, time.Minute)
+	require.NoError(t, err)
+
+	data, err := personalAccessToken.Get(ctx, entry.Id)
+	require.NoError(t, err)
+	assert.Equal(t, entry, data, "Retrieved token should match the set value")
+
+	tokens, err := personalAccessToken.ListByAccount(ctx, entry.AccountId)
+	require.NoError(t, err)
+	assert.Equal(t, []cache.PersonalAccessTokenEntry{entry}, tokens)
+
+	err = personalAccessToken.Del(ctx, entry.AccountId, entry.Id)
+	require.NoError(t, err)
+
+	_, err = personalAccessToken.Get(ctx, entry.Id)
+	assert.Equal(t, cache.ErrCacheMiss, err, "Get should return ErrCacheMiss after deletion")
+
+	tokens, err = personalAccessToken.ListByAccount(ctx, entry.AccountId)
+	require.NoError(t, err)
+	assert.Empty(t, tokens, "Deleted token should leave the account index")
+}
+
+func TestPersonalAccessTokenLastUsedAt(t *testing.T) {
+	ctx := context.Background()
+	personalAccessToken := cache.NewPersonalAccessToken(client, zap.NewNop())
+
+	entry := cache.PersonalAccessTokenEntry{Id: "test_pat_last_used", AccountId: 66666}
+	require.NoError(t, personalAccessToken.Set(ctx, entry, 0))
+
+	lastUsedAt := time.Now().Unix()
+	require.NoError(t, personalAccessToken.SetLastUsedAt(ctx, entry.Id, lastUsedAt, 0))
+
+	data, err := personalAccessToken.Get(ctx, entry.Id)
+	require.NoError(t, err)
+	assert.Equal(t, lastUsedAt, data.LastUsedAt)
+
+	// Recording a use after the deletion does not bring the token back
+	require.NoError(t, personalAccessToken.Del(ctx, entry.AccountId, entry.Id))
+	require.NoError(t, personalAccessToken.SetLastUsedAt(ctx, entry.Id, lastUsedAt, 0))
+
+	_, err = personalAccessToken.Get(ctx, entry.Id)
+	assert.Equal(t, cache.ErrCacheMiss, err)
+}
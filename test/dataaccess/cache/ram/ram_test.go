@@ -0,0 +1,169 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRamSetAndGet(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key9"
+	expected := "value9"
+	err := client.Set(ctx, key, expected, time.Second)
+	require.NoError(t, err)
+
+	actual, err := client.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+}
+
+func TestRamSetExpires(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_expiring"
+	err := client.Set(ctx, key, "value", 50*time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = client.Get(ctx, key)
+	require.ErrorIs(t, err, cache.ErrCacheMiss)
+}
+
+func TestRamSetWithoutTTLPersists(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_persistent"
+	err := client.Set(ctx, key, "value", 50*time.Millisecond)
+	require.NoError(t, err)
+
+	// Overwriting without a ttl drops the previous expiry, as redis does
+	err = client.Set(ctx, key, "value", 0)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	actual, err := client.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "value", actual)
+
+	require.NoError(t, client.Del(ctx, key))
+}
+
+func TestRamDel(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key9f"
+	err := client.Set(ctx, key, "sdsd", 0)
+	require.NoError(t, err)
+
+	err = client.Del(ctx, key)
+	require.NoError(t, err)
+
+	_, err = client.Get(ctx, key)
+	require.Error(t, err)
+}
+
+func TestRamAddToSet(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key38"
+	err := client.AddToSet(ctx, key, "v1", "v2", "v3")
+	require.NoError(t, err)
+
+	isTrue, err := client.IsDataInSet(ctx, key, "v3")
+	require.NoError(t, err)
+	require.Equal(t, true, isTrue)
+
+	err = client.Del(ctx, key)
+	require.NoError(t, err)
+}
+
+func TestRamIncr(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_counter"
+	for expected := int64(1); expected <= 3; expected++ {
+		actual, err := client.Incr(ctx, key, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	// Counters read back as strings, the way redis returns them
+	actual, err := client.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "3", actual)
+
+	require.NoError(t, client.Set(ctx, key, "not a number", 0))
+	_, err = client.Incr(ctx, key, time.Second)
+	require.Error(t, err)
+
+	require.NoError(t, client.Del(ctx, key))
+}
+
+func TestRamDecr(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_counter_decr"
+	actual, err := client.Decr(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), actual)
+	_, err = client.Get(ctx, key)
+	require.ErrorIs(t, err, cache.ErrCacheMiss, "a missing counter is not created")
+
+	for range 2 {
+		_, err := client.Incr(ctx, key, 50*time.Millisecond)
+		require.NoError(t, err)
+	}
+	actual, err = client.Decr(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), actual)
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = client.Get(ctx, key)
+	require.ErrorIs(t, err, cache.ErrCacheMiss, "a decrement keeps the ttl")
+}
+
+func TestRamSetIfAbsent(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_set_if_absent"
+	isSet, err := client.SetIfAbsent(ctx, key, "first", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, isSet)
+
+	isSet, err = client.SetIfAbsent(ctx, key, "second", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, isSet)
+
+	actual, err := client.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "first", actual)
+
+	time.Sleep(100 * time.Millisecond)
+
+	isSet, err = client.SetIfAbsent(ctx, key, "third", 0)
+	require.NoError(t, err)
+	require.True(t, isSet, "an expired key can be set again")
+
+	require.NoError(t, client.Del(ctx, key))
+}
+
+func TestRamIncrExpires(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_counter_expiring"
+	_, err := client.Incr(ctx, key, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	actual, err := client.Incr(ctx, key, 50*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), actual, "an expired counter starts over")
+}
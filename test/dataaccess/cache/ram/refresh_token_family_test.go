@@ -0,0 +1,75 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRefreshTokenFamilySetAndGet(t *testing.T) {
+	ctx := context.Background()
+	family := cache.NewRefreshTokenFamily(client, zap.NewNop())
+
+	familyId := "test_family_set_get"
+	entry := cache.RefreshTokenFamilyEntry{
+		AccountId:    12345,
+		CurrentToken: "test_token_current",
+		CreatedAt:    time.Now().Unix(),
+	}
+
+	err := family.Set(ctx, familyId, entry, time.Minute)
+	assert.NoError(t, err, "Set should not return an error")
+
+	data, err := family.Get(ctx, familyId)
+	assert.NoError(t, err, "Get should not return an error")
+	assert.Equal(t, entry, data, "Retrieved family should match the set value")
+
+	t.Cleanup(func() {
+		_ = family.Del(ctx, familyId)
+	})
+}
+
+func TestRefreshTokenFamilyDel(t *testing.T) {
+	ctx := context.Background()
+	family := cache.NewRefreshTokenFamily(client, zap.NewNop())
+
+	familyId := "test_family_del"
+	err := family.Set(ctx, familyId, cache.RefreshTokenFamilyEntry{
+		AccountId:    11111,
+		CurrentToken: "test_token_current",
+	}, time.Minute)
+	assert.NoError(t, err, "Set should not return an error")
+
+	err = family.Del(ctx, familyId)
+	assert.NoError(t, err, "Del should not return an error")
+
+	_, err = family.Get(ctx, familyId)
+	assert.Equal(t, cache.ErrCacheMiss, err, "Get should return ErrCacheMiss after deletion")
+}
+
+func TestRefreshTokenRotatedMarker(t *testing.T) {
+	ctx := context.Background()
+	refreshToken := cache.NewRefreshToken(client, zap.NewNop())
+
+	testToken := "test_token_rotated"
+	entry := cache.RefreshTokenEntry{
+		AccountId: 22222,
+		FamilyId:  "test_family",
+		RotatedAt: time.Now().Unix(),
+	}
+
+	err := refreshToken.Set(ctx, testToken, entry, time.Minute)
+	assert.NoError(t, err, "Set should not return an error")
+
+	data, err := refreshToken.Get(ctx, testToken)
+	assert.NoError(t, err, "Get should not return an error")
+	assert.Equal(t, entry.RotatedAt, data.RotatedAt, "Rotated marker should survive the round trip")
+
+	t.Cleanup(func() {
+		_, _ = refreshToken.Del(ctx, testToken)
+	})
+}
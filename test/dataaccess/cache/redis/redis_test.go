@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
 	"github.com/stretchr/testify/require"
 )
 
@@ -51,3 +52,65 @@ func TestAddToSet(t *testing.T) {
 	err = client.Del(ctx, key)
 	require.NoError(t, err)
 }
+
+func TestRedisIncr(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_counter"
+	require.NoError(t, client.Del(ctx, key))
+	for expected := int64(1); expected <= 3; expected++ {
+		actual, err := client.Incr(ctx, key, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	actual, err := client.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "3", actual)
+
+	require.NoError(t, client.Del(ctx, key))
+}
+
+func TestRedisDecr(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_counter_decr"
+	require.NoError(t, client.Del(ctx, key))
+
+	actual, err := client.Decr(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), actual)
+	_, err = client.Get(ctx, key)
+	require.ErrorIs(t, err, cache.ErrCacheMiss)
+
+	for range 2 {
+		_, err := client.Incr(ctx, key, time.Second)
+		require.NoError(t, err)
+	}
+	actual, err = client.Decr(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), actual)
+
+	require.NoError(t, client.Del(ctx, key))
+}
+
+func TestRedisSetIfAbsent(t *testing.T) {
+	ctx := context.Background()
+
+	key := "key_set_if_absent"
+	require.NoError(t, client.Del(ctx, key))
+
+	isSet, err := client.SetIfAbsent(ctx, key, "first", time.Second)
+	require.NoError(t, err)
+	require.True(t, isSet)
+
+	isSet, err = client.SetIfAbsent(ctx, key, "second", time.Second)
+	require.NoError(t, err)
+	require.False(t, isSet)
+
+	actual, err := client.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "first", actual)
+
+	require.NoError(t, client.Del(ctx, key))
+}
@@ -19,7 +19,10 @@ func TestRefreshTokenSet(t *testing.T) {
 	testAccountID := uint64(12345)
 
 	// Set the refresh token
-	err := refreshToken.Set(ctx, testToken, testAccountID, time.Minute)
+	err := refreshToken.Set(ctx, testToken, cache.RefreshTokenEntry{
+		AccountId: testAccountID,
+		FamilyId:  "test_family",
+	}, time.Minute)
 	assert.NoError(t, err, "Set should not return an error")
 
 	t.Cleanup(func() {
@@ -36,13 +39,16 @@ func TestRefreshTokenGet(t *testing.T) {
 	testAccountID := uint64(67890)
 
 	// Set the refresh token first
-	err := refreshToken.Set(ctx, testToken, testAccountID, time.Minute)
+	err := refreshToken.Set(ctx, testToken, cache.RefreshTokenEntry{
+		AccountId: testAccountID,
+		FamilyId:  "test_family",
+	}, time.Minute)
 	assert.NoError(t, err, "Set should not return an error")
 
 	// Get the refresh token
 	data, err := refreshToken.Get(ctx, testToken)
 	assert.NoError(t, err, "Get should not return an error")
-	assert.Equal(t, testAccountID, data, "Retrieved account ID should match the set value")
+	assert.Equal(t, testAccountID, data.AccountId, "Retrieved account ID should match the set value")
 
 	t.Cleanup(func() {
 		_, _ = refreshToken.Del(ctx, testToken)
@@ -70,7 +76,10 @@ func TestRefreshTokenDel(t *testing.T) {
 	testAccountID := uint64(11111)
 
 	// Set the refresh token first
-	err := refreshToken.Set(ctx, testToken, testAccountID, time.Minute)
+	err := refreshToken.Set(ctx, testToken, cache.RefreshTokenEntry{
+		AccountId: testAccountID,
+		FamilyId:  "test_family",
+	}, time.Minute)
 	assert.NoError(t, err, "Set should not return an error")
 
 	// Delete the refresh token
@@ -93,17 +102,23 @@ func TestRefreshTokenSetAndOverwrite(t *testing.T) {
 	accountID2 := uint64(22222)
 
 	// Set initial refresh token
-	err := refreshToken.Set(ctx, testToken, accountID1, time.Minute)
+	err := refreshToken.Set(ctx, testToken, cache.RefreshTokenEntry{
+		AccountId: accountID1,
+		FamilyId:  "test_family",
+	}, time.Minute)
 	assert.NoError(t, err, "First Set should not return an error")
 
 	// Overwrite with new account ID
-	err = refreshToken.Set(ctx, testToken, accountID2, time.Minute)
+	err = refreshToken.Set(ctx, testToken, cache.RefreshTokenEntry{
+		AccountId: accountID2,
+		FamilyId:  "test_family",
+	}, time.Minute)
 	assert.NoError(t, err, "Second Set should not return an error")
 
 	// Verify the new value is stored
 	data, err := refreshToken.Get(ctx, testToken)
 	assert.NoError(t, err, "Get should not return an error")
-	assert.Equal(t, accountID2, data, "Retrieved account ID should be the overwritten value")
+	assert.Equal(t, accountID2, data.AccountId, "Retrieved account ID should be the overwritten value")
 
 	// Cleanup
 	t.Cleanup(func() {
@@ -136,20 +151,26 @@ func TestRefreshTokenMultipleKeys(t *testing.T) {
 	accountID2 := uint64(88888)
 
 	// Set multiple tokens
-	err := refreshToken.Set(ctx, testToken1, accountID1, time.Minute)
+	err := refreshToken.Set(ctx, testToken1, cache.RefreshTokenEntry{
+		AccountId: accountID1,
+		FamilyId:  "test_family",
+	}, time.Minute)
 	assert.NoError(t, err, "First Set should not return an error")
 
-	err = refreshToken.Set(ctx, testToken2, accountID2, time.Minute)
+	err = refreshToken.Set(ctx, testToken2, cache.RefreshTokenEntry{
+		AccountId: accountID2,
+		FamilyId:  "test_family",
+	}, time.Minute)
 	assert.NoError(t, err, "Second Set should not return an error")
 
 	// Verify both tokens are stored correctly
 	data1, err := refreshToken.Get(ctx, testToken1)
 	assert.NoError(t, err, "First Get should not return an error")
-	assert.Equal(t, accountID1, data1, "First token should have correct account ID")
+	assert.Equal(t, accountID1, data1.AccountId, "First token should have correct account ID")
 
 	data2, err := refreshToken.Get(ctx, testToken2)
 	assert.NoError(t, err, "Second Get should not return an error")
-	assert.Equal(t, accountID2, data2, "Second token should have correct account ID")
+	assert.Equal(t, accountID2, data2.AccountId, "Second token should have correct account ID")
 
 	// Cleanup
 	t.Cleanup(func() {
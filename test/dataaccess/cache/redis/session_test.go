@@ -0,0 +1,73 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSessionSetGetAndDel(t *testing.T) {
+	ctx := context.Background()
+	session := cache.NewSession(client, zap.NewNop())
+
+	entry := cache.SessionEntry{
+		Id:              "test_session_set_get",
+		AccountId:       33333,
+		UserAgent:       "Mozilla/5.0",
+		IpAddress:       "203.0.113.7",
+		CreatedAt:       time.Now().Unix(),
+		LastRefreshedAt: time.Now().Unix(),
+		IsRememberMe:    true,
+	}
+
+	err := session.Set(ctx, entry, time.Minute)
+	assert.NoError(t, err, "Set should not return an error")
+
+	data, err := session.Get(ctx, entry.Id)
+	assert.NoError(t, err, "Get should not return an error")
+	assert.Equal(t, entry, data, "Retrieved session should match the set value")
+
+	err = session.Del(ctx, entry.AccountId, entry.Id)
+	assert.NoError(t, err, "Del should not return an error")
+
+	_, err = session.Get(ctx, entry.Id)
+	assert.Equal(t, cache.ErrCacheMiss, err, "Get should return ErrCacheMiss after deletion")
+
+	sessions, err := session.ListByAccount(ctx, entry.AccountId)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions, "Deleted session should leave the account index")
+}
+
+func TestSessionListByAccountSkipsExpired(t *testing.T) {
+	ctx := context.Background()
+	session := cache.NewSession(client, zap.NewNop())
+
+	accountId := uint64(44444)
+	err := session.Set(ctx, cache.SessionEntry{Id: "test_session_alive", AccountId: accountId}, time.Minute)
+	require.NoError(t, err)
+	err = session.Set(ctx, cache.SessionEntry{Id: "test_session_expiring", AccountId: accountId}, 50*time.Millisecond)
+	require.NoError(t, err)
+	err = session.Set(ctx, cache.SessionEntry{Id: "test_session_other", AccountId: accountId + 1}, time.Minute)
+	require.NoError(t, err)
+
+	sessions, err := session.ListByAccount(ctx, accountId)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	time.Sleep(100 * time.Millisecond)
+
+	sessions, err = session.ListByAccount(ctx, accountId)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "test_session_alive", sessions[0].Id)
+
+	t.Cleanup(func() {
+		_ = session.Del(ctx, accountId, "test_session_alive")
+		_ = session.Del(ctx, accountId+1, "test_session_other")
+	})
+}
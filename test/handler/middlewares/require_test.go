@@ -0,0 +1,121 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/handler/middlewares"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/test/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Helper function to call a guarded route as the principal set up by
+// the principal middleware, returns the status code
+func callGuarded(principal gin.HandlerFunc, guard gin.HandlerFunc) int {
+	r := gin.New()
+	r.GET("/guarded", principal, guard, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/guarded", nil))
+	return w.Code
+}
+
+func asUser(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("principalType", middlewares.PrincipalTypeUser)
+		c.Set("accountId", uint64(1))
+		c.Set("role", role)
+	}
+}
+
+func asScoped(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("principalType", middlewares.PrincipalTypeService)
+		c.Set("clientId", "portfolio-service")
+		c.Set("scopes", scopes)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	guard := middlewares.RequireRole(token_logic.RoleAdmin)
+
+	assert.Equal(t, http.StatusNoContent, callGuarded(asUser(token_logic.RoleAdmin), guard))
+	assert.Equal(t, http.StatusForbidden, callGuarded(asUser(token_logic.RoleMember), guard))
+	assert.Equal(t, http.StatusForbidden, callGuarded(asUser(""), guard))
+	assert.Equal(t, http.StatusForbidden, callGuarded(asScoped("read:accounts"), guard),
+		"services have no role")
+}
+
+func TestRequireScope(t *testing.T) {
+	guard := middlewares.RequireScope("read:accounts", "write:orders")
+
+	assert.Equal(t, http.StatusNoContent, callGuarded(asScoped("write:orders", "read:accounts"), guard))
+	assert.Equal(t, http.StatusForbidden, callGuarded(asScoped("read:accounts"), guard))
+	assert.Equal(t, http.StatusForbidden, callGuarded(asScoped(), guard))
+	assert.Equal(t, http.StatusNoContent, callGuarded(asUser(token_logic.RoleMember), guard),
+		"sign-in tokens are not restricted to scopes")
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	guard := middlewares.RequireVerifiedEmail()
+	asUnverified := func(c *gin.Context) {
+		asUser(token_logic.RoleMember)(c)
+		c.Set("emailUnverified", true)
+	}
+
+	assert.Equal(t, http.StatusNoContent, callGuarded(asUser(token_logic.RoleMember), guard))
+	assert.Equal(t, http.StatusForbidden, callGuarded(asUnverified, guard))
+	assert.Equal(t, http.StatusNoContent, callGuarded(asScoped("read:accounts"), guard))
+}
+
+func TestRefuseImpersonation(t *testing.T) {
+	guard := middlewares.RefuseImpersonation()
+	asImpersonated := func(c *gin.Context) {
+		asUser(token_logic.RoleMember)(c)
+		c.Set("actorAccountId", uint64(7))
+	}
+
+	assert.Equal(t, http.StatusNoContent, callGuarded(asUser(token_logic.RoleMember), guard))
+	assert.Equal(t, http.StatusForbidden, callGuarded(asImpersonated, guard))
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	clock := testutils.NewFakeClock(time.Now())
+	guard := middlewares.RequireRecentAuth(5*time.Minute, clock)
+	authenticatedAgo := func(d time.Duration) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			asUser(token_logic.RoleMember)(c)
+			c.Set("authTime", clock.Now().Add(-d))
+		}
+	}
+
+	assert.Equal(t, http.StatusNoContent, callGuarded(authenticatedAgo(time.Minute), guard))
+	assert.Equal(t, http.StatusUnauthorized, callGuarded(authenticatedAgo(time.Hour), guard))
+	assert.Equal(t, http.StatusUnauthorized, callGuarded(asUser(token_logic.RoleMember), guard),
+		"tokens without auth_time must step up")
+
+	// Exactly maxAge after the authentication is still recent
+	authenticatedAt := clock.Now()
+	authenticated := func(c *gin.Context) {
+		asUser(token_logic.RoleMember)(c)
+		c.Set("authTime", authenticatedAt)
+	}
+	clock.Advance(5 * time.Minute)
+	assert.Equal(t, http.StatusNoContent, callGuarded(authenticated, guard))
+	clock.Advance(time.Second)
+	assert.Equal(t, http.StatusUnauthorized, callGuarded(authenticated, guard))
+
+	r := gin.New()
+	r.GET("/guarded", authenticatedAgo(time.Hour), guard)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/guarded", nil))
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="insufficient_user_authentication"`)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "max_age=300")
+	assert.Contains(t, w.Body.String(), `"code":"StepUpRequired"`)
+}
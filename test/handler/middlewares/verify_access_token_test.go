@@ -0,0 +1,71 @@
+package middlewares_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/handler/middlewares"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/test/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestVerifyAccessTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+
+	// The clock runs in the past, the real time would find every token
+	// expired
+	clock := testutils.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tokenConfig := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+	}
+	keyring, err := token_logic.NewKeyring(tokenConfig, clock, logger)
+	require.NoError(t, err)
+	tokenLogic := token_logic.NewTokenLogic(tokenConfig, keyring, clock, logger)
+	sessionLogic := session_logic.NewSessionLogic(
+		tokenConfig,
+		session_logic.NewSessionPolicy(tokenConfig, clock),
+		cache.NewRefreshToken(client, logger),
+		cache.NewRefreshTokenFamily(client, logger),
+		cache.NewSession(client, logger),
+		cache.NewAccessTokenRevocation(client, logger),
+		tokenLogic,
+		clock,
+		logger,
+	)
+
+	r := gin.New()
+	r.GET("/me", middlewares.VerifyAccessToken(tokenLogic, sessionLogic, nil, nil, clock), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{
+		AccountId: 1,
+		Role:      token_logic.RoleMember,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, call(token))
+
+	clock.Advance(15*time.Minute + time.Second)
+	assert.Equal(t, http.StatusUnauthorized, call(token))
+}
@@ -0,0 +1,89 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/handler/middlewares"
+	csrf_logic "github.com/Fiagram/gateway/internal/logic/csrf"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// Helper function to call a route guarded by VerifyCsrf, the headers and
+// cookies are set by prepare. Returns the status code.
+func callCsrfGuarded(csrfLogic csrf_logic.Csrf, prepare func(req *http.Request)) int {
+	r := gin.New()
+	r.POST("/api/v1/auth/token/refresh", middlewares.VerifyCsrf(csrfLogic), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/token/refresh", nil)
+	prepare(req)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestVerifyCsrf(t *testing.T) {
+	csrfLogic, err := csrf_logic.NewCsrfLogic(configs.Csrf{
+		AllowedOrigins: []string{"https://app.example.com/"},
+		Secret:         "test-csrf-secret",
+	}, zap.NewNop())
+	require.NoError(t, err)
+	refreshToken := "refresh-token-1"
+	csrfToken := csrfLogic.GenerateToken(refreshToken)
+
+	withTokens := func(cookieToken string, headerToken string) func(req *http.Request) {
+		return func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: "refresh_token", Value: refreshToken})
+			if cookieToken != "" {
+				req.AddCookie(&http.Cookie{Name: csrf_logic.CookieName, Value: cookieToken})
+			}
+			if headerToken != "" {
+				req.Header.Set(csrf_logic.HeaderName, headerToken)
+			}
+		}
+	}
+	withOrigin := func(header string, value string) func(req *http.Request) {
+		return func(req *http.Request) {
+			withTokens(csrfToken, csrfToken)(req)
+			req.Header.Set(header, value)
+		}
+	}
+
+	t.Run("tokens", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, callCsrfGuarded(csrfLogic, withTokens(csrfToken, csrfToken)))
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withTokens(csrfToken, "")))
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withTokens("", csrfToken)))
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withTokens("planted", "planted")),
+			"a cookie planted from a sibling subdomain does not match the refresh token")
+		otherToken := csrfLogic.GenerateToken("refresh-token-2")
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withTokens(otherToken, otherToken)))
+	})
+
+	t.Run("origins", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, callCsrfGuarded(csrfLogic, withOrigin("Origin", "https://app.example.com")))
+		assert.Equal(t, http.StatusNoContent, callCsrfGuarded(csrfLogic, withOrigin("Origin", "http://example.com")),
+			"same-origin requests are allowed")
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withOrigin("Origin", "https://example.com")),
+			"the scheme is part of the origin")
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withOrigin("Referer", "https://example.com/settings")))
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withOrigin("Origin", "https://evil.example.com")))
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withOrigin("Origin", "null")))
+		assert.Equal(t, http.StatusNoContent, callCsrfGuarded(csrfLogic, withOrigin("Referer", "https://app.example.com/settings")))
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, withOrigin("Referer", "https://evil.example.com/")))
+	})
+
+	t.Run("without cookie", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, callCsrfGuarded(csrfLogic, func(*http.Request) {}),
+			"requests without the cookie are left to the handler")
+		assert.Equal(t, http.StatusForbidden, callCsrfGuarded(csrfLogic, func(req *http.Request) {
+			req.Header.Set("Origin", "https://evil.example.com")
+		}))
+	})
+}
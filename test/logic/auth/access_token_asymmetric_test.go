@@ -0,0 +1,181 @@
+package logic_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAsymmetricTokenRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		kty       string
+		newKey    func() crypto.Signer
+	}{
+		{
+			name:      "RS256 with rsa key",
+			algorithm: logic.AlgorithmRS256,
+			kty:       "RSA",
+			newKey: func() crypto.Signer {
+				key, _ := rsa.GenerateKey(rand.Reader, 2048)
+				return key
+			},
+		},
+		{
+			name:      "ES256 with p-256 key",
+			algorithm: logic.AlgorithmES256,
+			kty:       "EC",
+			newKey: func() crypto.Signer {
+				key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				return key
+			},
+		},
+		{
+			name:      "EdDSA with ed25519 key",
+			algorithm: logic.AlgorithmEdDSA,
+			kty:       "OKP",
+			newKey: func() crypto.Signer {
+				_, key, _ := ed25519.GenerateKey(rand.Reader)
+				return key
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			config := configs.Token{
+				Algorithm:       tt.algorithm,
+				PrivateKeyFile:  writePrivateKeyPEM(t, tt.newKey()),
+				AccessTokenTTL:  15 * time.Minute,
+				RefreshTokenTTL: 7 * 24 * time.Hour,
+			}
+			tokenLogic := newTokenLogic(t, config)
+
+			token, expiresAt, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+				AccountId: 424242,
+			})
+			require.NoError(t, err)
+
+			payload, retrievedExpiresAt, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(424242), payload.AccountId)
+			assert.Equal(t, expiresAt.Unix(), retrievedExpiresAt.Unix())
+
+			// The published key must match the kid of the issued token
+			jwks := tokenLogic.GetJSONWebKeySet(ctx)
+			require.Len(t, jwks, 1)
+			assert.Equal(t, tt.kty, jwks[0].Kty)
+			assert.Equal(t, tt.algorithm, jwks[0].Alg)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.algorithm, parsed.Method.Alg())
+			assert.Equal(t, jwks[0].Kid, parsed.Header["kid"])
+		})
+	}
+}
+
+func TestAsymmetricTokenRejectsOtherAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	config := configs.Token{
+		Algorithm:       logic.AlgorithmES256,
+		PrivateKeyFile:  writePrivateKeyPEM(t, ecKey),
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+	tokenLogic := newTokenLogic(t, config)
+
+	claims := jwt.MapClaims{
+		"id":  12345,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+
+	// HS256 signed with the public key bytes must not pass as ES256
+	publicDER, err := x509.MarshalPKIXPublicKey(ecKey.Public())
+	require.NoError(t, err)
+	hsToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(publicDER)
+	require.NoError(t, err)
+
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edToken, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(otherKey)
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"hmac signed token": hsToken,
+		"unsigned token":    noneToken,
+		"eddsa token":       edToken,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSymmetricTokenPublishesNoKeys(t *testing.T) {
+	config := configs.Token{
+		Algorithm:       logic.AlgorithmHS256,
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+	tokenLogic := newTokenLogic(t, config)
+
+	assert.Empty(t, tokenLogic.GetJSONWebKeySet(context.Background()))
+}
+
+func TestTokenLogicRejectsMismatchedKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	config := configs.Token{
+		Algorithm:      logic.AlgorithmES256,
+		PrivateKeyFile: writePrivateKeyPEM(t, rsaKey),
+		AccessTokenTTL: 15 * time.Minute,
+	}
+	_, err = logic.NewKeyring(config, utils.NewClock(), zap.NewNop())
+	assert.Error(t, err)
+}
+
+// Helper function to store a private key as a PKCS#8 PEM file
+func writePrivateKeyPEM(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "private_key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), 0o600)
+	require.NoError(t, err)
+
+	return path
+}
@@ -8,20 +8,20 @@ import (
 
 	"github.com/Fiagram/gateway/internal/configs"
 	logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/test/testutils"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"go.uber.org/zap"
 )
 
 func TestTokenGenerate(t *testing.T) {
-	logger := zap.NewNop()
 	config := configs.Token{
 		Secret:          "test-secret-key-123",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 
 	tests := []struct {
 		name      string
@@ -59,14 +59,13 @@ func TestTokenGenerate(t *testing.T) {
 }
 
 func TestTokenGetPayload(t *testing.T) {
-	logger := zap.NewNop()
 	config := configs.Token{
 		Secret:          "test-secret-key-123",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 	ctx := context.Background()
 
 	tests := []struct {
@@ -107,14 +106,13 @@ func TestTokenGetPayload(t *testing.T) {
 }
 
 func TestTokenInvalidToken(t *testing.T) {
-	logger := zap.NewNop()
 	config := configs.Token{
 		Secret:          "test-secret-key-123",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 	ctx := context.Background()
 
 	tests := []struct {
@@ -135,7 +133,7 @@ func TestTokenInvalidToken(t *testing.T) {
 		},
 		{
 			name:  "token with wrong secret",
-			token: generateTokenWithDifferentSecret(),
+			token: generateTokenWithDifferentSecret(t),
 		},
 	}
 
@@ -148,14 +146,13 @@ func TestTokenInvalidToken(t *testing.T) {
 }
 
 func TestTokenRoundTrip(t *testing.T) {
-	logger := zap.NewNop()
 	config := configs.Token{
 		Secret:          "test-secret-key-123",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 	ctx := context.Background()
 
 	originalPayload := logic.TokenPayload{
@@ -178,7 +175,6 @@ func TestTokenRoundTrip(t *testing.T) {
 }
 
 func TestTokenDifferentSecrets(t *testing.T) {
-	logger := zap.NewNop()
 	config1 := configs.Token{
 		Secret:          "secret-key-1",
 		AccessTokenTTL:  15 * time.Minute,
@@ -190,8 +186,8 @@ func TestTokenDifferentSecrets(t *testing.T) {
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic1 := logic.NewTokenLogic(config1, logger)
-	tokenLogic2 := logic.NewTokenLogic(config2, logger)
+	tokenLogic1 := newTokenLogic(t, config1)
+	tokenLogic2 := newTokenLogic(t, config2)
 	ctx := context.Background()
 
 	payload := logic.TokenPayload{
@@ -208,15 +204,14 @@ func TestTokenDifferentSecrets(t *testing.T) {
 }
 
 // Helper function to generate a token with a different secret
-func generateTokenWithDifferentSecret() string {
-	logger := zap.NewNop()
+func generateTokenWithDifferentSecret(t *testing.T) string {
 	config := configs.Token{
 		Secret:          "different-secret-key",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 	ctx := context.Background()
 
 	payload := logic.TokenPayload{
@@ -226,3 +221,347 @@ func generateTokenWithDifferentSecret() string {
 	token, _, _ := tokenLogic.GenerateAccessToken(ctx, payload)
 	return token
 }
+
+func TestTokenCarriesIdAndIssuedAt(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	clock := testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	tokenLogic := newTokenLogicWithClock(t, config, clock)
+	ctx := context.Background()
+
+	token1, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 22222})
+	require.NoError(t, err)
+	token2, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 22222})
+	require.NoError(t, err)
+
+	payload1, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token1)
+	require.NoError(t, err)
+	payload2, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token2)
+	require.NoError(t, err)
+
+	// Every token gets its own jti so it can be revoked on its own
+	assert.NotEmpty(t, payload1.TokenId)
+	assert.NotEqual(t, payload1.TokenId, payload2.TokenId)
+	assert.Equal(t, clock.Now().Unix(), payload1.IssuedAt.Unix())
+}
+
+func TestServiceTokenCarriesClientAndScopes(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		ClientId: "portfolio-service",
+		Scopes:   []string{"read:accounts", "write:orders"},
+	})
+	require.NoError(t, err)
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, payload.IsService())
+	assert.Equal(t, uint64(0), payload.AccountId)
+	assert.Equal(t, "portfolio-service", payload.ClientId)
+	assert.Equal(t, []string{"read:accounts", "write:orders"}, payload.Scopes)
+
+	// Tokens of accounts stay user principals
+	token, _, err = tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 33333})
+	require.NoError(t, err)
+	payload, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.False(t, payload.IsService())
+	assert.Equal(t, uint64(33333), payload.AccountId)
+}
+
+func TestTokenCarriesRole(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId: 44444,
+		Role:      logic.RoleAdmin,
+	})
+	require.NoError(t, err)
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, logic.RoleAdmin, payload.Role)
+	assert.Empty(t, payload.Scopes)
+}
+
+func TestTokenCarriesEmailUnverified(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId:         55555,
+		IsEmailUnverified: true,
+	})
+	require.NoError(t, err)
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, payload.IsEmailUnverified)
+
+	token, _, err = tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 55555})
+	require.NoError(t, err)
+	payload, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.False(t, payload.IsEmailUnverified)
+}
+
+func TestTokenCarriesActor(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+
+	token, expiresAt, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId:      55555,
+		ActorAccountId: 7,
+		TTL:            5 * time.Minute,
+	})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), expiresAt, 5*time.Second)
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, payload.IsImpersonation())
+	assert.Equal(t, uint64(7), payload.ActorAccountId)
+
+	// A TTL cannot lengthen the token
+	token, expiresAt, err = tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId: 55555,
+		TTL:       time.Hour,
+	})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), expiresAt, 5*time.Second)
+	payload, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.False(t, payload.IsImpersonation())
+}
+
+func TestTokenCarriesAuthTime(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId: 55555,
+		AuthTime:  authTime,
+	})
+	require.NoError(t, err)
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, authTime.Equal(payload.AuthTime))
+
+	token, _, err = tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 55555})
+	require.NoError(t, err)
+	payload, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, payload.AuthTime.IsZero())
+}
+
+func TestTokenCarriesKeyThumbprint(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId:     55555,
+		KeyThumbprint: "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I",
+	})
+	require.NoError(t, err)
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I", payload.KeyThumbprint)
+}
+
+func TestTokenCarriesIssuerAndAudience(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		Issuer:          "https://auth.fiagram.test",
+		Audience:        "fiagram-gateway",
+		Audiences:       []string{"fiagram-portfolio"},
+	}
+
+	clock := testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	tokenLogic := newTokenLogicWithClock(t, config, clock)
+	ctx := context.Background()
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 66666})
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+	require.NoError(t, err)
+	assert.Equal(t, "https://auth.fiagram.test", claims["iss"])
+	assert.Equal(t, "66666", claims["sub"])
+	assert.Equal(t, []any{"fiagram-gateway"}, claims["aud"])
+	assert.Equal(t, float64(clock.Now().UnixMilli())/1000, claims["iat"])
+	assert.Equal(t, float64(clock.Now().Unix()), claims["nbf"])
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fiagram-gateway"}, payload.Audience)
+}
+
+func TestTokenForAnotherAudience(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		Audience:        "fiagram-gateway",
+		Audiences:       []string{"fiagram-portfolio", "fiagram-market"},
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+
+	token, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId: 66666,
+		Audience:  []string{"fiagram-portfolio"},
+	})
+	require.NoError(t, err)
+
+	// The gateway refuses tokens meant for other services but still
+	// describes them to those services
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	assert.Error(t, err)
+	payload, _, err := tokenLogic.InspectAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fiagram-portfolio"}, payload.Audience)
+
+	token, _, err = tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId: 66666,
+		Audience:  []string{"fiagram-portfolio", "fiagram-gateway"},
+	})
+	require.NoError(t, err)
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	assert.NoError(t, err)
+
+	_, _, err = tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{
+		AccountId: 66666,
+		Audience:  []string{"fiagram-unknown"},
+	})
+	assert.ErrorIs(t, err, logic.ErrInvalidAudience)
+}
+
+func TestTokenRejectsOtherIssuerAndAudience(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		Issuer:          "https://auth.fiagram.test",
+		Audience:        "fiagram-gateway",
+		Audiences:       []string{"fiagram-portfolio"},
+	}
+
+	tokenLogic := newTokenLogic(t, config)
+	ctx := context.Background()
+
+	otherIssuer := config
+	otherIssuer.Issuer = "https://auth.elsewhere.test"
+	token, _, err := newTokenLogic(t, otherIssuer).GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 66666})
+	require.NoError(t, err)
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	assert.Error(t, err)
+	_, _, err = tokenLogic.InspectAccessToken(ctx, token)
+	assert.Error(t, err)
+
+	// A service sharing the key but not known to the gateway
+	otherService := config
+	otherService.Audience = "fiagram-billing"
+	token, _, err = newTokenLogic(t, otherService).GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 66666})
+	require.NoError(t, err)
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	assert.Error(t, err)
+	_, _, err = tokenLogic.InspectAccessToken(ctx, token)
+	assert.Error(t, err)
+
+	// Tokens from before the claims existed are no longer accepted
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":  66666,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	token, err = legacy.SignedString([]byte(config.Secret))
+	require.NoError(t, err)
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, token)
+	assert.Error(t, err)
+}
+
+func TestTokenLeeway(t *testing.T) {
+	config := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		Leeway:          30 * time.Second,
+	}
+
+	issuerClock := testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	token, _, err := newTokenLogicWithClock(t, config, issuerClock).
+		GenerateAccessToken(context.Background(), logic.TokenPayload{AccountId: 66666})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		isValid bool
+	}{
+		{name: "verifier clock behind within leeway", offset: -20 * time.Second, isValid: true},
+		{name: "verifier clock behind beyond leeway", offset: -time.Minute, isValid: false},
+		{name: "expired within leeway", offset: 15*time.Minute + 20*time.Second, isValid: true},
+		{name: "expired beyond leeway", offset: 15*time.Minute + time.Minute, isValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifierClock := testutils.NewFakeClock(issuerClock.Now().Add(tt.offset))
+			tokenLogic := newTokenLogicWithClock(t, config, verifierClock)
+
+			_, _, err := tokenLogic.GetPayloadFromAccessToken(context.Background(), token)
+			if tt.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
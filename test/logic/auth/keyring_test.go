@@ -0,0 +1,207 @@
+package logic_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/Fiagram/gateway/test/testutils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestKeyringRotationKeepsOldKeyUntilTokensExpire(t *testing.T) {
+	ctx := context.Background()
+	clock := testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := configs.Token{
+		Algorithm:       logic.AlgorithmES256,
+		KeysDir:         t.TempDir(),
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+	}
+
+	keyring, err := logic.NewKeyring(config, clock, zap.NewNop())
+	require.NoError(t, err)
+	tokenLogic := logic.NewTokenLogic(config, keyring, clock, zap.NewNop())
+	oldKid := keyring.ActiveKid()
+
+	oldToken, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 1})
+	require.NoError(t, err)
+
+	// Rotate halfway through the lifetime of the old token
+	clock.Advance(5 * time.Minute)
+	newKid, err := keyring.Rotate(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, oldKid, newKid)
+	assert.Equal(t, oldKid, keyring.ActiveKid(), "the new key is only published for verification yet")
+	assert.Len(t, tokenLogic.GetJSONWebKeySet(ctx), 2)
+
+	// The new key signs once every instance has had a reload to pick it up
+	clock.Advance(time.Minute)
+	assert.Equal(t, newKid, keyring.ActiveKid())
+
+	newToken, _, err := tokenLogic.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 2})
+	require.NoError(t, err)
+	assert.Equal(t, newKid, kidOf(t, newToken))
+
+	// Both tokens are verified with the key named in their header
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), payload.AccountId)
+	payload, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, newToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), payload.AccountId)
+	assert.Len(t, tokenLogic.GetJSONWebKeySet(ctx), 2)
+
+	// Once the old key has been retired for a full access token TTL it is pruned
+	clock.Advance(config.AccessTokenTTL + time.Second)
+	require.NoError(t, keyring.Refresh(ctx))
+	assert.Equal(t, []string{newKid}, keyring.Kids())
+	assert.NoFileExists(t, filepath.Join(config.KeysDir, oldKid+".pem"))
+
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, newToken)
+	assert.Error(t, err, "the new token has expired by now as well")
+	jwks := tokenLogic.GetJSONWebKeySet(ctx)
+	require.Len(t, jwks, 1)
+	assert.Equal(t, newKid, jwks[0].Kid)
+}
+
+func TestKeyringScheduledRotation(t *testing.T) {
+	ctx := context.Background()
+	clock := testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := configs.Token{
+		Algorithm:        logic.AlgorithmHS256,
+		KeysDir:          t.TempDir(),
+		RotationInterval: 24 * time.Hour,
+		AccessTokenTTL:   15 * time.Minute,
+	}
+
+	keyring, err := logic.NewKeyring(config, clock, zap.NewNop())
+	require.NoError(t, err)
+	firstKid := keyring.ActiveKid()
+
+	clock.Advance(23 * time.Hour)
+	require.NoError(t, keyring.Refresh(ctx))
+	assert.Equal(t, firstKid, keyring.ActiveKid(), "rotation is not due yet")
+
+	clock.Advance(time.Hour)
+	require.NoError(t, keyring.Refresh(ctx))
+	assert.Equal(t, firstKid, keyring.ActiveKid(), "the rotated key is not active yet")
+	assert.Len(t, keyring.Kids(), 2)
+
+	// The pending key is not rotated again while it waits to activate
+	clock.Advance(time.Minute)
+	require.NoError(t, keyring.Refresh(ctx))
+	assert.NotEqual(t, firstKid, keyring.ActiveKid())
+	assert.Len(t, keyring.Kids(), 2)
+}
+
+func TestKeyringSharesRotationThroughKeysDir(t *testing.T) {
+	ctx := context.Background()
+	clock := testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := configs.Token{
+		Algorithm:      logic.AlgorithmEdDSA,
+		KeysDir:        t.TempDir(),
+		AccessTokenTTL: 15 * time.Minute,
+	}
+
+	// The running gateway and the CLI see the same keys directory
+	serverKeyring, err := logic.NewKeyring(config, clock, zap.NewNop())
+	require.NoError(t, err)
+	server := logic.NewTokenLogic(config, serverKeyring, clock, zap.NewNop())
+
+	cliKeyring, err := logic.NewKeyring(config, clock, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, serverKeyring.ActiveKid(), cliKeyring.ActiveKid())
+
+	clock.Advance(time.Minute)
+	rotatedKid, err := cliKeyring.Rotate(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, rotatedKid, serverKeyring.ActiveKid())
+
+	// The server verifies the key from its next reload on and signs with
+	// it once it activates
+	require.NoError(t, serverKeyring.Refresh(ctx))
+	assert.Contains(t, serverKeyring.Kids(), rotatedKid)
+	assert.NotEqual(t, rotatedKid, serverKeyring.ActiveKid())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, rotatedKid, serverKeyring.ActiveKid())
+	assert.Equal(t, rotatedKid, cliKeyring.ActiveKid())
+
+	token, _, err := server.GenerateAccessToken(ctx, logic.TokenPayload{AccountId: 7})
+	require.NoError(t, err)
+	assert.Equal(t, rotatedKid, kidOf(t, token))
+}
+
+func TestKeyringRejectsUnknownKid(t *testing.T) {
+	ctx := context.Background()
+	clock := testutils.NewFakeClock(time.Now())
+	config := configs.Token{
+		Algorithm:      logic.AlgorithmHS256,
+		Secret:         "test-secret-key-123",
+		AccessTokenTTL: 15 * time.Minute,
+	}
+	tokenLogic := newTokenLogicWithClock(t, config, clock)
+
+	// Signed with the right secret but naming a key the keyring does not hold
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":  1,
+		"exp": clock.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = "unknown"
+	tokenString, err := token.SignedString([]byte(config.Secret))
+	require.NoError(t, err)
+
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, tokenString)
+	assert.Error(t, err)
+}
+
+func TestKeyringRotateRequiresKeysDir(t *testing.T) {
+	config := configs.Token{
+		Algorithm:      logic.AlgorithmHS256,
+		Secret:         "test-secret-key-123",
+		AccessTokenTTL: 15 * time.Minute,
+	}
+	keyring, err := logic.NewKeyring(config, utils.NewClock(), zap.NewNop())
+	require.NoError(t, err)
+
+	_, err = keyring.Rotate(context.Background())
+	assert.ErrorIs(t, err, logic.ErrKeysDirNotConfigured)
+}
+
+func TestKeyringRejectsTamperedKeyFile(t *testing.T) {
+	config := configs.Token{
+		Algorithm:      logic.AlgorithmES256,
+		KeysDir:        t.TempDir(),
+		AccessTokenTTL: 15 * time.Minute,
+	}
+	keyring, err := logic.NewKeyring(config, utils.NewClock(), zap.NewNop())
+	require.NoError(t, err)
+
+	// A key file whose name does not match its thumbprint is refused
+	err = os.Rename(
+		filepath.Join(config.KeysDir, keyring.ActiveKid()+".pem"),
+		filepath.Join(config.KeysDir, "renamed.pem"),
+	)
+	require.NoError(t, err)
+
+	_, err = logic.NewKeyring(config, utils.NewClock(), zap.NewNop())
+	assert.Error(t, err)
+}
+
+// Helper function to read the kid header without verifying the token
+func kidOf(t *testing.T, token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
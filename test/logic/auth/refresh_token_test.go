@@ -7,48 +7,42 @@ import (
 	"time"
 
 	"github.com/Fiagram/gateway/internal/configs"
-	logic "github.com/Fiagram/gateway/internal/logic/token"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"go.uber.org/zap"
 )
 
 func TestGenerateRefreshToken(t *testing.T) {
-	logger := zap.NewNop()
 	config := configs.Token{
 		Secret:          "test-secret-key-123",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 	ctx := context.Background()
 
 	// Generate refresh token
-	token, expiresAt, err := tokenLogic.GenerateRefreshToken(ctx)
+	token, err := tokenLogic.GenerateRefreshToken(ctx)
 
 	require.NoError(t, err)
 	assert.NotEmpty(t, token)
-	assert.True(t, expiresAt.After(time.Now()))
-	assert.True(t, expiresAt.Before(time.Now().Add(config.RefreshTokenTTL+time.Second)))
 }
 
 func TestGenerateRefreshTokenUniqueness(t *testing.T) {
-	logger := zap.NewNop()
 	config := configs.Token{
 		Secret:          "test-secret-key-123",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 	ctx := context.Background()
 
 	// Generate multiple refresh tokens
-	token1, _, err1 := tokenLogic.GenerateRefreshToken(ctx)
+	token1, err1 := tokenLogic.GenerateRefreshToken(ctx)
 	require.NoError(t, err1)
 
-	token2, _, err2 := tokenLogic.GenerateRefreshToken(ctx)
+	token2, err2 := tokenLogic.GenerateRefreshToken(ctx)
 	require.NoError(t, err2)
 
 	// Tokens should be unique (different random bytes)
@@ -56,17 +50,16 @@ func TestGenerateRefreshTokenUniqueness(t *testing.T) {
 }
 
 func TestGenerateRefreshTokenFormat(t *testing.T) {
-	logger := zap.NewNop()
 	config := configs.Token{
 		Secret:          "test-secret-key-123",
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour,
 	}
 
-	tokenLogic := logic.NewTokenLogic(config, logger)
+	tokenLogic := newTokenLogic(t, config)
 	ctx := context.Background()
 
-	token, _, err := tokenLogic.GenerateRefreshToken(ctx)
+	token, err := tokenLogic.GenerateRefreshToken(ctx)
 	require.NoError(t, err)
 
 	// Verify token is valid base64 by attempting to decode
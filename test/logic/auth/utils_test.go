@@ -0,0 +1,24 @@
+package logic_test
+
+import (
+	"testing"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTokenLogic(t *testing.T, config configs.Token) logic.Token {
+	return newTokenLogicWithClock(t, config, utils.NewClock())
+}
+
+func newTokenLogicWithClock(t *testing.T, config configs.Token, clock utils.Clock) logic.Token {
+	logger := zap.NewNop()
+
+	keyring, err := logic.NewKeyring(config, clock, logger)
+	require.NoError(t, err)
+
+	return logic.NewTokenLogic(config, keyring, clock, logger)
+}
@@ -0,0 +1,187 @@
+package logic_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const refreshUri = "https://auth.example.com/api/v1/auth/token/refresh"
+
+// proofKey is the key of a client along with its public JWK
+type proofKey struct {
+	private *ecdsa.PrivateKey
+	jwk     token_logic.JSONWebKey
+}
+
+func newProofKey(t *testing.T) proofKey {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	point, err := private.PublicKey.Bytes()
+	require.NoError(t, err)
+	return proofKey{
+		private: private,
+		jwk: token_logic.JSONWebKey{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+			Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+		},
+	}
+}
+
+// Helper function to sign a proof, edit changes the claims and headers
+// before signing
+func (k proofKey) proof(t *testing.T, method string, uri string, edit func(token *jwt.Token)) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"jti": rand.Text(),
+		"htm": method,
+		"htu": uri,
+		"iat": clock.Now().Unix(),
+	})
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = k.jwk
+	if edit != nil {
+		edit(token)
+	}
+	proof, err := token.SignedString(k.private)
+	require.NoError(t, err)
+	return proof
+}
+
+func TestVerifyProof(t *testing.T) {
+	ctx := context.Background()
+	key := newProofKey(t)
+	expected, err := key.jwk.Thumbprint()
+	require.NoError(t, err)
+
+	proof := key.proof(t, "POST", refreshUri, nil)
+	thumbprint, err := dpopLogic.VerifyProof(ctx, proof, "POST", refreshUri+"?ignored=1", "")
+	require.NoError(t, err)
+	assert.Equal(t, expected, thumbprint)
+
+	// A proof is accepted once
+	_, err = dpopLogic.VerifyProof(ctx, proof, "POST", refreshUri, "")
+	assert.ErrorIs(t, err, dpop_logic.ErrInvalidProof)
+}
+
+func TestVerifyProofWithAccessToken(t *testing.T) {
+	ctx := context.Background()
+	key := newProofKey(t)
+	uri := "https://auth.example.com/api/v1/users/me"
+	sum := sha256.Sum256([]byte("access-token"))
+	withAth := func(ath string) func(token *jwt.Token) {
+		return func(token *jwt.Token) {
+			token.Claims.(jwt.MapClaims)["ath"] = ath
+		}
+	}
+
+	_, err := dpopLogic.VerifyProof(ctx, key.proof(t, "GET", uri, nil), "GET", uri, "access-token")
+	assert.ErrorIs(t, err, dpop_logic.ErrInvalidProof, "ath is required with an access token")
+
+	_, err = dpopLogic.VerifyProof(ctx, key.proof(t, "GET", uri, withAth("bm90IHRoZSBoYXNo")),
+		"GET", uri, "access-token")
+	assert.ErrorIs(t, err, dpop_logic.ErrInvalidProof)
+
+	_, err = dpopLogic.VerifyProof(ctx,
+		key.proof(t, "GET", uri, withAth(base64.RawURLEncoding.EncodeToString(sum[:]))),
+		"GET", uri, "access-token")
+	assert.NoError(t, err)
+}
+
+func TestVerifyProofRefusesInvalidProofs(t *testing.T) {
+	ctx := context.Background()
+	key := newProofKey(t)
+
+	tests := []struct {
+		name  string
+		proof string
+	}{
+		{
+			name:  "not a jwt",
+			proof: "not-a-proof",
+		},
+		{
+			name:  "other method",
+			proof: key.proof(t, "GET", refreshUri, nil),
+		},
+		{
+			name:  "other uri",
+			proof: key.proof(t, "POST", "https://auth.example.com/api/v1/auth/signin", nil),
+		},
+		{
+			name:  "other host",
+			proof: key.proof(t, "POST", "https://evil.example.com/api/v1/auth/token/refresh", nil),
+		},
+		{
+			name: "stale",
+			proof: key.proof(t, "POST", refreshUri, func(token *jwt.Token) {
+				token.Claims.(jwt.MapClaims)["iat"] = clock.Now().Add(-2 * time.Minute).Unix()
+			}),
+		},
+		{
+			name: "from the future",
+			proof: key.proof(t, "POST", refreshUri, func(token *jwt.Token) {
+				token.Claims.(jwt.MapClaims)["iat"] = clock.Now().Add(2 * time.Minute).Unix()
+			}),
+		},
+		{
+			name: "without jti",
+			proof: key.proof(t, "POST", refreshUri, func(token *jwt.Token) {
+				delete(token.Claims.(jwt.MapClaims), "jti")
+			}),
+		},
+		{
+			name: "wrong typ",
+			proof: key.proof(t, "POST", refreshUri, func(token *jwt.Token) {
+				token.Header["typ"] = "JWT"
+			}),
+		},
+		{
+			name: "without jwk",
+			proof: key.proof(t, "POST", refreshUri, func(token *jwt.Token) {
+				delete(token.Header, "jwk")
+			}),
+		},
+		{
+			name: "signed by another key",
+			proof: key.proof(t, "POST", refreshUri, func(token *jwt.Token) {
+				token.Header["jwk"] = newProofKey(t).jwk
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dpopLogic.VerifyProof(ctx, tt.proof, "POST", refreshUri, "")
+			assert.ErrorIs(t, err, dpop_logic.ErrInvalidProof)
+		})
+	}
+}
+
+func TestVerifyProofRefusesSymmetricAlgorithms(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti": rand.Text(),
+		"htm": "POST",
+		"htu": refreshUri,
+		"iat": clock.Now().Unix(),
+	})
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = map[string]string{"kty": "oct", "k": "c2VjcmV0"}
+	proof, err := token.SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	_, err = dpopLogic.VerifyProof(context.Background(), proof, "POST", refreshUri, "")
+	assert.ErrorIs(t, err, dpop_logic.ErrInvalidProof)
+}
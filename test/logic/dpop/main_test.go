@@ -0,0 +1,33 @@
+package logic_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	dpop_logic "github.com/Fiagram/gateway/internal/logic/dpop"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+)
+
+var (
+	clock     *testutils.FakeClock
+	dpopLogic dpop_logic.Dpop
+)
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+
+	dpopLogic = dpop_logic.NewDpopLogic(
+		configs.Dpop{ProofMaxAge: time.Minute},
+		cache.NewDpopProof(client, logger),
+		clock,
+		logger,
+	)
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,263 @@
+package logic_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	federation_logic "github.com/Fiagram/gateway/internal/logic/federation"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signIn runs a federated sign-in of the user with the claims at the stub
+func signIn(t *testing.T, providerId string, claims jwt.MapClaims) (federation_logic.LoginResult, error) {
+	return signInFrom(t, providerId, claims, "203.0.113.7")
+}
+
+// signInFrom runs a federated sign-in from the given client IP
+func signInFrom(t *testing.T, providerId string, claims jwt.MapClaims, ipAddress string) (federation_logic.LoginResult, error) {
+	authorizationUrl, err := federationLogic.StartLogin(context.Background(), providerId, true)
+	require.NoError(t, err)
+
+	code, state := stub.Authorize(authorizationUrl, claims)
+	return federationLogic.CompleteLogin(context.Background(), state, code, ipAddress)
+}
+
+func TestListProviders(t *testing.T) {
+	providers := federationLogic.ListProviders(context.Background())
+	assert.Equal(t, []federation_logic.ProviderInfo{
+		{Id: "corporate", Name: "Corporate SSO"},
+		{Id: "social", Name: "Social"},
+	}, providers)
+}
+
+func TestStartLogin(t *testing.T) {
+	authorizationUrl, err := federationLogic.StartLogin(context.Background(), "corporate", false)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authorizationUrl)
+	require.NoError(t, err)
+	assert.Equal(t, stub.server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	query := parsed.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, clientId, query.Get("client_id"))
+	assert.Equal(t, redirectUri, query.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.NotEmpty(t, query.Get("code_challenge"))
+	assert.NotEmpty(t, query.Get("state"))
+	assert.NotEmpty(t, query.Get("nonce"))
+
+	_, err = federationLogic.StartLogin(context.Background(), "unknown", false)
+	assert.ErrorIs(t, err, federation_logic.ErrUnknownProvider)
+}
+
+func TestFirstLoginCreatesAccount(t *testing.T) {
+	claims := jwt.MapClaims{
+		"sub":                "social-user-1",
+		"name":               "Dave Bowman",
+		"preferred_username": "Dave.Bowman",
+		"email":              "dave@example.com",
+		"email_verified":     true,
+	}
+
+	result, err := signIn(t, "social", claims)
+	require.NoError(t, err)
+	assert.True(t, result.IsCreated)
+	assert.True(t, result.IsRememberMe)
+
+	account := accounts.Get(result.AccountId)
+	require.NotNil(t, account)
+	assert.Equal(t, "dave.bowman", account.Username)
+	assert.Equal(t, "Dave Bowman", account.Fullname)
+	assert.Equal(t, "dave@example.com", account.Email)
+	assert.Equal(t, account_service.AccountInfo_MEMBER, account.Role)
+
+	isVerified, err := verificationLogic.IsVerified(context.Background(), result.AccountId)
+	require.NoError(t, err)
+	assert.True(t, isVerified, "the provider verified the email")
+
+	// The next sign-in finds the linked account, even with another email
+	count := accounts.Count()
+	claims["email"] = "dave@elsewhere.example.com"
+	again, err := signIn(t, "social", claims)
+	require.NoError(t, err)
+	assert.False(t, again.IsCreated)
+	assert.Equal(t, result.AccountId, again.AccountId)
+	assert.Equal(t, count, accounts.Count())
+}
+
+func TestUnverifiedEmailIsVerifiedByMail(t *testing.T) {
+	result, err := signIn(t, "social", jwt.MapClaims{
+		"sub":   "social-user-2",
+		"email": "erin.smith@example.com",
+	})
+	require.NoError(t, err)
+	assert.True(t, result.IsCreated)
+	assert.Equal(t, "erin.smith", accounts.Get(result.AccountId).Username)
+
+	isVerified, err := verificationLogic.IsVerified(context.Background(), result.AccountId)
+	require.NoError(t, err)
+	assert.False(t, isVerified)
+}
+
+func TestUsernameFallback(t *testing.T) {
+	// alice is taken and "bob" is too short
+	result, err := signIn(t, "social", jwt.MapClaims{
+		"sub":                "social-user-3",
+		"preferred_username": "alice",
+		"email":              "bob@example.com",
+	})
+	require.NoError(t, err)
+
+	username := accounts.Get(result.AccountId).Username
+	assert.Regexp(t, `^fed_[0-9a-f]{16}$`, username)
+}
+
+func TestLinkByVerifiedEmail(t *testing.T) {
+	// An unverified email is not enough to take over an account
+	result, err := signIn(t, "corporate", jwt.MapClaims{
+		"sub":   "corporate-user-1",
+		"email": "alice@example.com",
+	})
+	require.NoError(t, err)
+	assert.True(t, result.IsCreated)
+	assert.NotEqual(t, uint64(1), result.AccountId)
+	assert.Empty(t, accounts.Get(result.AccountId).Email, "the email of another account is not stored")
+
+	result, err = signIn(t, "corporate", jwt.MapClaims{
+		"sub":            "corporate-user-2",
+		"email":          "ALICE@example.com",
+		"email_verified": true,
+	})
+	require.NoError(t, err)
+	assert.False(t, result.IsCreated)
+	assert.Equal(t, uint64(1), result.AccountId)
+
+	// Providers not trusted with emails never link by email
+	result, err = signIn(t, "social", jwt.MapClaims{
+		"sub":            "social-user-4",
+		"email":          "alice@example.com",
+		"email_verified": true,
+	})
+	require.NoError(t, err)
+	assert.True(t, result.IsCreated)
+	assert.Empty(t, accounts.Get(result.AccountId).Email)
+}
+
+func TestNoLinkByAmbiguousEmail(t *testing.T) {
+	accounts.Add(&account_service.AccountInfo{Username: "carol", Email: "shared@example.com"})
+	accounts.Add(&account_service.AccountInfo{Username: "carla", Email: "SHARED@example.com"})
+
+	count := accounts.Count()
+	_, err := signIn(t, "corporate", jwt.MapClaims{
+		"sub":            "corporate-user-3",
+		"email":          "shared@example.com",
+		"email_verified": true,
+	})
+	assert.ErrorIs(t, err, federation_logic.ErrEmailNotUnique)
+	assert.Equal(t, count, accounts.Count())
+}
+
+func TestNoAccountCreatedUnlessRegistrationIsOpen(t *testing.T) {
+	invites.SetMode(configs.RegistrationModeInviteOnly)
+	defer invites.SetMode(configs.RegistrationModeOpen)
+
+	count := accounts.Count()
+	_, err := signIn(t, "social", jwt.MapClaims{
+		"sub":            "social-user-9",
+		"email":          "frank@example.com",
+		"email_verified": true,
+	})
+	assert.ErrorIs(t, err, federation_logic.ErrSignUpClosed)
+	assert.Equal(t, count, accounts.Count())
+
+	// Existing accounts are still linked
+	result, err := signIn(t, "corporate", jwt.MapClaims{
+		"sub":            "corporate-user-9",
+		"email":          "alice@example.com",
+		"email_verified": true,
+	})
+	require.NoError(t, err)
+	assert.False(t, result.IsCreated)
+	assert.Equal(t, uint64(1), result.AccountId)
+}
+
+func TestStateIsSingleUse(t *testing.T) {
+	authorizationUrl, err := federationLogic.StartLogin(context.Background(), "social", false)
+	require.NoError(t, err)
+
+	code, state := stub.Authorize(authorizationUrl, jwt.MapClaims{"sub": "social-user-5"})
+	_, err = federationLogic.CompleteLogin(context.Background(), state, code, "203.0.113.7")
+	require.NoError(t, err)
+
+	_, err = federationLogic.CompleteLogin(context.Background(), state, code, "203.0.113.7")
+	assert.ErrorIs(t, err, federation_logic.ErrInvalidState)
+
+	_, err = federationLogic.CompleteLogin(context.Background(), "forged-state", code, "203.0.113.7")
+	assert.ErrorIs(t, err, federation_logic.ErrInvalidState)
+}
+
+func TestExpiredState(t *testing.T) {
+	authorizationUrl, err := federationLogic.StartLogin(context.Background(), "social", false)
+	require.NoError(t, err)
+
+	code, state := stub.Authorize(authorizationUrl, jwt.MapClaims{"sub": "social-user-6"})
+	clock.Advance(11 * time.Minute)
+
+	_, err = federationLogic.CompleteLogin(context.Background(), state, code, "203.0.113.7")
+	assert.ErrorIs(t, err, federation_logic.ErrInvalidState)
+}
+
+func TestCodeRejected(t *testing.T) {
+	authorizationUrl, err := federationLogic.StartLogin(context.Background(), "social", false)
+	require.NoError(t, err)
+
+	_, state := stub.Authorize(authorizationUrl, jwt.MapClaims{"sub": "social-user-7"})
+	_, err = federationLogic.CompleteLogin(context.Background(), state, "forged-code", "203.0.113.7")
+	assert.ErrorIs(t, err, federation_logic.ErrCodeRejected)
+}
+
+func TestInvalidIdToken(t *testing.T) {
+	testCases := map[string]jwt.MapClaims{
+		"wrong nonce":    {"nonce": "another-nonce"},
+		"wrong audience": {"aud": "another-client"},
+		"wrong issuer":   {"iss": "https://evil.example.com"},
+		"expired":        {"exp": clock.Now().Add(-time.Hour).Unix()},
+		"no subject":     {"sub": ""},
+		"other party":    {"aud": []string{clientId, "another-client"}, "azp": "another-client"},
+	}
+
+	for name, override := range testCases {
+		t.Run(name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "social-user-8"}
+			for claim, value := range override {
+				claims[claim] = value
+			}
+
+			_, err := signIn(t, "social", claims)
+			assert.ErrorIs(t, err, federation_logic.ErrInvalidIdToken)
+		})
+	}
+}
+
+func TestFirstLoginsAreLimitedPerIp(t *testing.T) {
+	for i := range 20 {
+		_, err := signInFrom(t, "social", jwt.MapClaims{"sub": fmt.Sprintf("crowd-user-%d", i)}, "198.51.100.10")
+		require.NoError(t, err)
+	}
+
+	_, err := signInFrom(t, "social", jwt.MapClaims{"sub": "crowd-user-20"}, "198.51.100.10")
+	assert.ErrorIs(t, err, federation_logic.ErrTooManyLinks)
+
+	// Linked external accounts still sign in
+	_, err = signInFrom(t, "social", jwt.MapClaims{"sub": "crowd-user-0"}, "198.51.100.10")
+	assert.NoError(t, err)
+}
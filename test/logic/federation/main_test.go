@@ -0,0 +1,334 @@
+package logic_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/idp"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	federation_logic "github.com/Fiagram/gateway/internal/logic/federation"
+	invite_logic "github.com/Fiagram/gateway/internal/logic/invite"
+	verification_logic "github.com/Fiagram/gateway/internal/logic/verification"
+	"github.com/Fiagram/gateway/test/testutils"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+const (
+	redirectUri  = "https://app.example.com/federation/callback"
+	clientId     = "fiagram"
+	clientSecret = "stub-client-secret"
+)
+
+var (
+	clock             *testutils.FakeClock
+	accounts          *fakeAccounts
+	invites           *fakeInvite
+	stub              *stubIdp
+	verificationLogic verification_logic.EmailVerification
+	federationLogic   federation_logic.Federation
+)
+
+// fakeInvite is an invite logic whose registration mode can be switched
+type fakeInvite struct {
+	invite_logic.Invite
+	mode  configs.RegistrationMode
+	mutex sync.Mutex
+}
+
+func (f *fakeInvite) Mode() configs.RegistrationMode {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.mode
+}
+
+func (f *fakeInvite) SetMode(mode configs.RegistrationMode) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.mode = mode
+}
+
+// fakeAccounts is an account service holding the accounts in memory
+type fakeAccounts struct {
+	account_service.AccountServiceClient
+	accounts map[uint64]*account_service.AccountInfo
+	mutex    sync.Mutex
+}
+
+func (f *fakeAccounts) CreateAccount(
+	_ context.Context,
+	in *account_service.CreateAccountRequest,
+	_ ...grpc.CallOption,
+) (*account_service.CreateAccountResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	accountId := uint64(len(f.accounts) + 1)
+	f.accounts[accountId] = in.AccountInfo
+	return &account_service.CreateAccountResponse{AccountId: accountId}, nil
+}
+
+func (f *fakeAccounts) IsUsernameTaken(
+	_ context.Context,
+	in *account_service.IsUsernameTakenRequest,
+	_ ...grpc.CallOption,
+) (*account_service.IsUsernameTakenResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, account := range f.accounts {
+		if account.Username == in.Username {
+			return &account_service.IsUsernameTakenResponse{IsTaken: true}, nil
+		}
+	}
+	return &account_service.IsUsernameTakenResponse{}, nil
+}
+
+func (f *fakeAccounts) GetAccountAll(
+	_ context.Context,
+	_ *account_service.GetAccountAllRequest,
+	_ ...grpc.CallOption,
+) (*account_service.GetAccountAllResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	resp := &account_service.GetAccountAllResponse{}
+	for accountId, account := range f.accounts {
+		resp.AccountIdList = append(resp.AccountIdList, accountId)
+		resp.AccountInfoList = append(resp.AccountInfoList, account)
+	}
+	return resp, nil
+}
+
+// Add stores an account the way the account service would, which does not
+// enforce unique emails
+func (f *fakeAccounts) Add(account *account_service.AccountInfo) uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	accountId := uint64(len(f.accounts) + 1)
+	f.accounts[accountId] = account
+	return accountId
+}
+
+func (f *fakeAccounts) Get(accountId uint64) *account_service.AccountInfo {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.accounts[accountId]
+}
+
+func (f *fakeAccounts) Count() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.accounts)
+}
+
+func (f *fakeAccounts) Close() error {
+	return nil
+}
+
+// stubIdp is an in-process OpenID Connect provider. Users sign in at it
+// through Authorize, which answers the code and the state the provider
+// would hand to the redirect_uri.
+type stubIdp struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	codes  map[string]stubCode
+	mutex  sync.Mutex
+}
+
+type stubCode struct {
+	redirectUri   string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newStubIdp() *stubIdp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &stubIdp{
+		key:   key,
+		kid:   "stub-key",
+		codes: make(map[string]stubCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, idp.Metadata{
+			Issuer:                s.server.URL,
+			AuthorizationEndpoint: s.server.URL + "/authorize",
+			TokenEndpoint:         s.server.URL + "/token",
+			JwksUri:               s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, idp.JSONWebKeySet{Keys: []idp.JSONWebKey{{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: s.kid,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", s.token)
+	s.server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Authorize signs the user with the claims in, the claims override the
+// ones the stub sets.
+func (s *stubIdp) Authorize(authorizationUrl string, claims jwt.MapClaims) (code string, state string) {
+	parsed, err := url.Parse(authorizationUrl)
+	if err != nil {
+		panic(err)
+	}
+	query := parsed.Query()
+
+	idTokenClaims := jwt.MapClaims{
+		"iss":   s.server.URL,
+		"aud":   query.Get("client_id"),
+		"iat":   clock.Now().Unix(),
+		"exp":   clock.Now().Add(5 * time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idTokenClaims[name] = value
+	}
+
+	code = rand.Text()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.codes[code] = stubCode{
+		redirectUri:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        idTokenClaims,
+	}
+	return code, query.Get("state")
+}
+
+func (s *stubIdp) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != clientId || secret != clientSecret {
+		writeJSON(w, http.StatusUnauthorized, idp.TokenError{Code: "invalid_client"})
+		return
+	}
+
+	s.mutex.Lock()
+	code, ok := s.codes[r.PostFormValue("code")]
+	delete(s.codes, r.PostFormValue("code"))
+	s.mutex.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok ||
+		r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != code.redirectUri ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != code.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, idp.TokenError{Code: "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, code.claims)
+	token.Header["kid"] = s.kid
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, idp.TokenError{Code: "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, idp.TokenResponse{
+		AccessToken: rand.Text(),
+		TokenType:   "Bearer",
+		IdToken:     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+	stub = newStubIdp()
+
+	outboxDir, err := os.MkdirTemp("", "outbox")
+	if err != nil {
+		panic(err)
+	}
+
+	accounts = &fakeAccounts{
+		accounts: map[uint64]*account_service.AccountInfo{
+			1: {Username: "alice", Fullname: "Alice", Email: "alice@example.com", Role: account_service.AccountInfo_MEMBER},
+		},
+	}
+	verificationLogic = verification_logic.NewEmailVerificationLogic(
+		configs.EmailVerification{Url: "https://app.example.com/verify-email"},
+		cache.NewEmailVerification(client, logger),
+		mail.NewFileSender("Fiagram <no-reply@example.com>", filepath.Join(outboxDir, "outbox.jsonl"), logger),
+		clock,
+		logger,
+	)
+
+	invites = &fakeInvite{mode: configs.RegistrationModeOpen}
+
+	federationLogic = federation_logic.NewFederationLogic(
+		configs.Federation{
+			RedirectUri: redirectUri,
+			StateTTL:    10 * time.Minute,
+			IpMaxLinks:  20,
+			Window:      time.Hour,
+			Providers: []configs.FederatedProvider{
+				{
+					Id:           "corporate",
+					Name:         "Corporate SSO",
+					Issuer:       stub.server.URL,
+					ClientId:     clientId,
+					ClientSecret: clientSecret,
+					LinkByEmail:  true,
+				},
+				{
+					Id:           "social",
+					Name:         "Social",
+					Issuer:       stub.server.URL,
+					ClientId:     clientId,
+					ClientSecret: clientSecret,
+				},
+			},
+		},
+		cache.NewFederatedLoginState(client, logger),
+		cache.NewFederatedIdentity(client, logger),
+		idp.NewClient(logger),
+		accounts,
+		verificationLogic,
+		invites,
+		clock,
+		logger,
+	)
+
+	code := m.Run()
+	stub.server.Close()
+	os.RemoveAll(outboxDir)
+	os.Exit(code)
+}
@@ -0,0 +1,215 @@
+package logic_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	invite_logic "github.com/Fiagram/gateway/internal/logic/invite"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRegistrationMode(t *testing.T) {
+	assert.Equal(t, configs.RegistrationModeInviteOnly, inviteLogic.Mode())
+
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	defaulted, err := invite_logic.NewInviteLogic(configs.Registration{},
+		cache.NewInviteCode(client, logger), clock, logger)
+	require.NoError(t, err)
+	assert.Equal(t, configs.RegistrationModeOpen, defaulted.Mode())
+
+	_, err = invite_logic.NewInviteLogic(configs.Registration{Mode: "invite_only"},
+		cache.NewInviteCode(client, logger), clock, logger)
+	assert.Error(t, err)
+}
+
+func TestSingleUseInviteCode(t *testing.T) {
+	ctx := context.Background()
+
+	code, entry, err := inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(code, invite_logic.CodePrefix+entry.Id+"_"))
+	assert.Equal(t, token_logic.RoleMember, entry.Role)
+	assert.Equal(t, int64(1), entry.MaxUses)
+	assert.Equal(t, uint64(1), entry.CreatedBy)
+	assert.Equal(t, clock.Now().Add(24*time.Hour).Unix(), entry.ExpiresAt)
+	assert.NotContains(t, entry.SecretHash, strings.TrimPrefix(code, invite_logic.CodePrefix+entry.Id+"_"))
+
+	redeemed, err := inviteLogic.Redeem(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, entry.Id, redeemed.Id)
+	assert.Equal(t, int64(1), redeemed.Uses)
+
+	_, err = inviteLogic.Redeem(ctx, code)
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidInviteCode)
+
+	// A used up code is no longer listed
+	entries, err := inviteLogic.List(ctx)
+	require.NoError(t, err)
+	for _, listed := range entries {
+		assert.NotEqual(t, entry.Id, listed.Id)
+	}
+}
+
+func TestMultiUseInviteCodeUnderConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	code, _, err := inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1, MaxUses: 3})
+	require.NoError(t, err)
+
+	var redeemed atomic.Int64
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := inviteLogic.Redeem(ctx, code); err == nil {
+				redeemed.Add(1)
+			} else {
+				assert.ErrorIs(t, err, invite_logic.ErrInvalidInviteCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(3), redeemed.Load())
+}
+
+func TestReleaseInviteCode(t *testing.T) {
+	ctx := context.Background()
+
+	// A sign-up failing after the redeem gives the last use back
+	code, entry, err := inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1})
+	require.NoError(t, err)
+	redeemed, err := inviteLogic.Redeem(ctx, code)
+	require.NoError(t, err)
+	require.NoError(t, inviteLogic.Release(ctx, redeemed))
+
+	entries, err := inviteLogic.List(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, entries, entry, "a released code is listed again")
+
+	redeemed, err = inviteLogic.Redeem(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), redeemed.Uses)
+	_, err = inviteLogic.Redeem(ctx, code)
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidInviteCode)
+
+	// Only the released use comes back to a multi-use code
+	code, _, err = inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1, MaxUses: 2})
+	require.NoError(t, err)
+	redeemed, err = inviteLogic.Redeem(ctx, code)
+	require.NoError(t, err)
+	require.NoError(t, inviteLogic.Release(ctx, redeemed))
+	for expected := int64(1); expected <= 2; expected++ {
+		redeemed, err = inviteLogic.Redeem(ctx, code)
+		require.NoError(t, err)
+		assert.Equal(t, expected, redeemed.Uses)
+	}
+	_, err = inviteLogic.Redeem(ctx, code)
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidInviteCode)
+}
+
+func TestInviteCodePreassignsRole(t *testing.T) {
+	ctx := context.Background()
+
+	code, entry, err := inviteLogic.Create(ctx, invite_logic.CreateParams{
+		CreatedBy: 1,
+		Role:      token_logic.RoleAdmin,
+		MaxUses:   2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, token_logic.RoleAdmin, entry.Role)
+
+	entries, err := inviteLogic.List(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, entries, entry)
+
+	redeemed, err := inviteLogic.Redeem(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, token_logic.RoleAdmin, redeemed.Role)
+}
+
+func TestInviteCodeExpires(t *testing.T) {
+	ctx := context.Background()
+
+	code, _, err := inviteLogic.Create(ctx, invite_logic.CreateParams{
+		CreatedBy: 1,
+		ExpiresAt: clock.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	clock.Advance(time.Hour)
+	_, err = inviteLogic.Redeem(ctx, code)
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidInviteCode)
+}
+
+func TestInvalidInviteCodeParams(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1, Role: "owner"})
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidRole)
+
+	_, _, err = inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1, MaxUses: -1})
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidMaxUses)
+
+	_, _, err = inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1, MaxUses: 10001})
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidMaxUses)
+
+	_, _, err = inviteLogic.Create(ctx, invite_logic.CreateParams{
+		CreatedBy: 1,
+		ExpiresAt: clock.Now().Add(-time.Minute),
+	})
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidExpiry)
+
+	// Past the max lifetime
+	_, _, err = inviteLogic.Create(ctx, invite_logic.CreateParams{
+		CreatedBy: 1,
+		ExpiresAt: clock.Now().Add(8 * 24 * time.Hour),
+	})
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidExpiry)
+}
+
+func TestInvalidInviteCodes(t *testing.T) {
+	ctx := context.Background()
+
+	code, entry, err := inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1})
+	require.NoError(t, err)
+
+	for _, invalid := range []string{
+		"",
+		"not-a-code",
+		invite_logic.CodePrefix + entry.Id,
+		invite_logic.CodePrefix + entry.Id + "_wrong-secret",
+		invite_logic.CodePrefix + "0000000000000000_" + strings.TrimPrefix(code, invite_logic.CodePrefix+entry.Id+"_"),
+	} {
+		_, err := inviteLogic.Redeem(ctx, invalid)
+		assert.ErrorIs(t, err, invite_logic.ErrInvalidInviteCode, invalid)
+	}
+
+	// Wrong secrets do not use the code up
+	_, err = inviteLogic.Redeem(ctx, code)
+	assert.NoError(t, err)
+}
+
+func TestRevokeInviteCode(t *testing.T) {
+	ctx := context.Background()
+
+	code, entry, err := inviteLogic.Create(ctx, invite_logic.CreateParams{CreatedBy: 1, MaxUses: 5})
+	require.NoError(t, err)
+
+	require.NoError(t, inviteLogic.Revoke(ctx, entry.Id))
+	assert.ErrorIs(t, inviteLogic.Revoke(ctx, entry.Id), invite_logic.ErrInviteNotFound)
+
+	_, err = inviteLogic.Redeem(ctx, code)
+	assert.ErrorIs(t, err, invite_logic.ErrInvalidInviteCode)
+}
@@ -0,0 +1,41 @@
+package logic_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	invite_logic "github.com/Fiagram/gateway/internal/logic/invite"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+)
+
+var (
+	clock       *testutils.FakeClock
+	inviteLogic invite_logic.Invite
+)
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+
+	var err error
+	inviteLogic, err = invite_logic.NewInviteLogic(
+		configs.Registration{
+			Mode:             configs.RegistrationModeInviteOnly,
+			InviteCodeTTL:    24 * time.Hour,
+			MaxInviteCodeTTL: 7 * 24 * time.Hour,
+		},
+		cache.NewInviteCode(client, logger),
+		clock,
+		logger,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
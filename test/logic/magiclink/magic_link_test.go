@@ -0,0 +1,148 @@
+package logic_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	magiclink_logic "github.com/Fiagram/gateway/internal/logic/magiclink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var signInUrlPattern = regexp.MustCompile(`https://\S+`)
+
+// readOutbox returns the mails written to the outbox so far.
+func readOutbox(t *testing.T) []mail.OutboxEntry {
+	file, err := os.Open(outboxFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries := make([]mail.OutboxEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry mail.OutboxEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+// requestMagicLink asks for a link and returns the token of the mailed link.
+func requestMagicLink(t *testing.T, email string, isRememberMe bool) string {
+	sent := len(readOutbox(t))
+	_, err := magicLinkLogic.Request(context.Background(), email, "203.0.113.7", isRememberMe)
+	require.NoError(t, err)
+
+	entries := readOutbox(t)
+	require.Len(t, entries, sent+1)
+	entry := entries[len(entries)-1]
+	assert.Equal(t, email, entry.To)
+
+	signInUrl, err := url.Parse(signInUrlPattern.FindString(entry.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "app.example.com", signInUrl.Host)
+	token := signInUrl.Query().Get("token")
+	require.NotEmpty(t, token)
+	return token
+}
+
+func TestConsumeMagicLink(t *testing.T) {
+	ctx := context.Background()
+
+	token := requestMagicLink(t, "alice@example.com", true)
+	entry, err := magicLinkLogic.Consume(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), entry.AccountId)
+	assert.True(t, entry.IsRememberMe)
+
+	_, err = magicLinkLogic.Consume(ctx, token)
+	assert.ErrorIs(t, err, magiclink_logic.ErrInvalidMagicLink, "a link is single-use")
+}
+
+func TestConsumeMagicLinkConcurrently(t *testing.T) {
+	token := requestMagicLink(t, "bob@example.com", false)
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		successes int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := magicLinkLogic.Consume(context.Background(), token); err == nil {
+				mutex.Lock()
+				successes++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, successes, "a replayed link must not sign in twice")
+}
+
+func TestConsumeExpiredMagicLink(t *testing.T) {
+	token := requestMagicLink(t, "carol@example.com", false)
+
+	clock.Advance(16 * time.Minute)
+	_, err := magicLinkLogic.Consume(context.Background(), token)
+	assert.ErrorIs(t, err, magiclink_logic.ErrInvalidMagicLink)
+}
+
+func TestConsumeInvalidMagicLink(t *testing.T) {
+	_, err := magicLinkLogic.Consume(context.Background(), "not-a-token")
+	assert.ErrorIs(t, err, magiclink_logic.ErrInvalidMagicLink)
+}
+
+func TestRequestMagicLinkForUnknownEmail(t *testing.T) {
+	sent := len(readOutbox(t))
+	_, err := magicLinkLogic.Request(context.Background(), "nobody@example.com", "203.0.113.7", false)
+	require.NoError(t, err)
+	assert.Len(t, readOutbox(t), sent)
+}
+
+func TestRequestMagicLinkRateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := magicLinkLogic.Request(ctx, "mallory@example.com", "198.51.100.8", false)
+		require.NoError(t, err)
+	}
+
+	retryAfter, err := magicLinkLogic.Request(ctx, "Mallory@Example.com", "198.51.100.9", false)
+	assert.ErrorIs(t, err, magiclink_logic.ErrTooManyRequests,
+		"unknown emails are limited as well, the answer must not tell them apart")
+	assert.Equal(t, time.Hour, retryAfter)
+}
+
+func TestRequestMagicLinkIpRateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	for i := range 10 {
+		_, err := magicLinkLogic.Request(ctx, fmt.Sprintf("guess%d@example.com", i), "198.51.100.10", false)
+		require.NoError(t, err)
+	}
+
+	retryAfter, err := magicLinkLogic.Request(ctx, "guess10@example.com", "198.51.100.10", false)
+	assert.ErrorIs(t, err, magiclink_logic.ErrTooManyRequests)
+	assert.Equal(t, time.Hour, retryAfter)
+
+	// Other clients are not affected
+	_, err = magicLinkLogic.Request(ctx, "guess10@example.com", "198.51.100.11", false)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,84 @@
+package logic_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	magiclink_logic "github.com/Fiagram/gateway/internal/logic/magiclink"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+var (
+	clock          *testutils.FakeClock
+	outboxFile     string
+	magicLinkLogic magiclink_logic.MagicLink
+)
+
+// fakeAccounts is an account service holding the emails of the accounts
+type fakeAccounts struct {
+	account_service.AccountServiceClient
+	emails map[uint64]string
+}
+
+func (f *fakeAccounts) GetAccountAll(
+	_ context.Context,
+	_ *account_service.GetAccountAllRequest,
+	_ ...grpc.CallOption,
+) (*account_service.GetAccountAllResponse, error) {
+	resp := &account_service.GetAccountAllResponse{}
+	for accountId, email := range f.emails {
+		resp.AccountIdList = append(resp.AccountIdList, accountId)
+		resp.AccountInfoList = append(resp.AccountInfoList, &account_service.AccountInfo{Email: email})
+	}
+	return resp, nil
+}
+
+func (f *fakeAccounts) Close() error {
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+
+	outboxDir, err := os.MkdirTemp("", "outbox")
+	if err != nil {
+		panic(err)
+	}
+	outboxFile = filepath.Join(outboxDir, "outbox.jsonl")
+
+	magicLinkLogic = magiclink_logic.NewMagicLinkLogic(
+		configs.MagicLink{
+			Url:           "https://app.example.com/magic-link",
+			TokenTTL:      15 * time.Minute,
+			MaxRequests:   3,
+			IpMaxRequests: 10,
+			Window:        time.Hour,
+		},
+		cache.NewMagicLinkToken(client, logger),
+		&fakeAccounts{
+			emails: map[uint64]string{
+				1: "alice@example.com",
+				2: "bob@example.com",
+				3: "carol@example.com",
+			},
+		},
+		mail.NewFileSender("Fiagram <no-reply@example.com>", outboxFile, logger),
+		clock,
+		logger,
+	)
+
+	code := m.Run()
+	os.RemoveAll(outboxDir)
+	os.Exit(code)
+}
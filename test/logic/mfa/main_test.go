@@ -0,0 +1,53 @@
+package logic_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	mfa_logic "github.com/Fiagram/gateway/internal/logic/mfa"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+)
+
+var (
+	clock    *testutils.FakeClock
+	mfaLogic mfa_logic.Mfa
+)
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	mfaLogic = mfa_logic.NewMfaLogic(
+		configs.Mfa{
+			Issuer:        "Fiagram",
+			ChallengeTTL:  5 * time.Minute,
+			MaxAttempts:   3,
+			EnrollmentTTL: 10 * time.Minute,
+		},
+		cache.NewTotpEnrollment(client, logger),
+		cache.NewMfaChallenge(client, logger),
+		throttle_logic.NewSignInThrottleLogic(
+			configs.SignInThrottle{
+				Window:              time.Hour,
+				DelayAfter:          3,
+				BaseDelay:           time.Minute,
+				MaxDelay:            4 * time.Minute,
+				UsernameMaxFailures: 8,
+				LockoutDuration:     time.Hour,
+			},
+			cache.NewSignInThrottle(client, logger),
+			clock,
+			logger,
+		),
+		clock,
+		logger,
+	)
+
+	os.Exit(m.Run())
+}
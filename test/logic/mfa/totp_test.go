@@ -0,0 +1,318 @@
+package logic_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	mfa_logic "github.com/Fiagram/gateway/internal/logic/mfa"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTotpCodeRFC6238Vectors(t *testing.T) {
+	// Base32 of the ASCII secret "12345678901234567890" of RFC 6238
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	// The RFC lists 8 digit codes, we keep their last 6 digits
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range tests {
+		code, err := mfa_logic.TotpCode(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, "code at %d", unix)
+	}
+}
+
+// Helper function to enable TOTP for an account and return its secret
+func enrollTotp(t *testing.T, accountId uint64) string {
+	ctx := context.Background()
+
+	enrollment, err := mfaLogic.BeginTotpEnrollment(ctx, accountId, "alice")
+	require.NoError(t, err)
+
+	code, err := mfa_logic.TotpCode(enrollment.Secret, clock.Now())
+	require.NoError(t, err)
+	require.NoError(t, mfaLogic.ConfirmTotpEnrollment(ctx, accountId, code))
+
+	// Later codes must come from the next time step
+	clock.Advance(30 * time.Second)
+	return enrollment.Secret
+}
+
+func TestTotpEnrollment(t *testing.T) {
+	ctx := context.Background()
+
+	enrollment, err := mfaLogic.BeginTotpEnrollment(ctx, 2001, "alice")
+	require.NoError(t, err)
+
+	uri, err := url.Parse(enrollment.ProvisioningUri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Fiagram:alice", uri.Path)
+	assert.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Fiagram", uri.Query().Get("issuer"))
+
+	// Not enabled until confirmed
+	isEnabled, err := mfaLogic.IsEnabled(ctx, 2001)
+	require.NoError(t, err)
+	assert.False(t, isEnabled)
+
+	err = mfaLogic.ConfirmTotpEnrollment(ctx, 2001, "000000")
+	assert.ErrorIs(t, err, mfa_logic.ErrInvalidCode)
+
+	code, err := mfa_logic.TotpCode(enrollment.Secret, clock.Now())
+	require.NoError(t, err)
+	require.NoError(t, mfaLogic.ConfirmTotpEnrollment(ctx, 2001, code))
+
+	isEnabled, err = mfaLogic.IsEnabled(ctx, 2001)
+	require.NoError(t, err)
+	assert.True(t, isEnabled)
+
+	_, err = mfaLogic.BeginTotpEnrollment(ctx, 2001, "alice")
+	assert.ErrorIs(t, err, mfa_logic.ErrMfaAlreadyEnabled)
+}
+
+func TestTotpConfirmWithoutEnrollment(t *testing.T) {
+	err := mfaLogic.ConfirmTotpEnrollment(context.Background(), 2002, "123456")
+	assert.ErrorIs(t, err, mfa_logic.ErrEnrollmentNotFound)
+}
+
+func TestTotpDisable(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2003)
+
+	err := mfaLogic.DisableTotp(ctx, 2003, "000000")
+	assert.ErrorIs(t, err, mfa_logic.ErrInvalidCode)
+
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+	require.NoError(t, mfaLogic.DisableTotp(ctx, 2003, code))
+
+	isEnabled, err := mfaLogic.IsEnabled(ctx, 2003)
+	require.NoError(t, err)
+	assert.False(t, isEnabled)
+
+	err = mfaLogic.DisableTotp(ctx, 2003, code)
+	assert.ErrorIs(t, err, mfa_logic.ErrMfaNotEnabled)
+}
+
+func TestMfaChallenge(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2004)
+
+	challenge, expiresAt, err := mfaLogic.StartChallenge(ctx, 2004, true)
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(5*time.Minute).Unix(), expiresAt.Unix())
+
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+
+	entry, err := mfaLogic.CompleteChallenge(ctx, challenge, code)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2004), entry.AccountId)
+	assert.True(t, entry.IsRememberMe)
+
+	// The challenge signs in only once
+	_, err = mfaLogic.CompleteChallenge(ctx, challenge, code)
+	assert.ErrorIs(t, err, mfa_logic.ErrInvalidChallenge)
+}
+
+func TestMfaChallengeRejectsReplayedCode(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2005)
+
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+
+	first, _, err := mfaLogic.StartChallenge(ctx, 2005, false)
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, first, code)
+	require.NoError(t, err)
+
+	// An observed code cannot sign in a second time within its window
+	second, _, err := mfaLogic.StartChallenge(ctx, 2005, false)
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, second, code)
+	assert.ErrorIs(t, err, mfa_logic.ErrInvalidCode)
+
+	// The code of the next step is fine
+	clock.Advance(30 * time.Second)
+	code, err = mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, second, code)
+	assert.NoError(t, err)
+}
+
+func TestMfaChallengeAcceptsClockDrift(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2006)
+	clock.Advance(30 * time.Second)
+
+	// The phone is one step behind the gateway
+	code, err := mfa_logic.TotpCode(secret, clock.Now().Add(-30*time.Second))
+	require.NoError(t, err)
+
+	challenge, _, err := mfaLogic.StartChallenge(ctx, 2006, false)
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, challenge, code)
+	assert.NoError(t, err)
+
+	// Two steps are too far off
+	clock.Advance(30 * time.Second)
+	code, err = mfa_logic.TotpCode(secret, clock.Now().Add(-90*time.Second))
+	require.NoError(t, err)
+
+	challenge, _, err = mfaLogic.StartChallenge(ctx, 2006, false)
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, challenge, code)
+	assert.ErrorIs(t, err, mfa_logic.ErrInvalidCode)
+}
+
+func TestMfaChallengeMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2007)
+
+	challenge, _, err := mfaLogic.StartChallenge(ctx, 2007, false)
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = mfaLogic.CompleteChallenge(ctx, challenge, "000000")
+		assert.ErrorIs(t, err, mfa_logic.ErrInvalidCode)
+	}
+
+	// The challenge is gone, even the right code does not help anymore
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, challenge, code)
+	assert.ErrorIs(t, err, mfa_logic.ErrInvalidChallenge)
+}
+
+func TestMfaChallengeMaxAttemptsWithConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	enrollTotp(t, 2010)
+
+	challenge, _, err := mfaLogic.StartChallenge(ctx, 2010, false)
+	require.NoError(t, err)
+
+	var (
+		wg           sync.WaitGroup
+		mutex        sync.Mutex
+		invalidCodes int
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := mfaLogic.CompleteChallenge(ctx, challenge, "000000")
+			if errors.Is(err, mfa_logic.ErrInvalidCode) {
+				mutex.Lock()
+				invalidCodes++
+				mutex.Unlock()
+			} else {
+				assert.ErrorIs(t, err, mfa_logic.ErrInvalidChallenge)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, invalidCodes, "only the max attempts are checked")
+}
+
+func TestMfaFailuresAreThrottledPerAccount(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2011)
+
+	// Every new challenge brings new attempts, the account failures add up
+	for range 2 {
+		challenge, _, err := mfaLogic.StartChallenge(ctx, 2011, false)
+		require.NoError(t, err)
+		for range 2 {
+			_, err = mfaLogic.CompleteChallenge(ctx, challenge, "000000")
+			assert.ErrorIs(t, err, mfa_logic.ErrInvalidCode)
+		}
+	}
+
+	challenge, _, err := mfaLogic.StartChallenge(ctx, 2011, false)
+	require.NoError(t, err)
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, challenge, code)
+	assert.ErrorIs(t, err, throttle_logic.ErrTooManyAttempts)
+
+	// The right code gets through once the delay is over
+	clock.Advance(time.Minute)
+	code, err = mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+	_, err = mfaLogic.CompleteChallenge(ctx, challenge, code)
+	assert.NoError(t, err)
+}
+
+func TestMfaChallengeExpires(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2008)
+
+	challenge, _, err := mfaLogic.StartChallenge(ctx, 2008, false)
+	require.NoError(t, err)
+
+	clock.Advance(6 * time.Minute)
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+
+	_, err = mfaLogic.CompleteChallenge(ctx, challenge, code)
+	assert.ErrorIs(t, err, mfa_logic.ErrInvalidChallenge)
+}
+
+func TestTotpVerify(t *testing.T) {
+	ctx := context.Background()
+
+	err := mfaLogic.VerifyTotp(ctx, 2009, "123456")
+	assert.ErrorIs(t, err, mfa_logic.ErrMfaNotEnabled)
+
+	secret := enrollTotp(t, 2009)
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, mfaLogic.VerifyTotp(ctx, 2009, "000000"), mfa_logic.ErrInvalidCode)
+	require.NoError(t, mfaLogic.VerifyTotp(ctx, 2009, code))
+	assert.ErrorIs(t, mfaLogic.VerifyTotp(ctx, 2009, code), mfa_logic.ErrInvalidCode,
+		"a code is used once")
+}
+
+func TestTotpCodeIsUsedOnceWithConcurrentRequests(t *testing.T) {
+	ctx := context.Background()
+	secret := enrollTotp(t, 2012)
+	code, err := mfa_logic.TotpCode(secret, clock.Now())
+	require.NoError(t, err)
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		successes int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if mfaLogic.VerifyTotp(ctx, 2012, code) == nil {
+				mutex.Lock()
+				successes++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, successes, "a replayed code must not pass twice")
+}
@@ -0,0 +1,119 @@
+package logic_test
+
+import (
+	"context"
+	"testing"
+
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCredentialsWithConfigClient(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := oauthLogic.IssueClientCredentialsToken(ctx, "config-service", configClientSecret, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read:accounts"}, issued.Scopes, "every scope of the client is granted by default")
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, payload.IsService())
+	assert.Equal(t, "config-service", payload.ClientId)
+	assert.Equal(t, uint64(0), payload.AccountId)
+	assert.Equal(t, []string{"read:accounts"}, payload.Scopes)
+}
+
+func TestClientCredentialsWithRegisteredClient(t *testing.T) {
+	ctx := context.Background()
+
+	secret, entry, err := oauthLogic.RegisterClient(ctx, oauth_logic.RegisterClientParams{
+		Id:     "portfolio-service",
+		Name:   "Portfolio",
+		Scopes: []string{"read:accounts", "write:orders"},
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, entry.SecretHash, "only the hash of the secret is stored")
+
+	issued, err := oauthLogic.IssueClientCredentialsToken(ctx, "portfolio-service", secret, []string{"write:orders"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"write:orders"}, issued.Scopes)
+
+	_, err = oauthLogic.IssueClientCredentialsToken(ctx, "portfolio-service", secret, []string{"admin"}, nil)
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidScope)
+
+	// The client was not given any other service
+	_, err = oauthLogic.IssueClientCredentialsToken(ctx, "portfolio-service", secret, nil, []string{"fiagram-portfolio"})
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidAudience)
+
+	_, err = oauthLogic.IssueClientCredentialsToken(ctx, "portfolio-service", "wrong-secret", nil, nil)
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidClient)
+
+	require.NoError(t, oauthLogic.DeleteClient(ctx, "portfolio-service"))
+	_, err = oauthLogic.IssueClientCredentialsToken(ctx, "portfolio-service", secret, nil, nil)
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidClient)
+}
+
+func TestClientCredentialsAudienceAllowList(t *testing.T) {
+	ctx := context.Background()
+
+	secret, entry, err := oauthLogic.RegisterClient(ctx, oauth_logic.RegisterClientParams{
+		Id:        "reporting-service",
+		Scopes:    []string{"read:accounts"},
+		Audiences: []string{"fiagram-portfolio"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fiagram-portfolio"}, entry.Audiences)
+
+	issued, err := oauthLogic.IssueClientCredentialsToken(ctx, "reporting-service", secret, nil, []string{"fiagram-portfolio"})
+	require.NoError(t, err)
+	payload, _, err := tokenLogic.InspectAccessToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fiagram-portfolio"}, payload.Audience)
+
+	_, err = oauthLogic.IssueClientCredentialsToken(ctx, "reporting-service", secret, nil,
+		[]string{"fiagram-portfolio", "fiagram-billing"})
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidAudience, "every requested audience has to be allowed")
+
+	// Tokens for the gateway need no audience of the client
+	_, err = oauthLogic.IssueClientCredentialsToken(ctx, "reporting-service", secret, nil, nil)
+	require.NoError(t, err)
+}
+
+func TestClientCredentialsRejectsUnknownClient(t *testing.T) {
+	_, err := oauthLogic.IssueClientCredentialsToken(context.Background(), "unknown-service", "secret", nil, nil)
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidClient)
+}
+
+func TestRegisterClientValidation(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := oauthLogic.RegisterClient(ctx, oauth_logic.RegisterClientParams{Id: "config-service"})
+	assert.ErrorIs(t, err, oauth_logic.ErrClientExists, "config clients cannot be shadowed")
+
+	_, _, err = oauthLogic.RegisterClient(ctx, oauth_logic.RegisterClientParams{Id: "Bad Id"})
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidClientId)
+
+	_, _, err = oauthLogic.RegisterClient(ctx, oauth_logic.RegisterClientParams{Id: "scoped-service", Scopes: []string{"Read All"}})
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidScope)
+
+	err = oauthLogic.DeleteClient(ctx, "config-service")
+	assert.ErrorIs(t, err, oauth_logic.ErrClientNotFound, "config clients are only removed from the config")
+}
+
+func TestListClients(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := oauthLogic.RegisterClient(ctx, oauth_logic.RegisterClientParams{Id: "listed-service"})
+	require.NoError(t, err)
+
+	clients, err := oauthLogic.ListClients(ctx)
+	require.NoError(t, err)
+
+	ids := make([]string, 0, len(clients))
+	for _, client := range clients {
+		ids = append(ids, client.Id)
+	}
+	assert.Contains(t, ids, "config-service")
+	assert.Contains(t, ids, "listed-service")
+}
@@ -0,0 +1,158 @@
+package logic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospectAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	accessToken, expiresAt, err := tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{
+		AccountId: 42,
+		Scopes:    []string{"read:accounts"},
+	})
+	require.NoError(t, err)
+
+	introspection, err := introspectionLogic.Introspect(ctx, accessToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, oauth_logic.TokenTypeAccessToken, introspection.TokenType)
+	assert.Equal(t, "42", introspection.Subject)
+	assert.Equal(t, []string{"read:accounts"}, introspection.Scopes)
+	assert.Equal(t, expiresAt.Unix(), introspection.ExpiresAt.Unix())
+	assert.NotEmpty(t, introspection.TokenId)
+
+	// The token of a first-party sign-in was issued to no client
+	err = introspectionLogic.RevokeToken(ctx, "config-service", accessToken)
+	assert.ErrorIs(t, err, oauth_logic.ErrTokenNotOwned)
+
+	introspection, err = introspectionLogic.Introspect(ctx, accessToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+}
+
+func TestIntrospectServiceToken(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := oauthLogic.IssueClientCredentialsToken(ctx, "config-service", configClientSecret, nil, nil)
+	require.NoError(t, err)
+
+	introspection, err := introspectionLogic.Introspect(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, "config-service", introspection.Subject)
+	assert.Equal(t, "config-service", introspection.ClientId)
+
+	err = introspectionLogic.RevokeToken(ctx, "another-service", issued.AccessToken)
+	assert.ErrorIs(t, err, oauth_logic.ErrTokenNotOwned)
+
+	require.NoError(t, introspectionLogic.RevokeToken(ctx, "config-service", issued.AccessToken))
+	introspection, err = introspectionLogic.Introspect(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, introspection.Active)
+}
+
+func TestIntrospectTokenForAnotherAudience(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := oauthLogic.IssueClientCredentialsToken(ctx, "config-service", configClientSecret,
+		nil, []string{"fiagram-portfolio"})
+	require.NoError(t, err)
+
+	// The portfolio service learns the token is meant for it, the gateway
+	// itself would not take it
+	introspection, err := introspectionLogic.Introspect(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, []string{"fiagram-portfolio"}, introspection.Audience)
+	_, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, issued.AccessToken)
+	assert.Error(t, err)
+
+	_, err = oauthLogic.IssueClientCredentialsToken(ctx, "config-service", configClientSecret,
+		nil, []string{"fiagram-unknown"})
+	assert.ErrorIs(t, err, oauth_logic.ErrInvalidAudience)
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := sessionLogic.Start(ctx, session_logic.StartParams{AccountId: 7, ClientId: "config-service"})
+	require.NoError(t, err)
+
+	introspection, err := introspectionLogic.Introspect(ctx, issued.RefreshToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, oauth_logic.TokenTypeRefreshToken, introspection.TokenType)
+	assert.Equal(t, "7", introspection.Subject)
+	assert.False(t, introspection.ExpiresAt.IsZero())
+
+	rotated, err := sessionLogic.Rotate(ctx, issued.RefreshToken, session_logic.ClientInfo{})
+	require.NoError(t, err)
+
+	introspection, err = introspectionLogic.Introspect(ctx, issued.RefreshToken)
+	require.NoError(t, err)
+	assert.False(t, introspection.Active, "a rotated token is inactive")
+
+	err = introspectionLogic.RevokeToken(ctx, "another-service", rotated.RefreshToken)
+	assert.ErrorIs(t, err, oauth_logic.ErrTokenNotOwned)
+	introspection, err = introspectionLogic.Introspect(ctx, rotated.RefreshToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active, "only the client of the session may revoke it")
+
+	require.NoError(t, introspectionLogic.RevokeToken(ctx, "config-service", rotated.RefreshToken))
+	introspection, err = introspectionLogic.Introspect(ctx, rotated.RefreshToken)
+	require.NoError(t, err)
+	assert.False(t, introspection.Active)
+
+	sessions, err := sessionLogic.List(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "revoking the refresh token ends its session")
+}
+
+func TestRevokeRefreshTokenOfFirstPartySignIn(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := sessionLogic.Start(ctx, session_logic.StartParams{AccountId: 8})
+	require.NoError(t, err)
+
+	err = introspectionLogic.RevokeToken(ctx, "config-service", issued.RefreshToken)
+	assert.ErrorIs(t, err, oauth_logic.ErrTokenNotOwned)
+
+	introspection, err := introspectionLogic.Introspect(ctx, issued.RefreshToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+}
+
+func TestIntrospectOldFormatRefreshToken(t *testing.T) {
+	ctx := context.Background()
+
+	// Tokens stored before the entries were JSON only hold the account id
+	require.NoError(t, client.Set(ctx, "refresh_token:old_format_token", "9", time.Hour))
+
+	introspection, err := introspectionLogic.Introspect(ctx, "old_format_token")
+	require.NoError(t, err)
+	assert.False(t, introspection.Active)
+
+	assert.NoError(t, introspectionLogic.RevokeToken(ctx, "config-service", "old_format_token"))
+}
+
+func TestIntrospectUnknownToken(t *testing.T) {
+	ctx := context.Background()
+
+	for _, token := range []string{"unknown-refresh-token", "not.a.jwt"} {
+		introspection, err := introspectionLogic.Introspect(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, introspection.Active)
+
+		assert.NoError(t, introspectionLogic.RevokeToken(ctx, "config-service", token),
+			"unknown tokens are revoked successfully")
+	}
+}
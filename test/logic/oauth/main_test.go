@@ -0,0 +1,125 @@
+package logic_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// configClientSecret is the secret of the client declared in the config
+const configClientSecret = "config-client-secret"
+
+var (
+	client             cache.Client
+	tokenLogic         token_logic.Token
+	sessionLogic       session_logic.Session
+	oauthLogic         oauth_logic.OAuth
+	introspectionLogic oauth_logic.TokenIntrospection
+	tokenExchangeLogic oauth_logic.TokenExchange
+)
+
+// fakeAccounts is an account service holding the accounts in memory
+type fakeAccounts struct {
+	account_service.AccountServiceClient
+	accounts map[uint64]*account_service.AccountInfo
+}
+
+func (f *fakeAccounts) GetAccount(
+	_ context.Context,
+	in *account_service.GetAccountRequest,
+	_ ...grpc.CallOption,
+) (*account_service.GetAccountResponse, error) {
+	return &account_service.GetAccountResponse{
+		AccountId: in.AccountId,
+		Account:   f.accounts[in.AccountId],
+	}, nil
+}
+
+func (f *fakeAccounts) Close() error {
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client = cache.NewRamClient(logger)
+	clock := utils.NewClock()
+
+	tokenConfig := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+		Audiences:       []string{"fiagram-portfolio"},
+	}
+	keyring, err := token_logic.NewKeyring(tokenConfig, clock, logger)
+	if err != nil {
+		panic(err)
+	}
+	tokenLogic = token_logic.NewTokenLogic(tokenConfig, keyring, clock, logger)
+
+	refreshTokenCache := cache.NewRefreshToken(client, logger)
+	sessionLogic = session_logic.NewSessionLogic(
+		tokenConfig,
+		session_logic.NewSessionPolicy(tokenConfig, clock),
+		refreshTokenCache,
+		cache.NewRefreshTokenFamily(client, logger),
+		cache.NewSession(client, logger),
+		cache.NewAccessTokenRevocation(client, logger),
+		tokenLogic,
+		clock,
+		logger,
+	)
+
+	oauthLogic = oauth_logic.NewOAuthLogic(
+		configs.OAuth{
+			Clients: []configs.OAuthClient{{
+				Id:   "config-service",
+				Name: "Config service",
+				// SHA-256 of configClientSecret
+				SecretHash: "76e232be2daefaae4bef5a049ca0333e9f6c783f7abe70a0c56def10a79dcab5",
+				Scopes:     []string{"read:accounts"},
+				Audiences:  []string{"fiagram-portfolio"},
+			}},
+		},
+		cache.NewOAuthClient(client, logger),
+		tokenLogic,
+		clock,
+		logger,
+	)
+	introspectionLogic = oauth_logic.NewTokenIntrospectionLogic(
+		tokenLogic,
+		sessionLogic,
+		refreshTokenCache,
+		clock,
+		logger,
+	)
+	tokenExchangeLogic = oauth_logic.NewTokenExchangeLogic(
+		configs.Impersonation{TokenTTL: 5 * time.Minute},
+		&fakeAccounts{
+			accounts: map[uint64]*account_service.AccountInfo{
+				1: {Username: "alice", Role: account_service.AccountInfo_ADMIN},
+				2: {Username: "bob", Role: account_service.AccountInfo_MEMBER},
+				3: {Username: "carol", Role: account_service.AccountInfo_ADMIN},
+				4: {Username: "dave", Role: account_service.AccountInfo_ADMIN},
+				// erin was demoted after signing in
+				5: {Username: "erin", Role: account_service.AccountInfo_MEMBER},
+			},
+		},
+		tokenLogic,
+		sessionLogic,
+		clock,
+		logger,
+	)
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,141 @@
+package logic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	oauth_logic "github.com/Fiagram/gateway/internal/logic/oauth"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to issue the access token of a signed in account
+func signedInToken(t *testing.T, payload token_logic.TokenPayload) string {
+	token, _, err := tokenLogic.GenerateAccessToken(context.Background(), payload)
+	require.NoError(t, err)
+	return token
+}
+
+func TestImpersonate(t *testing.T) {
+	ctx := context.Background()
+	adminToken := signedInToken(t, token_logic.TokenPayload{AccountId: 1, Role: token_logic.RoleAdmin})
+
+	issued, err := tokenExchangeLogic.Impersonate(ctx, adminToken, "", 2)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), issued.ExpiresAt, 5*time.Second)
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), payload.AccountId)
+	assert.Equal(t, uint64(1), payload.ActorAccountId)
+	assert.Equal(t, token_logic.RoleMember, payload.Role)
+	assert.Empty(t, payload.SessionId, "impersonation tokens belong to no session")
+
+	// Impersonation tokens cannot be exchanged in turn
+	_, err = tokenExchangeLogic.Impersonate(ctx, issued.AccessToken, "", 2)
+	assert.ErrorIs(t, err, oauth_logic.ErrImpersonationNotAllowed)
+}
+
+func TestImpersonateRefusesNonAdministrators(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		subjectToken string
+		expectedErr  error
+	}{
+		{
+			name:         "invalid token",
+			subjectToken: "not-a-token",
+			expectedErr:  oauth_logic.ErrInvalidSubjectToken,
+		},
+		{
+			name:         "member",
+			subjectToken: signedInToken(t, token_logic.TokenPayload{AccountId: 2, Role: token_logic.RoleMember}),
+			expectedErr:  oauth_logic.ErrImpersonationNotAllowed,
+		},
+		{
+			name:         "demoted administrator",
+			subjectToken: signedInToken(t, token_logic.TokenPayload{AccountId: 5, Role: token_logic.RoleAdmin}),
+			expectedErr:  oauth_logic.ErrImpersonationNotAllowed,
+		},
+		{
+			name: "scoped token",
+			subjectToken: signedInToken(t, token_logic.TokenPayload{
+				AccountId: 1,
+				Role:      token_logic.RoleAdmin,
+				Scopes:    []string{"read:accounts"},
+			}),
+			expectedErr: oauth_logic.ErrImpersonationNotAllowed,
+		},
+		{
+			name:         "service token",
+			subjectToken: signedInToken(t, token_logic.TokenPayload{ClientId: "config-service", Role: token_logic.RoleAdmin}),
+			expectedErr:  oauth_logic.ErrImpersonationNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tokenExchangeLogic.Impersonate(ctx, tt.subjectToken, "", 2)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestImpersonateRefusesTargets(t *testing.T) {
+	ctx := context.Background()
+	adminToken := signedInToken(t, token_logic.TokenPayload{AccountId: 1, Role: token_logic.RoleAdmin})
+
+	for name, accountId := range map[string]uint64{
+		"self":          1,
+		"administrator": 3,
+		"unknown":       404,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := tokenExchangeLogic.Impersonate(ctx, adminToken, "", accountId)
+			assert.ErrorIs(t, err, oauth_logic.ErrInvalidTarget)
+		})
+	}
+}
+
+func TestImpersonationEndsWhenAdministratorSignsOutEverywhere(t *testing.T) {
+	ctx := context.Background()
+	adminToken := signedInToken(t, token_logic.TokenPayload{AccountId: 4, Role: token_logic.RoleAdmin})
+
+	issued, err := tokenExchangeLogic.Impersonate(ctx, adminToken, "", 2)
+	require.NoError(t, err)
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, sessionLogic.RevokeAll(ctx, 4))
+
+	isRevoked, err := sessionLogic.IsAccessTokenRevoked(ctx, payload)
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+}
+
+func TestImpersonateWithDpopBoundToken(t *testing.T) {
+	ctx := context.Background()
+	adminToken := signedInToken(t, token_logic.TokenPayload{
+		AccountId:     1,
+		Role:          token_logic.RoleAdmin,
+		KeyThumbprint: "admin-key",
+	})
+
+	// Without a proof, or with the proof of another key, the bound token is
+	// refused
+	for _, keyThumbprint := range []string{"", "other-key"} {
+		_, err := tokenExchangeLogic.Impersonate(ctx, adminToken, keyThumbprint, 2)
+		assert.ErrorIs(t, err, oauth_logic.ErrDpopKeyMismatch, keyThumbprint)
+	}
+
+	// The impersonation token is bound to the key as well
+	issued, err := tokenExchangeLogic.Impersonate(ctx, adminToken, "admin-key", 2)
+	require.NoError(t, err)
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "admin-key", payload.KeyThumbprint)
+}
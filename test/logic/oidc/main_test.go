@@ -0,0 +1,123 @@
+package logic_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	oidc_logic "github.com/Fiagram/gateway/internal/logic/oidc"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+const (
+	tokenSecret = "test-secret-key-123"
+	// confidentialClientSecret is the secret of the confidential client
+	confidentialClientSecret = "config-client-secret"
+)
+
+var (
+	clock         *testutils.FakeClock
+	tokenLogic    token_logic.Token
+	sessionLogic  session_logic.Session
+	providerLogic oidc_logic.Provider
+)
+
+// fakeAccounts is an account service holding the accounts in memory
+type fakeAccounts struct {
+	account_service.AccountServiceClient
+	accounts map[uint64]*account_service.AccountInfo
+}
+
+func (f *fakeAccounts) GetAccount(
+	_ context.Context,
+	in *account_service.GetAccountRequest,
+	_ ...grpc.CallOption,
+) (*account_service.GetAccountResponse, error) {
+	return &account_service.GetAccountResponse{
+		AccountId: in.AccountId,
+		Account:   f.accounts[in.AccountId],
+	}, nil
+}
+
+func (f *fakeAccounts) Close() error {
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+
+	tokenConfig := configs.Token{
+		Secret:          tokenSecret,
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+	}
+	keyring, err := token_logic.NewKeyring(tokenConfig, clock, logger)
+	if err != nil {
+		panic(err)
+	}
+	tokenLogic = token_logic.NewTokenLogic(tokenConfig, keyring, clock, logger)
+
+	refreshTokenCache := cache.NewRefreshToken(client, logger)
+	sessionLogic = session_logic.NewSessionLogic(
+		tokenConfig,
+		session_logic.NewSessionPolicy(tokenConfig, clock),
+		refreshTokenCache,
+		cache.NewRefreshTokenFamily(client, logger),
+		cache.NewSession(client, logger),
+		cache.NewAccessTokenRevocation(client, logger),
+		tokenLogic,
+		clock,
+		logger,
+	)
+
+	providerLogic = oidc_logic.NewProviderLogic(
+		configs.Oidc{
+			Issuer:               "https://auth.example.com/",
+			LoginUrl:             "https://app.example.com/login",
+			AuthorizationCodeTTL: time.Minute,
+			Clients: []configs.OidcClient{
+				{
+					Id:           "web",
+					Name:         "Web",
+					RedirectUris: []string{"https://app.example.com/callback"},
+				},
+				{
+					Id:   "backoffice",
+					Name: "Backoffice",
+					// SHA-256 of confidentialClientSecret
+					SecretHash:   "76e232be2daefaae4bef5a049ca0333e9f6c783f7abe70a0c56def10a79dcab5",
+					RedirectUris: []string{"https://backoffice.example.com/callback"},
+				},
+			},
+		},
+		cache.NewOidcAuthorizationCode(client, logger),
+		refreshTokenCache,
+		&fakeAccounts{
+			accounts: map[uint64]*account_service.AccountInfo{
+				1: {
+					Username:    "alice",
+					Fullname:    "Alice Liddell",
+					Email:       "alice@example.com",
+					PhoneNumber: "+44 123456",
+					Role:        account_service.AccountInfo_ADMIN,
+				},
+			},
+		},
+		tokenLogic,
+		sessionLogic,
+		clock,
+		logger,
+	)
+
+	os.Exit(m.Run())
+}
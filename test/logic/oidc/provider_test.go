@@ -0,0 +1,254 @@
+package logic_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	oidc_logic "github.com/Fiagram/gateway/internal/logic/oidc"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const codeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func authorizationRequest(clientId string, redirectUri string) oidc_logic.AuthorizationRequest {
+	return oidc_logic.AuthorizationRequest{
+		ResponseType:        oidc_logic.ResponseTypeCode,
+		ClientId:            clientId,
+		RedirectUri:         redirectUri,
+		Scopes:              []string{"openid", "profile", "email"},
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       codeChallenge(codeVerifier),
+		CodeChallengeMethod: oidc_logic.CodeChallengeMethodS256,
+	}
+}
+
+// parseIdToken checks the signature of an ID token and returns its claims
+func parseIdToken(t *testing.T, idToken string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(*jwt.Token) (any, error) {
+		return []byte(tokenSecret), nil
+	}, jwt.WithTimeFunc(clock.Now))
+	require.NoError(t, err)
+	return claims
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+
+	code, err := providerLogic.Authorize(ctx, 1, authorizationRequest("web", "https://app.example.com/callback"))
+	require.NoError(t, err)
+
+	issued, err := providerLogic.ExchangeCode(ctx, oidc_logic.ExchangeCodeParams{
+		ClientId:     "web",
+		Code:         code,
+		RedirectUri:  "https://app.example.com/callback",
+		CodeVerifier: codeVerifier,
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, issued.RefreshToken)
+	assert.Equal(t, []string{"openid", "profile", "email"}, issued.Scopes)
+
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), payload.AccountId)
+	assert.Equal(t, token_logic.RoleAdmin, payload.Role)
+	assert.NotEmpty(t, payload.SessionId)
+
+	claims := parseIdToken(t, issued.IdToken)
+	assert.Equal(t, "https://auth.example.com", claims["iss"])
+	assert.Equal(t, "1", claims["sub"])
+	assert.Equal(t, "web", claims["aud"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, payload.SessionId, claims["sid"])
+	assert.Equal(t, "Alice Liddell", claims["name"])
+	assert.Equal(t, "alice", claims["preferred_username"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.NotContains(t, claims, "phone_number", "the phone scope was not granted")
+
+	refreshed, err := providerLogic.Refresh(ctx, "web", "", issued.RefreshToken, session_logic.ClientInfo{})
+	require.NoError(t, err)
+	assert.NotEqual(t, issued.RefreshToken, refreshed.RefreshToken)
+	assert.NotEmpty(t, refreshed.AccessToken)
+}
+
+func TestAuthorizationCodeReplay(t *testing.T) {
+	ctx := context.Background()
+
+	code, err := providerLogic.Authorize(ctx, 1, authorizationRequest("web", "https://app.example.com/callback"))
+	require.NoError(t, err)
+
+	params := oidc_logic.ExchangeCodeParams{
+		ClientId:     "web",
+		Code:         code,
+		RedirectUri:  "https://app.example.com/callback",
+		CodeVerifier: codeVerifier,
+	}
+	issued, err := providerLogic.ExchangeCode(ctx, params)
+	require.NoError(t, err)
+
+	_, err = providerLogic.ExchangeCode(ctx, params)
+	assert.ErrorIs(t, err, oidc_logic.ErrInvalidGrant)
+
+	_, err = providerLogic.Refresh(ctx, "web", "", issued.RefreshToken, session_logic.ClientInfo{})
+	assert.ErrorIs(t, err, oidc_logic.ErrInvalidGrant, "a replayed code revokes the tokens issued for it")
+}
+
+func TestAuthorizationCodeConcurrentReplay(t *testing.T) {
+	ctx := context.Background()
+
+	code, err := providerLogic.Authorize(ctx, 1, authorizationRequest("web", "https://app.example.com/callback"))
+	require.NoError(t, err)
+
+	params := oidc_logic.ExchangeCodeParams{
+		ClientId:     "web",
+		Code:         code,
+		RedirectUri:  "https://app.example.com/callback",
+		CodeVerifier: codeVerifier,
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		issued []oidc_logic.IssuedTokens
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tokens, err := providerLogic.ExchangeCode(ctx, params); err == nil {
+				mutex.Lock()
+				issued = append(issued, tokens)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Whichever request came second revoked the session of the first one
+	require.Len(t, issued, 1, "a code must not be exchanged twice")
+	_, err = providerLogic.Refresh(ctx, "web", "", issued[0].RefreshToken, session_logic.ClientInfo{})
+	assert.ErrorIs(t, err, oidc_logic.ErrInvalidGrant)
+}
+
+func TestExchangeCodeRequiresPkce(t *testing.T) {
+	ctx := context.Background()
+
+	code, err := providerLogic.Authorize(ctx, 1, authorizationRequest("web", "https://app.example.com/callback"))
+	require.NoError(t, err)
+
+	_, err = providerLogic.ExchangeCode(ctx, oidc_logic.ExchangeCodeParams{
+		ClientId:     "web",
+		Code:         code,
+		RedirectUri:  "https://app.example.com/callback",
+		CodeVerifier: "wrong-verifier-wrong-verifier-wrong-verifier",
+	})
+	assert.ErrorIs(t, err, oidc_logic.ErrInvalidGrant)
+}
+
+func TestExchangeExpiredCode(t *testing.T) {
+	ctx := context.Background()
+
+	code, err := providerLogic.Authorize(ctx, 1, authorizationRequest("web", "https://app.example.com/callback"))
+	require.NoError(t, err)
+
+	clock.Advance(2 * time.Minute)
+	_, err = providerLogic.ExchangeCode(ctx, oidc_logic.ExchangeCodeParams{
+		ClientId:     "web",
+		Code:         code,
+		RedirectUri:  "https://app.example.com/callback",
+		CodeVerifier: codeVerifier,
+	})
+	assert.ErrorIs(t, err, oidc_logic.ErrInvalidGrant)
+}
+
+func TestConfidentialClient(t *testing.T) {
+	ctx := context.Background()
+	redirectUri := "https://backoffice.example.com/callback"
+
+	code, err := providerLogic.Authorize(ctx, 1, authorizationRequest("backoffice", redirectUri))
+	require.NoError(t, err)
+
+	params := oidc_logic.ExchangeCodeParams{
+		ClientId:     "backoffice",
+		ClientSecret: "wrong-secret",
+		Code:         code,
+		RedirectUri:  redirectUri,
+		CodeVerifier: codeVerifier,
+	}
+	_, err = providerLogic.ExchangeCode(ctx, params)
+	assert.ErrorIs(t, err, oidc_logic.ErrInvalidClient)
+
+	params.ClientSecret = confidentialClientSecret
+	issued, err := providerLogic.ExchangeCode(ctx, params)
+	require.NoError(t, err)
+
+	// Refresh tokens are bound to their client
+	_, err = providerLogic.Refresh(ctx, "web", "", issued.RefreshToken, session_logic.ClientInfo{})
+	assert.ErrorIs(t, err, oidc_logic.ErrInvalidGrant)
+}
+
+func TestValidateAuthorizationRequest(t *testing.T) {
+	ctx := context.Background()
+	valid := authorizationRequest("web", "https://app.example.com/callback")
+	require.NoError(t, providerLogic.ValidateAuthorizationRequest(ctx, valid))
+
+	req := valid
+	req.ClientId = "unknown"
+	assert.ErrorIs(t, providerLogic.ValidateAuthorizationRequest(ctx, req), oidc_logic.ErrUnknownClient)
+
+	req = valid
+	req.RedirectUri = "https://evil.example.com/callback"
+	assert.ErrorIs(t, providerLogic.ValidateAuthorizationRequest(ctx, req), oidc_logic.ErrInvalidRedirectUri)
+
+	req = valid
+	req.ResponseType = "token"
+	assert.ErrorIs(t, providerLogic.ValidateAuthorizationRequest(ctx, req), oidc_logic.ErrUnsupportedResponseType)
+
+	req = valid
+	req.Scopes = []string{"profile"}
+	assert.ErrorIs(t, providerLogic.ValidateAuthorizationRequest(ctx, req), oidc_logic.ErrInvalidScope)
+
+	req = valid
+	req.CodeChallengeMethod = "plain"
+	assert.ErrorIs(t, providerLogic.ValidateAuthorizationRequest(ctx, req), oidc_logic.ErrPkceRequired)
+}
+
+func TestGetLoginUrl(t *testing.T) {
+	loginUrl, err := providerLogic.GetLoginUrl(context.Background(), url.Values{
+		"client_id": {"web"},
+		"state":     {"xyz"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://app.example.com/login?client_id=web&state=xyz", loginUrl)
+}
+
+func TestGetUserInfo(t *testing.T) {
+	userInfo, err := providerLogic.GetUserInfo(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "1", userInfo.Subject)
+	assert.Equal(t, "alice", userInfo.PreferredUsername)
+	assert.Equal(t, "+44 123456", userInfo.PhoneNumber)
+}
+
+func TestGetMetadata(t *testing.T) {
+	metadata := providerLogic.GetMetadata(context.Background())
+	assert.Equal(t, "https://auth.example.com", metadata.Issuer)
+	assert.Equal(t, "https://auth.example.com/api/v1/oauth/authorize", metadata.AuthorizationEndpoint)
+	assert.Equal(t, "https://auth.example.com/.well-known/jwks.json", metadata.JwksUri)
+	assert.Equal(t, "HS256", metadata.SigningAlgorithm)
+}
@@ -0,0 +1,35 @@
+package logic_test
+
+import (
+	"context"
+	"testing"
+
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAccountValid(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		accountId uint64
+	}{
+		{name: "trimmed password typed as stored", username: "carol", password: "Car0lsPassword!", accountId: 3},
+		{name: "trimmed password typed with whitespace", username: "carol", password: "  Car0lsPassword!\t", accountId: 3},
+		{name: "password with whitespace typed as stored", username: "dave", password: " Dav3sPassword! ", accountId: 4},
+		{name: "password with whitespace typed trimmed", username: "dave", password: "Dav3sPassword!"},
+		{name: "wrong password", username: "carol", password: " Wr0ngPassword! "},
+		{name: "whitespace only", username: "carol", password: "   "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accountId, err := password_logic.CheckAccountValid(ctx, accounts, tt.username, tt.password)
+			require.NoError(t, err)
+			assert.Equal(t, tt.accountId, accountId)
+		})
+	}
+}
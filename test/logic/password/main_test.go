@@ -0,0 +1,226 @@
+package logic_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	"github.com/Fiagram/gateway/internal/generated/grpc/account_service"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+var (
+	clock              *testutils.FakeClock
+	accounts           *fakeAccounts
+	outboxFile         string
+	sessionLogic       session_logic.Session
+	passwordPolicy     password_logic.Policy
+	passwordResetLogic password_logic.PasswordReset
+)
+
+// fakeAccounts is an account service holding the accounts in memory
+type fakeAccounts struct {
+	account_service.AccountServiceClient
+	usernames map[uint64]string
+	emails    map[uint64]string
+	passwords map[uint64]string
+	updateErr error
+	mutex     sync.Mutex
+}
+
+func (f *fakeAccounts) GetAccount(
+	_ context.Context,
+	in *account_service.GetAccountRequest,
+	_ ...grpc.CallOption,
+) (*account_service.GetAccountResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return &account_service.GetAccountResponse{
+		Account: &account_service.AccountInfo{
+			Username: f.usernames[in.AccountId],
+			Email:    f.emails[in.AccountId],
+		},
+	}, nil
+}
+
+func (f *fakeAccounts) GetAccountAll(
+	_ context.Context,
+	_ *account_service.GetAccountAllRequest,
+	_ ...grpc.CallOption,
+) (*account_service.GetAccountAllResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	resp := &account_service.GetAccountAllResponse{}
+	for accountId, email := range f.emails {
+		resp.AccountIdList = append(resp.AccountIdList, accountId)
+		resp.AccountInfoList = append(resp.AccountInfoList, &account_service.AccountInfo{Email: email})
+	}
+	return resp, nil
+}
+
+func (f *fakeAccounts) CheckAccountValid(
+	_ context.Context,
+	in *account_service.CheckAccountValidRequest,
+	_ ...grpc.CallOption,
+) (*account_service.CheckAccountValidResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for accountId, username := range f.usernames {
+		if username == in.Username && f.passwords[accountId] == in.Password {
+			return &account_service.CheckAccountValidResponse{AccountId: accountId}, nil
+		}
+	}
+	return &account_service.CheckAccountValidResponse{}, nil
+}
+
+func (f *fakeAccounts) UpdateAccountPassword(
+	_ context.Context,
+	in *account_service.UpdateAccountPasswordRequest,
+	_ ...grpc.CallOption,
+) (*account_service.UpdateAccountPasswordResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	f.passwords[in.AccountId] = in.Password
+	return &account_service.UpdateAccountPasswordResponse{AccountId: in.AccountId}, nil
+}
+
+func (f *fakeAccounts) Password(accountId uint64) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.passwords[accountId]
+}
+
+// FailUpdates makes the password updates fail with err until it is nil
+func (f *fakeAccounts) FailUpdates(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.updateErr = err
+}
+
+func (f *fakeAccounts) Close() error {
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+	accounts = &fakeAccounts{
+		usernames: map[uint64]string{
+			1: "alice",
+			2: "bob",
+			3: "carol",
+			4: "dave",
+		},
+		emails: map[uint64]string{
+			1: "alice@example.com",
+			2: "bob@example.com",
+		},
+		passwords: map[uint64]string{
+			// Signed up while passwords were stored trimmed
+			3: "Car0lsPassword!",
+			4: " Dav3sPassword! ",
+		},
+	}
+
+	outboxDir, err := os.MkdirTemp("", "outbox")
+	if err != nil {
+		panic(err)
+	}
+	outboxFile = filepath.Join(outboxDir, "outbox.jsonl")
+
+	tokenConfig := configs.Token{
+		Secret:          "test-secret-key-123",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+	}
+	keyring, err := token_logic.NewKeyring(tokenConfig, clock, logger)
+	if err != nil {
+		panic(err)
+	}
+	tokenLogic := token_logic.NewTokenLogic(tokenConfig, keyring, clock, logger)
+	sessionLogic = session_logic.NewSessionLogic(
+		tokenConfig,
+		session_logic.NewSessionPolicy(tokenConfig, clock),
+		cache.NewRefreshToken(client, logger),
+		cache.NewRefreshTokenFamily(client, logger),
+		cache.NewSession(client, logger),
+		cache.NewAccessTokenRevocation(client, logger),
+		tokenLogic,
+		clock,
+		logger,
+	)
+
+	breachedDir, err := os.MkdirTemp("", "breached")
+	if err != nil {
+		panic(err)
+	}
+	writeBreachedPasswords(breachedDir, "Tr0ub4dor&3x", "C0rrect-Horse")
+
+	passwordPolicy, err = password_logic.NewPasswordPolicyLogic(configs.PasswordPolicy{
+		Denylist:             []string{"password", "fiagram"},
+		BreachedPasswordsDir: breachedDir,
+	}, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	passwordResetLogic = password_logic.NewPasswordResetLogic(
+		configs.PasswordReset{
+			Url:           "https://app.example.com/reset-password",
+			TokenTTL:      30 * time.Minute,
+			MaxRequests:   5,
+			IpMaxRequests: 20,
+			Window:        time.Hour,
+		},
+		cache.NewPasswordResetToken(client, logger),
+		accounts,
+		sessionLogic,
+		passwordPolicy,
+		mail.NewFileSender("Fiagram <no-reply@example.com>", outboxFile, logger),
+		clock,
+		logger,
+	)
+
+	code := m.Run()
+	os.RemoveAll(outboxDir)
+	os.RemoveAll(breachedDir)
+	os.Exit(code)
+}
+
+// writeBreachedPasswords writes the range files of the passwords the way
+// Pwned Passwords serves them, next to a padding entry
+func writeBreachedPasswords(dir string, passwords ...string) {
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		file, err := os.OpenFile(filepath.Join(dir, hash[:5]+".txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(file, "%s:0\r\n%s:42\r\n", strings.Repeat("0", 35), hash[5:])
+		file.Close()
+	}
+}
@@ -0,0 +1,77 @@
+package logic_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	account := password_logic.Account{Username: "alice", Email: "alice.smith@example.com"}
+
+	tests := []struct {
+		name       string
+		password   string
+		violations []string
+	}{
+		{name: "strong password", password: "N3wPassword!"},
+		{name: "too short", password: "Sh0rt!", violations: []string{password_logic.ViolationTooShort}},
+		{name: "too long", password: "L0ng!" + strings.Repeat("a", 70), violations: []string{password_logic.ViolationTooLong}},
+		{name: "whitespace", password: "Has Space1!", violations: []string{password_logic.ViolationWhitespace}},
+		{name: "missing classes", password: "alllowercase", violations: []string{password_logic.ViolationCharacterClasses}},
+		{name: "denylisted", password: "FIAGRAM", violations: []string{
+			password_logic.ViolationTooShort,
+			password_logic.ViolationCharacterClasses,
+			password_logic.ViolationDenylisted,
+		}},
+		{name: "denylisted with suffix", password: "Password123!", violations: []string{password_logic.ViolationDenylisted}},
+		{name: "contains the username", password: "Alice2026!x", violations: []string{password_logic.ViolationSimilarToAccount}},
+		{name: "contains the email", password: "Alice.Smith9!", violations: []string{password_logic.ViolationSimilarToAccount}},
+		{name: "breached", password: "Tr0ub4dor&3x", violations: []string{password_logic.ViolationBreached}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := passwordPolicy.Validate(context.Background(), tt.password, account)
+			if tt.violations == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, password_logic.ErrInvalidPassword)
+			var policyErr *password_logic.PolicyError
+			require.ErrorAs(t, err, &policyErr)
+			assert.Equal(t, tt.violations, policyErr.Violations)
+		})
+	}
+}
+
+func TestPasswordPolicyDefaultsAndDenylistFile(t *testing.T) {
+	denylistFile := filepath.Join(t.TempDir(), "denylist.txt")
+	require.NoError(t, os.WriteFile(denylistFile, []byte("Summer\n\nwinter\n"), 0o600))
+
+	policy, err := password_logic.NewPasswordPolicyLogic(configs.PasswordPolicy{
+		MinLength:           6,
+		MinCharacterClasses: 2,
+		DenylistFile:        denylistFile,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	assert.NoError(t, policy.Validate(ctx, "abc123", password_logic.Account{}))
+	assert.ErrorIs(t, policy.Validate(ctx, "Winter2026", password_logic.Account{}), password_logic.ErrInvalidPassword)
+	assert.NoError(t, policy.Validate(ctx, "Tr0ub4dor&3x", password_logic.Account{}), "no breached passwords without a dataset")
+
+	_, err = password_logic.NewPasswordPolicyLogic(configs.PasswordPolicy{
+		DenylistFile: filepath.Join(t.TempDir(), "missing.txt"),
+	}, zap.NewNop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package logic_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	password_logic "github.com/Fiagram/gateway/internal/logic/password"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var resetUrlPattern = regexp.MustCompile(`https://\S+`)
+
+// readOutbox returns the mails written to the outbox so far.
+func readOutbox(t *testing.T) []mail.OutboxEntry {
+	file, err := os.Open(outboxFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries := make([]mail.OutboxEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry mail.OutboxEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+// requestResetToken asks for a reset and returns the token of the mailed link.
+func requestResetToken(t *testing.T, email string) string {
+	sent := len(readOutbox(t))
+	_, err := passwordResetLogic.RequestReset(context.Background(), email, "203.0.113.7")
+	require.NoError(t, err)
+
+	// The mail is sent after the request returns
+	var entries []mail.OutboxEntry
+	require.Eventually(t, func() bool {
+		entries = readOutbox(t)
+		return len(entries) > sent
+	}, time.Second, 10*time.Millisecond)
+	require.Len(t, entries, sent+1)
+	entry := entries[len(entries)-1]
+	assert.Equal(t, email, entry.To)
+	assert.Equal(t, "Fiagram <no-reply@example.com>", entry.From)
+
+	resetUrl, err := url.Parse(resetUrlPattern.FindString(entry.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "app.example.com", resetUrl.Host)
+	token := resetUrl.Query().Get("token")
+	require.NotEmpty(t, token)
+	return token
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := sessionLogic.Start(ctx, session_logic.StartParams{AccountId: 1})
+	require.NoError(t, err)
+
+	token := requestResetToken(t, "Alice@Example.com")
+	require.NoError(t, passwordResetLogic.ResetPassword(ctx, token, "N3wPassword!"))
+	assert.Equal(t, "N3wPassword!", accounts.Password(1))
+
+	_, err = sessionLogic.Rotate(ctx, issued.RefreshToken, session_logic.ClientInfo{})
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken, "a reset signs out every session")
+
+	err = passwordResetLogic.ResetPassword(ctx, token, "An0therPassword!")
+	assert.ErrorIs(t, err, password_logic.ErrInvalidResetToken, "a reset token is single-use")
+	assert.Equal(t, "N3wPassword!", accounts.Password(1))
+}
+
+func TestResetPasswordRetriesAfterFailedUpdate(t *testing.T) {
+	ctx := context.Background()
+	token := requestResetToken(t, "bob@example.com")
+
+	accounts.FailUpdates(errors.New("account service unavailable"))
+	err := passwordResetLogic.ResetPassword(ctx, token, "B0bsNewPassword!")
+	accounts.FailUpdates(nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, password_logic.ErrInvalidResetToken)
+
+	// The token was not spent by the failed update
+	require.NoError(t, passwordResetLogic.ResetPassword(ctx, token, "B0bsNewPassword!"))
+	assert.Equal(t, "B0bsNewPassword!", accounts.Password(2))
+}
+
+func TestRequestResetForUnknownEmail(t *testing.T) {
+	sent := len(readOutbox(t))
+
+	_, err := passwordResetLogic.RequestReset(context.Background(), "nobody@example.com", "203.0.113.7")
+	require.NoError(t, err)
+	assert.Never(t, func() bool {
+		return len(readOutbox(t)) > sent
+	}, 100*time.Millisecond, 10*time.Millisecond, "no mail is sent to unknown addresses")
+}
+
+func TestRequestResetIsLimitedPerEmail(t *testing.T) {
+	ctx := context.Background()
+
+	// Unknown addresses are limited alike, the answer tells nothing
+	for range 5 {
+		_, err := passwordResetLogic.RequestReset(ctx, "Carol@example.com", "198.51.100.8")
+		require.NoError(t, err)
+	}
+	retryAfter, err := passwordResetLogic.RequestReset(ctx, "carol@example.com", "198.51.100.9")
+	assert.ErrorIs(t, err, password_logic.ErrTooManyRequests)
+	assert.Equal(t, time.Hour, retryAfter)
+}
+
+func TestRequestResetIsLimitedPerIp(t *testing.T) {
+	ctx := context.Background()
+
+	for i := range 20 {
+		_, err := passwordResetLogic.RequestReset(ctx, fmt.Sprintf("guess%d@example.com", i), "198.51.100.10")
+		require.NoError(t, err)
+	}
+	_, err := passwordResetLogic.RequestReset(ctx, "guess20@example.com", "198.51.100.10")
+	assert.ErrorIs(t, err, password_logic.ErrTooManyRequests)
+
+	// Other clients are not affected
+	_, err = passwordResetLogic.RequestReset(ctx, "guess20@example.com", "198.51.100.11")
+	assert.NoError(t, err)
+}
+
+func TestOnlyLatestResetTokenIsAccepted(t *testing.T) {
+	ctx := context.Background()
+
+	older := requestResetToken(t, "bob@example.com")
+	newer := requestResetToken(t, "bob@example.com")
+
+	err := passwordResetLogic.ResetPassword(ctx, older, "N3wPassword!")
+	assert.ErrorIs(t, err, password_logic.ErrInvalidResetToken)
+	require.NoError(t, passwordResetLogic.ResetPassword(ctx, newer, "N3wPassword!"))
+}
+
+func TestResetTokenExpires(t *testing.T) {
+	token := requestResetToken(t, "bob@example.com")
+
+	clock.Advance(31 * time.Minute)
+	err := passwordResetLogic.ResetPassword(context.Background(), token, "N3wPassword!")
+	assert.ErrorIs(t, err, password_logic.ErrInvalidResetToken)
+}
+
+func TestResetPasswordValidation(t *testing.T) {
+	ctx := context.Background()
+
+	for _, password := range []string{"short", "has whitespace!", string(make([]byte, 73))} {
+		err := passwordResetLogic.ResetPassword(ctx, "token", password)
+		assert.ErrorIs(t, err, password_logic.ErrInvalidPassword)
+	}
+
+	err := passwordResetLogic.ResetPassword(ctx, "unknown-token", "N3wPassword!")
+	assert.ErrorIs(t, err, password_logic.ErrInvalidResetToken)
+}
+
+func TestResetPasswordRefusesSimilarPassword(t *testing.T) {
+	ctx := context.Background()
+
+	token := requestResetToken(t, "bob@example.com")
+	err := passwordResetLogic.ResetPassword(ctx, token, "Bob-Tables9!")
+	var policyErr *password_logic.PolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, []string{password_logic.ViolationSimilarToAccount}, policyErr.Violations)
+
+	// The token survives a refused password
+	require.NoError(t, passwordResetLogic.ResetPassword(ctx, token, "N3wPassword!"))
+}
@@ -0,0 +1,31 @@
+package logic_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	pat_logic "github.com/Fiagram/gateway/internal/logic/pat"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+)
+
+var (
+	clock    *testutils.FakeClock
+	patLogic pat_logic.PersonalAccessToken
+)
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+
+	patLogic = pat_logic.NewPersonalAccessTokenLogic(
+		cache.NewPersonalAccessToken(client, logger),
+		clock,
+		logger,
+	)
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,145 @@
+package logic_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pat_logic "github.com/Fiagram/gateway/internal/logic/pat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonalAccessTokenCreateAndVerify(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(2001)
+
+	token, entry, err := patLogic.Create(ctx, pat_logic.CreateParams{
+		AccountId: accountId,
+		Name:      "ci-deploy",
+		Scopes:    []string{"read:accounts"},
+	})
+	require.NoError(t, err)
+	assert.True(t, pat_logic.IsPersonalAccessToken(token))
+	assert.True(t, strings.HasPrefix(token, pat_logic.TokenPrefix+entry.Id+"_"))
+	assert.NotContains(t, entry.SecretHash, strings.TrimPrefix(token, pat_logic.TokenPrefix+entry.Id+"_"),
+		"the secret is only stored hashed")
+
+	verified, err := patLogic.Verify(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, accountId, verified.AccountId)
+	assert.Equal(t, []string{"read:accounts"}, verified.Scopes)
+	assert.Equal(t, clock.Now().Unix(), verified.LastUsedAt)
+}
+
+func TestPersonalAccessTokenRejectsWrongSecret(t *testing.T) {
+	ctx := context.Background()
+
+	token, entry, err := patLogic.Create(ctx, pat_logic.CreateParams{AccountId: 2002, Name: "script"})
+	require.NoError(t, err)
+
+	tests := []string{
+		pat_logic.TokenPrefix + entry.Id + "_" + "not-the-secret",
+		pat_logic.TokenPrefix + entry.Id,
+		pat_logic.TokenPrefix + "0000000000000000_" + strings.TrimPrefix(token, pat_logic.TokenPrefix+entry.Id+"_"),
+		strings.TrimPrefix(token, pat_logic.TokenPrefix),
+	}
+	for _, tt := range tests {
+		_, err := patLogic.Verify(ctx, tt)
+		assert.ErrorIs(t, err, pat_logic.ErrInvalidToken, "token %q", tt)
+	}
+}
+
+func TestPersonalAccessTokenExpires(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := patLogic.Create(ctx, pat_logic.CreateParams{
+		AccountId: 2003,
+		Name:      "expired",
+		ExpiresAt: clock.Now().Add(-time.Second),
+	})
+	assert.ErrorIs(t, err, pat_logic.ErrInvalidExpiry)
+
+	token, entry, err := patLogic.Create(ctx, pat_logic.CreateParams{
+		AccountId: 2003,
+		Name:      "short-lived",
+		ExpiresAt: clock.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(time.Hour).Unix(), entry.ExpiresAt)
+
+	_, err = patLogic.Verify(ctx, token)
+	require.NoError(t, err)
+
+	clock.Advance(time.Hour)
+	_, err = patLogic.Verify(ctx, token)
+	assert.ErrorIs(t, err, pat_logic.ErrInvalidToken)
+}
+
+func TestPersonalAccessTokenRecordsLastUseToTheMinute(t *testing.T) {
+	ctx := context.Background()
+
+	token, _, err := patLogic.Create(ctx, pat_logic.CreateParams{AccountId: 2004, Name: "busy"})
+	require.NoError(t, err)
+
+	first, err := patLogic.Verify(ctx, token)
+	require.NoError(t, err)
+
+	clock.Advance(10 * time.Second)
+	second, err := patLogic.Verify(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, first.LastUsedAt, second.LastUsedAt)
+
+	clock.Advance(time.Minute)
+	third, err := patLogic.Verify(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Unix(), third.LastUsedAt)
+}
+
+func TestPersonalAccessTokenListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(2005)
+
+	token, entry, err := patLogic.Create(ctx, pat_logic.CreateParams{AccountId: accountId, Name: "first"})
+	require.NoError(t, err)
+	_, _, err = patLogic.Create(ctx, pat_logic.CreateParams{AccountId: accountId, Name: "second"})
+	require.NoError(t, err)
+
+	entries, err := patLogic.List(ctx, accountId)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// Other accounts cannot revoke the token
+	err = patLogic.Revoke(ctx, accountId+1, entry.Id)
+	assert.ErrorIs(t, err, pat_logic.ErrTokenNotFound)
+
+	require.NoError(t, patLogic.Revoke(ctx, accountId, entry.Id))
+	_, err = patLogic.Verify(ctx, token)
+	assert.ErrorIs(t, err, pat_logic.ErrInvalidToken)
+
+	err = patLogic.Revoke(ctx, accountId, entry.Id)
+	assert.ErrorIs(t, err, pat_logic.ErrTokenNotFound)
+
+	entries, err = patLogic.List(ctx, accountId)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", entries[0].Name)
+}
+
+func TestPersonalAccessTokenValidatesParams(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		params   pat_logic.CreateParams
+		expected error
+	}{
+		"blank name":    {pat_logic.CreateParams{AccountId: 2006, Name: "  "}, pat_logic.ErrInvalidName},
+		"long name":     {pat_logic.CreateParams{AccountId: 2006, Name: strings.Repeat("x", 101)}, pat_logic.ErrInvalidName},
+		"invalid scope": {pat_logic.CreateParams{AccountId: 2006, Name: "x", Scopes: []string{"Read Accounts"}}, pat_logic.ErrInvalidScope},
+	}
+	for name, tt := range tests {
+		_, _, err := patLogic.Create(ctx, tt.params)
+		assert.ErrorIs(t, err, tt.expected, name)
+	}
+}
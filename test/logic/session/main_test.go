@@ -0,0 +1,55 @@
+package logic_test
+
+import (
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+)
+
+var (
+	client       cache.Client
+	clock        *testutils.FakeClock
+	tokenLogic   token_logic.Token
+	sessionLogic session_logic.Session
+)
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	clock = testutils.NewFakeClock(time.Now())
+	config := configs.Token{
+		Algorithm:           token_logic.AlgorithmHS256,
+		Secret:              "test-secret-key-123",
+		AccessTokenTTL:      15 * time.Minute,
+		RefreshTokenTTL:     24 * time.Hour,
+		RefreshTokenLongTTL: 720 * time.Hour,
+	}
+
+	keyring, err := token_logic.NewKeyring(config, clock, logger)
+	if err != nil {
+		log.Fatal("failed to init keyring")
+	}
+	tokenLogic = token_logic.NewTokenLogic(config, keyring, clock, logger)
+
+	client = cache.NewRamClient(logger)
+	sessionLogic = session_logic.NewSessionLogic(
+		config,
+		session_logic.NewSessionPolicy(config, clock),
+		cache.NewRefreshToken(client, logger),
+		cache.NewRefreshTokenFamily(client, logger),
+		cache.NewSession(client, logger),
+		cache.NewAccessTokenRevocation(client, logger),
+		tokenLogic,
+		clock,
+		logger,
+	)
+
+	os.Exit(m.Run())
+}
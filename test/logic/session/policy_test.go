@@ -0,0 +1,53 @@
+package logic_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	"github.com/Fiagram/gateway/test/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionPolicy(t *testing.T) {
+	policyClock := testutils.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	policy := session_logic.NewSessionPolicy(configs.Token{
+		RefreshTokenTTL:              time.Hour,
+		RefreshTokenLongTTL:          24 * time.Hour,
+		SessionMaxLifetime:           8 * time.Hour,
+		RememberMeSessionMaxLifetime: 72 * time.Hour,
+	}, policyClock)
+	createdAt := policyClock.Now()
+
+	tests := []struct {
+		name         string
+		age          time.Duration
+		isRememberMe bool
+		expiresIn    time.Duration
+		isExpired    bool
+	}{
+		{name: "new session", age: 0, expiresIn: time.Hour},
+		{name: "new remember-me session", age: 0, isRememberMe: true, expiresIn: 24 * time.Hour},
+		{name: "idle timeout capped by max lifetime", age: 7*time.Hour + 30*time.Minute, expiresIn: 30 * time.Minute},
+		{name: "remember-me outlives the short max lifetime", age: 10 * time.Hour, isRememberMe: true, expiresIn: 24 * time.Hour},
+		{name: "remember-me capped by its max lifetime", age: 60 * time.Hour, isRememberMe: true, expiresIn: 12 * time.Hour},
+		{name: "past max lifetime", age: 8 * time.Hour, isExpired: true},
+		{name: "remember-me past max lifetime", age: 80 * time.Hour, isRememberMe: true, isExpired: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyClock.Set(createdAt.Add(tt.age))
+
+			expiresAt, err := policy.ExpiresAt(createdAt, tt.isRememberMe)
+			if tt.isExpired {
+				assert.ErrorIs(t, err, session_logic.ErrSessionExpired)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, policyClock.Now().Add(tt.expiresIn), expiresAt)
+		})
+	}
+}
@@ -0,0 +1,434 @@
+package logic_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	session_logic "github.com/Fiagram/gateway/internal/logic/session"
+	token_logic "github.com/Fiagram/gateway/internal/logic/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var (
+	laptop = session_logic.ClientInfo{UserAgent: "Mozilla/5.0 (X11; Linux x86_64)", IpAddress: "203.0.113.7"}
+	phone  = session_logic.ClientInfo{UserAgent: "Mozilla/5.0 (iPhone)", IpAddress: "198.51.100.23"}
+)
+
+// Helper function to start a session from the given device
+func startSession(t *testing.T, accountId uint64, client session_logic.ClientInfo) session_logic.IssuedRefreshToken {
+	issued, err := sessionLogic.Start(context.Background(), session_logic.StartParams{
+		AccountId: accountId,
+		Client:    client,
+	})
+	require.NoError(t, err)
+	return issued
+}
+
+func TestSessionRotate(t *testing.T) {
+	ctx := context.Background()
+
+	issued1 := startSession(t, 1001, laptop)
+
+	issued2, err := sessionLogic.Rotate(ctx, issued1.RefreshToken, laptop)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1001), issued2.AccountId)
+	assert.Equal(t, issued1.SessionId, issued2.SessionId)
+	assert.NotEqual(t, issued1.RefreshToken, issued2.RefreshToken)
+
+	issued3, err := sessionLogic.Rotate(ctx, issued2.RefreshToken, laptop)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1001), issued3.AccountId)
+	assert.NotEqual(t, issued2.RefreshToken, issued3.RefreshToken)
+}
+
+func TestSessionReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+
+	stolen := startSession(t, 1002, laptop).RefreshToken
+
+	// The legitimate client rotates first, the attacker replays afterwards
+	current, err := sessionLogic.Rotate(ctx, stolen, laptop)
+	require.NoError(t, err)
+
+	_, err = sessionLogic.Rotate(ctx, stolen, phone)
+	assert.ErrorIs(t, err, session_logic.ErrRefreshTokenReused)
+
+	// Every token of the family is dead now, including the newest one
+	_, err = sessionLogic.Rotate(ctx, current.RefreshToken, laptop)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+
+	sessions, err := sessionLogic.List(ctx, 1002)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestSessionReuseAfterAttackerRotated(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := sessionLogic.Start(ctx, session_logic.StartParams{
+		AccountId:    1003,
+		IsRememberMe: true,
+		Client:       laptop,
+	})
+	require.NoError(t, err)
+
+	// The attacker rotates first and keeps the branch alive
+	attacker, err := sessionLogic.Rotate(ctx, issued.RefreshToken, phone)
+	require.NoError(t, err)
+
+	// The victim's refresh with the original token exposes the reuse
+	_, err = sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+	assert.ErrorIs(t, err, session_logic.ErrRefreshTokenReused)
+
+	_, err = sessionLogic.Rotate(ctx, attacker.RefreshToken, phone)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+}
+
+func TestSessionRevoke(t *testing.T) {
+	ctx := context.Background()
+
+	issued1 := startSession(t, 1004, laptop)
+	issued2, err := sessionLogic.Rotate(ctx, issued1.RefreshToken, laptop)
+	require.NoError(t, err)
+
+	require.NoError(t, sessionLogic.Revoke(ctx, issued2.RefreshToken))
+
+	_, err = sessionLogic.Rotate(ctx, issued2.RefreshToken, laptop)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+
+	sessions, err := sessionLogic.List(ctx, 1004)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// Revoking an unknown token is not an error
+	assert.NoError(t, sessionLogic.Revoke(ctx, "unknown_token"))
+}
+
+func TestSessionsAreIndependent(t *testing.T) {
+	ctx := context.Background()
+
+	onLaptop := startSession(t, 1005, laptop)
+	onPhone := startSession(t, 1005, phone)
+
+	// Revoking one family leaves the other sign-in untouched
+	_, err := sessionLogic.Rotate(ctx, onLaptop.RefreshToken, laptop)
+	require.NoError(t, err)
+	_, err = sessionLogic.Rotate(ctx, onLaptop.RefreshToken, laptop)
+	require.ErrorIs(t, err, session_logic.ErrRefreshTokenReused)
+
+	_, err = sessionLogic.Rotate(ctx, onPhone.RefreshToken, phone)
+	assert.NoError(t, err)
+}
+
+func TestSessionRotateUnknownToken(t *testing.T) {
+	_, err := sessionLogic.Rotate(context.Background(), "unknown_token", laptop)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+}
+
+func TestSessionRotateOldFormatToken(t *testing.T) {
+	ctx := context.Background()
+
+	// Tokens stored before the entries were JSON only hold the account id
+	require.NoError(t, client.Set(ctx, "refresh_token:old_format_token", "1001", time.Hour))
+
+	_, err := sessionLogic.Rotate(ctx, "old_format_token", laptop)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+
+	require.NoError(t, sessionLogic.Revoke(ctx, "old_format_token"))
+	_, err = client.Get(ctx, "refresh_token:old_format_token")
+	assert.ErrorIs(t, err, cache.ErrCacheMiss)
+}
+
+func TestSessionRotateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	issued := startSession(t, 1020, laptop)
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		successes int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := sessionLogic.Rotate(ctx, issued.RefreshToken, laptop); err == nil {
+				mutex.Lock()
+				successes++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, successes, "a refresh token must not rotate twice")
+}
+
+func TestSessionList(t *testing.T) {
+	ctx := context.Background()
+
+	onLaptop := startSession(t, 1006, laptop)
+	onPhone := startSession(t, 1006, phone)
+	startSession(t, 1007, laptop)
+
+	// Refreshing from another network updates the device details
+	moved := session_logic.ClientInfo{UserAgent: phone.UserAgent, IpAddress: "192.0.2.99"}
+	_, err := sessionLogic.Rotate(ctx, onPhone.RefreshToken, moved)
+	require.NoError(t, err)
+
+	sessions, err := sessionLogic.List(ctx, 1006)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	byId := make(map[string]string)
+	for _, s := range sessions {
+		assert.Equal(t, uint64(1006), s.AccountId)
+		assert.NotZero(t, s.CreatedAt)
+		assert.GreaterOrEqual(t, s.LastRefreshedAt, s.CreatedAt)
+		byId[s.Id] = s.IpAddress
+	}
+	assert.Equal(t, laptop.IpAddress, byId[onLaptop.SessionId])
+	assert.Equal(t, moved.IpAddress, byId[onPhone.SessionId])
+}
+
+func TestSessionRevokeById(t *testing.T) {
+	ctx := context.Background()
+
+	onLaptop := startSession(t, 1008, laptop)
+	onPhone := startSession(t, 1008, phone)
+
+	// Another account cannot revoke or even detect the session
+	err := sessionLogic.RevokeSession(ctx, 1009, onPhone.SessionId)
+	assert.ErrorIs(t, err, session_logic.ErrSessionNotFound)
+
+	require.NoError(t, sessionLogic.RevokeSession(ctx, 1008, onPhone.SessionId))
+
+	_, err = sessionLogic.Rotate(ctx, onPhone.RefreshToken, phone)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+
+	sessions, err := sessionLogic.List(ctx, 1008)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, onLaptop.SessionId, sessions[0].Id)
+
+	err = sessionLogic.RevokeSession(ctx, 1008, onPhone.SessionId)
+	assert.ErrorIs(t, err, session_logic.ErrSessionNotFound)
+}
+
+func TestSessionRevokeAll(t *testing.T) {
+	ctx := context.Background()
+
+	onLaptop := startSession(t, 1010, laptop)
+	onPhone := startSession(t, 1010, phone)
+	elsewhere := startSession(t, 1011, laptop)
+
+	accessToken, _, err := tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{AccountId: 1010})
+	require.NoError(t, err)
+	payload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+
+	clock.Advance(time.Second)
+	require.NoError(t, sessionLogic.RevokeAll(ctx, 1010))
+
+	// Every refresh token and every access token issued so far is dead
+	_, err = sessionLogic.Rotate(ctx, onLaptop.RefreshToken, laptop)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+	_, err = sessionLogic.Rotate(ctx, onPhone.RefreshToken, phone)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+
+	isRevoked, err := sessionLogic.IsAccessTokenRevoked(ctx, payload)
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+
+	sessions, err := sessionLogic.List(ctx, 1010)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// Other accounts are untouched
+	_, err = sessionLogic.Rotate(ctx, elsewhere.RefreshToken, laptop)
+	assert.NoError(t, err)
+
+	// Signing in again afterwards works
+	clock.Advance(time.Second)
+	accessToken, _, err = tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{AccountId: 1010})
+	require.NoError(t, err)
+	payload, _, err = tokenLogic.GetPayloadFromAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+
+	isRevoked, err = sessionLogic.IsAccessTokenRevoked(ctx, payload)
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+}
+
+func TestSessionRevokeAllKeepsTokensIssuedInTheSameSecond(t *testing.T) {
+	ctx := context.Background()
+
+	// Start on a whole second so that every step below stays within it
+	clock.Set(clock.Now().Truncate(time.Second).Add(time.Second))
+	revokedAt := clock.Now()
+
+	before, _, err := tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{AccountId: 1021})
+	require.NoError(t, err)
+	beforePayload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, before)
+	require.NoError(t, err)
+
+	clock.Advance(300 * time.Millisecond)
+	require.NoError(t, sessionLogic.RevokeAll(ctx, 1021))
+
+	clock.Advance(300 * time.Millisecond)
+	after, _, err := tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{AccountId: 1021})
+	require.NoError(t, err)
+	afterPayload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, after)
+	require.NoError(t, err)
+	require.Equal(t, revokedAt.Unix(), afterPayload.IssuedAt.Unix())
+
+	isRevoked, err := sessionLogic.IsAccessTokenRevoked(ctx, beforePayload)
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+
+	isRevoked, err = sessionLogic.IsAccessTokenRevoked(ctx, afterPayload)
+	require.NoError(t, err)
+	assert.False(t, isRevoked, "a sign-in right after signing out everywhere keeps its token")
+}
+
+func TestSessionRevokeAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	revoked, expiresAt, err := tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{AccountId: 1012})
+	require.NoError(t, err)
+	kept, _, err := tokenLogic.GenerateAccessToken(ctx, token_logic.TokenPayload{AccountId: 1012})
+	require.NoError(t, err)
+
+	revokedPayload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, revoked)
+	require.NoError(t, err)
+	keptPayload, _, err := tokenLogic.GetPayloadFromAccessToken(ctx, kept)
+	require.NoError(t, err)
+
+	require.NoError(t, sessionLogic.RevokeAccessToken(ctx, revokedPayload, expiresAt))
+
+	isRevoked, err := sessionLogic.IsAccessTokenRevoked(ctx, revokedPayload)
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+
+	// Only the token with that jti is refused
+	isRevoked, err = sessionLogic.IsAccessTokenRevoked(ctx, keptPayload)
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+}
+
+func TestSessionKeepsAuthTime(t *testing.T) {
+	ctx := context.Background()
+
+	issued := startSession(t, 1012, laptop)
+	assert.Equal(t, clock.Now().Unix(), issued.AuthTime.Unix())
+	authTime := issued.AuthTime
+
+	// Refreshing is not authenticating
+	clock.Advance(time.Hour)
+	issued, err := sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+	require.NoError(t, err)
+	assert.Equal(t, authTime.Unix(), issued.AuthTime.Unix())
+
+	reauthenticatedAt, err := sessionLogic.Reauthenticate(ctx, 1012, issued.SessionId)
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Unix(), reauthenticatedAt.Unix())
+
+	issued, err = sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+	require.NoError(t, err)
+	assert.Equal(t, reauthenticatedAt.Unix(), issued.AuthTime.Unix())
+
+	// Only the owner of the session can reauthenticate in it
+	_, err = sessionLogic.Reauthenticate(ctx, 1013, issued.SessionId)
+	assert.ErrorIs(t, err, session_logic.ErrSessionNotFound)
+
+	require.NoError(t, sessionLogic.Revoke(ctx, issued.RefreshToken))
+	_, err = sessionLogic.Reauthenticate(ctx, 1012, issued.SessionId)
+	assert.ErrorIs(t, err, session_logic.ErrSessionNotFound)
+}
+
+func TestSessionReauthenticateRefusesOidcSessions(t *testing.T) {
+	issued, err := sessionLogic.Start(context.Background(), session_logic.StartParams{
+		AccountId: 1014,
+		Client:    laptop,
+		ClientId:  "web",
+	})
+	require.NoError(t, err)
+
+	_, err = sessionLogic.Reauthenticate(context.Background(), 1014, issued.SessionId)
+	assert.ErrorIs(t, err, session_logic.ErrSessionNotFound)
+}
+
+func TestSessionBoundToDpopKey(t *testing.T) {
+	ctx := context.Background()
+	boundLaptop := laptop
+	boundLaptop.KeyThumbprint = "laptop-key-thumbprint"
+
+	issued := startSession(t, 1015, boundLaptop)
+
+	// Without the key the token is refused and stays usable for its owner
+	_, err := sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+	assert.ErrorIs(t, err, session_logic.ErrKeyMismatch)
+
+	issued, err = sessionLogic.Rotate(ctx, issued.RefreshToken, boundLaptop)
+	require.NoError(t, err)
+	_, err = sessionLogic.Rotate(ctx, issued.RefreshToken, boundLaptop)
+	assert.NoError(t, err)
+}
+
+func TestSessionRememberMeSurvivesRotation(t *testing.T) {
+	ctx := context.Background()
+
+	issued, err := sessionLogic.Start(ctx, session_logic.StartParams{
+		AccountId:    1016,
+		IsRememberMe: true,
+		Client:       laptop,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(720*time.Hour).Unix(), issued.ExpiresAt.Unix())
+
+	// Rotation keeps the long idle timeout instead of the short one
+	clock.Advance(time.Hour)
+	issued, err = sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(720*time.Hour).Unix(), issued.ExpiresAt.Unix())
+
+	entry, err := cache.NewRefreshToken(client, zap.NewNop()).Get(ctx, issued.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, issued.ExpiresAt.Unix(), entry.ExpiresAt, "the cache and the cookie expire together")
+
+	issued = startSession(t, 1016, phone)
+	assert.Equal(t, clock.Now().Add(24*time.Hour).Unix(), issued.ExpiresAt.Unix())
+}
+
+func TestSessionEndsAtMaxLifetime(t *testing.T) {
+	ctx := context.Background()
+
+	issued := startSession(t, 1017, laptop)
+	endsAt := clock.Now().Add(7 * 24 * time.Hour)
+
+	// Daily use keeps the session alive, but not past its maximum lifetime
+	var err error
+	for range 6 {
+		clock.Advance(23 * time.Hour)
+		issued, err = sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+		require.NoError(t, err)
+		assert.Equal(t, clock.Now().Add(24*time.Hour).Unix(), issued.ExpiresAt.Unix())
+	}
+	clock.Advance(23 * time.Hour)
+	issued, err = sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+	require.NoError(t, err)
+	assert.Equal(t, endsAt.Unix(), issued.ExpiresAt.Unix())
+
+	clock.Advance(24 * time.Hour)
+	_, err = sessionLogic.Rotate(ctx, issued.RefreshToken, laptop)
+	assert.ErrorIs(t, err, session_logic.ErrInvalidRefreshToken)
+
+	sessions, err := sessionLogic.List(ctx, 1017)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
@@ -0,0 +1,41 @@
+package logic_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+)
+
+var (
+	clock         *testutils.FakeClock
+	throttleLogic throttle_logic.SignInThrottle
+)
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+
+	throttleLogic = throttle_logic.NewSignInThrottleLogic(
+		configs.SignInThrottle{
+			Window:              time.Hour,
+			DelayAfter:          2,
+			BaseDelay:           time.Minute,
+			MaxDelay:            4 * time.Minute,
+			UsernameMaxFailures: 6,
+			IpMaxFailures:       8,
+			LockoutDuration:     time.Hour,
+		},
+		cache.NewSignInThrottle(client, logger),
+		clock,
+		logger,
+	)
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,126 @@
+package logic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	throttle_logic "github.com/Fiagram/gateway/internal/logic/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fail records failures of the username and asserts the delay that follows
+// the last one.
+func fail(t *testing.T, username string, ipAddress string, times int, expectedRetryAfter time.Duration) {
+	ctx := context.Background()
+	for range times {
+		require.NoError(t, throttleLogic.RecordFailure(ctx, username, ipAddress))
+	}
+
+	retryAfter, err := throttleLogic.Check(ctx, username, ipAddress)
+	if expectedRetryAfter == 0 {
+		require.NoError(t, err)
+		return
+	}
+	require.ErrorIs(t, err, throttle_logic.ErrTooManyAttempts)
+	assert.InDelta(t, expectedRetryAfter.Seconds(), retryAfter.Seconds(), 1)
+}
+
+func TestProgressiveDelays(t *testing.T) {
+	fail(t, "delayed", "198.51.100.1", 2, 0)
+	fail(t, "delayed", "198.51.100.1", 1, time.Minute)
+
+	clock.Advance(time.Minute)
+	fail(t, "delayed", "198.51.100.1", 1, 2*time.Minute)
+
+	clock.Advance(2 * time.Minute)
+	fail(t, "delayed", "198.51.100.1", 1, 4*time.Minute)
+
+	clock.Advance(4 * time.Minute)
+	fail(t, "delayed", "198.51.100.1", 0, 0)
+}
+
+func TestDelayIsCapped(t *testing.T) {
+	// Failures recorded while blocked still count, as a concurrent attacker
+	// would produce them
+	fail(t, "capped", "198.51.100.2", 5, 4*time.Minute)
+}
+
+func TestLockoutAndUnlock(t *testing.T) {
+	ctx := context.Background()
+
+	fail(t, "locked", "198.51.100.3", 6, time.Hour)
+
+	lockouts, err := throttleLogic.ListLockouts(ctx)
+	require.NoError(t, err)
+	require.Len(t, lockouts, 1)
+	assert.Equal(t, throttle_logic.KindUsername, lockouts[0].Kind)
+	assert.Equal(t, "locked", lockouts[0].Value)
+	assert.Equal(t, int64(6), lockouts[0].Failures)
+
+	// The username is locked whatever its spelling and IP
+	_, err = throttleLogic.Check(ctx, "LOCKED", "203.0.113.9")
+	assert.ErrorIs(t, err, throttle_logic.ErrTooManyAttempts)
+
+	require.NoError(t, throttleLogic.Unlock(ctx, throttle_logic.KindUsername, "Locked"))
+	_, err = throttleLogic.Check(ctx, "locked", "203.0.113.9")
+	assert.NoError(t, err)
+
+	lockouts, err = throttleLogic.ListLockouts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, lockouts)
+
+	err = throttleLogic.Unlock(ctx, throttle_logic.KindUsername, "locked")
+	assert.ErrorIs(t, err, throttle_logic.ErrLockoutNotFound)
+	err = throttleLogic.Unlock(ctx, "email", "locked")
+	assert.ErrorIs(t, err, throttle_logic.ErrInvalidKind)
+}
+
+func TestIpLockoutSpansUsernames(t *testing.T) {
+	ctx := context.Background()
+
+	for _, username := range []string{"ip-a", "ip-b", "ip-c"} {
+		fail(t, username, "198.51.100.4", 2, 0)
+	}
+	fail(t, "ip-d", "198.51.100.4", 2, time.Hour)
+
+	// The eighth failure of the IP locks it out for every username
+	_, err := throttleLogic.Check(ctx, "ip-e", "198.51.100.4")
+	assert.ErrorIs(t, err, throttle_logic.ErrTooManyAttempts)
+
+	require.NoError(t, throttleLogic.Unlock(ctx, throttle_logic.KindIp, "198.51.100.4"))
+	_, err = throttleLogic.Check(ctx, "ip-e", "198.51.100.4")
+	assert.NoError(t, err)
+}
+
+func TestSuccessResetsUsernameFailures(t *testing.T) {
+	ctx := context.Background()
+
+	fail(t, "forgetful", "198.51.100.5", 2, 0)
+	require.NoError(t, throttleLogic.RecordSuccess(ctx, "forgetful"))
+
+	// Two more failures would have been the third and fourth
+	fail(t, "forgetful", "198.51.100.5", 2, 0)
+}
+
+func TestAccountFailuresOutliveThePasswordStep(t *testing.T) {
+	ctx := context.Background()
+
+	for range 3 {
+		require.NoError(t, throttleLogic.RecordAccountFailure(ctx, 7001))
+		// Each new challenge starts with a valid password
+		require.NoError(t, throttleLogic.RecordSuccess(ctx, "second-factor"))
+	}
+
+	retryAfter, err := throttleLogic.CheckAccount(ctx, 7001)
+	assert.ErrorIs(t, err, throttle_logic.ErrTooManyAttempts)
+	assert.InDelta(t, time.Minute.Seconds(), retryAfter.Seconds(), 1)
+
+	// A valid code forgets the failures
+	clock.Advance(time.Minute)
+	require.NoError(t, throttleLogic.RecordAccountSuccess(ctx, 7001))
+	require.NoError(t, throttleLogic.RecordAccountFailure(ctx, 7001))
+	_, err = throttleLogic.CheckAccount(ctx, 7001)
+	assert.NoError(t, err)
+}
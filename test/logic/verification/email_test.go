@@ -0,0 +1,132 @@
+package logic_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	verification_logic "github.com/Fiagram/gateway/internal/logic/verification"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var verifyUrlPattern = regexp.MustCompile(`https://\S+`)
+
+// readOutbox returns the mails written to the outbox so far.
+func readOutbox(t *testing.T) []mail.OutboxEntry {
+	file, err := os.Open(outboxFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries := make([]mail.OutboxEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry mail.OutboxEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+// lastToken returns the token of the latest mailed link, sent to email.
+func lastToken(t *testing.T, email string) string {
+	entries := readOutbox(t)
+	require.NotEmpty(t, entries)
+	entry := entries[len(entries)-1]
+	assert.Equal(t, email, entry.To)
+
+	verifyUrl, err := url.Parse(verifyUrlPattern.FindString(entry.Body))
+	require.NoError(t, err)
+	token := verifyUrl.Query().Get("token")
+	require.NotEmpty(t, token)
+	return token
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+
+	require.NoError(t, verificationLogic.Start(ctx, 1, "alice@example.com"))
+	isVerified, err := verificationLogic.IsVerified(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, isVerified)
+
+	token := lastToken(t, "alice@example.com")
+	accountId, err := verificationLogic.Verify(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), accountId)
+
+	isVerified, err = verificationLogic.IsVerified(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, isVerified)
+
+	_, err = verificationLogic.Verify(ctx, token)
+	assert.ErrorIs(t, err, verification_logic.ErrInvalidVerificationToken, "a token is single-use")
+
+	// Verified addresses get no more links
+	sent := len(readOutbox(t))
+	require.NoError(t, verificationLogic.Resend(ctx, "alice@example.com"))
+	assert.Len(t, readOutbox(t), sent)
+}
+
+func TestVerifyEmailWithInvalidToken(t *testing.T) {
+	_, err := verificationLogic.Verify(context.Background(), "not-a-token")
+	assert.ErrorIs(t, err, verification_logic.ErrInvalidVerificationToken)
+}
+
+func TestVerifyEmailWithExpiredToken(t *testing.T) {
+	ctx := context.Background()
+
+	require.NoError(t, verificationLogic.Start(ctx, 2, "bob@example.com"))
+	token := lastToken(t, "bob@example.com")
+
+	clock.Advance(25 * time.Hour)
+	_, err := verificationLogic.Verify(ctx, token)
+	assert.ErrorIs(t, err, verification_logic.ErrInvalidVerificationToken)
+
+	isVerified, err := verificationLogic.IsVerified(ctx, 2)
+	require.NoError(t, err)
+	assert.False(t, isVerified)
+}
+
+func TestResendEmailVerificationCooldown(t *testing.T) {
+	ctx := context.Background()
+
+	require.NoError(t, verificationLogic.Start(ctx, 3, "carol@example.com"))
+	firstToken := lastToken(t, "carol@example.com")
+
+	sent := len(readOutbox(t))
+	require.NoError(t, verificationLogic.Resend(ctx, "Carol@Example.com"))
+	assert.Len(t, readOutbox(t), sent, "no mail within the cooldown")
+
+	clock.Advance(2 * time.Minute)
+	require.NoError(t, verificationLogic.Resend(ctx, "carol@example.com"))
+	require.Len(t, readOutbox(t), sent+1)
+	secondToken := lastToken(t, "carol@example.com")
+	assert.NotEqual(t, firstToken, secondToken)
+
+	accountId, err := verificationLogic.Verify(ctx, secondToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), accountId)
+}
+
+func TestResendEmailVerificationForUnknownEmail(t *testing.T) {
+	sent := len(readOutbox(t))
+	require.NoError(t, verificationLogic.Resend(context.Background(), "nobody@example.com"))
+	assert.Len(t, readOutbox(t), sent)
+}
+
+func TestIsVerifiedWithoutVerification(t *testing.T) {
+	isVerified, err := verificationLogic.IsVerified(context.Background(), 42)
+	require.NoError(t, err)
+	assert.True(t, isVerified, "accounts created before verification count as verified")
+}
@@ -0,0 +1,50 @@
+package logic_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	"github.com/Fiagram/gateway/internal/dataaccess/mail"
+	verification_logic "github.com/Fiagram/gateway/internal/logic/verification"
+	"github.com/Fiagram/gateway/test/testutils"
+	"go.uber.org/zap"
+)
+
+var (
+	clock             *testutils.FakeClock
+	outboxFile        string
+	verificationLogic verification_logic.EmailVerification
+)
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+	clock = testutils.NewFakeClock(time.Now())
+
+	outboxDir, err := os.MkdirTemp("", "outbox")
+	if err != nil {
+		panic(err)
+	}
+	outboxFile = filepath.Join(outboxDir, "outbox.jsonl")
+
+	verificationLogic = verification_logic.NewEmailVerificationLogic(
+		configs.EmailVerification{
+			Url:              "https://app.example.com/verify-email",
+			TokenTTL:         24 * time.Hour,
+			ResendCooldown:   time.Minute,
+			UnverifiedAccess: configs.UnverifiedAccessRestrict,
+		},
+		cache.NewEmailVerification(client, logger),
+		mail.NewFileSender("Fiagram <no-reply@example.com>", outboxFile, logger),
+		clock,
+		logger,
+	)
+
+	code := m.Run()
+	os.RemoveAll(outboxDir)
+	os.Exit(code)
+}
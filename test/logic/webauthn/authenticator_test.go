@@ -0,0 +1,147 @@
+package logic_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/stretchr/testify/require"
+)
+
+// Authenticator data flags of the WebAuthn specification
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// softAuthenticator is a platform authenticator holding a single P-256
+// passkey in memory, it answers ceremonies the way a browser would pass
+// them on to the relying party.
+type softAuthenticator struct {
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialId := make([]byte, 32)
+	_, err = rand.Read(credentialId)
+	require.NoError(t, err)
+
+	return &softAuthenticator{
+		origin:       origin,
+		key:          key,
+		credentialId: credentialId,
+	}
+}
+
+// clone copies the passkey including its sign counter, as malware
+// extracting the private key would.
+func (a *softAuthenticator) clone() *softAuthenticator {
+	copied := *a
+	return &copied
+}
+
+// create answers navigator.credentials.create() with a "none" attestation
+func (a *softAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) []byte {
+	userHandle, ok := options.Response.User.ID.(protocol.URLEncodedBase64)
+	require.True(t, ok)
+	a.userHandle = userHandle
+
+	clientData := a.clientData(t, "webauthn.create", options.Response.Challenge)
+
+	// COSE_Key of an EC2 P-256 ES256 public key
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	authData := a.authData(flagUserPresent | flagUserVerified | flagAttestedCredentialData)
+	authData = append(authData, make([]byte, 16)...) // zero AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialId)))
+	authData = append(authData, a.credentialId...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    encode(clientData),
+		"attestationObject": encode(attestationObject),
+		"transports":        []string{"internal"},
+	})
+}
+
+// get answers navigator.credentials.get() with a signed assertion
+func (a *softAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion) []byte {
+	a.signCount++
+	clientData := a.clientData(t, "webauthn.get", options.Response.Challenge)
+	authData := a.authData(flagUserPresent | flagUserVerified)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	clientData, err := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge.String(),
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	require.NoError(t, err)
+	return clientData
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	authData := append(rpIdHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, a.signCount)
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]any) []byte {
+	credential, err := json.Marshal(map[string]any{
+		"id":                      encode(a.credentialId),
+		"rawId":                   encode(a.credentialId),
+		"type":                    "public-key",
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+		"response":                response,
+	})
+	require.NoError(t, err)
+	return credential
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,44 @@
+package logic_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Fiagram/gateway/internal/configs"
+	"github.com/Fiagram/gateway/internal/dataaccess/cache"
+	webauthn_logic "github.com/Fiagram/gateway/internal/logic/webauthn"
+	"github.com/Fiagram/gateway/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	rpId   = "localhost"
+	origin = "http://localhost:8080"
+)
+
+var webAuthnLogic webauthn_logic.WebAuthn
+
+func TestMain(m *testing.M) {
+	logger := zap.NewNop()
+	client := cache.NewRamClient(logger)
+
+	var err error
+	webAuthnLogic, err = webauthn_logic.NewWebAuthnLogic(
+		configs.WebAuthn{
+			RPID:          rpId,
+			RPDisplayName: "Fiagram",
+			RPOrigins:     []string{origin},
+			CeremonyTTL:   5 * time.Minute,
+		},
+		cache.NewWebAuthnSession(client, logger),
+		cache.NewWebAuthnCredential(client, logger),
+		utils.NewClock(),
+		logger,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,211 @@
+package logic_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	webauthn_logic "github.com/Fiagram/gateway/internal/logic/webauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to register the passkey of the authenticator to an account
+func registerPasskey(t *testing.T, accountId uint64, authenticator *softAuthenticator) {
+	ctx := context.Background()
+
+	sessionId, options, err := webAuthnLogic.BeginRegistration(ctx, accountId, "alice", "Alice")
+	require.NoError(t, err)
+	require.NotEmpty(t, sessionId)
+
+	err = webAuthnLogic.FinishRegistration(ctx, accountId, sessionId, authenticator.create(t, options))
+	require.NoError(t, err)
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1001)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+
+	// Every login verifies a fresh signature
+	for range 2 {
+		sessionId, options, err := webAuthnLogic.BeginLogin(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, options.Response.AllowedCredentials)
+
+		signedInAccountId, err := webAuthnLogic.FinishLogin(ctx, sessionId, authenticator.get(t, options))
+		require.NoError(t, err)
+		assert.Equal(t, accountId, signedInAccountId)
+	}
+}
+
+func TestWebAuthnRegistrationExcludesRegisteredPasskeys(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1002)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+
+	sessionId, options, err := webAuthnLogic.BeginRegistration(ctx, accountId, "alice", "Alice")
+	require.NoError(t, err)
+	require.Len(t, options.Response.CredentialExcludeList, 1)
+	assert.Equal(t, authenticator.credentialId, []byte(options.Response.CredentialExcludeList[0].CredentialID))
+
+	// An authenticator ignoring the exclude list cannot register twice
+	err = webAuthnLogic.FinishRegistration(ctx, accountId, sessionId, authenticator.create(t, options))
+	assert.ErrorIs(t, err, webauthn_logic.ErrCredentialAlreadyRegistered)
+}
+
+func TestWebAuthnCeremonyIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1003)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+
+	sessionId, options, err := webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+
+	_, err = webAuthnLogic.FinishLogin(ctx, sessionId, authenticator.get(t, options))
+	require.NoError(t, err)
+
+	_, err = webAuthnLogic.FinishLogin(ctx, sessionId, authenticator.get(t, options))
+	assert.ErrorIs(t, err, webauthn_logic.ErrInvalidCeremony)
+}
+
+func TestWebAuthnCeremonyIsSingleUseUnderConcurrency(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1009)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+
+	sessionId, options, err := webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+	assertion := authenticator.get(t, options)
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		successes int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := webAuthnLogic.FinishLogin(ctx, sessionId, assertion); err == nil {
+				mutex.Lock()
+				successes++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, successes, "a webauthn challenge must not be answered twice")
+}
+
+func TestWebAuthnRegistrationBelongsToItsAccount(t *testing.T) {
+	ctx := context.Background()
+	authenticator := newSoftAuthenticator(t)
+
+	sessionId, options, err := webAuthnLogic.BeginRegistration(ctx, 1004, "alice", "Alice")
+	require.NoError(t, err)
+
+	err = webAuthnLogic.FinishRegistration(ctx, 1005, sessionId, authenticator.create(t, options))
+	assert.ErrorIs(t, err, webauthn_logic.ErrInvalidCeremony)
+}
+
+func TestWebAuthnLoginRejectsUnknownPasskey(t *testing.T) {
+	ctx := context.Background()
+	authenticator := newSoftAuthenticator(t)
+	authenticator.userHandle = []byte{0, 0, 0, 0, 0, 0, 0x03, 0xee}
+
+	sessionId, options, err := webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+
+	_, err = webAuthnLogic.FinishLogin(ctx, sessionId, authenticator.get(t, options))
+	assert.ErrorIs(t, err, webauthn_logic.ErrInvalidCredential)
+}
+
+func TestWebAuthnLoginRejectsWrongOrigin(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1006)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+
+	sessionId, options, err := webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+
+	authenticator.origin = "https://phishing.example"
+	_, err = webAuthnLogic.FinishLogin(ctx, sessionId, authenticator.get(t, options))
+	assert.ErrorIs(t, err, webauthn_logic.ErrInvalidCredential)
+}
+
+func TestWebAuthnLoginRejectsAnotherChallenge(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1007)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+
+	_, firstOptions, err := webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+	secondSessionId, _, err := webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+
+	_, err = webAuthnLogic.FinishLogin(ctx, secondSessionId, authenticator.get(t, firstOptions))
+	assert.ErrorIs(t, err, webauthn_logic.ErrInvalidCredential)
+}
+
+func TestWebAuthnLoginRejectsClonedPasskey(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1008)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+	cloned := authenticator.clone()
+
+	sessionId, options, err := webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+	_, err = webAuthnLogic.FinishLogin(ctx, sessionId, authenticator.get(t, options))
+	require.NoError(t, err)
+
+	// The clone signs with a counter the gateway has already seen
+	sessionId, options, err = webAuthnLogic.BeginLogin(ctx)
+	require.NoError(t, err)
+	_, err = webAuthnLogic.FinishLogin(ctx, sessionId, cloned.get(t, options))
+	assert.ErrorIs(t, err, webauthn_logic.ErrInvalidCredential)
+}
+
+func TestWebAuthnLoginRejectsClonedPasskeyUsedConcurrently(t *testing.T) {
+	ctx := context.Background()
+	accountId := uint64(1010)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, accountId, authenticator)
+	cloned := authenticator.clone()
+
+	// Both copies sign the same counter, only one of them may sign in
+	assertions := make(map[string][]byte)
+	for _, signer := range []*softAuthenticator{authenticator, cloned} {
+		sessionId, options, err := webAuthnLogic.BeginLogin(ctx)
+		require.NoError(t, err)
+		assertions[sessionId] = signer.get(t, options)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		successes int
+	)
+	for sessionId, assertion := range assertions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := webAuthnLogic.FinishLogin(ctx, sessionId, assertion); err == nil {
+				mutex.Lock()
+				successes++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, successes, "a sign counter must not be accepted twice")
+}